@@ -29,12 +29,21 @@ var (
 	// ErrBlobInvalidLength returned when the blob has an expected length on
 	// commit, meaning mismatched with the descriptor or an invalid value.
 	ErrBlobInvalidLength = errors.New("blob invalid length")
+
+	// ErrBlobUploadLimit returned when the repository already has as many
+	// uploads in progress as it is allowed.
+	ErrBlobUploadLimit = errors.New("too many blob uploads in progress")
 )
 
 // ErrBlobInvalidDigest returned when digest check fails.
 type ErrBlobInvalidDigest struct {
 	Digest digest.Digest
 	Reason error
+
+	// Computed is the digest of the content, in the algorithm of Digest,
+	// and Size its length, if the content was hashed.
+	Computed digest.Digest
+	Size     int64
 }
 
 func (err ErrBlobInvalidDigest) Error() string {
@@ -42,6 +51,18 @@ func (err ErrBlobInvalidDigest) Error() string {
 		err.Digest, err.Reason)
 }
 
+// ErrBlobInUse returned when a blob cannot be deleted because manifests in
+// the repository still reference it.
+type ErrBlobInUse struct {
+	Digest    digest.Digest
+	Manifests []digest.Digest
+}
+
+func (err ErrBlobInUse) Error() string {
+	return fmt.Sprintf("blob %v is referenced by manifests: %v",
+		err.Digest, err.Manifests)
+}
+
 // ErrBlobMounted returned when a blob is mounted from another repository
 // instead of initiating an upload session.
 type ErrBlobMounted struct {
@@ -81,6 +81,10 @@ type Configuration struct {
 		// Secret specifies the secret key which HMAC tokens are created with.
 		Secret string `yaml:"secret,omitempty"`
 
+		// PreviousSecrets lists secrets HMAC tokens were created with before
+		// Secret was rotated, which are still accepted when verifying them.
+		PreviousSecrets []string `yaml:"previoussecrets,omitempty"`
+
 		// RelativeURLs specifies that relative URLs should be returned in
 		// Location headers
 		RelativeURLs bool `yaml:"relativeurls,omitempty"`
@@ -154,6 +158,10 @@ type Configuration struct {
 			// to connect via http2. If set to true, only http/1.1 is supported.
 			Disabled bool `yaml:"disabled,omitempty"`
 		} `yaml:"http2,omitempty"`
+
+		// RateLimit limits the rate of requests of each client, if
+		// specified.
+		RateLimit RateLimit `yaml:"ratelimit,omitempty"`
 	} `yaml:"http,omitempty"`
 
 	// Notifications specifies configuration about various endpoint to which
@@ -203,7 +211,26 @@ type Configuration struct {
 			TrustKey string `yaml:"signingkeyfile,omitempty"`
 			// Enabled determines if schema1 manifests should be pullable
 			Enabled bool `yaml:"enabled,omitempty"`
+			// RejectOnPull stops serving the schema1 manifests already in
+			// storage
+			RejectOnPull bool `yaml:"rejectonpull,omitempty"`
+			// ConvertOnPull serves stored schema1 manifests as schema2 to
+			// clients accepting it
+			ConvertOnPull bool `yaml:"convertonpull,omitempty"`
+			// TrustedKeys are files of the public keys whose signatures are
+			// trusted on schema1 manifests. Any signature is trusted if it is
+			// empty.
+			TrustedKeys []string `yaml:"trustedkeyfiles,omitempty"`
 		} `yaml:"schema1,omitempty"`
+		// BlobNotFound configures the response returned when a requested
+		// blob does not exist, for clients that mishandle the default
+		BlobNotFound struct {
+			// Bare returns a 404 without the BLOB_UNKNOWN error body
+			Bare bool `yaml:"bare,omitempty"`
+			// IncludeDigest sets the Docker-Content-Digest header to the
+			// requested digest
+			IncludeDigest bool `yaml:"includedigest,omitempty"`
+		} `yaml:"blobnotfound,omitempty"`
 	} `yaml:"compatibility,omitempty"`
 
 	// Validation configures validation options for the registry.
@@ -223,7 +250,40 @@ type Configuration struct {
 				// Deny specifies regular expressions (https://godoc.org/regexp/syntax)
 				// that URLs in pushed manifests must not match.
 				Deny []string `yaml:"deny,omitempty"`
+				// MediaTypes replaces Allow or Deny for manifests whose
+				// config has the media type of the key, such as the type of
+				// an OCI artifact.
+				MediaTypes map[string]struct {
+					Allow []string `yaml:"allow,omitempty"`
+					Deny  []string `yaml:"deny,omitempty"`
+				} `yaml:"mediatypes,omitempty"`
 			} `yaml:"urls,omitempty"`
+			// ConfigMediaTypes restricts the config media types accepted in
+			// OCI image manifests. Any is accepted if it is empty.
+			ConfigMediaTypes []string `yaml:"configmediatypes,omitempty"`
+			// MaxBytes is the largest manifest payload accepted on push. The
+			// default matches the largest request body accepted by the API.
+			MaxBytes int64 `yaml:"maxbytes,omitempty"`
+			// MaxReferences is the largest number of blobs an image manifest
+			// may reference, counting its config. Zero means unlimited.
+			MaxReferences int `yaml:"maxreferences,omitempty"`
+			// MaxListEntries is the largest number of manifests a manifest
+			// list may reference. Zero means unlimited.
+			MaxListEntries int `yaml:"maxlistentries,omitempty"`
+			// AllowLazyLists accepts manifest lists referencing manifests
+			// which are not pushed yet.
+			AllowLazyLists bool `yaml:"allowlazylists,omitempty"`
+			// Admission configures a webhook asked whether each pushed
+			// manifest may be stored.
+			Admission struct {
+				// URL is the address manifest admission requests are POSTed to
+				URL string `yaml:"url,omitempty"`
+				// Timeout is the duration to wait for the webhook to answer
+				Timeout time.Duration `yaml:"timeout,omitempty"`
+				// FailOpen stores manifests when the webhook fails to answer,
+				// instead of rejecting them
+				FailOpen bool `yaml:"failopen,omitempty"`
+			} `yaml:"admission,omitempty"`
 		} `yaml:"manifests,omitempty"`
 	} `yaml:"validation,omitempty"`
 
@@ -417,8 +477,24 @@ func (storage Storage) Type() string {
 			// allow configuration of caching
 		case "delete":
 			// allow configuration of delete
+		case "tags":
+			// allow configuration of immutable tags
 		case "redirect":
 			// allow configuration of redirect
+		case "pushtimestamps":
+			// allow configuration of push timestamps
+		case "mediatypes":
+			// allow configuration of blob media types
+		case "blobpaths":
+			// allow configuration of blob path sharding
+		case "digest":
+			// allow configuration of the digest algorithm
+		case "uploads":
+			// allow configuration of blob uploads
+		case "quota":
+			// allow configuration of repository quotas
+		case "automount":
+			// allow configuration of blob auto mounting
 		default:
 			storageType = append(storageType, k)
 		}
@@ -458,8 +534,24 @@ func (storage *Storage) UnmarshalYAML(unmarshal func(interface{}) error) error {
 					// allow configuration of caching
 				case "delete":
 					// allow configuration of delete
+				case "tags":
+					// allow configuration of immutable tags
 				case "redirect":
 					// allow configuration of redirect
+				case "pushtimestamps":
+					// allow configuration of push timestamps
+				case "mediatypes":
+					// allow configuration of blob media types
+				case "blobpaths":
+					// allow configuration of blob path sharding
+				case "digest":
+					// allow configuration of the digest algorithm
+				case "uploads":
+					// allow configuration of blob uploads
+				case "quota":
+					// allow configuration of repository quotas
+				case "automount":
+					// allow configuration of blob auto mounting
 				default:
 					types = append(types, k)
 				}
@@ -626,6 +718,29 @@ type Middleware struct {
 	Options Parameters `yaml:"options"`
 }
 
+// RateLimit configures a token bucket for each client, identified by the
+// subject it authenticated as or, for anonymous requests, its IP address.
+// Requests of a client whose bucket is empty are refused.
+type RateLimit struct {
+	// RequestsPerSecond is the rate at which buckets refill. Rate limiting
+	// is disabled unless it is positive.
+	RequestsPerSecond float64 `yaml:"requestspersecond,omitempty"`
+
+	// Burst is the number of tokens a bucket holds, which defaults to
+	// RequestsPerSecond rounded up.
+	Burst int `yaml:"burst,omitempty"`
+
+	// Store is where buckets are kept: "inmemory", the default, or "redis"
+	// to share them between the registries using the redis instance.
+	Store string `yaml:"store,omitempty"`
+
+	// TrustedProxies are the addresses, or CIDR ranges, of the proxies
+	// whose X-Forwarded-For and X-Real-IP headers tell the IP address of
+	// anonymous clients. Requests from other addresses are told by the
+	// address they come from.
+	TrustedProxies []string `yaml:"trustedproxies,omitempty"`
+}
+
 // Proxy configures the registry as a pull through cache
 type Proxy struct {
 	// RemoteURL is the URL of the remote registry
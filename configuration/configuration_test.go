@@ -72,14 +72,15 @@ var configStruct = Configuration{
 		},
 	},
 	HTTP: struct {
-		Addr         string        `yaml:"addr,omitempty"`
-		Net          string        `yaml:"net,omitempty"`
-		Host         string        `yaml:"host,omitempty"`
-		Prefix       string        `yaml:"prefix,omitempty"`
-		Secret       string        `yaml:"secret,omitempty"`
-		RelativeURLs bool          `yaml:"relativeurls,omitempty"`
-		DrainTimeout time.Duration `yaml:"draintimeout,omitempty"`
-		TLS          struct {
+		Addr            string        `yaml:"addr,omitempty"`
+		Net             string        `yaml:"net,omitempty"`
+		Host            string        `yaml:"host,omitempty"`
+		Prefix          string        `yaml:"prefix,omitempty"`
+		Secret          string        `yaml:"secret,omitempty"`
+		PreviousSecrets []string      `yaml:"previoussecrets,omitempty"`
+		RelativeURLs    bool          `yaml:"relativeurls,omitempty"`
+		DrainTimeout    time.Duration `yaml:"draintimeout,omitempty"`
+		TLS             struct {
 			Certificate string   `yaml:"certificate,omitempty"`
 			Key         string   `yaml:"key,omitempty"`
 			ClientCAs   []string `yaml:"clientcas,omitempty"`
@@ -101,6 +102,7 @@ var configStruct = Configuration{
 		HTTP2 struct {
 			Disabled bool `yaml:"disabled,omitempty"`
 		} `yaml:"http2,omitempty"`
+		RateLimit RateLimit `yaml:"ratelimit,omitempty"`
 	}{
 		TLS: struct {
 			Certificate string   `yaml:"certificate,omitempty"`
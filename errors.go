@@ -20,10 +20,18 @@ var ErrManifestNotModified = errors.New("manifest not modified")
 // performed
 var ErrUnsupported = errors.New("operation unsupported")
 
+// ErrDeleteDisabled is returned when content is deleted from a registry
+// which is configured not to allow deletes.
+var ErrDeleteDisabled = errors.New("delete is disabled on this registry")
+
 // ErrSchemaV1Unsupported is returned when a client tries to upload a schema v1
 // manifest but the registry is configured to reject it
 var ErrSchemaV1Unsupported = errors.New("manifest schema v1 unsupported")
 
+// ErrSchemaV1Rejected is returned when a client tries to fetch a schema v1
+// manifest but the registry is configured to no longer serve them
+var ErrSchemaV1Rejected = errors.New("manifest schema v1 is no longer served; re-push the image as a schema2 or OCI manifest")
+
 // ErrTagUnknown is returned if the given tag is not known by the tag service
 type ErrTagUnknown struct {
 	Tag string
@@ -33,6 +41,31 @@ func (err ErrTagUnknown) Error() string {
 	return fmt.Sprintf("unknown tag=%s", err.Tag)
 }
 
+// ErrTagImmutable is returned when moving a tag which must keep referencing
+// the manifest it was first given.
+type ErrTagImmutable struct {
+	Tag    string
+	Digest digest.Digest
+}
+
+func (err ErrTagImmutable) Error() string {
+	if err.Digest == "" {
+		return fmt.Sprintf("tag %s is immutable", err.Tag)
+	}
+	return fmt.Sprintf("tag %s is immutable and references %s", err.Tag, err.Digest)
+}
+
+// ErrLastTagProtected is returned when a delete would leave a repository
+// without tags and the registry protects the last tag of repositories.
+type ErrLastTagProtected struct {
+	Name string
+	Tags []string
+}
+
+func (err ErrLastTagProtected) Error() string {
+	return fmt.Sprintf("deleting %v would leave repository %s without tags", err.Tags, err.Name)
+}
+
 // ErrRepositoryUnknown is returned if the named repository is not known by
 // the registry.
 type ErrRepositoryUnknown struct {
@@ -43,6 +76,16 @@ func (err ErrRepositoryUnknown) Error() string {
 	return fmt.Sprintf("unknown repository name=%s", err.Name)
 }
 
+// ErrRepositoryExists is returned if a repository is to be created under a
+// name which is already taken.
+type ErrRepositoryExists struct {
+	Name string
+}
+
+func (err ErrRepositoryExists) Error() string {
+	return fmt.Sprintf("repository name=%s already exists", err.Name)
+}
+
 // ErrRepositoryNameInvalid should be used to denote an invalid repository
 // name. Reason may set, indicating the cause of invalidity.
 type ErrRepositoryNameInvalid struct {
@@ -107,6 +150,61 @@ func (err ErrManifestBlobUnknown) Error() string {
 	return fmt.Sprintf("unknown blob %v on manifest", err.Digest)
 }
 
+// ErrManifestConfigMediaTypeInvalid returned when the config of a manifest
+// has a media type the registry does not accept.
+type ErrManifestConfigMediaTypeInvalid struct {
+	MediaType string
+}
+
+func (err ErrManifestConfigMediaTypeInvalid) Error() string {
+	return fmt.Sprintf("config media type %q not allowed", err.MediaType)
+}
+
+// ErrManifestTooLarge returned when a manifest payload exceeds the size
+// the registry accepts.
+type ErrManifestTooLarge struct {
+	Size  int64
+	Limit int64
+}
+
+func (err ErrManifestTooLarge) Error() string {
+	return fmt.Sprintf("manifest of %d bytes exceeds the limit of %d bytes", err.Size, err.Limit)
+}
+
+// ErrManifestAdmissionDenied returned when the admission webhook of the
+// registry rejects a manifest.
+type ErrManifestAdmissionDenied struct {
+	Reason string
+}
+
+func (err ErrManifestAdmissionDenied) Error() string {
+	return fmt.Sprintf("manifest denied by admission webhook: %s", err.Reason)
+}
+
+// ErrQuotaExceeded returned when a write would take a repository past the
+// number of bytes it may hold.
+type ErrQuotaExceeded struct {
+	Name  string
+	Usage int64
+	Size  int64
+	Limit int64
+}
+
+func (err ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("repository %s holds %d bytes; adding %d bytes exceeds its quota of %d bytes", err.Name, err.Usage, err.Size, err.Limit)
+}
+
+// ErrManifestTooManyReferences returned when a manifest references more
+// blobs, or a manifest list more manifests, than the registry accepts.
+type ErrManifestTooManyReferences struct {
+	Count int
+	Limit int
+}
+
+func (err ErrManifestTooManyReferences) Error() string {
+	return fmt.Sprintf("manifest has %d references, exceeding the limit of %d", err.Count, err.Limit)
+}
+
 // ErrManifestNameInvalid should be used to denote an invalid manifest
 // name. Reason may set, indicating the cause of invalidity.
 type ErrManifestNameInvalid struct {
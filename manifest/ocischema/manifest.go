@@ -50,6 +50,14 @@ type Manifest struct {
 
 	// Annotations contains arbitrary metadata for the image manifest.
 	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// ArtifactType is the type of the artifact, when the manifest is used
+	// for an artifact rather than an image.
+	ArtifactType string `json:"artifactType,omitempty"`
+
+	// Subject is the manifest this manifest refers to, for example the
+	// image a signature applies to.
+	Subject *distribution.Descriptor `json:"subject,omitempty"`
 }
 
 // References returns the descriptors of this manifests references.
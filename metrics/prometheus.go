@@ -10,4 +10,7 @@ const (
 var (
 	// StorageNamespace is the prometheus namespace of blob/cache related operations
 	StorageNamespace = metrics.NewNamespace(NamespacePrefix, "storage", nil)
+
+	// GCNamespace is the prometheus namespace of garbage collection runs
+	GCNamespace = metrics.NewNamespace(NamespacePrefix, "gc", nil)
 )
@@ -215,6 +215,44 @@ func (b *bridge) createEvent(action string) *Event {
 	return event
 }
 
+// GCBridge writes events for content removed by the garbage collector to a
+// sink. It satisfies storage.GCListener.
+type GCBridge struct {
+	source SourceRecord
+	sink   Sink
+}
+
+// NewGCBridge returns a GCBridge writing events from source to sink.
+func NewGCBridge(source SourceRecord, sink Sink) *GCBridge {
+	return &GCBridge{
+		source: source,
+		sink:   sink,
+	}
+}
+
+// ManifestDeleted writes a gc-delete event for a manifest removed from repo.
+func (b *GCBridge) ManifestDeleted(repo string, desc distribution.Descriptor) error {
+	event := b.createEvent(desc)
+	event.Target.Repository = repo
+
+	return b.sink.Write(*event)
+}
+
+// BlobDeleted writes a gc-delete event for a blob removed from the blob
+// store.
+func (b *GCBridge) BlobDeleted(desc distribution.Descriptor) error {
+	return b.sink.Write(*b.createEvent(desc))
+}
+
+func (b *GCBridge) createEvent(desc distribution.Descriptor) *Event {
+	event := createEvent(EventActionGCDelete)
+	event.Source = b.source
+	event.Target.Descriptor = desc
+	event.Target.Length = desc.Size
+
+	return event
+}
+
 // createEvent returns a new event, timestamped, with the specified action.
 func createEvent(action string) *Event {
 	return &Event{
@@ -263,3 +263,33 @@ func mustUB(ub *v2.URLBuilder, err error) *v2.URLBuilder {
 
 	return ub
 }
+
+func TestGCBridgeManifestDeleted(t *testing.T) {
+	desc := distribution.Descriptor{
+		MediaType: schema1.MediaTypeSignedManifest,
+		Digest:    digest.FromString("manifest"),
+	}
+	b := NewGCBridge(source, testSinkFn(func(events ...Event) error {
+		if len(events) != 1 {
+			t.Fatalf("unexpected number of events: %v != 1", len(events))
+		}
+		event := events[0]
+		if event.Action != EventActionGCDelete {
+			t.Fatalf("unexpected event action: %q != %q", event.Action, EventActionGCDelete)
+		}
+		if event.Source != source {
+			t.Fatalf("source not equal: %#v != %#v", event.Source, source)
+		}
+		if event.Target.Repository != repo {
+			t.Fatalf("unexpected repository: %q != %q", event.Target.Repository, repo)
+		}
+		if event.Target.Digest != desc.Digest || event.Target.MediaType != schema1.MediaTypeSignedManifest {
+			t.Fatalf("unexpected target: %#v", event.Target)
+		}
+		return nil
+	}))
+
+	if err := b.ManifestDeleted(repo, desc); err != nil {
+		t.Fatalf("unexpected error notifying manifest deletion: %v", err)
+	}
+}
@@ -13,6 +13,9 @@ const (
 	EventActionPush   = "push"
 	EventActionMount  = "mount"
 	EventActionDelete = "delete"
+
+	// EventActionGCDelete marks content removed by the garbage collector.
+	EventActionGCDelete = "gc-delete"
 )
 
 const (
@@ -2,6 +2,7 @@ package distribution
 
 import (
 	"context"
+	"time"
 
 	"github.com/docker/distribution/reference"
 )
@@ -59,6 +60,27 @@ type RepositoryRemover interface {
 	Remove(ctx context.Context, name reference.Named) error
 }
 
+// RepositoryPrefixLister lists the repositories whose names start with a
+// prefix, without enumerating the rest of the catalog. It otherwise behaves
+// like Namespace.Repositories.
+type RepositoryPrefixLister interface {
+	RepositoriesWithPrefix(ctx context.Context, repos []string, prefix, last string) (n int, err error)
+}
+
+// RepositoryPushTimeReader retrieves the time of the most recent manifest push
+// to a repository. A zero time is returned if the time is not known.
+type RepositoryPushTimeReader interface {
+	LastPushed(ctx context.Context, name reference.Named) (time.Time, error)
+}
+
+// RepositoryModTimeScanner determines when a repository was last modified
+// from the modification times, as reported by the storage backend, of the
+// links of its tags and manifests. At most limit links are examined, zero
+// meaning all of them. A zero time is returned for a repository without any.
+type RepositoryModTimeScanner interface {
+	ScanLastModified(ctx context.Context, name reference.Named, limit int) (time.Time, error)
+}
+
 // ManifestServiceOption is a function argument for Manifest Service methods
 type ManifestServiceOption interface {
 	Apply(ManifestService) error
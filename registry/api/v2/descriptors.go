@@ -26,6 +26,14 @@ var (
 		Description: `Tag or digest of the target manifest.`,
 	}
 
+	tagParameterDescriptor = ParameterDescriptor{
+		Name:        "tag",
+		Type:        "string",
+		Format:      reference.TagRegexp.String(),
+		Required:    true,
+		Description: `Name of the target tag.`,
+	}
+
 	uuidParameterDescriptor = ParameterDescriptor{
 		Name:        "uuid",
 		Type:        "opaque",
@@ -196,6 +204,47 @@ var (
 			errcode.ErrorCodeTooManyRequests,
 		},
 	}
+
+	quotaExceededDescriptor = ResponseDescriptor{
+		Name:        "Quota Exceeded",
+		StatusCode:  http.StatusRequestEntityTooLarge,
+		Description: "The write would take the repository past the number of bytes the registry allows it to hold.",
+		Headers: []ParameterDescriptor{
+			{
+				Name:        "Content-Length",
+				Type:        "integer",
+				Description: "Length of the JSON response body.",
+				Format:      "<length>",
+			},
+		},
+		Body: BodyDescriptor{
+			ContentType: "application/json; charset=utf-8",
+			Format:      errorsBody,
+		},
+		ErrorCodes: []errcode.ErrorCode{
+			ErrorCodeQuotaExceeded,
+		},
+	}
+
+	forceDeleteParameterDescriptor = ParameterDescriptor{
+		Name:        "force",
+		Type:        "boolean",
+		Format:      "true",
+		Description: "Delete even if the repository would be left without tags.",
+	}
+
+	lastTagProtectedDescriptor = ResponseDescriptor{
+		Name:        "Last Tag Protected",
+		StatusCode:  http.StatusConflict,
+		Description: "The delete would leave the repository without tags and the registry protects the last tag of repositories. The delete may be forced with `force=true`.",
+		Body: BodyDescriptor{
+			ContentType: "application/json; charset=utf-8",
+			Format:      errorsBody,
+		},
+		ErrorCodes: []errcode.ErrorCode{
+			ErrorCodeLastTagProtected,
+		},
+	}
 )
 
 const (
@@ -223,6 +272,17 @@ const (
         ...
     ]
 }`
+
+	bulkDeleteBody = `{
+    "results": [
+        {
+            "digest": "<digest>",
+            "status": "<status>",
+            "error": "<error message>"
+        },
+        ...
+    ]
+}`
 )
 
 // APIDescriptor exports descriptions of the layout of the v2 registry API.
@@ -485,6 +545,53 @@ var routeDescriptors = []RouteDescriptor{
         <tag>,
         ...
     ],
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+					{
+						Name:           "Tags Detail",
+						Description:    "Return all tags for the repository with the digest each tag points to and the time it was last updated.",
+						PathParameters: []ParameterDescriptor{nameParameterDescriptor},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "detail",
+								Type:        "boolean",
+								Format:      "true",
+								Description: "Return tag metadata instead of tag names.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode:  http.StatusOK,
+								Description: "A list of tags with their metadata, sorted by tag name.",
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "name": <name>,
+    "tags": [
+        {
+            "name": <tag>,
+            "digest": <digest>,
+            "modified": <RFC3339 timestamp>
+        },
+        ...
+    ]
 }`,
 								},
 							},
@@ -501,14 +608,14 @@ var routeDescriptors = []RouteDescriptor{
 		},
 	},
 	{
-		Name:        RouteNameManifest,
-		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
-		Entity:      "Manifest",
-		Description: "Create, update, delete and retrieve manifests.",
+		Name:        RouteNameTag,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/tags/{tag:" + reference.TagRegexp.String() + "}",
+		Entity:      "Tag",
+		Description: "Delete individual tags.",
 		Methods: []MethodDescriptor{
 			{
-				Method:      "GET",
-				Description: "Fetch the manifest identified by `name` and `reference` where `reference` can be a tag or digest. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
+				Method:      "DELETE",
+				Description: "Delete the tag identified by `name` and `tag`. Only the tag is removed; the manifest it points to and any other tags referring to that manifest are left in place.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -517,28 +624,101 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							referenceParameterDescriptor,
+							tagParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							forceDeleteParameterDescriptor,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The manifest identified by `name` and `reference`. The contents can be used to identify and resolve resources required to run the specified image.",
+								StatusCode: http.StatusAccepted,
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+							lastTagProtectedDescriptor,
+							{
+								Name:        "Unknown Tag",
+								Description: "The specified `tag` is unknown to the registry. Clients can assume the tag was already deleted if this response is returned.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Tag delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameManifestsBulkDelete,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/_bulkDelete",
+		Entity:      "Manifests Bulk Delete",
+		Description: "Delete several manifests at once.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Delete each manifest in the repository identified by `name` whose digest is listed in the request body, removing the tags that reference it. Deletions are processed concurrently and do not stop at the first failure. Requires `delete` access to the repository.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "application/json",
+							Format:      `["<digest>", ...]`,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "Every listed manifest was deleted.",
 								StatusCode:  http.StatusOK,
-								Headers: []ParameterDescriptor{
-									digestHeader,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      bulkDeleteBody,
 								},
+							},
+							{
+								Description: "Some listed manifests were not deleted. The `status` of each result is one of `deleted`, `not_found`, `invalid` or `error`.",
+								StatusCode:  http.StatusMultiStatus,
 								Body: BodyDescriptor{
-									ContentType: "<media type of manifest>",
-									Format:      manifestBody,
+									ContentType: "application/json; charset=utf-8",
+									Format:      bulkDeleteBody,
 								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Description: "The name or reference was invalid.",
+								Name:        "Invalid Request",
+								Description: "The request body is not a JSON array of digests or lists too many of them.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
 									ErrorCodeNameInvalid,
-									ErrorCodeTagInvalid,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
@@ -549,13 +729,33 @@ var routeDescriptors = []RouteDescriptor{
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
 							tooManyRequestsDescriptor,
+							{
+								Name:        "Not allowed",
+								Description: "Manifest delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
 						},
 					},
 				},
 			},
+		},
+	},
+	{
+		Name:        RouteNameManifestRestore,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{digest:" + digest.DigestRegexp.String() + "}/_restore",
+		Entity:      "Manifest Restore",
+		Description: "Restore soft deleted manifests.",
+		Methods: []MethodDescriptor{
 			{
-				Method:      "PUT",
-				Description: "Put the manifest identified by `name` and `reference` where `reference` can be a tag or digest.",
+				Method:      "POST",
+				Description: "Restore the manifest identified by `name` and `digest`, deleted while the registry keeps deleted manifests for a restore window. The tags that referenced the manifest when it was deleted are restored unless they have since been pushed again.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -564,21 +764,17 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
-							referenceParameterDescriptor,
-						},
-						Body: BodyDescriptor{
-							ContentType: "<media type of manifest>",
-							Format:      manifestBody,
+							digestPathParameter,
 						},
 						Successes: []ResponseDescriptor{
 							{
-								Description: "The manifest has been accepted by the registry and is stored under the specified `name` and `tag`.",
+								Description: "The manifest has been restored.",
 								StatusCode:  http.StatusCreated,
 								Headers: []ParameterDescriptor{
 									{
 										Name:        "Location",
 										Type:        "url",
-										Description: "The canonical location url of the uploaded manifest.",
+										Description: "The canonical location url of the restored manifest.",
 										Format:      "<url>",
 									},
 									contentLengthZeroHeader,
@@ -588,62 +784,62 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Name:        "Invalid Manifest",
-								Description: "The received manifest was invalid in some way, as described by the error codes. The client should resolve the issue and retry the request.",
+								Name:        "Invalid Digest",
+								Description: "The `digest` was invalid.",
 								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+									ErrorCodeNameInvalid,
+								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
 									Format:      errorsBody,
 								},
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameInvalid,
-									ErrorCodeTagInvalid,
-									ErrorCodeManifestInvalid,
-									ErrorCodeManifestUnverified,
-									ErrorCodeBlobUnknown,
-								},
 							},
 							unauthorizedResponseDescriptor,
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
 							tooManyRequestsDescriptor,
 							{
-								Name:        "Missing Layer(s)",
-								Description: "One or more layers may be missing during a manifest upload. If so, the missing layers will be enumerated in the error response.",
-								StatusCode:  http.StatusBadRequest,
+								Name:        "Unknown Manifest",
+								Description: "The manifest was not deleted, or its restore window has passed.",
+								StatusCode:  http.StatusNotFound,
 								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeBlobUnknown,
+									ErrorCodeNameUnknown,
+									ErrorCodeManifestUnknown,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
-									Format: `{
-    "errors:" [{
-            "code": "BLOB_UNKNOWN",
-            "message": "blob unknown to registry",
-            "detail": {
-                "digest": "<digest>"
-            }
-        },
-        ...
-    ]
-}`,
+									Format:      errorsBody,
 								},
 							},
 							{
 								Name:        "Not allowed",
-								Description: "Manifest put is not allowed because the registry is configured as a pull-through cache or for some other reason",
+								Description: "Manifest restore is not allowed because the registry is configured as a pull-through cache, `delete` has been disabled or deleted manifests are not kept.",
 								StatusCode:  http.StatusMethodNotAllowed,
 								ErrorCodes: []errcode.ErrorCode{
 									errcode.ErrorCodeUnsupported,
 								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
 							},
 						},
 					},
 				},
 			},
+		},
+	},
+	{
+		Name:        RouteNameManifest,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/manifests/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+		Entity:      "Manifest",
+		Description: "Create, update, delete and retrieve manifests.",
+		Methods: []MethodDescriptor{
 			{
-				Method:      "DELETE",
-				Description: "Delete the manifest identified by `name` and `reference`. Note that a manifest can _only_ be deleted by `digest`.",
+				Method:      "GET",
+				Description: "Fetch the manifest identified by `name` and `reference` where `reference` can be a tag or digest. A `HEAD` request can also be issued to this endpoint to obtain resource information without receiving all data.",
 				Requests: []RequestDescriptor{
 					{
 						Headers: []ParameterDescriptor{
@@ -656,17 +852,665 @@ var routeDescriptors = []RouteDescriptor{
 						},
 						Successes: []ResponseDescriptor{
 							{
-								StatusCode: http.StatusAccepted,
+								Description: "The manifest identified by `name` and `reference`. The contents can be used to identify and resolve resources required to run the specified image.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "<media type of manifest>",
+									Format:      manifestBody,
+								},
 							},
 						},
 						Failures: []ResponseDescriptor{
 							{
-								Name:        "Invalid Name or Reference",
-								Description: "The specified `name` or `reference` were invalid and the delete was unable to proceed.",
+								Description: "The name or reference was invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodeDigestInvalid,
+									ErrorCodeDigestUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+			{
+				Method:      "PUT",
+				Description: "Put the manifest identified by `name` and `reference` where `reference` can be a tag or digest.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Body: BodyDescriptor{
+							ContentType: "<media type of manifest>",
+							Format:      manifestBody,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The manifest has been accepted by the registry and is stored under the specified `name` and `tag`.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Description: "The canonical location url of the uploaded manifest.",
+										Format:      "<url>",
+									},
+									contentLengthZeroHeader,
+									digestHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Manifest",
+								Description: "The received manifest was invalid in some way, as described by the error codes. The client should resolve the issue and retry the request.",
+								StatusCode:  http.StatusBadRequest,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodeManifestInvalid,
+									ErrorCodeManifestUnverified,
+									ErrorCodeBlobUnknown,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+							quotaExceededDescriptor,
+							{
+								Name:        "Missing Layer(s)",
+								Description: "One or more layers may be missing during a manifest upload. If so, the missing layers will be enumerated in the error response.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "errors:" [{
+            "code": "BLOB_UNKNOWN",
+            "message": "blob unknown to registry",
+            "detail": {
+                "digest": "<digest>"
+            }
+        },
+        ...
+    ]
+}`,
+								},
+							},
+							{
+								Name:        "Immutable Tag",
+								Description: "The tag is immutable and already references another manifest, so the manifest was stored but not tagged.",
+								StatusCode:  http.StatusConflict,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeTagImmutable,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Manifest put is not allowed because the registry is configured as a pull-through cache or for some other reason",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+						},
+					},
+				},
+			},
+			{
+				Method:      "DELETE",
+				Description: "Delete the manifest identified by `name` and `reference`. Note that a manifest can _only_ be deleted by `digest`.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							forceDeleteParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusAccepted,
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Name:        "Invalid Name or Reference",
+								Description: "The specified `name` or `reference` were invalid and the delete was unable to proceed.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+							lastTagProtectedDescriptor,
+							{
+								Name:        "Unknown Manifest",
+								Description: "The specified `name` or `reference` are unknown to the registry and the delete was unable to proceed. Clients can assume the manifest was already deleted if this response is returned.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameUnknown,
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Name:        "Not allowed",
+								Description: "Manifest delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+
+	{
+		Name:        RouteNameDiffIDs,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_diffids/{reference:" + reference.TagRegexp.String() + "|" + digest.DigestRegexp.String() + "}",
+		Entity:      "DiffIDs",
+		Description: "Map the uncompressed layer digests (diffIDs) of an image configuration back to the stored layer blobs.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the layers of the image manifest identified by `name` and `reference`, in order, paired with the diffIDs listed in the `rootfs` of its configuration. Only image manifests with a configuration are supported.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							referenceParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The layer mapping of the manifest.",
+								StatusCode:  http.StatusOK,
+								Headers: []ParameterDescriptor{
+									digestHeader,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "name": <name>,
+    "digest": <manifest digest>,
+    "layers": [
+        {
+            "digest": <layer digest>,
+            "diffID": <uncompressed layer digest>
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The name or reference was invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+									ErrorCodeTagInvalid,
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The manifest is unknown to the registry.",
+								StatusCode:  http.StatusNotFound,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeManifestUnknown,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "The manifest does not reference an image configuration.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameUsage,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_usage",
+		Entity:      "Usage",
+		Description: "Report the storage consumed by the content linked into a repository.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the total size and count of the blobs and manifests linked into the repository identified by `name`. Each digest is counted once; blobs shared with other repositories are counted in full.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The storage usage of the repository.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "blob_bytes": <bytes>,
+    "manifest_bytes": <bytes>,
+    "blob_count": <count>,
+    "manifest_count": <count>
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The name was invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameSummary,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_summary",
+		Entity:      "Summary",
+		Description: "Summarize the content the tags of a repository refer to with a single digest.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch the tags of the repository identified by `name`, sorted by name, with the digest of the manifest each refers to and the sorted digests that manifest references, including those of the manifests of an index. `digest` is that of the JSON encoding of `tags`, so it stays the same as long as the content of the tags does not change.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The summary of the repository.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+    "digest": <digest>,
+    "tags": [
+        {
+            "tag": <tag>,
+            "manifest": <digest>,
+            "references": [<digest>, ...]
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The name was invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameVerify,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_verify",
+		Entity:      "Verify",
+		Description: "Verify that the content of the blobs linked into a repository still matches their digests.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Read back each blob linked into the repository identified by `name`, recompute its digest and stream a JSON object, one per line, for every blob that does not match. An empty body means no mismatches were found.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "sample",
+								Type:        "float",
+								Description: "Verify only this fraction of the blobs, chosen at random. Values outside (0, 1] verify every blob.",
+								Format:      "<fraction>",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blobs whose content does not match their digest. `actual` is omitted, and `error` set, when the content could not be read.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/x-ndjson",
+									Format: `{"digest": <digest>, "actual": <digest>, "size": <bytes>, "error": <message>}
+...`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The name was invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameOrphans,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_orphans",
+		Entity:      "Orphans",
+		Description: "List the blobs linked into a repository which none of its manifests reference.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Mark the blobs referenced by the manifests of the repository identified by `name`, as garbage collection does, and stream a JSON object, one per line, for every linked blob left unmarked. Nothing is deleted, so the request is served in read-only mode too. An empty body means every linked blob is referenced.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The blobs no manifest of the repository references.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/x-ndjson",
+									Format: `{"digest": <digest>}
+...`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The name was invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameRepositoryMove,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_move",
+		Entity:      "Repository Move",
+		Description: "Rename a repository without pulling and pushing its content.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "POST",
+				Description: "Move the manifests, tags and blob links of the repository identified by `name` to the repository named by the `to` parameter, which must not exist yet. Requires delete to be enabled, and push access to both repositories. Pushes to the repository should be stopped while it is moved.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "to",
+								Type:        "string",
+								Format:      "<name>",
+								Required:    true,
+								Description: "The name the repository is moved to.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The repository was moved. The location of its tags is returned.",
+								StatusCode:  http.StatusCreated,
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Location",
+										Type:        "url",
+										Format:      "<url>",
+										Description: "The tags list of the moved repository.",
+									},
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The name of either repository was invalid, or the repository holds others nested under its name.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "Content is already stored under the destination name.",
+								StatusCode:  http.StatusConflict,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeNameExists,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							{
+								Description: "Moving repositories is not supported, because delete is not enabled or the registry is a pull through cache.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							repositoryNotFoundResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameReferrers,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/referrers/{digest:" + digest.DigestRegexp.String() + "}",
+		Entity:      "Referrers",
+		Description: "List the manifests that declare a given manifest as their `subject`, such as signatures and attestations.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Fetch an image index of the manifests in the repository identified by `name` whose subject is `digest`. The subject itself need not exist.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+							digestPathParameter,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "artifactType",
+								Type:        "string",
+								Description: "Only return referrers of this artifact type. The `OCI-Filters-Applied` header is set when the filter was applied.",
+								Format:      "<media type>",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The referrers of the digest. The list is empty if there are none.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/vnd.oci.image.index.v1+json",
+									Format: `{
+    "schemaVersion": 2,
+    "mediaType": "application/vnd.oci.image.index.v1+json",
+    "manifests": [
+        {
+            "mediaType": <manifest media type>,
+            "size": <size>,
+            "digest": <manifest digest>,
+            "artifactType": <artifact type>,
+            "annotations": <annotations>
+        },
+        ...
+    ]
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The name or digest was invalid.",
 								StatusCode:  http.StatusBadRequest,
 								ErrorCodes: []errcode.ErrorCode{
 									ErrorCodeNameInvalid,
-									ErrorCodeTagInvalid,
+									ErrorCodeDigestInvalid,
 								},
 								Body: BodyDescriptor{
 									ContentType: "application/json; charset=utf-8",
@@ -677,34 +1521,12 @@ var routeDescriptors = []RouteDescriptor{
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
 							tooManyRequestsDescriptor,
-							{
-								Name:        "Unknown Manifest",
-								Description: "The specified `name` or `reference` are unknown to the registry and the delete was unable to proceed. Clients can assume the manifest was already deleted if this response is returned.",
-								StatusCode:  http.StatusNotFound,
-								ErrorCodes: []errcode.ErrorCode{
-									ErrorCodeNameUnknown,
-									ErrorCodeManifestUnknown,
-								},
-								Body: BodyDescriptor{
-									ContentType: "application/json; charset=utf-8",
-									Format:      errorsBody,
-								},
-							},
-							{
-								Name:        "Not allowed",
-								Description: "Manifest delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled.",
-								StatusCode:  http.StatusMethodNotAllowed,
-								ErrorCodes: []errcode.ErrorCode{
-									errcode.ErrorCodeUnsupported,
-								},
-							},
 						},
 					},
 				},
 			},
 		},
 	},
-
 	{
 		Name:        RouteNameBlob,
 		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/blobs/{digest:" + digest.DigestRegexp.String() + "}",
@@ -720,6 +1542,12 @@ var routeDescriptors = []RouteDescriptor{
 						Headers: []ParameterDescriptor{
 							hostHeader,
 							authHeader,
+							{
+								Name:        "Accept-Digest",
+								Type:        "string",
+								Description: "Algorithms, such as `sha512`, in which the `Docker-Content-Digest` of a blob served directly is preferred, weighted with optional `q` values. If none of them is the algorithm the blob is stored under, the digest is computed with the preferred one. The stored digest is returned if the blob is redirected to or its digest can't be computed.",
+								Format:      "<algorithm>[;q=<weight>], ...",
+							},
 						},
 						PathParameters: []ParameterDescriptor{
 							nameParameterDescriptor,
@@ -913,6 +1741,17 @@ var routeDescriptors = []RouteDescriptor{
 									ErrorCodeBlobUnknown,
 								},
 							},
+							{
+								Description: "The blob is still referenced by manifests in the repository and the registry checks references before deletion. The error detail lists the referencing manifests.",
+								StatusCode:  http.StatusConflict,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeBlobInUse,
+								},
+							},
 							{
 								Description: "Blob delete is not allowed because the registry is configured as a pull-through cache or `delete` has been disabled",
 								StatusCode:  http.StatusMethodNotAllowed,
@@ -1352,7 +2191,7 @@ var routeDescriptors = []RouteDescriptor{
 								},
 							},
 							{
-								Description: "The `Content-Range` specification cannot be accepted, either because it does not overlap with the current progress or it is invalid.",
+								Description: "The `Content-Range` specification cannot be accepted, either because it does not start where the uploaded content ends, does not match the length of the chunk, or is invalid. The `Range` and `Location` headers give the progress of the upload, as for an accepted chunk.",
 								StatusCode:  http.StatusRequestedRangeNotSatisfiable,
 							},
 							unauthorizedResponseDescriptor,
@@ -1450,6 +2289,7 @@ var routeDescriptors = []RouteDescriptor{
 							repositoryNotFoundResponseDescriptor,
 							deniedResponseDescriptor,
 							tooManyRequestsDescriptor,
+							quotaExceededDescriptor,
 						},
 					},
 				},
@@ -1579,6 +2419,283 @@ var routeDescriptors = []RouteDescriptor{
 							},
 						},
 					},
+					{
+						Name:        "Catalog Fetch By Prefix",
+						Description: "Return the repositories whose names start with a prefix, such as the namespace of a team. It can be combined with pagination, in which case the `Link` header keeps the prefix.",
+						QueryParameters: append([]ParameterDescriptor{
+							{
+								Name:        "prefix",
+								Type:        "string",
+								Description: "Only return repositories whose names start with prefix.",
+								Format:      "<prefix>",
+							},
+						}, paginationParameters...),
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+	"repositories": [
+		<name>,
+		...
+	]
+}`,
+								},
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+									linkHeader,
+								},
+							},
+						},
+					},
+					{
+						Name:        "Catalog Fetch With Details",
+						Description: "Return the repositories along with their metadata. The time of the most recent manifest push is the one recorded by the registry if it records push timestamps. Otherwise it is estimated from the modification times of the tag and manifest links of the repository, which are cached briefly.",
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "detail",
+								Type:        "boolean",
+								Description: "If set to `true`, include a `details` entry for each returned repository.",
+								Format:      "true",
+							},
+							{
+								Name:        "limit",
+								Type:        "integer",
+								Description: "The number of tag and manifest links examined per repository to estimate its most recent push. It defaults to 100.",
+								Format:      "<integer>",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								StatusCode: http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+	"repositories": [
+		<name>,
+		...
+	],
+	"details": [
+		{
+			"name": <name>,
+			"lastPushed": <RFC3339 time>
+		},
+		...
+	]
+}`,
+								},
+								Headers: []ParameterDescriptor{
+									{
+										Name:        "Content-Length",
+										Type:        "integer",
+										Description: "Length of the JSON response body.",
+										Format:      "<length>",
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameDedupStats,
+		Path:        "/v2/_dedup-stats",
+		Entity:      "DedupStats",
+		Description: "Report how much storage is saved by sharing blobs between repositories.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Walk the blobs linked into every repository and compare their total size, counted once per link, with the size of the distinct blobs stored. Requires the same access as the catalog.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The deduplication statistics of the registry.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+	"repositories": <count>,
+	"links": <count>,
+	"blobs": <count>,
+	"logical_bytes": <bytes>,
+	"physical_bytes": <bytes>
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameRepositoryCache,
+		Path:        "/v2/{name:" + reference.NameRegexp.String() + "}/_cache",
+		Entity:      "Repository Cache",
+		Description: "Invalidate the blob descriptors cached for a repository.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "DELETE",
+				Description: "Drop the blob descriptors cached for the repository identified by `name`, so that they are read from storage again. Descriptors cached for the registry as a whole are kept, so use the registry cache route after blobs themselves changed in storage. Requires delete access to the repository and the `delete` action on the `registry:cache` resource.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						PathParameters: []ParameterDescriptor{
+							nameParameterDescriptor,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The cached descriptors of the repository were dropped.",
+								StatusCode:  http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The registry does not cache blob descriptors.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameCache,
+		Path:        "/v2/_cache",
+		Entity:      "Cache",
+		Description: "Invalidate all cached blob descriptors.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "DELETE",
+				Description: "Drop every cached blob descriptor, as well as the blobs remembered as unknown, for instance after blobs were deleted or restored in storage by hand. Requires the `delete` action on the `registry:cache` resource.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The cached descriptors were dropped.",
+								StatusCode:  http.StatusAccepted,
+								Headers: []ParameterDescriptor{
+									contentLengthZeroHeader,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The registry does not cache blob descriptors.",
+								StatusCode:  http.StatusMethodNotAllowed,
+								ErrorCodes: []errcode.ErrorCode{
+									errcode.ErrorCodeUnsupported,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		Name:        RouteNameWhereIs,
+		Path:        "/v2/_whereis",
+		Entity:      "WhereIs",
+		Description: "Find the tags referencing a manifest or blob in any repository.",
+		Methods: []MethodDescriptor{
+			{
+				Method:      "GET",
+				Description: "Walk the tags of every repository and list those pointing at `digest`, or whose manifest, or a manifest of whose index, references it. Use it to find what depends on content before deleting it. Requires the same access as the catalog.",
+				Requests: []RequestDescriptor{
+					{
+						Headers: []ParameterDescriptor{
+							hostHeader,
+							authHeader,
+						},
+						QueryParameters: []ParameterDescriptor{
+							{
+								Name:        "digest",
+								Type:        "string",
+								Format:      "<digest>",
+								Required:    true,
+								Description: "Digest of the manifest or blob to find the tags of.",
+							},
+						},
+						Successes: []ResponseDescriptor{
+							{
+								Description: "The tags referencing the digest, by repository. Repositories without such tags are left out.",
+								StatusCode:  http.StatusOK,
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format: `{
+	"digest": <digest>,
+	"repositories": {
+		<name>: [<tag>, ...],
+		...
+	}
+}`,
+								},
+							},
+						},
+						Failures: []ResponseDescriptor{
+							{
+								Description: "The digest was missing or invalid.",
+								StatusCode:  http.StatusBadRequest,
+								ErrorCodes: []errcode.ErrorCode{
+									ErrorCodeDigestInvalid,
+								},
+								Body: BodyDescriptor{
+									ContentType: "application/json; charset=utf-8",
+									Format:      errorsBody,
+								},
+							},
+							unauthorizedResponseDescriptor,
+							deniedResponseDescriptor,
+							tooManyRequestsDescriptor,
+						},
+					},
 				},
 			},
 		},
@@ -22,6 +22,16 @@ var (
 		HTTPStatusCode: http.StatusBadRequest,
 	})
 
+	// ErrorCodeDigestUnsupported is returned when a digest uses an
+	// algorithm the registry does not support.
+	ErrorCodeDigestUnsupported = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "DIGEST_UNSUPPORTED",
+		Message: "digest algorithm is not supported",
+		Description: `This error is returned when a manifest is requested by
+		a digest using an algorithm the registry does not support.`,
+		HTTPStatusCode: http.StatusBadRequest,
+	})
+
 	// ErrorCodeSizeInvalid is returned when uploading a blob if the provided
 	ErrorCodeSizeInvalid = errcode.Register(errGroup, errcode.ErrorDescriptor{
 		Value:   "SIZE_INVALID",
@@ -52,6 +62,17 @@ var (
 		HTTPStatusCode: http.StatusBadRequest,
 	})
 
+	// ErrorCodeTagImmutable is returned when a manifest is pushed to an
+	// immutable tag which references another manifest.
+	ErrorCodeTagImmutable = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "TAG_IMMUTABLE",
+		Message: "tag is immutable",
+		Description: `This error may be returned when a manifest is pushed
+		to a tag which already references another manifest, if the registry
+		is configured to keep such tags immutable.`,
+		HTTPStatusCode: http.StatusConflict,
+	})
+
 	// ErrorCodeNameUnknown when the repository name is not known.
 	ErrorCodeNameUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
 		Value:   "NAME_UNKNOWN",
@@ -61,6 +82,15 @@ var (
 		HTTPStatusCode: http.StatusNotFound,
 	})
 
+	// ErrorCodeNameExists when the repository name is already taken.
+	ErrorCodeNameExists = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "NAME_EXISTS",
+		Message: "repository name already exists",
+		Description: `This is returned if a repository is moved to a name
+		under which content is already stored.`,
+		HTTPStatusCode: http.StatusConflict,
+	})
+
 	// ErrorCodeManifestUnknown returned when image manifest is unknown.
 	ErrorCodeManifestUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
 		Value:   "MANIFEST_UNKNOWN",
@@ -116,6 +146,43 @@ var (
 		HTTPStatusCode: http.StatusNotFound,
 	})
 
+	// ErrorCodeBlobInUse is returned when deleting a blob that is still
+	// referenced by manifests in the repository.
+	ErrorCodeBlobInUse = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "BLOB_IN_USE",
+		Message: "blob is referenced by a manifest",
+		Description: `This error may be returned when deleting a blob that
+		is still referenced by a manifest in the repository, if the registry
+		checks references before deletion. The detail lists the referencing
+		manifests.`,
+		HTTPStatusCode: http.StatusConflict,
+	})
+
+	// ErrorCodeLastTagProtected is returned when a delete would leave a
+	// repository without tags.
+	ErrorCodeLastTagProtected = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "LAST_TAG_PROTECTED",
+		Message: "last tag of the repository is protected",
+		Description: `This error may be returned when deleting a tag, or a
+		manifest by digest, would leave the repository without tags, if the
+		registry protects the last tag of repositories. The delete may be
+		forced with the force query parameter. The detail lists the tags
+		which would be removed.`,
+		HTTPStatusCode: http.StatusConflict,
+	})
+
+	// ErrorCodeQuotaExceeded is returned when a push would take a
+	// repository past the number of bytes it may hold.
+	ErrorCodeQuotaExceeded = errcode.Register(errGroup, errcode.ErrorDescriptor{
+		Value:   "QUOTA_EXCEEDED",
+		Message: "repository quota exceeded",
+		Description: `This error may be returned when completing a blob
+		upload or putting a manifest into a repository which holds, or would
+		hold with the blob, more bytes than the registry allows. The detail
+		describes the usage and limit of the repository.`,
+		HTTPStatusCode: http.StatusRequestEntityTooLarge,
+	})
+
 	// ErrorCodeBlobUploadUnknown is returned when an upload is unknown.
 	ErrorCodeBlobUploadUnknown = errcode.Register(errGroup, errcode.ErrorDescriptor{
 		Value:   "BLOB_UPLOAD_UNKNOWN",
@@ -5,13 +5,27 @@ import "github.com/gorilla/mux"
 // The following are definitions of the name under which all V2 routes are
 // registered. These symbols can be used to look up a route based on the name.
 const (
-	RouteNameBase            = "base"
-	RouteNameManifest        = "manifest"
-	RouteNameTags            = "tags"
-	RouteNameBlob            = "blob"
-	RouteNameBlobUpload      = "blob-upload"
-	RouteNameBlobUploadChunk = "blob-upload-chunk"
-	RouteNameCatalog         = "catalog"
+	RouteNameBase                = "base"
+	RouteNameManifest            = "manifest"
+	RouteNameManifestsBulkDelete = "manifests-bulk-delete"
+	RouteNameManifestRestore     = "manifest-restore"
+	RouteNameTags                = "tags"
+	RouteNameTag                 = "tag"
+	RouteNameBlob                = "blob"
+	RouteNameBlobUpload          = "blob-upload"
+	RouteNameBlobUploadChunk     = "blob-upload-chunk"
+	RouteNameCatalog             = "catalog"
+	RouteNameDiffIDs             = "diffids"
+	RouteNameUsage               = "usage"
+	RouteNameSummary             = "summary"
+	RouteNameVerify              = "verify"
+	RouteNameOrphans             = "orphans"
+	RouteNameRepositoryMove      = "repository-move"
+	RouteNameDedupStats          = "dedup-stats"
+	RouteNameReferrers           = "referrers"
+	RouteNameRepositoryCache     = "repository-cache"
+	RouteNameCache               = "cache"
+	RouteNameWhereIs             = "whereis"
 )
 
 // Router builds a gorilla router with named routes for the various API
@@ -59,6 +59,94 @@ func TestRouter(t *testing.T) {
 				"reference": "sha256:abcdef01234567890",
 			},
 		},
+		{
+			RouteName:  RouteNameDiffIDs,
+			RequestURI: "/v2/foo/bar/_diffids/tag",
+			Vars: map[string]string{
+				"name":      "foo/bar",
+				"reference": "tag",
+			},
+		},
+		{
+			RouteName:  RouteNameReferrers,
+			RequestURI: "/v2/foo/bar/referrers/sha256:abcdef0123456789",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0123456789",
+			},
+		},
+		{
+			RouteName:  RouteNameDedupStats,
+			RequestURI: "/v2/_dedup-stats",
+			Vars:       map[string]string{},
+		},
+		{
+			RouteName:  RouteNameUsage,
+			RequestURI: "/v2/foo/bar/_usage",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameManifestRestore,
+			RequestURI: "/v2/foo/bar/manifests/sha256:abcdef0123456789/_restore",
+			Vars: map[string]string{
+				"name":   "foo/bar",
+				"digest": "sha256:abcdef0123456789",
+			},
+		},
+		{
+			RouteName:  RouteNameManifestsBulkDelete,
+			RequestURI: "/v2/foo/bar/manifests/_bulkDelete",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameVerify,
+			RequestURI: "/v2/foo/bar/_verify",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameSummary,
+			RequestURI: "/v2/foo/bar/_summary",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameOrphans,
+			RequestURI: "/v2/foo/bar/_orphans",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameRepositoryMove,
+			RequestURI: "/v2/foo/bar/_move",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameRepositoryCache,
+			RequestURI: "/v2/foo/bar/_cache",
+			Vars: map[string]string{
+				"name": "foo/bar",
+			},
+		},
+		{
+			RouteName:  RouteNameCache,
+			RequestURI: "/v2/_cache",
+			Vars:       map[string]string{},
+		},
+		{
+			RouteName:  RouteNameWhereIs,
+			RequestURI: "/v2/_whereis",
+			Vars:       map[string]string{},
+		},
 		{
 			RouteName:  RouteNameTags,
 			RequestURI: "/v2/foo/bar/tags/list",
@@ -87,6 +175,14 @@ func TestRouter(t *testing.T) {
 				"name": "docker.com/foo/bar/baz",
 			},
 		},
+		{
+			RouteName:  RouteNameTag,
+			RequestURI: "/v2/foo/bar/tags/v1.0",
+			Vars: map[string]string{
+				"name": "foo/bar",
+				"tag":  "v1.0",
+			},
+		},
 		{
 			RouteName:  RouteNameBlob,
 			RequestURI: "/v2/foo/bar/blobs/sha256:abcdef0919234",
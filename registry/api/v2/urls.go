@@ -8,6 +8,7 @@ import (
 
 	"github.com/docker/distribution/reference"
 	"github.com/gorilla/mux"
+	"github.com/opencontainers/go-digest"
 )
 
 // URLBuilder creates registry API urls from a single base endpoint. It can be
@@ -139,6 +140,18 @@ func (ub *URLBuilder) BuildTagsURL(name reference.Named) (string, error) {
 	return tagsURL.String(), nil
 }
 
+// BuildTagURL constructs a url for the tag identified by name and tag.
+func (ub *URLBuilder) BuildTagURL(ref reference.NamedTagged) (string, error) {
+	route := ub.cloneRoute(RouteNameTag)
+
+	tagURL, err := route.URL("name", ref.Name(), "tag", ref.Tag())
+	if err != nil {
+		return "", err
+	}
+
+	return tagURL.String(), nil
+}
+
 // BuildManifestURL constructs a url for the manifest identified by name and
 // reference. The argument reference may be either a tag or digest.
 func (ub *URLBuilder) BuildManifestURL(ref reference.Named) (string, error) {
@@ -162,6 +175,186 @@ func (ub *URLBuilder) BuildManifestURL(ref reference.Named) (string, error) {
 	return manifestURL.String(), nil
 }
 
+// BuildDiffIDsURL constructs a url for the layer diffID mapping of the
+// manifest identified by name and reference. The argument reference may be
+// either a tag or digest.
+func (ub *URLBuilder) BuildDiffIDsURL(ref reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameDiffIDs)
+
+	tagOrDigest := ""
+	switch v := ref.(type) {
+	case reference.Tagged:
+		tagOrDigest = v.Tag()
+	case reference.Digested:
+		tagOrDigest = v.Digest().String()
+	default:
+		return "", fmt.Errorf("reference must have a tag or digest")
+	}
+
+	diffIDsURL, err := route.URL("name", ref.Name(), "reference", tagOrDigest)
+	if err != nil {
+		return "", err
+	}
+
+	return diffIDsURL.String(), nil
+}
+
+// BuildReferrersURL constructs a url for the manifests referring to the
+// digest of ref.
+func (ub *URLBuilder) BuildReferrersURL(ref reference.Canonical, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameReferrers)
+
+	referrersURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(referrersURL, values...).String(), nil
+}
+
+// BuildDedupStatsURL constructs a url for the registry deduplication
+// statistics.
+func (ub *URLBuilder) BuildDedupStatsURL() (string, error) {
+	route := ub.cloneRoute(RouteNameDedupStats)
+
+	dedupStatsURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return dedupStatsURL.String(), nil
+}
+
+// BuildCacheURL constructs a url for the blob descriptor cache of the
+// registry.
+func (ub *URLBuilder) BuildCacheURL() (string, error) {
+	route := ub.cloneRoute(RouteNameCache)
+
+	cacheURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return cacheURL.String(), nil
+}
+
+// BuildRepositoryCacheURL constructs a url for the blob descriptor cache of
+// the repository identified by name.
+func (ub *URLBuilder) BuildRepositoryCacheURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameRepositoryCache)
+
+	cacheURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return cacheURL.String(), nil
+}
+
+// BuildWhereIsURL constructs a url for the tags of all repositories
+// referencing dgst.
+func (ub *URLBuilder) BuildWhereIsURL(dgst digest.Digest) (string, error) {
+	route := ub.cloneRoute(RouteNameWhereIs)
+
+	whereIsURL, err := route.URL()
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(whereIsURL, url.Values{"digest": []string{dgst.String()}}).String(), nil
+}
+
+// BuildUsageURL constructs a url for the storage usage of the repository
+// identified by name.
+func (ub *URLBuilder) BuildUsageURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameUsage)
+
+	usageURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return usageURL.String(), nil
+}
+
+// BuildSummaryURL constructs a url for summarizing the content the tags of
+// the repository identified by name refer to.
+func (ub *URLBuilder) BuildSummaryURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameSummary)
+
+	summaryURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return summaryURL.String(), nil
+}
+
+// BuildVerifyURL constructs a url for verifying the blob content of the
+// repository identified by name.
+func (ub *URLBuilder) BuildVerifyURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameVerify)
+
+	verifyURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(verifyURL, values...).String(), nil
+}
+
+// BuildOrphansURL constructs a url for listing the blobs linked into the
+// repository identified by name which no manifest references.
+func (ub *URLBuilder) BuildOrphansURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameOrphans)
+
+	orphansURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return orphansURL.String(), nil
+}
+
+// BuildRepositoryMoveURL constructs a url for moving the repository
+// identified by name.
+func (ub *URLBuilder) BuildRepositoryMoveURL(name reference.Named, values ...url.Values) (string, error) {
+	route := ub.cloneRoute(RouteNameRepositoryMove)
+
+	moveURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return appendValuesURL(moveURL, values...).String(), nil
+}
+
+// BuildManifestRestoreURL constructs a url for restoring the soft deleted
+// manifest identified by ref.
+func (ub *URLBuilder) BuildManifestRestoreURL(ref reference.Canonical) (string, error) {
+	route := ub.cloneRoute(RouteNameManifestRestore)
+
+	restoreURL, err := route.URL("name", ref.Name(), "digest", ref.Digest().String())
+	if err != nil {
+		return "", err
+	}
+
+	return restoreURL.String(), nil
+}
+
+// BuildManifestsBulkDeleteURL constructs a url for deleting several manifests
+// of the repository identified by name.
+func (ub *URLBuilder) BuildManifestsBulkDeleteURL(name reference.Named) (string, error) {
+	route := ub.cloneRoute(RouteNameManifestsBulkDelete)
+
+	bulkDeleteURL, err := route.URL("name", name.Name())
+	if err != nil {
+		return "", err
+	}
+
+	return bulkDeleteURL.String(), nil
+}
+
 // BuildBlobURL constructs the url for the blob identified by name and dgst.
 func (ub *URLBuilder) BuildBlobURL(ref reference.Canonical) (string, error) {
 	route := ub.cloneRoute(RouteNameBlob)
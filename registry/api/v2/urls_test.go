@@ -51,6 +51,118 @@ func makeURLBuilderTestCases(urlBuilder *URLBuilder) []urlBuilderTestCase {
 				return urlBuilder.BuildManifestURL(fooBarRef)
 			},
 		},
+		{
+			description:  "test diffids url tagged ref",
+			expectedPath: "/v2/foo/bar/_diffids/tag",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				ref, _ := reference.WithTag(fooBarRef, "tag")
+				return urlBuilder.BuildDiffIDsURL(ref)
+			},
+		},
+		{
+			description:  "test tag url",
+			expectedPath: "/v2/foo/bar/tags/tag",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				ref, _ := reference.WithTag(fooBarRef, "tag")
+				return urlBuilder.BuildTagURL(ref)
+			},
+		},
+		{
+			description:  "test referrers url",
+			expectedPath: "/v2/foo/bar/referrers/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				ref, _ := reference.WithDigest(fooBarRef, "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+				return urlBuilder.BuildReferrersURL(ref)
+			},
+		},
+		{
+			description:  "test dedup stats url",
+			expectedPath: "/v2/_dedup-stats",
+			expectedErr:  nil,
+			build:        urlBuilder.BuildDedupStatsURL,
+		},
+		{
+			description:  "test cache url",
+			expectedPath: "/v2/_cache",
+			expectedErr:  nil,
+			build:        urlBuilder.BuildCacheURL,
+		},
+		{
+			description:  "test whereis url",
+			expectedPath: "/v2/_whereis?digest=sha256%3A3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildWhereIsURL("sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+			},
+		},
+		{
+			description:  "test repository cache url",
+			expectedPath: "/v2/foo/bar/_cache",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildRepositoryCacheURL(fooBarRef)
+			},
+		},
+		{
+			description:  "test usage url",
+			expectedPath: "/v2/foo/bar/_usage",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildUsageURL(fooBarRef)
+			},
+		},
+		{
+			description:  "test manifest restore url",
+			expectedPath: "/v2/foo/bar/manifests/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5/_restore",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				ref, _ := reference.WithDigest(fooBarRef, "sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5")
+				return urlBuilder.BuildManifestRestoreURL(ref)
+			},
+		},
+		{
+			description:  "test manifests bulk delete url",
+			expectedPath: "/v2/foo/bar/manifests/_bulkDelete",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildManifestsBulkDeleteURL(fooBarRef)
+			},
+		},
+		{
+			description:  "test summary url",
+			expectedPath: "/v2/foo/bar/_summary",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildSummaryURL(fooBarRef)
+			},
+		},
+		{
+			description:  "test verify url",
+			expectedPath: "/v2/foo/bar/_verify?sample=0.1",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildVerifyURL(fooBarRef, url.Values{"sample": []string{"0.1"}})
+			},
+		},
+		{
+			description:  "test orphans url",
+			expectedPath: "/v2/foo/bar/_orphans",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildOrphansURL(fooBarRef)
+			},
+		},
+		{
+			description:  "test repository move url",
+			expectedPath: "/v2/foo/bar/_move?to=foo%2Fbaz",
+			expectedErr:  nil,
+			build: func() (string, error) {
+				return urlBuilder.BuildRepositoryMoveURL(fooBarRef, url.Values{"to": []string{"foo/baz"}})
+			},
+		},
 		{
 			description:  "build blob url",
 			expectedPath: "/v2/foo/bar/blobs/sha256:3b3692957d439ac1928219a83fac91e7bf96c153725526874673ae1f2023f8d5",
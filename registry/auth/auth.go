@@ -106,6 +106,16 @@ type AccessController interface {
 	Authorized(ctx context.Context, access ...Access) (context.Context, error)
 }
 
+// CatalogFilterer may be implemented by an AccessController to restrict the
+// catalog to the repositories a request may pull.
+type CatalogFilterer interface {
+	// CatalogFilter returns a predicate reporting whether the named
+	// repository may be listed to the request of ctx, which has been
+	// authorized to read the catalog. A nil predicate lists every
+	// repository.
+	CatalogFilter(ctx context.Context) (func(name string) bool, error)
+}
+
 // CredentialAuthenticator is an object which is able to authenticate credentials
 type CredentialAuthenticator interface {
 	AuthenticateUser(username, password string) error
@@ -127,12 +127,13 @@ func (ac authChallenge) SetHeaders(r *http.Request, w http.ResponseWriter) {
 
 // accessController implements the auth.AccessController interface.
 type accessController struct {
-	realm        string
-	autoRedirect bool
-	issuer       string
-	service      string
-	rootCerts    *x509.CertPool
-	trustedKeys  map[string]libtrust.PublicKey
+	realm         string
+	autoRedirect  bool
+	filterCatalog bool
+	issuer        string
+	service       string
+	rootCerts     *x509.CertPool
+	trustedKeys   map[string]libtrust.PublicKey
 }
 
 // tokenAccessOptions is a convenience type for handling
@@ -140,6 +141,7 @@ type accessController struct {
 type tokenAccessOptions struct {
 	realm          string
 	autoRedirect   bool
+	filterCatalog  bool
 	issuer         string
 	service        string
 	rootCertBundle string
@@ -171,6 +173,15 @@ func checkOptions(options map[string]interface{}) (tokenAccessOptions, error) {
 		opts.autoRedirect = autoRedirect
 	}
 
+	filterCatalogVal, ok := options["filtercatalog"]
+	if ok {
+		filterCatalog, ok := filterCatalogVal.(bool)
+		if !ok {
+			return opts, fmt.Errorf("token auth requires a valid option bool: filtercatalog")
+		}
+		opts.filterCatalog = filterCatalog
+	}
+
 	return opts, nil
 }
 
@@ -223,12 +234,13 @@ func newAccessController(options map[string]interface{}) (auth.AccessController,
 	}
 
 	return &accessController{
-		realm:        config.realm,
-		autoRedirect: config.autoRedirect,
-		issuer:       config.issuer,
-		service:      config.service,
-		rootCerts:    rootPool,
-		trustedKeys:  trustedKeys,
+		realm:         config.realm,
+		autoRedirect:  config.autoRedirect,
+		filterCatalog: config.filterCatalog,
+		issuer:        config.issuer,
+		service:       config.service,
+		rootCerts:     rootPool,
+		trustedKeys:   trustedKeys,
 	}, nil
 }
 
@@ -247,19 +259,37 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 		return nil, err
 	}
 
+	token, err := ac.verifiedToken(req)
+	if err != nil {
+		challenge.err = err
+		return nil, challenge
+	}
+
+	accessSet := token.accessSet()
+	for _, access := range accessItems {
+		if !accessSet.contains(access) {
+			challenge.err = ErrInsufficientScope
+			return nil, challenge
+		}
+	}
+
+	ctx = auth.WithResources(ctx, token.resources())
+
+	return auth.WithUser(ctx, auth.UserInfo{Name: token.Claims.Subject}), nil
+}
+
+// verifiedToken returns the bearer token of the request once it has been
+// verified to be issued for this registry.
+func (ac *accessController) verifiedToken(req *http.Request) (*Token, error) {
 	parts := strings.Split(req.Header.Get("Authorization"), " ")
 
 	if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-		challenge.err = ErrTokenRequired
-		return nil, challenge
+		return nil, ErrTokenRequired
 	}
 
-	rawToken := parts[1]
-
-	token, err := NewToken(rawToken)
+	token, err := NewToken(parts[1])
 	if err != nil {
-		challenge.err = err
-		return nil, challenge
+		return nil, err
 	}
 
 	verifyOpts := VerifyOptions{
@@ -269,22 +299,37 @@ func (ac *accessController) Authorized(ctx context.Context, accessItems ...auth.
 		TrustedKeys:       ac.trustedKeys,
 	}
 
-	if err = token.Verify(verifyOpts); err != nil {
-		challenge.err = err
-		return nil, challenge
+	if err := token.Verify(verifyOpts); err != nil {
+		return nil, err
 	}
 
-	accessSet := token.accessSet()
-	for _, access := range accessItems {
-		if !accessSet.contains(access) {
-			challenge.err = ErrInsufficientScope
-			return nil, challenge
-		}
+	return token, nil
+}
+
+// CatalogFilter restricts the catalog to the repositories the token grants
+// pull access to, if the filtercatalog option is set.
+func (ac *accessController) CatalogFilter(ctx context.Context) (func(name string) bool, error) {
+	if !ac.filterCatalog {
+		return nil, nil
 	}
 
-	ctx = auth.WithResources(ctx, token.resources())
+	req, err := dcontext.GetRequest(ctx)
+	if err != nil {
+		return nil, err
+	}
 
-	return auth.WithUser(ctx, auth.UserInfo{Name: token.Claims.Subject}), nil
+	token, err := ac.verifiedToken(req)
+	if err != nil {
+		return nil, err
+	}
+
+	accessSet := token.accessSet()
+	return func(name string) bool {
+		return accessSet.contains(auth.Access{
+			Resource: auth.Resource{Type: "repository", Name: name},
+			Action:   "pull",
+		})
+	}, nil
 }
 
 // init handles registering the token auth backend.
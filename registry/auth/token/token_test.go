@@ -478,6 +478,81 @@ func TestAccessController(t *testing.T) {
 	}
 }
 
+// This tests that the catalog filter of the access controller, once enabled,
+// allows only the repositories the token grants pull access to.
+func TestAccessControllerCatalogFilter(t *testing.T) {
+	rootKeys, err := makeRootKeys(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootCertBundleFilename, err := writeTempRootCerts(rootKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(rootCertBundleFilename)
+
+	issuer := "test-issuer.example.com"
+	service := "test-service.example.com"
+
+	options := map[string]interface{}{
+		"realm":          "https://auth.example.com/token/",
+		"issuer":         issuer,
+		"service":        service,
+		"rootcertbundle": rootCertBundleFilename,
+	}
+
+	token, err := makeTestToken(
+		issuer, service,
+		[]*ResourceActions{
+			{Type: "registry", Name: "catalog", Actions: []string{"*"}},
+			{Type: "repository", Name: "team/pulled", Actions: []string{"pull"}},
+			{Type: "repository", Name: "team/pushed", Actions: []string{"push"}},
+		},
+		rootKeys[0], 1, time.Now(), time.Now().Add(5*time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req, err := http.NewRequest("GET", "http://example.com/v2/_catalog", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token.compactRaw()))
+	ctx := context.WithRequest(context.Background(), req)
+
+	// catalogs are not filtered unless enabled
+	accessController, err := newAccessController(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed, err := accessController.(auth.CatalogFilterer).CatalogFilter(ctx)
+	if err != nil || allowed != nil {
+		t.Fatalf("expected no filter, got %v", err)
+	}
+
+	options["filtercatalog"] = true
+	accessController, err = newAccessController(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	allowed, err = accessController.(auth.CatalogFilterer).CatalogFilter(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting catalog filter: %v", err)
+	}
+
+	for name, expected := range map[string]bool{
+		"team/pulled": true,
+		"team/pushed": false,
+		"other/repo":  false,
+	} {
+		if allowed(name) != expected {
+			t.Errorf("unexpected filter result for %s: %t != %t", name, !expected, expected)
+		}
+	}
+}
+
 // This tests that newAccessController can handle PEM blocks in the certificate
 // file other than certificates, for example a private key.
 func TestNewAccessControllerPemBlock(t *testing.T) {
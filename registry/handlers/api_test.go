@@ -3,6 +3,7 @@ package handlers
 import (
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -18,17 +19,23 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/configuration"
 	"github.com/docker/distribution/manifest"
 	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/ocischema"
 	"github.com/docker/distribution/manifest/schema1"
 	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/notifications"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/storage"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/factory"
 	_ "github.com/docker/distribution/registry/storage/driver/testdriver"
@@ -36,6 +43,7 @@ import (
 	"github.com/docker/libtrust"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 var headerConfig = http.Header{
@@ -196,6 +204,2016 @@ func TestCatalogAPI(t *testing.T) {
 	}
 }
 
+func TestCatalogAPIDetail(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver":     configuration.Parameters{},
+			"pushtimestamps": configuration.Parameters{"enabled": true},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	before := time.Now().Add(-time.Second)
+	images := []string{"foo/aaaa", "foo/bbbb"}
+	for _, image := range images {
+		createRepository(env, t, image, "sometag")
+	}
+
+	catalogURL, err := env.builder.BuildCatalogURL(url.Values{"detail": []string{"true"}})
+	if err != nil {
+		t.Fatalf("unexpected error building catalog url: %v", err)
+	}
+
+	resp, err := http.Get(catalogURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "issuing catalog api check", resp, http.StatusOK)
+
+	var ctlg struct {
+		Repositories []string `json:"repositories"`
+		Details      []struct {
+			Name       string     `json:"name"`
+			LastPushed *time.Time `json:"lastPushed"`
+		} `json:"details"`
+	}
+
+	dec := json.NewDecoder(resp.Body)
+	if err := dec.Decode(&ctlg); err != nil {
+		t.Fatalf("error decoding fetched catalog: %v", err)
+	}
+
+	if len(ctlg.Details) != len(images) {
+		t.Fatalf("unexpected number of details: %d != %d", len(ctlg.Details), len(images))
+	}
+
+	for i, detail := range ctlg.Details {
+		if detail.Name != images[i] {
+			t.Fatalf("unexpected repository in details: %q != %q", detail.Name, images[i])
+		}
+		if detail.LastPushed == nil || detail.LastPushed.Before(before) {
+			t.Fatalf("unexpected last pushed time for %s: %v", detail.Name, detail.LastPushed)
+		}
+	}
+}
+
+func TestCatalogAPIDetailEstimated(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	before := time.Now().Add(-time.Second)
+	createRepository(env, t, "foo/aaaa", "sometag")
+
+	catalogURL, err := env.builder.BuildCatalogURL(url.Values{
+		"detail": []string{"true"},
+		"limit":  []string{"1"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building catalog url: %v", err)
+	}
+
+	resp, err := http.Get(catalogURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "issuing catalog api check", resp, http.StatusOK)
+
+	var ctlg struct {
+		Details []struct {
+			Name       string     `json:"name"`
+			LastPushed *time.Time `json:"lastPushed"`
+		} `json:"details"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ctlg); err != nil {
+		t.Fatalf("error decoding fetched catalog: %v", err)
+	}
+
+	// without recorded push timestamps the time is taken from the links
+	if len(ctlg.Details) != 1 || ctlg.Details[0].LastPushed == nil || ctlg.Details[0].LastPushed.Before(before) {
+		t.Fatalf("unexpected details: %+v", ctlg.Details)
+	}
+}
+
+func TestCatalogAPIPrefix(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	for _, image := range []string{"bar/aaaa", "foo/aaaa", "foo/bbbb", "foo/cccc"} {
+		createRepository(env, t, image, "sometag")
+	}
+
+	catalogURL, err := env.builder.BuildCatalogURL(url.Values{
+		"prefix": []string{"foo/"},
+		"n":      []string{"2"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error building catalog url: %v", err)
+	}
+
+	var ctlg struct {
+		Repositories []string `json:"repositories"`
+	}
+
+	resp, err := http.Get(catalogURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "issuing catalog api check", resp, http.StatusOK)
+	if err := json.NewDecoder(resp.Body).Decode(&ctlg); err != nil {
+		t.Fatalf("error decoding fetched catalog: %v", err)
+	}
+	if !reflect.DeepEqual(ctlg.Repositories, []string{"foo/aaaa", "foo/bbbb"}) {
+		t.Fatalf("unexpected repositories: %v", ctlg.Repositories)
+	}
+
+	values := checkLink(t, resp.Header.Get("Link"), 2, "foo/bbbb")
+	if values.Get("prefix") != "foo/" {
+		t.Fatalf("catalog link does not keep the prefix: %v", values)
+	}
+
+	catalogURL, err = env.builder.BuildCatalogURL(values)
+	if err != nil {
+		t.Fatalf("unexpected error building catalog url: %v", err)
+	}
+	resp, err = http.Get(catalogURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "issuing catalog api check", resp, http.StatusOK)
+	if err := json.NewDecoder(resp.Body).Decode(&ctlg); err != nil {
+		t.Fatalf("error decoding fetched catalog: %v", err)
+	}
+	if !reflect.DeepEqual(ctlg.Repositories, []string{"foo/cccc"}) {
+		t.Fatalf("unexpected repositories: %v", ctlg.Repositories)
+	}
+	if resp.Header.Get("Link") != "" {
+		t.Fatalf("repositories has more data when none expected")
+	}
+}
+
+// catalogFilteringController authorizes every request and lists only the
+// repositories in allowed.
+type catalogFilteringController struct {
+	allowed map[string]bool
+}
+
+func (c *catalogFilteringController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	return ctx, nil
+}
+
+func (c *catalogFilteringController) CatalogFilter(ctx context.Context) (func(name string) bool, error) {
+	return func(name string) bool {
+		return c.allowed[name]
+	}, nil
+}
+
+func TestCatalogAPIFiltered(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	for _, image := range []string{"foo/aaaa", "foo/bbbb", "foo/cccc", "foo/dddd", "foo/eeee"} {
+		createRepository(env, t, image, "sometag")
+	}
+	env.app.accessController = &catalogFilteringController{allowed: map[string]bool{
+		"foo/aaaa": true,
+		"foo/cccc": true,
+		"foo/eeee": true,
+	}}
+
+	var pages [][]string
+	values := url.Values{"n": []string{"2"}}
+	for {
+		catalogURL, err := env.builder.BuildCatalogURL(values)
+		if err != nil {
+			t.Fatalf("unexpected error building catalog url: %v", err)
+		}
+		resp, err := http.Get(catalogURL)
+		if err != nil {
+			t.Fatalf("unexpected error issuing request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		checkResponse(t, "issuing catalog api check", resp, http.StatusOK)
+		var ctlg struct {
+			Repositories []string `json:"repositories"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&ctlg); err != nil {
+			t.Fatalf("error decoding fetched catalog: %v", err)
+		}
+		pages = append(pages, ctlg.Repositories)
+
+		if resp.Header.Get("Link") == "" {
+			break
+		}
+		values = checkLink(t, resp.Header.Get("Link"), 2, ctlg.Repositories[len(ctlg.Repositories)-1])
+	}
+
+	expected := [][]string{{"foo/aaaa", "foo/cccc"}, {"foo/eeee"}}
+	if !reflect.DeepEqual(pages, expected) {
+		t.Fatalf("unexpected catalog pages: %v != %v", pages, expected)
+	}
+}
+
+func TestDedupStatsAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	for _, image := range []string{"foo/aaaa", "foo/bbbb"} {
+		createRepository(env, t, image, "sometag")
+	}
+
+	dedupStatsURL, err := env.builder.BuildDedupStatsURL()
+	if err != nil {
+		t.Fatalf("unexpected error building dedup stats url: %v", err)
+	}
+
+	resp, err := http.Get(dedupStatsURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching dedup stats", resp, http.StatusOK)
+
+	var stats struct {
+		Repositories  int   `json:"repositories"`
+		Links         int   `json:"links"`
+		Blobs         int   `json:"blobs"`
+		LogicalBytes  int64 `json:"logical_bytes"`
+		PhysicalBytes int64 `json:"physical_bytes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		t.Fatalf("error decoding dedup stats: %v", err)
+	}
+
+	// each repository was pushed its own random layer
+	if stats.Repositories != 2 || stats.Links != 2 || stats.Blobs != 2 {
+		t.Fatalf("unexpected counts: %+v", stats)
+	}
+	if stats.LogicalBytes != stats.PhysicalBytes {
+		t.Fatalf("unexpected sizes: %+v", stats)
+	}
+}
+
+func TestWhereIsAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	dgst := createRepository(env, t, "foo/aaaa", "sometag")
+	createRepository(env, t, "foo/bbbb", "sometag")
+
+	whereIsURL, err := env.builder.BuildWhereIsURL(dgst)
+	if err != nil {
+		t.Fatalf("unexpected error building whereis url: %v", err)
+	}
+
+	resp, err := http.Get(whereIsURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching tags referencing manifest", resp, http.StatusOK)
+
+	var whereIs struct {
+		Digest       digest.Digest       `json:"digest"`
+		Repositories map[string][]string `json:"repositories"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&whereIs); err != nil {
+		t.Fatalf("error decoding tags referencing manifest: %v", err)
+	}
+	expected := map[string][]string{"foo/aaaa": {"sometag"}}
+	if whereIs.Digest != dgst || !reflect.DeepEqual(whereIs.Repositories, expected) {
+		t.Fatalf("expected %v to be referenced by %v, got %+v", dgst, expected, whereIs)
+	}
+
+	resp, err = http.Get(strings.Split(whereIsURL, "?")[0] + "?digest=invalid")
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching tags referencing invalid digest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "fetching tags referencing invalid digest", resp, v2.ErrorCodeDigestInvalid)
+}
+
+func TestReferrersAPI(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/referrers")
+	pushOCIManifest := func(config []byte, m ocischema.Manifest) distribution.Descriptor {
+		configDigest := digest.FromBytes(config)
+		uploadURLBase, _ := startPushLayer(t, env, imageName)
+		pushLayer(t, env.builder, imageName, configDigest, uploadURLBase, bytes.NewReader(config))
+
+		m.Versioned = ocischema.SchemaVersion
+		m.Config.Digest = configDigest
+		m.Config.Size = int64(len(config))
+		dm, err := ocischema.FromStruct(m)
+		if err != nil {
+			t.Fatalf("unexpected error creating manifest: %v", err)
+		}
+		mediaType, payload, _ := dm.Payload()
+		desc := distribution.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(payload), Size: int64(len(payload))}
+
+		digestRef, _ := reference.WithDigest(imageName, desc.Digest)
+		manifestURL, err := env.builder.BuildManifestURL(digestRef)
+		checkErr(t, err, "building manifest url")
+		resp := putManifest(t, "putting oci manifest", manifestURL, mediaType, dm)
+		checkResponse(t, "putting oci manifest", resp, http.StatusCreated)
+		return desc
+	}
+
+	subject := pushOCIManifest([]byte(`{"image":true}`), ocischema.Manifest{
+		Config: distribution.Descriptor{MediaType: v1.MediaTypeImageConfig},
+	})
+	signatureType := "application/vnd.example.signature"
+	signature := pushOCIManifest([]byte(`{"signature":true}`), ocischema.Manifest{
+		Config:       distribution.Descriptor{MediaType: "application/vnd.example.signature.config+json"},
+		ArtifactType: signatureType,
+		Subject:      &subject,
+		Annotations:  map[string]string{"signed": "yes"},
+	})
+
+	getReferrers := func(values url.Values) (*http.Response, referrersAPIResponse) {
+		subjectRef, _ := reference.WithDigest(imageName, subject.Digest)
+		referrersURL, err := env.builder.BuildReferrersURL(subjectRef, values)
+		checkErr(t, err, "building referrers url")
+
+		resp, err := http.Get(referrersURL)
+		if err != nil {
+			t.Fatalf("unexpected error fetching referrers: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "fetching referrers", resp, http.StatusOK)
+
+		var index referrersAPIResponse
+		if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+			t.Fatalf("error decoding referrers: %v", err)
+		}
+		return resp, index
+	}
+
+	_, index := getReferrers(nil)
+	if len(index.Manifests) != 1 {
+		t.Fatalf("unexpected referrers: %+v", index.Manifests)
+	}
+	referrer := index.Manifests[0]
+	if referrer.Digest != signature.Digest || referrer.Size != signature.Size || referrer.ArtifactType != signatureType || referrer.Annotations["signed"] != "yes" {
+		t.Fatalf("unexpected referrer: %+v", referrer)
+	}
+
+	resp, index := getReferrers(url.Values{"artifactType": []string{"application/vnd.example.other"}})
+	if len(index.Manifests) != 0 {
+		t.Fatalf("unexpected filtered referrers: %+v", index.Manifests)
+	}
+	if resp.Header.Get("OCI-Filters-Applied") != "artifactType" {
+		t.Fatalf("missing OCI-Filters-Applied header: %v", resp.Header)
+	}
+}
+
+func TestRepositoryUsage(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/usage")
+	createRepository(env, t, imageName.Name(), "sometag")
+
+	usageURL, err := env.builder.BuildUsageURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building usage url: %v", err)
+	}
+
+	resp, err := http.Get(usageURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching usage", resp, http.StatusOK)
+
+	var usage struct {
+		BlobBytes     int64 `json:"blob_bytes"`
+		ManifestBytes int64 `json:"manifest_bytes"`
+		BlobCount     int   `json:"blob_count"`
+		ManifestCount int   `json:"manifest_count"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&usage); err != nil {
+		t.Fatalf("error decoding usage: %v", err)
+	}
+
+	if usage.BlobCount != 1 || usage.BlobBytes <= 0 {
+		t.Fatalf("unexpected blob usage: %+v", usage)
+	}
+	if usage.ManifestCount != 1 || usage.ManifestBytes <= 0 {
+		t.Fatalf("unexpected manifest usage: %+v", usage)
+	}
+}
+
+func TestRepositorySummary(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/summary")
+	dgst := createRepository(env, t, imageName.Name(), "sometag")
+
+	summaryURL, err := env.builder.BuildSummaryURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building summary url: %v", err)
+	}
+
+	var summaries []storage.Summary
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(summaryURL)
+		if err != nil {
+			t.Fatalf("unexpected error issuing request: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "fetching summary", resp, http.StatusOK)
+
+		var summary storage.Summary
+		if err := json.NewDecoder(resp.Body).Decode(&summary); err != nil {
+			t.Fatalf("error decoding summary: %v", err)
+		}
+		summaries = append(summaries, summary)
+	}
+
+	summary := summaries[0]
+	if len(summary.Tags) != 1 || summary.Tags[0].Tag != "sometag" || summary.Tags[0].Manifest != dgst {
+		t.Fatalf("unexpected summary tags: %+v", summary.Tags)
+	}
+	if len(summary.Tags[0].References) != 1 {
+		t.Fatalf("expected the layer in the summary references, got %v", summary.Tags[0].References)
+	}
+	if summary.Digest == "" || summaries[1].Digest != summary.Digest {
+		t.Fatalf("expected a stable summary digest, got %v and %v", summary.Digest, summaries[1].Digest)
+	}
+}
+
+func TestRepositoryVerify(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/verify")
+	createRepository(env, t, imageName.Name(), "sometag")
+
+	verify := func() []storage.BlobMismatch {
+		verifyURL, err := env.builder.BuildVerifyURL(imageName)
+		if err != nil {
+			t.Fatalf("unexpected error building verify url: %v", err)
+		}
+
+		resp, err := http.Get(verifyURL)
+		if err != nil {
+			t.Fatalf("unexpected error issuing request: %v", err)
+		}
+		defer resp.Body.Close()
+
+		checkResponse(t, "verifying repository", resp, http.StatusOK)
+
+		var mismatches []storage.BlobMismatch
+		dec := json.NewDecoder(resp.Body)
+		for dec.More() {
+			var mismatch storage.BlobMismatch
+			if err := dec.Decode(&mismatch); err != nil {
+				t.Fatalf("error decoding mismatch: %v", err)
+			}
+			mismatches = append(mismatches, mismatch)
+		}
+		return mismatches
+	}
+
+	if mismatches := verify(); len(mismatches) != 0 {
+		t.Fatalf("unexpected mismatches in intact repository: %+v", mismatches)
+	}
+
+	// corrupt every blob in the registry
+	var corrupted []string
+	err := env.app.driver.Walk(env.ctx, "/docker/registry/v2/blobs", func(fileInfo storagedriver.FileInfo) error {
+		if !fileInfo.IsDir() && path.Base(fileInfo.Path()) == "data" {
+			corrupted = append(corrupted, fileInfo.Path())
+			return env.app.driver.PutContent(env.ctx, fileInfo.Path(), []byte("corrupted"))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error corrupting blobs: %v", err)
+	}
+
+	// only the layer is linked into the repository blob store
+	mismatches := verify()
+	if len(mismatches) != 1 || mismatches[0].Actual != digest.FromString("corrupted") {
+		t.Fatalf("unexpected mismatches after corrupting %d blobs: %+v", len(corrupted), mismatches)
+	}
+}
+
+func TestBlobDescriptorCacheInvalidation(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"cache":      configuration.Parameters{"blobdescriptor": "inmemory"},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/cached")
+	content := []byte("cached descriptor")
+	dgst := digest.FromBytes(content)
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, dgst, uploadURLBase, bytes.NewReader(content))
+
+	ref, _ := reference.WithDigest(imageName, dgst)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building blob url: %v", err)
+	}
+	statBlob := func(msg string, expectedLength int) {
+		resp, err := http.Head(blobURL)
+		if err != nil {
+			t.Fatalf("unexpected error %s: %v", msg, err)
+		}
+		resp.Body.Close()
+		checkResponse(t, msg, resp, http.StatusOK)
+		checkHeaders(t, resp, http.Header{
+			"Content-Length": []string{fmt.Sprint(expectedLength)},
+		})
+	}
+	invalidate := func(msg string, cacheURL string) {
+		resp, err := httpDelete(cacheURL)
+		if err != nil {
+			t.Fatalf("unexpected error %s: %v", msg, err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, msg, resp, http.StatusAccepted)
+	}
+
+	// replace the blob behind the registry's back
+	replaced := []byte("replaced descriptor content")
+	blobPath := path.Join("/docker/registry/v2/blobs", dgst.Algorithm().String(), dgst.Hex()[:2], dgst.Hex(), "data")
+	if err := env.app.driver.PutContent(env.ctx, blobPath, replaced); err != nil {
+		t.Fatalf("unexpected error replacing blob: %v", err)
+	}
+	statBlob("statting the cached blob", len(content))
+
+	// the registry still caches the descriptor for all repositories
+	repositoryCacheURL, err := env.builder.BuildRepositoryCacheURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building repository cache url: %v", err)
+	}
+	invalidate("invalidating repository cache", repositoryCacheURL)
+	statBlob("statting the blob cached for the registry", len(content))
+
+	// the stat misses, and caches the descriptor read from storage
+	cacheURL, err := env.builder.BuildCacheURL()
+	if err != nil {
+		t.Fatalf("unexpected error building cache url: %v", err)
+	}
+	invalidate("invalidating cache", cacheURL)
+	statBlob("statting the replaced blob", len(replaced))
+	if err := env.app.driver.PutContent(env.ctx, blobPath, content); err != nil {
+		t.Fatalf("unexpected error restoring blob: %v", err)
+	}
+	statBlob("statting the recached blob", len(replaced))
+}
+
+func TestBlobDeletedFromStorage(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"cache":      configuration.Parameters{"blobdescriptor": "inmemory"},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/deleted")
+	content := []byte("deleted from storage")
+	dgst := digest.FromBytes(content)
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, dgst, uploadURLBase, bytes.NewReader(content))
+
+	ref, _ := reference.WithDigest(imageName, dgst)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building blob url: %v", err)
+	}
+
+	// the descriptor stays cached after the blob is deleted behind the
+	// registry's back
+	blobPath := path.Join("/docker/registry/v2/blobs", dgst.Algorithm().String(), dgst.Hex()[:2], dgst.Hex(), "data")
+	if err := env.app.driver.Delete(env.ctx, blobPath); err != nil {
+		t.Fatalf("unexpected error deleting blob: %v", err)
+	}
+
+	resp, err := http.Get(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching deleted blob: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching deleted blob", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "fetching deleted blob", resp, v2.ErrorCodeBlobUnknown)
+}
+
+func TestBlobDescriptorCacheInvalidationUncached(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	cacheURL, err := env.builder.BuildCacheURL()
+	if err != nil {
+		t.Fatalf("unexpected error building cache url: %v", err)
+	}
+
+	resp, err := httpDelete(cacheURL)
+	if err != nil {
+		t.Fatalf("unexpected error invalidating cache: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "invalidating cache without a cache", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "invalidating cache without a cache", resp, errcode.ErrorCodeUnsupported)
+}
+
+func TestRepositoryOrphans(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/orphans")
+	createRepository(env, t, imageName.Name(), "sometag")
+
+	content := []byte("unreferenced")
+	orphan := digest.FromBytes(content)
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	pushLayer(t, env.builder, imageName, orphan, uploadURLBase, bytes.NewReader(content))
+
+	orphansURL, err := env.builder.BuildOrphansURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building orphans url: %v", err)
+	}
+
+	resp, err := http.Get(orphansURL)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "listing orphaned blobs", resp, http.StatusOK)
+
+	var orphans []digest.Digest
+	dec := json.NewDecoder(resp.Body)
+	for dec.More() {
+		var orphaned struct {
+			Digest digest.Digest `json:"digest"`
+		}
+		if err := dec.Decode(&orphaned); err != nil {
+			t.Fatalf("error decoding orphaned blob: %v", err)
+		}
+		orphans = append(orphans, orphaned.Digest)
+	}
+	if len(orphans) != 1 || orphans[0] != orphan {
+		t.Fatalf("expected orphans [%v], got %v", orphan, orphans)
+	}
+}
+
+func TestManifestsBulkDelete(t *testing.T) {
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/bulkdelete")
+	first := createRepository(env, t, imageName.Name(), "first")
+	second := createRepository(env, t, imageName.Name(), "second")
+	unknown := digest.FromString("unknown manifest")
+
+	bulkDeleteURL, err := env.builder.BuildManifestsBulkDeleteURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building bulk delete url: %v", err)
+	}
+
+	body, err := json.Marshal([]string{first.String(), second.String(), unknown.String(), "bogus"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Post(bulkDeleteURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "bulk deleting manifests", resp, http.StatusMultiStatus)
+
+	var response bulkDeleteAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		t.Fatalf("error decoding bulk delete response: %v", err)
+	}
+	expected := []bulkDeleteResult{
+		{Digest: first.String(), Status: bulkDeleteStatusDeleted},
+		{Digest: second.String(), Status: bulkDeleteStatusDeleted},
+		{Digest: unknown.String(), Status: bulkDeleteStatusNotFound},
+	}
+	if len(response.Results) != 4 || !reflect.DeepEqual(response.Results[:3], expected) || response.Results[3].Status != bulkDeleteStatusInvalid {
+		t.Fatalf("unexpected bulk delete results: %+v", response.Results)
+	}
+
+	for _, tag := range []string{"first", "second"} {
+		ref, _ := reference.WithTag(imageName, tag)
+		manifestURL, err := env.builder.BuildManifestURL(ref)
+		if err != nil {
+			t.Fatalf("unexpected error building manifest url: %v", err)
+		}
+		resp, err := http.Get(manifestURL)
+		if err != nil {
+			t.Fatalf("unexpected error fetching manifest: %v", err)
+		}
+		defer resp.Body.Close()
+		checkResponse(t, "fetching deleted manifest by tag", resp, http.StatusNotFound)
+	}
+
+	// deleting what is left succeeds as a whole
+	body, err = json.Marshal([]string{createRepository(env, t, imageName.Name(), "third").String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err = http.Post(bulkDeleteURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "bulk deleting manifests", resp, http.StatusOK)
+}
+
+func TestManifestsBulkDeleteDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/bulkdelete")
+	dgst := createRepository(env, t, imageName.Name(), "sometag")
+
+	bulkDeleteURL, err := env.builder.BuildManifestsBulkDeleteURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building bulk delete url: %v", err)
+	}
+
+	resp, err := http.Post(bulkDeleteURL, "application/json", strings.NewReader(fmt.Sprintf("[%q]", dgst)))
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "bulk deleting manifests with delete disabled", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "bulk deleting manifests with delete disabled", resp, errcode.ErrorCodeUnsupported)
+}
+
+func TestManifestRestore(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"delete":     configuration.Parameters{"enabled": true, "softretention": "1h"},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.Compatibility.Schema1.Enabled = true
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/restore")
+	dgst := createRepository(env, t, imageName.Name(), "sometag")
+	digestRef, _ := reference.WithDigest(imageName, dgst)
+	tagRef, _ := reference.WithTag(imageName, "sometag")
+
+	restoreURL, err := env.builder.BuildManifestRestoreURL(digestRef)
+	if err != nil {
+		t.Fatalf("unexpected error building restore url: %v", err)
+	}
+	manifestURL, err := env.builder.BuildManifestURL(digestRef)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest url: %v", err)
+	}
+	tagURL, err := env.builder.BuildManifestURL(tagRef)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest url: %v", err)
+	}
+
+	// a manifest that was never deleted can't be restored
+	resp, err := http.Post(restoreURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "restoring a live manifest", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "restoring a live manifest", resp, v2.ErrorCodeManifestUnknown)
+
+	resp, err = httpDelete(manifestURL)
+	if err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "deleting manifest", resp, http.StatusAccepted)
+
+	resp, err = http.Get(tagURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching deleted manifest by tag", resp, http.StatusNotFound)
+
+	sink := &recordingSink{}
+	env.app.events.sink = sink
+	resp, err = http.Post(restoreURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "restoring manifest", resp, http.StatusCreated)
+	checkHeaders(t, resp, http.Header{
+		"Location":              []string{manifestURL},
+		"Docker-Content-Digest": []string{dgst.String()},
+	})
+
+	// the restore is reported as a push of the restored tag
+	events := sink.recorded()
+	if len(events) != 1 {
+		t.Fatalf("expected one event restoring manifest, got %+v", events)
+	}
+	if target := events[0].Target; events[0].Action != notifications.EventActionPush || target.Repository != imageName.Name() || target.Digest != dgst || target.Tag != "sometag" {
+		t.Fatalf("unexpected event restoring manifest: %+v", events[0])
+	}
+
+	resp, err = http.Get(tagURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching restored manifest by tag", resp, http.StatusOK)
+}
+
+// recordingSink is a notifications.Sink keeping the events written to it.
+type recordingSink struct {
+	mu     sync.Mutex
+	events []notifications.Event
+}
+
+func (rs *recordingSink) Write(events ...notifications.Event) error {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	rs.events = append(rs.events, events...)
+	return nil
+}
+
+func (rs *recordingSink) Close() error {
+	return nil
+}
+
+func (rs *recordingSink) recorded() []notifications.Event {
+	rs.mu.Lock()
+	defer rs.mu.Unlock()
+	return append([]notifications.Event(nil), rs.events...)
+}
+
+func TestRepositoryMove(t *testing.T) {
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+
+	fromName, _ := reference.WithName("team-a/app")
+	toName, _ := reference.WithName("team-b/app")
+	createRepository(env, t, fromName.Name(), "sometag")
+	createRepository(env, t, "team-c/app", "sometag")
+
+	moveURL, err := env.builder.BuildRepositoryMoveURL(fromName, url.Values{"to": []string{toName.Name()}})
+	if err != nil {
+		t.Fatalf("unexpected error building move url: %v", err)
+	}
+	tagsURL, err := env.builder.BuildTagsURL(toName)
+	if err != nil {
+		t.Fatalf("unexpected error building tags url: %v", err)
+	}
+
+	resp, err := http.Post(moveURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "moving repository", resp, http.StatusCreated)
+	checkHeaders(t, resp, http.Header{
+		"Location":       []string{tagsURL},
+		"Content-Length": []string{"0"},
+	})
+
+	for _, ref := range []reference.Named{fromName, toName} {
+		tagRef, _ := reference.WithTag(ref, "sometag")
+		manifestURL, err := env.builder.BuildManifestURL(tagRef)
+		if err != nil {
+			t.Fatalf("unexpected error building manifest url: %v", err)
+		}
+		resp, err = http.Get(manifestURL)
+		if err != nil {
+			t.Fatalf("unexpected error fetching manifest: %v", err)
+		}
+		defer resp.Body.Close()
+		if ref == fromName {
+			checkResponse(t, "fetching manifest of moved repository", resp, http.StatusNotFound)
+		} else {
+			checkResponse(t, "fetching manifest by new name", resp, http.StatusOK)
+		}
+	}
+
+	// the names of both repositories are now taken
+	teamCName, _ := reference.WithName("team-c/app")
+	moveURL, err = env.builder.BuildRepositoryMoveURL(teamCName, url.Values{"to": []string{toName.Name()}})
+	if err != nil {
+		t.Fatalf("unexpected error building move url: %v", err)
+	}
+	resp, err = http.Post(moveURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "moving to an existing repository", resp, http.StatusConflict)
+	checkBodyHasErrorCodes(t, "moving to an existing repository", resp, v2.ErrorCodeNameExists)
+}
+
+func TestRepositoryMoveDeleteDisabled(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	fromName, _ := reference.WithName("team-a/app")
+	createRepository(env, t, fromName.Name(), "sometag")
+
+	moveURL, err := env.builder.BuildRepositoryMoveURL(fromName, url.Values{"to": []string{"team-b/app"}})
+	if err != nil {
+		t.Fatalf("unexpected error building move url: %v", err)
+	}
+	resp, err := http.Post(moveURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error issuing request: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "moving repository with delete disabled", resp, http.StatusMethodNotAllowed)
+	checkBodyHasErrorCodes(t, "moving repository with delete disabled", resp, errcode.ErrorCodeUnsupported)
+}
+
+func TestBlobUploadResumedAfterRestart(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/restart")
+	chunks := [][]byte{[]byte("before the restart,"), []byte(" and after it")}
+	dgst := digest.FromBytes(append(append([]byte{}, chunks[0]...), chunks[1]...))
+
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	uploadURLBase, _ = pushChunk(t, env.builder, imageName, uploadURLBase, bytes.NewReader(chunks[0]), int64(len(chunks[0])))
+
+	// the restarted registry rotated its secret, and keeps nothing of the
+	// upload but what is in storage
+	config := env.config
+	config.HTTP.Secret = "rotated"
+	config.HTTP.PreviousSecrets = []string{env.config.HTTP.Secret}
+	restarted := newTestEnvWithConfig(t, &config)
+	defer restarted.Shutdown()
+	restarted.app.driver = env.app.driver
+	var err error
+	restarted.app.registry, err = storage.NewRegistry(restarted.ctx, env.app.driver, storage.EnableSchema1, storage.Schema1SigningKey(restarted.app.trustKey))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	uploadURLBase = strings.Replace(uploadURLBase, env.server.URL, restarted.server.URL, 1)
+	uploadURLBase, _ = pushChunk(t, restarted.builder, imageName, uploadURLBase, bytes.NewReader(chunks[1]), int64(len(chunks[0])+len(chunks[1])))
+	finishUpload(t, restarted.builder, imageName, uploadURLBase, dgst)
+}
+
+func TestBlobUploadInvalidState(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/state")
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	u, err := url.Parse(uploadURLBase)
+	if err != nil {
+		t.Fatalf("error parsing upload url: %v", err)
+	}
+	token, err := base64.URLEncoding.DecodeString(u.Query().Get("_state"))
+	if err != nil {
+		t.Fatalf("error decoding upload state: %v", err)
+	}
+	flipped := append([]byte{}, token...)
+	flipped[0] ^= 0xff
+
+	for _, tc := range []struct {
+		description string
+		state       string
+	}{
+		{"missing state", ""},
+		{"truncated state", base64.URLEncoding.EncodeToString(token[:16])},
+		{"tampered state", base64.URLEncoding.EncodeToString(flipped)},
+	} {
+		q := u.Query()
+		q.Set("_state", tc.state)
+		u.RawQuery = q.Encode()
+
+		resp, _, err := doPushChunk(t, u.String(), bytes.NewReader([]byte("chunk")))
+		if err != nil {
+			t.Fatalf("%s: unexpected error pushing chunk: %v", tc.description, err)
+		}
+		checkResponse(t, tc.description, resp, http.StatusNotFound)
+		checkBodyHasErrorCodes(t, tc.description, resp, v2.ErrorCodeBlobUploadInvalid)
+		resp.Body.Close()
+	}
+}
+
+func TestManifestPutConfigMediaTypes(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Validation.Manifests.ConfigMediaTypes = []string{v1.MediaTypeImageConfig}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/configs")
+	putOCIManifest := func(configMediaType string) *http.Response {
+		content := []byte(`{"config":"` + configMediaType + `"}`)
+		configDigest := digest.FromBytes(content)
+		uploadURLBase, _ := startPushLayer(t, env, imageName)
+		pushLayer(t, env.builder, imageName, configDigest, uploadURLBase, bytes.NewReader(content))
+
+		dm, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config:    distribution.Descriptor{MediaType: configMediaType, Digest: configDigest, Size: int64(len(content))},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating manifest: %v", err)
+		}
+		mediaType, payload, _ := dm.Payload()
+		digestRef, _ := reference.WithDigest(imageName, digest.FromBytes(payload))
+		manifestURL, err := env.builder.BuildManifestURL(digestRef)
+		checkErr(t, err, "building manifest url")
+		return putManifest(t, "putting oci manifest", manifestURL, mediaType, dm)
+	}
+
+	resp := putOCIManifest(v1.MediaTypeImageConfig)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest with an allowed config", resp, http.StatusCreated)
+
+	resp = putOCIManifest("application/vnd.example.config+json")
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest with another config", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "putting manifest with another config", resp, v2.ErrorCodeManifestInvalid)
+}
+
+func TestManifestPutDigestAlgorithm(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+			"digest": configuration.Parameters{"algorithm": "sha512"},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/sha512")
+	content := []byte(`{"config":"sha512"}`)
+	configDigest := digest.SHA512.FromBytes(content)
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	resp, err := doPushLayer(t, env.builder, imageName, configDigest, uploadURLBase, bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("unexpected error pushing config: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "pushing config", resp, http.StatusCreated)
+
+	dm, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    distribution.Descriptor{MediaType: v1.MediaTypeImageConfig, Digest: configDigest, Size: int64(len(content))},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	mediaType, payload, _ := dm.Payload()
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	resp = putManifest(t, "putting manifest by tag", manifestURL, mediaType, dm)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest by tag", resp, http.StatusCreated)
+	checkHeaders(t, resp, http.Header{
+		"Docker-Content-Digest": []string{digest.SHA512.FromBytes(payload).String()},
+	})
+}
+
+func TestManifestPutTooLarge(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.Schema1.Enabled = true
+	config.Validation.Manifests.MaxBytes = 16
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/toolarge")
+	tagRef, _ := reference.WithTag(imageName, "sometag")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest url: %v", err)
+	}
+
+	signedManifest, err := schema1.Sign(&schema1.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 1,
+		},
+		Name: imageName.Name(),
+		Tag:  "sometag",
+	}, env.pk)
+	if err != nil {
+		t.Fatalf("error signing manifest: %v", err)
+	}
+
+	resp := putManifest(t, "putting oversized manifest", manifestURL, schema1.MediaTypeSignedManifest, signedManifest)
+	defer resp.Body.Close()
+	checkResponse(t, "putting oversized manifest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "putting oversized manifest", resp, v2.ErrorCodeManifestInvalid)
+}
+
+func TestManifestPutTooManyReferences(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Validation.Manifests.MaxReferences = 1
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/references")
+	var descriptors []distribution.Descriptor
+	for _, content := range [][]byte{[]byte(`{"config":"references"}`), []byte("layer")} {
+		dgst := digest.FromBytes(content)
+		uploadURLBase, _ := startPushLayer(t, env, imageName)
+		pushLayer(t, env.builder, imageName, dgst, uploadURLBase, bytes.NewReader(content))
+		descriptors = append(descriptors, distribution.Descriptor{Digest: dgst, Size: int64(len(content))})
+	}
+	descriptors[0].MediaType = v1.MediaTypeImageConfig
+	descriptors[1].MediaType = v1.MediaTypeImageLayer
+
+	dm, err := ocischema.FromStruct(ocischema.Manifest{
+		Versioned: ocischema.SchemaVersion,
+		Config:    descriptors[0],
+		Layers:    descriptors[1:],
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating manifest: %v", err)
+	}
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	resp := putManifest(t, "putting manifest over the reference limit", manifestURL, v1.MediaTypeImageManifest, dm)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest over the reference limit", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "putting manifest over the reference limit", resp, v2.ErrorCodeManifestInvalid)
+}
+
+func TestManifestListPutLazy(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Validation.Manifests.AllowLazyLists = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/lazylist")
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	manifestList, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{
+		{
+			Descriptor: distribution.Descriptor{
+				Digest:    digest.FromString("not pushed yet"),
+				Size:      3253,
+				MediaType: schema2.MediaTypeManifest,
+			},
+			Platform: manifestlist.PlatformSpec{
+				Architecture: "amd64",
+				OS:           "linux",
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("could not create DeserializedManifestList: %v", err)
+	}
+
+	resp := putManifest(t, "putting manifest list of a missing manifest", manifestURL, manifestlist.MediaTypeManifestList, manifestList)
+	defer resp.Body.Close()
+	checkResponse(t, "putting manifest list of a missing manifest", resp, http.StatusCreated)
+}
+
+func TestManifestPutAdmission(t *testing.T) {
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request storage.ManifestAdmissionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("error decoding admission request: %v", err)
+		}
+		json.NewEncoder(w).Encode(storage.ManifestAdmissionResponse{
+			Allowed: request.Repository == "foo/admitted",
+			Reason:  "not admitted",
+		})
+	}))
+	defer webhook.Close()
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Validation.Manifests.Admission.URL = webhook.URL
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	for name, expected := range map[string]int{
+		"foo/admitted": http.StatusCreated,
+		"foo/rejected": http.StatusBadRequest,
+	} {
+		imageName, _ := reference.WithName(name)
+		content := []byte(`{"config":"admission"}`)
+		configDigest := digest.FromBytes(content)
+		uploadURLBase, _ := startPushLayer(t, env, imageName)
+		pushLayer(t, env.builder, imageName, configDigest, uploadURLBase, bytes.NewReader(content))
+
+		dm, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: ocischema.SchemaVersion,
+			Config:    distribution.Descriptor{MediaType: v1.MediaTypeImageConfig, Digest: configDigest, Size: int64(len(content))},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error creating manifest: %v", err)
+		}
+		tagRef, _ := reference.WithTag(imageName, "latest")
+		manifestURL, err := env.builder.BuildManifestURL(tagRef)
+		checkErr(t, err, "building manifest url")
+
+		resp := putManifest(t, "putting manifest to "+name, manifestURL, v1.MediaTypeImageManifest, dm)
+		defer resp.Body.Close()
+		checkResponse(t, "putting manifest to "+name, resp, expected)
+		if expected != http.StatusCreated {
+			checkBodyHasErrorCodes(t, "putting manifest to "+name, resp, v2.ErrorCodeManifestInvalid)
+		}
+	}
+}
+
+func TestSchema1Rejected(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.Schema1.RejectOnPull = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/schema1")
+	tagRef, _ := reference.WithTag(imageName, "sometag")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest url: %v", err)
+	}
+
+	signedManifest, err := schema1.Sign(&schema1.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 1,
+		},
+		Name: imageName.Name(),
+		Tag:  "sometag",
+	}, env.pk)
+	if err != nil {
+		t.Fatalf("error signing manifest: %v", err)
+	}
+
+	// the schema1 manifest was stored while schema1 pushes were enabled
+	registry, err := storage.NewRegistry(env.ctx, env.app.driver, storage.EnableSchema1, storage.Schema1SigningKey(env.app.trustKey))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repository, err := registry.Repository(env.ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+	manifests, err := repository.Manifests(env.ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest service: %v", err)
+	}
+	dgst, err := manifests.Put(env.ctx, signedManifest)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+	if err := repository.Tags(env.ctx).Tag(env.ctx, "sometag", distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+
+	resp, err := http.Get(manifestURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching rejected schema1 manifest", resp, http.StatusNotFound)
+	errs, _, _ := checkBodyHasErrorCodes(t, "fetching rejected schema1 manifest", resp, v2.ErrorCodeManifestUnknown)
+	if msg := errs[0].(errcode.Error).Message; msg != distribution.ErrSchemaV1Rejected.Error() {
+		t.Fatalf("unexpected error message: %q", msg)
+	}
+
+	resp = putManifest(t, "putting schema1 manifest", manifestURL, schema1.MediaTypeSignedManifest, signedManifest)
+	defer resp.Body.Close()
+	checkResponse(t, "putting schema1 manifest", resp, http.StatusBadRequest)
+	checkBodyHasErrorCodes(t, "putting schema1 manifest", resp, v2.ErrorCodeManifestInvalid)
+}
+
+func TestSchema1TrustedKeys(t *testing.T) {
+	trustedKey, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatalf("unexpected error generating private key: %v", err)
+	}
+	tmpfile, err := ioutil.TempFile("", "trusted")
+	if err != nil {
+		t.Fatalf("could not create temporary file: %v", err)
+	}
+	tmpfile.Close()
+	defer os.Remove(tmpfile.Name())
+	if err := libtrust.SavePublicKey(tmpfile.Name(), trustedKey.PublicKey()); err != nil {
+		t.Fatalf("error saving trusted key: %v", err)
+	}
+
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.Schema1.Enabled = true
+	config.Compatibility.Schema1.TrustedKeys = []string{tmpfile.Name()}
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/trusted")
+	tagRef, _ := reference.WithTag(imageName, "sometag")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+
+	for _, key := range []libtrust.PrivateKey{env.pk, trustedKey} {
+		signedManifest, err := schema1.Sign(&schema1.Manifest{
+			Versioned: manifest.Versioned{
+				SchemaVersion: 1,
+			},
+			Name: imageName.Name(),
+			Tag:  "sometag",
+		}, key)
+		if err != nil {
+			t.Fatalf("error signing manifest: %v", err)
+		}
+
+		resp := putManifest(t, "putting schema1 manifest", manifestURL, schema1.MediaTypeSignedManifest, signedManifest)
+		defer resp.Body.Close()
+		if key == trustedKey {
+			checkResponse(t, "putting manifest signed by a trusted key", resp, http.StatusCreated)
+		} else {
+			checkResponse(t, "putting manifest signed by another key", resp, http.StatusBadRequest)
+			checkBodyHasErrorCodes(t, "putting manifest signed by another key", resp, v2.ErrorCodeManifestUnverified)
+		}
+	}
+}
+
+func TestManifestSchema1DigestAcrossSigningKeys(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	var err error
+	env.app.registry, err = storage.NewRegistry(env.ctx, env.app.driver, storage.EnableSchema1, storage.Schema1SigningKey(env.app.trustKey))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	imageName, _ := reference.WithName("foo/resigned")
+	repository, err := env.app.registry.Repository(env.ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+	layer, err := repository.Blobs(env.ctx).Put(env.ctx, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatalf("unexpected error putting layer: %v", err)
+	}
+	signedManifest, err := schema1.Sign(&schema1.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 1,
+		},
+		Name:     imageName.Name(),
+		Tag:      "latest",
+		FSLayers: []schema1.FSLayer{{BlobSum: layer.Digest}},
+		History:  []schema1.History{{V1Compatibility: `{"id":"1","architecture":"amd64","os":"linux"}`}},
+	}, env.pk)
+	if err != nil {
+		t.Fatalf("error signing manifest: %v", err)
+	}
+	dgst := digest.FromBytes(signedManifest.Canonical)
+
+	// the digest a client pins is that of the unsigned payload, in any
+	// algorithm
+	digestRef, _ := reference.WithDigest(imageName, digest.SHA512.FromBytes(signedManifest.Canonical))
+	digestURL, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+	resp := putManifest(t, "putting schema1 manifest by sha512 digest", digestURL, schema1.MediaTypeSignedManifest, signedManifest)
+	defer resp.Body.Close()
+	checkResponse(t, "putting schema1 manifest by sha512 digest", resp, http.StatusCreated)
+
+	digestRef, _ = reference.WithDigest(imageName, dgst)
+	digestURL, err = env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+
+	var bodies [][]byte
+	for i := 0; i < 2; i++ {
+		key, err := libtrust.GenerateECP256PrivateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		env.app.registry, err = storage.NewRegistry(env.ctx, env.app.driver, storage.EnableSchema1, storage.Schema1SigningKey(key))
+		if err != nil {
+			t.Fatalf("error creating registry: %v", err)
+		}
+
+		resp, err := http.Get(digestURL)
+		checkErr(t, err, "fetching re-signed manifest")
+		defer resp.Body.Close()
+		checkResponse(t, "fetching re-signed manifest", resp, http.StatusOK)
+		checkHeaders(t, resp, http.Header{
+			"Docker-Content-Digest": []string{dgst.String()},
+		})
+
+		body, err := ioutil.ReadAll(resp.Body)
+		checkErr(t, err, "reading re-signed manifest")
+		var fetched schema1.SignedManifest
+		if err := fetched.UnmarshalJSON(body); err != nil {
+			t.Fatalf("error unmarshaling re-signed manifest: %v", err)
+		}
+		if digest.FromBytes(fetched.Canonical) != dgst {
+			t.Fatalf("unexpected digest of re-signed manifest: %s != %s", digest.FromBytes(fetched.Canonical), dgst)
+		}
+		bodies = append(bodies, body)
+	}
+	if bytes.Equal(bodies[0], bodies[1]) {
+		t.Fatalf("expected manifests signed by different keys to differ")
+	}
+}
+
+func TestManifestGetSchema1Converted(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.Schema1.Enabled = true
+	config.Compatibility.Schema1.ConvertOnPull = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/converted")
+	repository, err := env.app.registry.Repository(env.ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repository: %v", err)
+	}
+
+	layer, err := repository.Blobs(env.ctx).Put(env.ctx, schema2.MediaTypeLayer, []byte("layer"))
+	if err != nil {
+		t.Fatalf("unexpected error putting layer: %v", err)
+	}
+	signedManifest, err := schema1.Sign(&schema1.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 1,
+		},
+		Name:     imageName.Name(),
+		Tag:      "latest",
+		FSLayers: []schema1.FSLayer{{BlobSum: layer.Digest}},
+		History:  []schema1.History{{V1Compatibility: `{"id":"1","architecture":"amd64","os":"linux"}`}},
+	}, env.pk)
+	if err != nil {
+		t.Fatalf("error signing manifest: %v", err)
+	}
+
+	manifests, err := repository.Manifests(env.ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting manifest service: %v", err)
+	}
+	dgst, err := manifests.Put(env.ctx, signedManifest)
+	if err != nil {
+		t.Fatalf("unexpected error putting manifest: %v", err)
+	}
+	if err := repository.Tags(env.ctx).Tag(env.ctx, "latest", distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+
+	tagRef, _ := reference.WithTag(imageName, "latest")
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest url: %v", err)
+	}
+
+	// clients that don't accept schema2 get the stored manifest
+	resp, err := http.Get(manifestURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching schema1 manifest", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type":          []string{schema1.MediaTypeSignedManifest},
+		"Docker-Content-Digest": []string{dgst.String()},
+	})
+
+	req, err := http.NewRequest("GET", manifestURL, nil)
+	if err != nil {
+		t.Fatalf("error constructing request: %s", err)
+	}
+	req.Header.Set("Accept", schema2.MediaTypeManifest)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching converted manifest", resp, http.StatusOK)
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error reading body: %v", err)
+	}
+	convertedDigest := digest.FromBytes(body)
+	checkHeaders(t, resp, http.Header{
+		"Content-Type":          []string{schema2.MediaTypeManifest},
+		"Docker-Content-Digest": []string{convertedDigest.String()},
+	})
+
+	var converted schema2.Manifest
+	if err := json.Unmarshal(body, &converted); err != nil {
+		t.Fatalf("unexpected error decoding converted manifest: %v", err)
+	}
+	if len(converted.Layers) != 1 || converted.Layers[0].Digest != layer.Digest {
+		t.Fatalf("unexpected converted layers: %v", converted.Layers)
+	}
+
+	// the converted manifest and its configuration can be fetched by digest
+	convertedRef, _ := reference.WithDigest(imageName, convertedDigest)
+	convertedURL, err := env.builder.BuildManifestURL(convertedRef)
+	if err != nil {
+		t.Fatalf("unexpected error building manifest url: %v", err)
+	}
+	req, err = http.NewRequest("GET", convertedURL, nil)
+	if err != nil {
+		t.Fatalf("error constructing request: %s", err)
+	}
+	req.Header.Set("Accept", schema2.MediaTypeManifest)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error fetching manifest: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching converted manifest by digest", resp, http.StatusOK)
+
+	configRef, _ := reference.WithDigest(imageName, converted.Config.Digest)
+	configURL, err := env.builder.BuildBlobURL(configRef)
+	if err != nil {
+		t.Fatalf("unexpected error building blob url: %v", err)
+	}
+	resp, err = http.Get(configURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching config: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching converted config", resp, http.StatusOK)
+}
+
+func TestBlobUploadConcurrencyLimit(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+			"uploads": configuration.Parameters{"maxconcurrentperrepository": 1},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/uploadlimit")
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+
+	layerUploadURL, err := env.builder.BuildBlobUploadURL(imageName)
+	if err != nil {
+		t.Fatalf("unexpected error building layer upload url: %v", err)
+	}
+	resp, err := http.Post(layerUploadURL, "", nil)
+	if err != nil {
+		t.Fatalf("unexpected error starting layer push: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "starting upload over the limit", resp, http.StatusTooManyRequests)
+	checkBodyHasErrorCodes(t, "starting upload over the limit", resp, errcode.ErrorCodeTooManyRequests)
+	checkHeaders(t, resp, http.Header{
+		"Retry-After": []string{"10"},
+	})
+
+	// cancelling the upload in progress frees its slot
+	req, err := http.NewRequest("DELETE", uploadURLBase, nil)
+	if err != nil {
+		t.Fatalf("unexpected error creating delete request: %v", err)
+	}
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("unexpected error cancelling upload: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "cancelling upload", resp, http.StatusNoContent)
+
+	startPushLayer(t, env, imageName)
+}
+
+func TestBlobUploadQuota(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+			"quota": configuration.Parameters{
+				"default": 100,
+				"repositories": map[interface{}]interface{}{
+					"foo/large": 1000,
+				},
+			},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	for name, expected := range map[string]int{
+		"foo/small": http.StatusRequestEntityTooLarge,
+		"foo/large": http.StatusCreated,
+	} {
+		imageName, _ := reference.WithName(name)
+		for i, fill := range []string{"a", "b"} {
+			content := bytes.Repeat([]byte(fill), 60)
+			uploadURLBase, _ := startPushLayer(t, env, imageName)
+			resp, err := doPushLayer(t, env.builder, imageName, digest.FromBytes(content), uploadURLBase, bytes.NewReader(content))
+			if err != nil {
+				t.Fatalf("unexpected error pushing layer: %v", err)
+			}
+			defer resp.Body.Close()
+			if i == 0 {
+				checkResponse(t, "pushing layer within quota to "+name, resp, http.StatusCreated)
+				continue
+			}
+			checkResponse(t, "pushing second layer to "+name, resp, expected)
+			if expected != http.StatusCreated {
+				checkBodyHasErrorCodes(t, "pushing second layer to "+name, resp, v2.ErrorCodeQuotaExceeded)
+			}
+		}
+	}
+}
+
+func TestBlobUploadStaging(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+			"uploads": configuration.Parameters{"staging": map[interface{}]interface{}{
+				"inmemory": nil,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/staged")
+	content := []byte("staged layer")
+	dgst := digest.FromBytes(content)
+	uploadURLBase, _ := startPushLayer(t, env, imageName)
+	uploadURLBase, _ = pushChunk(t, env.builder, imageName, uploadURLBase, bytes.NewReader(content), int64(len(content)))
+
+	// the upload in progress is kept off the storage of the registry
+	if _, err := env.app.driver.List(env.ctx, "/docker/registry/v2/repositories/foo/staged/_uploads"); err == nil {
+		t.Fatalf("expected no uploads in the storage of the registry")
+	} else if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		t.Fatalf("unexpected error listing uploads: %v", err)
+	}
+
+	finishUpload(t, env.builder, imageName, uploadURLBase, dgst)
+	if _, err := env.app.driver.Stat(env.ctx, "/docker/registry/v2/blobs/sha256/"+dgst.Hex()[:2]+"/"+dgst.Hex()+"/data"); err != nil {
+		t.Fatalf("expected the committed blob in the storage of the registry: %v", err)
+	}
+}
+
+func TestBlobAutoMountFromGlobal(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+			"automount": configuration.Parameters{"enabled": true},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	source, _ := reference.WithName("foo/source")
+	content := []byte("shared base layer")
+	dgst := digest.FromBytes(content)
+	uploadURLBase, _ := startPushLayer(t, env, source)
+	pushLayer(t, env.builder, source, dgst, uploadURLBase, bytes.NewReader(content))
+
+	target, _ := reference.WithName("foo/target")
+	ref, _ := reference.WithDigest(target, dgst)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building blob url: %v", err)
+	}
+
+	// pulls don't link blobs
+	resp, err := http.Get(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching blob: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching blob of another repository", resp, http.StatusNotFound)
+
+	// neither do checks of clients which may not push
+	env.app.accessController = pullOnlyController{}
+	resp, err = http.Head(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error checking blob: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "checking blob of another repository without push access", resp, http.StatusNotFound)
+
+	env.app.accessController = nil
+	resp, err = http.Head(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error checking blob: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "checking blob of another repository", resp, http.StatusOK)
+	checkHeaders(t, resp, http.Header{
+		"Content-Length":        []string{fmt.Sprint(len(content))},
+		"Docker-Content-Digest": []string{dgst.String()},
+	})
+
+	resp, err = http.Get(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching blob: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching mounted blob", resp, http.StatusOK)
+}
+
+// pullOnlyController grants pull access to every repository, and nothing
+// else.
+type pullOnlyController struct{}
+
+func (pullOnlyController) Authorized(ctx context.Context, access ...auth.Access) (context.Context, error) {
+	for _, a := range access {
+		if a.Action != "pull" {
+			return nil, fmt.Errorf("access denied: %v", a)
+		}
+	}
+	return ctx, nil
+}
+
+func TestBlobUploadChunkOffsets(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/chunks")
+	location, _ := startPushLayer(t, env, imageName)
+
+	patch := func(contentRange, body string) *http.Response {
+		req, err := http.NewRequest("PATCH", location, strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		req.Header.Set("Content-Type", "application/octet-stream")
+		req.Header.Set("Content-Range", contentRange)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error pushing chunk: %v", err)
+		}
+		location = resp.Header.Get("Location")
+		return resp
+	}
+
+	for _, chunk := range []struct {
+		contentRange string
+		body         string
+		status       int
+		uploaded     string
+	}{
+		{contentRange: "0-4", body: "hello", status: http.StatusAccepted, uploaded: "0-4"},
+		{contentRange: "5-10", body: " chunk", status: http.StatusAccepted, uploaded: "0-10"},
+		// overlapping the uploaded content
+		{contentRange: "8-13", body: "unk ok", status: http.StatusRequestedRangeNotSatisfiable, uploaded: "0-10"},
+		// leaving a gap after it
+		{contentRange: "12-17", body: "chunks", status: http.StatusRequestedRangeNotSatisfiable, uploaded: "0-10"},
+		{contentRange: "11-12", body: "s!", status: http.StatusAccepted, uploaded: "0-12"},
+		// not matching the length of the chunk
+		{contentRange: "13-20", body: "!", status: http.StatusRequestedRangeNotSatisfiable, uploaded: "0-12"},
+		{contentRange: "invalid", body: "!", status: http.StatusRequestedRangeNotSatisfiable, uploaded: "0-12"},
+	} {
+		resp := patch(chunk.contentRange, chunk.body)
+		defer resp.Body.Close()
+		checkResponse(t, "pushing chunk "+chunk.contentRange, resp, chunk.status)
+		checkHeaders(t, resp, http.Header{
+			"Range": []string{chunk.uploaded},
+		})
+	}
+
+	content := "hello chunks!"
+	dgst := digest.FromString(content)
+	finishUpload(t, env.builder, imageName, location, dgst)
+
+	ref, _ := reference.WithDigest(imageName, dgst)
+	blobURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("unexpected error building blob url: %v", err)
+	}
+	resp, err := http.Get(blobURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching blob: %v", err)
+	}
+	defer resp.Body.Close()
+	checkResponse(t, "fetching chunked blob", resp, http.StatusOK)
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("unexpected error reading blob: %v", err)
+	}
+	if string(body) != content {
+		t.Fatalf("unexpected blob content: %q != %q", body, content)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver":  configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{"enabled": false}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.HTTP.RateLimit.RequestsPerSecond = 0.01
+	config.HTTP.RateLimit.Burst = 2
+
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	baseURL, err := env.builder.BuildBaseURL()
+	if err != nil {
+		t.Fatalf("unexpected error building base url: %v", err)
+	}
+	get := func(client string) *http.Response {
+		req, err := http.NewRequest("GET", baseURL, nil)
+		if err != nil {
+			t.Fatalf("unexpected error creating request: %v", err)
+		}
+		req.Header.Set("X-Forwarded-For", client)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("unexpected error issuing request: %v", err)
+		}
+		return resp
+	}
+
+	for i := 0; i < 2; i++ {
+		resp := get("192.0.2.1")
+		defer resp.Body.Close()
+		checkResponse(t, "request within burst", resp, http.StatusOK)
+	}
+	resp := get("192.0.2.1")
+	defer resp.Body.Close()
+	checkResponse(t, "request over rate limit", resp, http.StatusTooManyRequests)
+	checkBodyHasErrorCodes(t, "request over rate limit", resp, errcode.ErrorCodeTooManyRequests)
+	checkHeaders(t, resp, http.Header{
+		"Retry-After": []string{"100"},
+	})
+
+	// forwarding headers of clients which are not trusted proxies are
+	// ignored
+	resp = get("192.0.2.2")
+	defer resp.Body.Close()
+	checkResponse(t, "request with a spoofed X-Forwarded-For", resp, http.StatusTooManyRequests)
+
+	// clients behind a trusted proxy are limited separately
+	config.HTTP.RateLimit.TrustedProxies = []string{"127.0.0.0/8", "::1"}
+	proxied := newTestEnvWithConfig(t, &config)
+	defer proxied.Shutdown()
+	baseURL, err = proxied.builder.BuildBaseURL()
+	if err != nil {
+		t.Fatalf("unexpected error building base url: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		resp := get("192.0.2.1")
+		defer resp.Body.Close()
+		checkResponse(t, "proxied request within burst", resp, http.StatusOK)
+	}
+	resp = get("192.0.2.1")
+	defer resp.Body.Close()
+	checkResponse(t, "proxied request over rate limit", resp, http.StatusTooManyRequests)
+	resp = get("203.0.113.1, 192.0.2.1")
+	defer resp.Body.Close()
+	checkResponse(t, "proxied request with a spoofed X-Forwarded-For", resp, http.StatusTooManyRequests)
+	resp = get("192.0.2.2")
+	defer resp.Body.Close()
+	checkResponse(t, "proxied request of another client", resp, http.StatusOK)
+
+	// buckets refill over time
+	store := newMemoryRateLimitStore()
+	now := time.Now()
+	if wait, _ := store.take("client", 1, 1, now); wait != 0 {
+		t.Fatalf("expected a token, waiting %s", wait)
+	}
+	if wait, _ := store.take("client", 1, 1, now.Add(500*time.Millisecond)); wait != 500*time.Millisecond {
+		t.Fatalf("expected to wait 500ms, waiting %s", wait)
+	}
+	if wait, _ := store.take("client", 1, 1, now.Add(time.Second)); wait != 0 {
+		t.Fatalf("expected a token after refilling, waiting %s", wait)
+	}
+}
+
 func checkLink(t *testing.T, urlStr string, numEntries int, last string) url.Values {
 	re := regexp.MustCompile("<(/v2/_catalog.*)>; rel=\"next\"")
 	matches := re.FindStringSubmatch(urlStr)
@@ -387,6 +2405,42 @@ func TestRelativeURL(t *testing.T) {
 	}
 }
 
+func TestBlobNotFoundResponse(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": configuration.Parameters{},
+			"maintenance": configuration.Parameters{"uploadpurging": map[interface{}]interface{}{
+				"enabled": false,
+			}},
+		},
+	}
+	config.HTTP.Headers = headerConfig
+	config.Compatibility.BlobNotFound.Bare = true
+	config.Compatibility.BlobNotFound.IncludeDigest = true
+	env := newTestEnvWithConfig(t, &config)
+	defer env.Shutdown()
+
+	imageName, _ := reference.WithName("foo/bar")
+	dgst := digest.FromString("missing")
+	ref, _ := reference.WithDigest(imageName, dgst)
+	layerURL, err := env.builder.BuildBlobURL(ref)
+	if err != nil {
+		t.Fatalf("error building blob URL: %v", err)
+	}
+
+	resp, err := http.Get(layerURL)
+	if err != nil {
+		t.Fatalf("unexpected error fetching missing layer: %v", err)
+	}
+	defer resp.Body.Close()
+
+	checkResponse(t, "fetching missing layer", resp, http.StatusNotFound)
+	checkHeaders(t, resp, http.Header{
+		"Content-Length":        []string{"0"},
+		"Docker-Content-Digest": []string{dgst.String()},
+	})
+}
+
 func TestBlobDeleteDisabled(t *testing.T) {
 	deleteEnabled := false
 	env := newTestEnv(t, deleteEnabled)
@@ -485,7 +2539,16 @@ func testBlobAPI(t *testing.T, env *testEnv, args blobArgs) *testEnv {
 	}
 
 	checkResponse(t, "bad layer push", resp, http.StatusBadRequest)
-	checkBodyHasErrorCodes(t, "bad layer push", resp, v2.ErrorCodeDigestInvalid)
+	errs, _, _ := checkBodyHasErrorCodes(t, "bad layer push", resp, v2.ErrorCodeDigestInvalid, v2.ErrorCodeBlobUploadInvalid)
+	for _, e := range errs {
+		if e.(errcode.Error).Code != v2.ErrorCodeBlobUploadInvalid {
+			continue
+		}
+		detail, _ := e.(errcode.Error).Detail.(map[string]interface{})
+		if detail["expected"] != layerDigest.String() || detail["computed"] != digest.FromBytes(nil).String() || detail["size"] != float64(0) {
+			t.Fatalf("unexpected digest mismatch detail: %#v", e)
+		}
+	}
 
 	// -----------------------------------------
 	// Do layer push with an empty body and correct digest
@@ -588,7 +2651,7 @@ func testBlobAPI(t *testing.T, env *testEnv, args blobArgs) *testEnv {
 		"Content-Length":        []string{fmt.Sprint(layerLength)},
 		"Docker-Content-Digest": []string{canonicalDigest.String()},
 		"ETag":                  []string{fmt.Sprintf(`"%s"`, canonicalDigest)},
-		"Cache-Control":         []string{"max-age=31536000"},
+		"Cache-Control":         []string{"public, immutable, max-age=31536000"},
 	})
 
 	// Matching etag, gives 304
@@ -615,6 +2678,22 @@ func testBlobAPI(t *testing.T, env *testEnv, args blobArgs) *testEnv {
 	resp, _ = http.DefaultClient.Do(req)
 	checkResponse(t, "fetching layer with invalid etag", resp, http.StatusOK)
 
+	// Unchanged since Last-Modified, gives 304
+	lastModified := resp.Header.Get("Last-Modified")
+	if lastModified == "" {
+		t.Fatalf("missing Last-Modified header fetching layer")
+	}
+	req, err = http.NewRequest("GET", layerURL, nil)
+	if err != nil {
+		t.Fatalf("Error constructing request: %s", err)
+	}
+	req.Header.Set("If-Modified-Since", lastModified)
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error constructing request: %s", err)
+	}
+	checkResponse(t, "fetching layer unmodified since", resp, http.StatusNotModified)
+
 	// Missing tests:
 	// 	- Upload the same tar file under and different repository and
 	//       ensure the content remains uncorrupted.
@@ -726,6 +2805,10 @@ func TestDeleteDisabled(t *testing.T) {
 	}
 
 	checkResponse(t, "deleting layer with delete disabled", resp, http.StatusMethodNotAllowed)
+	errs, _, _ := checkBodyHasErrorCodes(t, "deleting layer with delete disabled", resp, errcode.ErrorCodeUnsupported)
+	if detail := errs[0].(errcode.Error).Detail; detail != distribution.ErrDeleteDisabled.Error() {
+		t.Fatalf("expected detail %q deleting layer with delete disabled, got %v", distribution.ErrDeleteDisabled.Error(), detail)
+	}
 }
 
 func TestDeleteReadOnly(t *testing.T) {
@@ -878,6 +2961,10 @@ func (dr *mockErrorDriver) GetContent(ctx context.Context, path string) ([]byte,
 	return nil, errors.New("Unknown storage error")
 }
 
+func (dr *mockErrorDriver) Capabilities() storagedriver.Capabilities {
+	return storagedriver.Capabilities{}
+}
+
 func TestGetManifestWithStorageError(t *testing.T) {
 	factory.Register("storagemanifesterror", &storageManifestErrDriverFactory{})
 	config := configuration.Configuration{
@@ -905,6 +2992,25 @@ func TestGetManifestWithStorageError(t *testing.T) {
 	testManifestWithStorageError(t, env1, repo, http.StatusInternalServerError, errcode.ErrorCodeUnknown)
 }
 
+func TestManifestGetInvalidDigest(t *testing.T) {
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+
+	for ref, code := range map[string]errcode.ErrorCode{
+		"md5:" + strings.Repeat("a", 32):    v2.ErrorCodeDigestUnsupported,
+		"sha256:" + strings.Repeat("a", 40): v2.ErrorCodeDigestInvalid,
+	} {
+		resp, err := http.Get(env.server.URL + "/v2/foo/bar/manifests/" + ref)
+		if err != nil {
+			t.Fatalf("unexpected error fetching manifest: %v", err)
+		}
+		defer resp.Body.Close()
+
+		checkResponse(t, "fetching manifest with invalid digest "+ref, resp, http.StatusBadRequest)
+		checkBodyHasErrorCodes(t, "fetching manifest with invalid digest "+ref, resp, code)
+	}
+}
+
 func TestManifestDelete(t *testing.T) {
 	schema1Repo, _ := reference.WithName("foo/schema1")
 	schema2Repo, _ := reference.WithName("foo/schema2")
@@ -942,6 +3048,141 @@ func testManifestDeleteDisabled(t *testing.T, env *testEnv, imageName reference.
 	checkResponse(t, "status of disabled delete of manifest", resp, http.StatusMethodNotAllowed)
 }
 
+func TestTagDelete(t *testing.T) {
+	imageName, _ := reference.WithName("foo/schema2")
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+	args := testManifestAPISchema2(t, env, imageName)
+
+	otherRef, _ := reference.WithTag(imageName, "other")
+	otherURL, err := env.builder.BuildManifestURL(otherRef)
+	checkErr(t, err, "building manifest url")
+	resp := putManifest(t, "putting manifest under a second tag", otherURL, args.mediaType, args.manifest)
+	checkResponse(t, "putting manifest under a second tag", resp, http.StatusCreated)
+
+	tagRef, _ := reference.WithTag(imageName, "schema2tag")
+	tagURL, err := env.builder.BuildTagURL(tagRef)
+	checkErr(t, err, "building tag url")
+
+	resp, err = httpDelete(tagURL)
+	checkErr(t, err, "deleting tag")
+	checkResponse(t, "deleting tag", resp, http.StatusAccepted)
+
+	manifestURL, err := env.builder.BuildManifestURL(tagRef)
+	checkErr(t, err, "building manifest url")
+	resp, err = http.Get(manifestURL)
+	checkErr(t, err, "fetching deleted tag")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching deleted tag", resp, http.StatusNotFound)
+
+	digestRef, _ := reference.WithDigest(imageName, args.dgst)
+	digestURL, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+	resp, err = http.Get(digestURL)
+	checkErr(t, err, "fetching manifest by digest")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching manifest by digest", resp, http.StatusOK)
+
+	tagsURL, err := env.builder.BuildTagsURL(imageName)
+	checkErr(t, err, "building tags url")
+	resp, err = http.Get(tagsURL)
+	checkErr(t, err, "fetching tags")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching tags", resp, http.StatusOK)
+
+	var tagsResponse tagsAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tagsResponse); err != nil {
+		t.Fatalf("unexpected error decoding tags response: %v", err)
+	}
+	if !reflect.DeepEqual(tagsResponse.Tags, []string{"other"}) {
+		t.Fatalf("unexpected tags after delete: %v", tagsResponse.Tags)
+	}
+
+	resp, err = httpDelete(tagURL)
+	checkErr(t, err, "deleting tag again")
+	checkResponse(t, "deleting tag again", resp, http.StatusNotFound)
+	checkBodyHasErrorCodes(t, "deleting tag again", resp, v2.ErrorCodeManifestUnknown)
+}
+
+func TestTagDeleteDisabled(t *testing.T) {
+	imageName, _ := reference.WithName("foo/schema2")
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+	testManifestAPISchema2(t, env, imageName)
+
+	tagRef, _ := reference.WithTag(imageName, "schema2tag")
+	tagURL, err := env.builder.BuildTagURL(tagRef)
+	checkErr(t, err, "building tag url")
+
+	resp, err := httpDelete(tagURL)
+	checkErr(t, err, "deleting tag")
+	defer resp.Body.Close()
+	checkResponse(t, "status of disabled delete of tag", resp, http.StatusMethodNotAllowed)
+}
+
+func TestTagDeleteProtectLastTag(t *testing.T) {
+	imageName, _ := reference.WithName("foo/schema2")
+	env := newTestEnv(t, true)
+	defer env.Shutdown()
+	args := testManifestAPISchema2(t, env, imageName)
+
+	var err error
+	env.app.registry, err = storage.NewRegistry(env.ctx, env.app.driver, storage.EnableDelete, storage.ProtectLastTag)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	tagRef, _ := reference.WithTag(imageName, "schema2tag")
+	tagURL, err := env.builder.BuildTagURL(tagRef)
+	checkErr(t, err, "building tag url")
+
+	resp, err := httpDelete(tagURL)
+	checkErr(t, err, "deleting last tag")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting last tag", resp, http.StatusConflict)
+	checkBodyHasErrorCodes(t, "deleting last tag", resp, v2.ErrorCodeLastTagProtected)
+
+	digestRef, _ := reference.WithDigest(imageName, args.dgst)
+	digestURL, err := env.builder.BuildManifestURL(digestRef)
+	checkErr(t, err, "building manifest url")
+	resp, err = httpDelete(digestURL)
+	checkErr(t, err, "deleting last tagged manifest")
+	defer resp.Body.Close()
+	checkResponse(t, "deleting last tagged manifest", resp, http.StatusConflict)
+	checkBodyHasErrorCodes(t, "deleting last tagged manifest", resp, v2.ErrorCodeLastTagProtected)
+
+	resp, err = httpDelete(tagURL + "?force=true")
+	checkErr(t, err, "forcing delete of last tag")
+	defer resp.Body.Close()
+	checkResponse(t, "forcing delete of last tag", resp, http.StatusAccepted)
+}
+
+func TestTagsAPIDetail(t *testing.T) {
+	imageName, _ := reference.WithName("foo/schema2")
+	env := newTestEnv(t, false)
+	defer env.Shutdown()
+	args := testManifestAPISchema2(t, env, imageName)
+
+	tagsURL, err := env.builder.BuildTagsURL(imageName)
+	checkErr(t, err, "building tags url")
+	resp, err := http.Get(tagsURL + "?detail=true")
+	checkErr(t, err, "fetching tags detail")
+	defer resp.Body.Close()
+	checkResponse(t, "fetching tags detail", resp, http.StatusOK)
+
+	var tagsResponse tagsDetailAPIResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tagsResponse); err != nil {
+		t.Fatalf("unexpected error decoding tags detail response: %v", err)
+	}
+	if tagsResponse.Name != imageName.Name() || len(tagsResponse.Tags) != 1 {
+		t.Fatalf("unexpected tags detail response: %+v", tagsResponse)
+	}
+	tag := tagsResponse.Tags[0]
+	if tag.Name != "schema2tag" || tag.Digest != args.dgst || tag.ModTime.IsZero() {
+		t.Fatalf("unexpected tag detail: %+v", tag)
+	}
+}
+
 func testManifestWithStorageError(t *testing.T, env *testEnv, imageName reference.Named, expectedStatusCode int, expectedErrorCode errcode.ErrorCode) {
 	tag := "latest"
 	tagRef, _ := reference.WithTag(imageName, tag)
@@ -2094,6 +4335,12 @@ func putManifest(t *testing.T, msg, url, contentType string, v interface{}) *htt
 			t.Fatalf("error getting payload: %v", err)
 		}
 		body = pl
+	case *ocischema.DeserializedManifest:
+		_, pl, err := m.Payload()
+		if err != nil {
+			t.Fatalf("error getting payload: %v", err)
+		}
+		body = pl
 	default:
 		var err error
 		body, err = json.MarshalIndent(v, "", "   ")
@@ -40,6 +40,7 @@ import (
 	"github.com/docker/libtrust"
 	"github.com/garyburd/redigo/redis"
 	"github.com/gorilla/mux"
+	"github.com/opencontainers/go-digest"
 	"github.com/sirupsen/logrus"
 )
 
@@ -50,6 +51,10 @@ const randomSecretSize = 32
 // defaultCheckInterval is the default time in between health checks
 const defaultCheckInterval = 10 * time.Second
 
+// defaultManifestAdmissionTimeout is the default time to wait for the
+// manifest admission webhook to answer
+const defaultManifestAdmissionTimeout = 5 * time.Second
+
 // App is a global registry application object. Shared resources can be placed
 // on this object that will be accessible from all requests. Any writable
 // fields should be protected.
@@ -76,6 +81,9 @@ type App struct {
 
 	redis *redis.Pool
 
+	// rateLimiter limits the rate of requests of each client, if configured
+	rateLimiter *rateLimiter
+
 	// trustKey is a deprecated key used to sign manifests converted to
 	// schema1 for backward compatibility. It should not be used for any
 	// other purposes.
@@ -86,15 +94,30 @@ type App struct {
 
 	// readOnly is true if the registry is in a read-only maintenance mode
 	readOnly bool
+
+	// deleteEnabled is true if content may be deleted through the API
+	deleteEnabled bool
+
+	// autoMountFromGlobal is true if blobs of the registry are linked into
+	// the repositories pushers check for them
+	autoMountFromGlobal bool
+
+	// modTimes caches the push times estimated for the catalog details
+	modTimes modTimeCache
+
+	// cancel stops the background work started with the app context
+	cancel context.CancelFunc
 }
 
 // NewApp takes a configuration and returns a configured app, ready to serve
 // requests. The app only implements ServeHTTP and can be wrapped in other
 // handlers accordingly.
 func NewApp(ctx context.Context, config *configuration.Configuration) *App {
+	ctx, cancel := context.WithCancel(ctx)
 	app := &App{
 		Config:  config,
 		Context: ctx,
+		cancel:  cancel,
 		router:  v2.RouterWithPrefix(config.HTTP.Prefix),
 		isCache: config.Proxy.RemoteURL != "",
 	}
@@ -103,12 +126,26 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	app.register(v2.RouteNameBase, func(ctx *Context, r *http.Request) http.Handler {
 		return http.HandlerFunc(apiBase)
 	})
-	app.register(v2.RouteNameManifest, manifestDispatcher)
-	app.register(v2.RouteNameCatalog, catalogDispatcher)
+	app.register(v2.RouteNameManifest, gzipDispatcher(manifestDispatcher))
+	app.register(v2.RouteNameManifestsBulkDelete, bulkDeleteDispatcher)
+	app.register(v2.RouteNameManifestRestore, restoreDispatcher)
+	app.register(v2.RouteNameCatalog, gzipDispatcher(catalogDispatcher))
 	app.register(v2.RouteNameTags, tagsDispatcher)
+	app.register(v2.RouteNameTag, tagDispatcher)
 	app.register(v2.RouteNameBlob, blobDispatcher)
 	app.register(v2.RouteNameBlobUpload, blobUploadDispatcher)
 	app.register(v2.RouteNameBlobUploadChunk, blobUploadDispatcher)
+	app.register(v2.RouteNameDiffIDs, diffIDsDispatcher)
+	app.register(v2.RouteNameUsage, usageDispatcher)
+	app.register(v2.RouteNameSummary, summaryDispatcher)
+	app.register(v2.RouteNameVerify, verifyDispatcher)
+	app.register(v2.RouteNameOrphans, orphansDispatcher)
+	app.register(v2.RouteNameRepositoryMove, moveDispatcher)
+	app.register(v2.RouteNameDedupStats, dedupStatsDispatcher)
+	app.register(v2.RouteNameReferrers, referrersDispatcher)
+	app.register(v2.RouteNameRepositoryCache, cacheDispatcher)
+	app.register(v2.RouteNameCache, cacheDispatcher)
+	app.register(v2.RouteNameWhereIs, whereIsDispatcher)
 
 	// override the storage driver's UA string for registry outbound HTTP requests
 	storageParams := config.Storage.Parameters()
@@ -127,7 +164,14 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	}
 
 	purgeConfig := uploadPurgeDefaultConfig()
+	var gcConfig map[interface{}]interface{}
 	if mc, ok := config.Storage["maintenance"]; ok {
+		if v, ok := mc["gc"]; ok {
+			gcConfig, ok = v.(map[interface{}]interface{})
+			if !ok {
+				panic("gc config key must contain additional keys")
+			}
+		}
 		if v, ok := mc["uploadpurging"]; ok {
 			purgeConfig, ok = v.(map[interface{}]interface{})
 			if !ok {
@@ -158,6 +202,7 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 	app.configureSecret(config)
 	app.configureEvents(config)
 	app.configureRedis(config)
+	app.configureRateLimit(config)
 	app.configureLogHook(config)
 
 	options := registrymiddleware.GetRegistryOptions()
@@ -177,10 +222,30 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 
 	options = append(options, storage.Schema1SigningKey(app.trustKey))
 
+	if len(config.Compatibility.Schema1.TrustedKeys) > 0 {
+		trustedKeys := make([]libtrust.PublicKey, 0, len(config.Compatibility.Schema1.TrustedKeys))
+		for _, filename := range config.Compatibility.Schema1.TrustedKeys {
+			key, err := libtrust.LoadPublicKeyFile(filename)
+			if err != nil {
+				panic(fmt.Sprintf(`could not load schema1 "trustedkeyfiles" parameter: %v`, err))
+			}
+			trustedKeys = append(trustedKeys, key)
+		}
+		options = append(options, storage.Schema1TrustedKeys(trustedKeys))
+	}
+
 	if config.Compatibility.Schema1.Enabled {
 		options = append(options, storage.EnableSchema1)
 	}
 
+	if config.Compatibility.Schema1.RejectOnPull {
+		options = append(options, storage.RejectSchema1OnPull)
+	}
+
+	if config.Compatibility.Schema1.ConvertOnPull {
+		options = append(options, storage.EnableSchema1Conversion)
+	}
+
 	if config.HTTP.Host != "" {
 		u, err := url.Parse(config.HTTP.Host)
 		if err != nil {
@@ -199,12 +264,142 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		if ok {
 			if deleteEnabled, ok := e.(bool); ok && deleteEnabled {
 				options = append(options, storage.EnableDelete)
+				app.deleteEnabled = true
+			}
+		}
+		c, ok := d["checkreferences"]
+		if ok {
+			if checkReferences, ok := c.(bool); ok && checkReferences {
+				options = append(options, storage.EnableDeleteReferenceCheck)
+			}
+		}
+		p, ok := d["protectlasttag"]
+		if ok {
+			if protectLastTag, ok := p.(bool); ok && protectLastTag {
+				options = append(options, storage.ProtectLastTag)
+			}
+		}
+	}
+
+	// configure immutable tags
+	if t, ok := config.Storage["tags"]; ok {
+		if i, ok := t["immutable"]; ok {
+			s, ok := i.(string)
+			if !ok {
+				panic(fmt.Sprintf("invalid type for storage.tags.immutable: %#v", i))
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				panic(fmt.Sprintf("storage.tags.immutable: %s", err))
+			}
+			options = append(options, storage.ImmutableTagsRegexp(re))
+		}
+	}
+
+	// configure blob uploads
+	if u, ok := config.Storage["uploads"]; ok {
+		if d, ok := u["resumabledigestdeny"]; ok {
+			s, ok := d.(string)
+			if !ok {
+				panic(fmt.Sprintf("invalid type for storage.uploads.resumabledigestdeny: %#v", d))
+			}
+			re, err := regexp.Compile(s)
+			if err != nil {
+				panic(fmt.Sprintf("storage.uploads.resumabledigestdeny: %s", err))
+			}
+			options = append(options, storage.ResumableDigestRepositoryDenyRegexp(re))
+		}
+		if m, ok := u["maxconcurrentperrepository"]; ok {
+			n, ok := m.(int)
+			if !ok {
+				panic(fmt.Sprintf("invalid type for storage.uploads.maxconcurrentperrepository: %#v", m))
+			}
+			options = append(options, storage.MaxConcurrentUploadsPerRepo(n))
+		}
+		if st, ok := u["staging"]; ok {
+			stagingDriver, err := createStagingDriver(st)
+			if err != nil {
+				panic(fmt.Sprintf("storage.uploads.staging: %v", err))
+			}
+			// uploads abandoned on the staging driver are purged from it
+			startUploadPurger(app, stagingDriver, dcontext.GetLogger(app), purgeConfig)
+			options = append(options, storage.UploadStagingDriver(stagingDriver))
+		}
+	}
+
+	// configure repository quotas
+	if q, ok := config.Storage["quota"]; ok {
+		option, err := repositoryQuotaOption(q)
+		if err != nil {
+			panic(err.Error())
+		}
+		options = append(options, option)
+	}
+
+	// configure scheduled garbage collection, which would fail to delete
+	// anything in read-only mode
+	if gcConfig["enabled"] == true {
+		if app.readOnly || app.isCache {
+			dcontext.GetLogger(app).Warnf("scheduled garbage collection is not run by read-only registries or pull through caches")
+		} else {
+			// report deletions to the notification endpoints
+			listener := notifications.NewGCBridge(app.events.source, app.events.sink)
+			options = append(options, gcScheduleOption(gcConfig, listener))
+		}
+	}
+
+	// configure push timestamps
+	if p, ok := config.Storage["pushtimestamps"]; ok {
+		e, ok := p["enabled"]
+		if ok {
+			if pushTimestampsEnabled, ok := e.(bool); ok && pushTimestampsEnabled {
+				options = append(options, storage.EnablePushTimestamps)
+			}
+		}
+	}
+
+	// configure blob media types
+	if m, ok := config.Storage["mediatypes"]; ok {
+		e, ok := m["enabled"]
+		if ok {
+			if mediaTypesEnabled, ok := e.(bool); ok && mediaTypesEnabled {
+				options = append(options, storage.RecordBlobMediaTypes)
 			}
 		}
 	}
 
+	// configure the digest algorithm of content written to the registry
+	if d, ok := config.Storage["digest"]; ok {
+		if a, ok := d["algorithm"]; ok {
+			algorithm, ok := a.(string)
+			if !ok {
+				panic(fmt.Sprintf("invalid type for digest.algorithm config: %#v", a))
+			}
+			options = append(options, storage.DefaultDigestAlgorithm(digest.Algorithm(algorithm)))
+		}
+	}
+
+	// configure mounting blobs of other repositories on HEAD
+	if m, ok := config.Storage["automount"]; ok {
+		e, ok := m["enabled"]
+		if ok {
+			if autoMountEnabled, ok := e.(bool); ok && autoMountEnabled {
+				options = append(options, storage.AutoMountFromGlobal)
+				app.autoMountFromGlobal = true
+			}
+		}
+	}
+
+	// configure how content is laid out in storage
+	sharedOptions, err := SharedStorageOptions(config)
+	if err != nil {
+		panic(err.Error())
+	}
+	options = append(options, sharedOptions...)
+
 	// configure redirects
-	var redirectDisabled bool
+	var redirectDisabled, redirectVerifyExistence bool
+	var redirectDenyUserAgent *regexp.Regexp
 	if redirectConfig, ok := config.Storage["redirect"]; ok {
 		v := redirectConfig["disable"]
 		switch v := v.(type) {
@@ -213,11 +408,36 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 		default:
 			panic(fmt.Sprintf("invalid type for redirect config: %#v", redirectConfig))
 		}
+
+		switch v := redirectConfig["verifyexistence"].(type) {
+		case bool:
+			redirectVerifyExistence = v
+		case nil:
+		default:
+			panic(fmt.Sprintf("invalid type for redirect.verifyexistence config: %#v", v))
+		}
+
+		switch v := redirectConfig["denyuseragent"].(type) {
+		case string:
+			redirectDenyUserAgent, err = regexp.Compile(v)
+			if err != nil {
+				panic(fmt.Sprintf("redirect.denyuseragent: %s", err))
+			}
+		case nil:
+		default:
+			panic(fmt.Sprintf("invalid type for redirect.denyuseragent config: %#v", v))
+		}
 	}
 	if redirectDisabled {
 		dcontext.GetLogger(app).Infof("backend redirection disabled")
 	} else {
 		options = append(options, storage.EnableRedirect)
+		if redirectVerifyExistence {
+			options = append(options, storage.RedirectVerifyExistence)
+		}
+		if redirectDenyUserAgent != nil {
+			options = append(options, storage.RedirectDenyUserAgentRegexp(redirectDenyUserAgent))
+		}
 	}
 
 	if !config.Validation.Enabled {
@@ -231,30 +451,48 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 			options = append(options, storage.ManifestURLsAllowRegexp(regexp.MustCompile("^$")))
 		} else {
 			if len(config.Validation.Manifests.URLs.Allow) > 0 {
-				for i, s := range config.Validation.Manifests.URLs.Allow {
-					// Validate via compilation.
-					if _, err := regexp.Compile(s); err != nil {
-						panic(fmt.Sprintf("validation.manifests.urls.allow: %s", err))
-					}
-					// Wrap with non-capturing group.
-					config.Validation.Manifests.URLs.Allow[i] = fmt.Sprintf("(?:%s)", s)
-				}
-				re := regexp.MustCompile(strings.Join(config.Validation.Manifests.URLs.Allow, "|"))
+				re := compileManifestURLs("validation.manifests.urls.allow", config.Validation.Manifests.URLs.Allow)
 				options = append(options, storage.ManifestURLsAllowRegexp(re))
 			}
 			if len(config.Validation.Manifests.URLs.Deny) > 0 {
-				for i, s := range config.Validation.Manifests.URLs.Deny {
-					// Validate via compilation.
-					if _, err := regexp.Compile(s); err != nil {
-						panic(fmt.Sprintf("validation.manifests.urls.deny: %s", err))
-					}
-					// Wrap with non-capturing group.
-					config.Validation.Manifests.URLs.Deny[i] = fmt.Sprintf("(?:%s)", s)
-				}
-				re := regexp.MustCompile(strings.Join(config.Validation.Manifests.URLs.Deny, "|"))
+				re := compileManifestURLs("validation.manifests.urls.deny", config.Validation.Manifests.URLs.Deny)
 				options = append(options, storage.ManifestURLsDenyRegexp(re))
 			}
 		}
+		for mediaType, rules := range config.Validation.Manifests.URLs.MediaTypes {
+			key := "validation.manifests.urls.mediatypes." + mediaType
+			if len(rules.Allow) > 0 {
+				options = append(options, storage.ManifestURLsAllowRegexpFor(mediaType, compileManifestURLs(key+".allow", rules.Allow)))
+			}
+			if len(rules.Deny) > 0 {
+				options = append(options, storage.ManifestURLsDenyRegexpFor(mediaType, compileManifestURLs(key+".deny", rules.Deny)))
+			}
+		}
+		if len(config.Validation.Manifests.ConfigMediaTypes) > 0 {
+			options = append(options, storage.OCIAllowedConfigMediaTypes(config.Validation.Manifests.ConfigMediaTypes))
+		}
+		if config.Validation.Manifests.MaxBytes > 0 {
+			options = append(options, storage.MaxManifestBytes(config.Validation.Manifests.MaxBytes))
+		}
+		if config.Validation.Manifests.MaxReferences > 0 {
+			options = append(options, storage.MaxManifestReferences(config.Validation.Manifests.MaxReferences))
+		}
+		if config.Validation.Manifests.MaxListEntries > 0 {
+			options = append(options, storage.MaxManifestListEntries(config.Validation.Manifests.MaxListEntries))
+		}
+		if config.Validation.Manifests.AllowLazyLists {
+			options = append(options, storage.AllowLazyManifestList)
+		}
+		if admission := config.Validation.Manifests.Admission; admission.URL != "" {
+			timeout := admission.Timeout
+			if timeout <= 0 {
+				timeout = defaultManifestAdmissionTimeout
+			}
+			options = append(options, storage.ManifestAdmissionWebhook(admission.URL, timeout))
+			if admission.FailOpen {
+				options = append(options, storage.ManifestAdmissionFailOpen)
+			}
+		}
 	}
 
 	// configure storage caches
@@ -265,6 +503,18 @@ func NewApp(ctx context.Context, config *configuration.Configuration) *App {
 			v = cc["layerinfo"]
 		}
 
+		if t, ok := cc["negativettl"]; ok {
+			ttlStr, ok := t.(string)
+			if !ok {
+				panic(fmt.Sprintf("invalid type for cache.negativettl config: %#v", t))
+			}
+			ttl, err := time.ParseDuration(ttlStr)
+			if err != nil {
+				panic(fmt.Sprintf("invalid cache.negativettl config: %v", err))
+			}
+			options = append(options, storage.NegativeStatCacheTTL(ttl))
+		}
+
 		switch v {
 		case "redis":
 			if app.redis == nil {
@@ -445,15 +695,38 @@ func (app *App) register(routeName string, dispatch dispatchFunc) {
 
 // configureEvents prepares the event sink for action.
 func (app *App) configureEvents(configuration *configuration.Configuration) {
+	app.events.sink = NewEventSink(app, configuration)
+
+	// Populate registry event source
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = configuration.HTTP.Addr
+	} else {
+		// try to pick the port off the config
+		_, port, err := net.SplitHostPort(configuration.HTTP.Addr)
+		if err == nil {
+			hostname = net.JoinHostPort(hostname, port)
+		}
+	}
+
+	app.events.source = notifications.SourceRecord{
+		Addr:       hostname,
+		InstanceID: dcontext.GetStringValue(app, "instance.id"),
+	}
+}
+
+// NewEventSink returns a sink broadcasting to the notification endpoints
+// enabled in configuration. Close it to flush queued events.
+func NewEventSink(ctx context.Context, configuration *configuration.Configuration) *notifications.Broadcaster {
 	// Configure all of the endpoint sinks.
 	var sinks []notifications.Sink
 	for _, endpoint := range configuration.Notifications.Endpoints {
 		if endpoint.Disabled {
-			dcontext.GetLogger(app).Infof("endpoint %s disabled, skipping", endpoint.Name)
+			dcontext.GetLogger(ctx).Infof("endpoint %s disabled, skipping", endpoint.Name)
 			continue
 		}
 
-		dcontext.GetLogger(app).Infof("configuring endpoint %v (%v), timeout=%s, headers=%v", endpoint.Name, endpoint.URL, endpoint.Timeout, endpoint.Headers)
+		dcontext.GetLogger(ctx).Infof("configuring endpoint %v (%v), timeout=%s, headers=%v", endpoint.Name, endpoint.URL, endpoint.Timeout, endpoint.Headers)
 		endpoint := notifications.NewEndpoint(endpoint.Name, endpoint.URL, notifications.EndpointConfig{
 			Timeout:           endpoint.Timeout,
 			Threshold:         endpoint.Threshold,
@@ -470,24 +743,7 @@ func (app *App) configureEvents(configuration *configuration.Configuration) {
 	// replacing broadcaster with a rabbitmq implementation. It's recommended
 	// that the registry instances also act as the workers to keep deployment
 	// simple.
-	app.events.sink = notifications.NewBroadcaster(sinks...)
-
-	// Populate registry event source
-	hostname, err := os.Hostname()
-	if err != nil {
-		hostname = configuration.HTTP.Addr
-	} else {
-		// try to pick the port off the config
-		_, port, err := net.SplitHostPort(configuration.HTTP.Addr)
-		if err == nil {
-			hostname = net.JoinHostPort(hostname, port)
-		}
-	}
-
-	app.events.source = notifications.SourceRecord{
-		Addr:       hostname,
-		InstanceID: dcontext.GetStringValue(app, "instance.id"),
-	}
+	return notifications.NewBroadcaster(sinks...)
 }
 
 type redisStartAtKey struct{}
@@ -669,6 +925,10 @@ func (app *App) dispatcher(dispatch dispatchFunc) http.Handler {
 		// Add username to request logging
 		context.Context = dcontext.WithLogger(context.Context, dcontext.GetLogger(context.Context, auth.UserNameKey))
 
+		if app.rateLimiter != nil && !app.rateLimiter.allow(context, w, r) {
+			return
+		}
+
 		// sync up context on the request.
 		r = r.WithContext(context)
 
@@ -818,6 +1078,22 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 
 	if repo != "" {
 		accessRecords = appendAccessRecords(accessRecords, r.Method, repo)
+		if route := mux.CurrentRoute(r); route != nil && route.GetName() == v2.RouteNameManifestsBulkDelete {
+			// a bulk delete is posted, but removes content
+			accessRecords = appendAccessRecords(accessRecords, "DELETE", repo)
+		}
+		if route := mux.CurrentRoute(r); route != nil && route.GetName() == v2.RouteNameRepositoryMove {
+			// a move removes the repository, and pushes it under its new name
+			accessRecords = appendAccessRecords(accessRecords, "DELETE", repo)
+			if toRepo := r.FormValue("to"); toRepo != "" {
+				accessRecords = appendAccessRecords(accessRecords, "POST", toRepo)
+			}
+		}
+		if route := mux.CurrentRoute(r); route != nil && route.GetName() == v2.RouteNameRepositoryCache {
+			// invalidating caches is reserved to administrators of the
+			// registry
+			accessRecords = appendCacheAccessRecord(accessRecords, r)
+		}
 		if fromRepo := r.FormValue("from"); fromRepo != "" {
 			// mounting a blob from one repository to another requires pull (GET)
 			// access to the source repository.
@@ -838,6 +1114,7 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 			return fmt.Errorf("forbidden: no repository name")
 		}
 		accessRecords = appendCatalogAccessRecord(accessRecords, r)
+		accessRecords = appendCacheAccessRecord(accessRecords, r)
 	}
 
 	ctx, err := app.accessController.Authorized(context.Context, accessRecords...)
@@ -870,6 +1147,21 @@ func (app *App) authorized(w http.ResponseWriter, r *http.Request, context *Cont
 	return nil
 }
 
+// authorizedTo reports whether the request of context, which has been
+// authorized already, is also granted access to the given resources. Unlike
+// authorized, it doesn't respond to the request.
+func (app *App) authorizedTo(context *Context, access ...auth.Access) bool {
+	if app.accessController == nil {
+		return true // access controller is not enabled.
+	}
+
+	if _, err := app.accessController.Authorized(context.Context, access...); err != nil {
+		dcontext.GetLogger(context).Debugf("access to %v not granted: %v", access, err)
+		return false
+	}
+	return true
+}
+
 // eventBridge returns a bridge for the current request, configured with the
 // correct actor and source.
 func (app *App) eventBridge(ctx *Context, r *http.Request) notifications.Listener {
@@ -888,7 +1180,7 @@ func (app *App) nameRequired(r *http.Request) bool {
 		return true
 	}
 	routeName := route.GetName()
-	return routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog
+	return routeName != v2.RouteNameBase && routeName != v2.RouteNameCatalog && routeName != v2.RouteNameDedupStats && routeName != v2.RouteNameCache && routeName != v2.RouteNameWhereIs
 }
 
 // apiBase implements a simple yes-man for doing overall checks against the
@@ -936,12 +1228,14 @@ func appendAccessRecords(records []auth.Access, method string, repo string) []au
 	return records
 }
 
-// Add the access record for the catalog if it's our current route
+// Add the access record for the catalog if it's our current route. The
+// registry-wide dedup statistics and tag lookups require the same access.
 func appendCatalogAccessRecord(accessRecords []auth.Access, r *http.Request) []auth.Access {
 	route := mux.CurrentRoute(r)
 	routeName := route.GetName()
 
-	if routeName == v2.RouteNameCatalog {
+	switch routeName {
+	case v2.RouteNameCatalog, v2.RouteNameDedupStats, v2.RouteNameWhereIs:
 		resource := auth.Resource{
 			Type: "registry",
 			Name: "catalog",
@@ -956,6 +1250,30 @@ func appendCatalogAccessRecord(accessRecords []auth.Access, r *http.Request) []a
 	return accessRecords
 }
 
+// Add the access record for the blob descriptor cache if it's our current
+// route. Invalidating it makes every instance read descriptors from storage
+// again, so it requires the "delete" action on the "registry:cache"
+// resource rather than access to the catalog.
+func appendCacheAccessRecord(accessRecords []auth.Access, r *http.Request) []auth.Access {
+	route := mux.CurrentRoute(r)
+	routeName := route.GetName()
+
+	switch routeName {
+	case v2.RouteNameCache, v2.RouteNameRepositoryCache:
+		resource := auth.Resource{
+			Type: "registry",
+			Name: "cache",
+		}
+
+		accessRecords = append(accessRecords,
+			auth.Access{
+				Resource: resource,
+				Action:   "delete",
+			})
+	}
+	return accessRecords
+}
+
 // applyRegistryMiddleware wraps a registry instance with the configured middlewares
 func applyRegistryMiddleware(ctx context.Context, registry distribution.Namespace, middlewares []configuration.Middleware) (distribution.Namespace, error) {
 	for _, mw := range middlewares {
@@ -993,6 +1311,163 @@ func applyStorageMiddleware(driver storagedriver.StorageDriver, middlewares []co
 	return driver, nil
 }
 
+// compileManifestURLs compiles the expressions of a list of the
+// validation.manifests.urls section into one matching any of them.
+func compileManifestURLs(key string, exprs []string) *regexp.Regexp {
+	wrapped := make([]string, len(exprs))
+	for i, s := range exprs {
+		// Validate via compilation.
+		if _, err := regexp.Compile(s); err != nil {
+			panic(fmt.Sprintf("%s: %s", key, err))
+		}
+		// Wrap with non-capturing group.
+		wrapped[i] = fmt.Sprintf("(?:%s)", s)
+	}
+	return regexp.MustCompile(strings.Join(wrapped, "|"))
+}
+
+// SharedStorageOptions returns the registry options of the storage
+// configuration which determine how content is laid out and retained in
+// storage. Commands working on the storage of a registry, such as
+// garbage-collect, need them to find and keep the content the registry
+// wrote.
+func SharedStorageOptions(config *configuration.Configuration) ([]storage.RegistryOption, error) {
+	var options []storage.RegistryOption
+
+	// configure blob path sharding
+	if blobPathsConfig, ok := config.Storage["blobpaths"]; ok {
+		if sharding, ok := blobPathsConfig["sharding"]; ok {
+			values, ok := sharding.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("invalid type for blobpaths.sharding config: %#v", sharding)
+			}
+			prefixes := make([]int, 0, len(values))
+			for _, v := range values {
+				length, ok := v.(int)
+				if !ok {
+					return nil, fmt.Errorf("invalid type for blobpaths.sharding config: %#v", sharding)
+				}
+				prefixes = append(prefixes, length)
+			}
+			options = append(options, storage.BlobPathSharding(prefixes))
+		}
+	}
+
+	// configure soft delete, whose tombstones garbage collection purges
+	if deleteConfig, ok := config.Storage["delete"]; ok {
+		if retention, ok := deleteConfig["softretention"]; ok {
+			retentionStr, ok := retention.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid type for delete.softretention config: %#v", retention)
+			}
+			d, err := time.ParseDuration(retentionStr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid delete.softretention config: %v", err)
+			}
+			if d <= 0 {
+				return nil, fmt.Errorf("delete.softretention must be positive: %s", retentionStr)
+			}
+			options = append(options, storage.SoftDeleteRetention(d))
+		}
+	}
+
+	return options, nil
+}
+
+// createStagingDriver creates the storage driver of the storage.uploads.staging
+// configuration section, which maps the name of a driver to its parameters.
+func createStagingDriver(stagingConfig interface{}) (storagedriver.StorageDriver, error) {
+	drivers, ok := stagingConfig.(map[interface{}]interface{})
+	if !ok || len(drivers) != 1 {
+		return nil, fmt.Errorf("must configure exactly one storage driver: %#v", stagingConfig)
+	}
+
+	var name string
+	parameters := make(map[string]interface{})
+	for k, v := range drivers {
+		if name, ok = k.(string); !ok {
+			return nil, fmt.Errorf("invalid storage driver name: %#v", k)
+		}
+		if v == nil {
+			break
+		}
+		params, ok := v.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid parameters of storage driver %s: %#v", name, v)
+		}
+		for pk, pv := range params {
+			key, ok := pk.(string)
+			if !ok {
+				return nil, fmt.Errorf("invalid parameter of storage driver %s: %#v", name, pk)
+			}
+			parameters[key] = pv
+		}
+	}
+	parameters["useragent"] = fmt.Sprintf("docker-distribution/%s %s", version.Version, runtime.Version())
+
+	return factory.Create(name, parameters)
+}
+
+// defaultQuotaCacheTTL is the default time the usage of a repository is
+// cached for when enforcing its quota
+const defaultQuotaCacheTTL = time.Minute
+
+// configQuotaProvider limits repositories to the number of bytes configured
+// for them, or to a default one.
+type configQuotaProvider struct {
+	defaultLimit int64
+	limits       map[string]int64
+}
+
+func (q *configQuotaProvider) Limit(ctx context.Context, name string) (int64, error) {
+	if limit, ok := q.limits[name]; ok {
+		return limit, nil
+	}
+	return q.defaultLimit, nil
+}
+
+// repositoryQuotaOption returns the registry option enforcing the quotas
+// of the storage.quota configuration section.
+func repositoryQuotaOption(quotaConfig configuration.Parameters) (storage.RegistryOption, error) {
+	provider := &configQuotaProvider{limits: make(map[string]int64)}
+	if d, ok := quotaConfig["default"]; ok {
+		limit, ok := d.(int)
+		if !ok || limit < 0 {
+			return nil, fmt.Errorf("invalid quota.default config: %#v", d)
+		}
+		provider.defaultLimit = int64(limit)
+	}
+	if r, ok := quotaConfig["repositories"]; ok {
+		repositories, ok := r.(map[interface{}]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid type for quota.repositories config: %#v", r)
+		}
+		for name, l := range repositories {
+			nameStr, ok := name.(string)
+			limit, isInt := l.(int)
+			if !ok || !isInt || limit < 0 {
+				return nil, fmt.Errorf("invalid quota.repositories config for %v: %#v", name, l)
+			}
+			provider.limits[nameStr] = int64(limit)
+		}
+	}
+
+	cacheTTL := defaultQuotaCacheTTL
+	if t, ok := quotaConfig["cachettl"]; ok {
+		ttlStr, ok := t.(string)
+		if !ok {
+			return nil, fmt.Errorf("invalid type for quota.cachettl config: %#v", t)
+		}
+		var err error
+		cacheTTL, err = time.ParseDuration(ttlStr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid quota.cachettl config: %v", err)
+		}
+	}
+
+	return storage.RepositoryQuotaProvider(provider, cacheTTL), nil
+}
+
 // uploadPurgeDefaultConfig provides a default configuration for upload
 // purging to be used in the absence of configuration in the
 // configuration file
@@ -1009,6 +1484,79 @@ func badPurgeUploadConfig(reason string) {
 	panic(fmt.Sprintf("Unable to parse upload purge configuration: %s", reason))
 }
 
+func badGCConfig(reason string) {
+	panic(fmt.Sprintf("Unable to parse garbage collection configuration: %s", reason))
+}
+
+// defaultGCActiveUploadWindow and defaultGCUntaggedGracePeriod are the
+// defaults of scheduled garbage collection, which runs while images are
+// pushed: repositories with uploads started within the window are skipped,
+// and untagged manifests pushed within the grace period are kept.
+const (
+	defaultGCActiveUploadWindow  = time.Hour
+	defaultGCUntaggedGracePeriod = time.Hour
+)
+
+// gcScheduleOption returns the registry option running garbage collection
+// as configured by the gc maintenance section, reporting deletions to
+// listener.
+func gcScheduleOption(config map[interface{}]interface{}, listener storage.GCListener) storage.RegistryOption {
+	intervalStr, ok := config["interval"].(string)
+	if !ok {
+		badGCConfig("interval missing or not a string")
+	}
+	interval, err := time.ParseDuration(intervalStr)
+	if err != nil {
+		badGCConfig(fmt.Sprintf("Cannot parse interval: %s", err.Error()))
+	}
+	if interval <= 0 {
+		badGCConfig("interval must be positive")
+	}
+
+	opts := storage.GCOpts{
+		ActiveUploadWindow:  defaultGCActiveUploadWindow,
+		UntaggedGracePeriod: defaultGCUntaggedGracePeriod,
+		Listener:            listener,
+	}
+	for key, value := range map[string]*bool{
+		"dryrun":         &opts.DryRun,
+		"deleteuntagged": &opts.RemoveUntagged,
+	} {
+		if v, ok := config[key]; ok {
+			if *value, ok = v.(bool); !ok {
+				badGCConfig(fmt.Sprintf("cannot parse %s", key))
+			}
+		}
+	}
+	for key, value := range map[string]*time.Duration{
+		"activeuploadwindow":  &opts.ActiveUploadWindow,
+		"untaggedgraceperiod": &opts.UntaggedGracePeriod,
+	} {
+		if v, ok := config[key]; ok {
+			str, ok := v.(string)
+			if !ok {
+				badGCConfig(fmt.Sprintf("%s is not a string", key))
+			}
+			d, err := time.ParseDuration(str)
+			if err != nil {
+				badGCConfig(fmt.Sprintf("Cannot parse %s: %s", key, err.Error()))
+			}
+			if d < 0 {
+				badGCConfig(fmt.Sprintf("%s must not be negative", key))
+			}
+			*value = d
+		}
+	}
+
+	return storage.GCSchedule(interval, opts)
+}
+
+// Shutdown stops the background work of the app, such as scheduled garbage
+// collection. It should be called once the app no longer serves requests.
+func (app *App) Shutdown() {
+	app.cancel()
+}
+
 // startUploadPurger schedules a goroutine which will periodically
 // check upload directories for old files and delete them
 func startUploadPurger(ctx context.Context, storageDriver storagedriver.StorageDriver, log dcontext.Logger, config map[interface{}]interface{}) {
@@ -212,6 +212,38 @@ func TestNewApp(t *testing.T) {
 	}
 }
 
+// TestSharedStorageOptions ensures that the options garbage-collect shares
+// with the registry are read from the storage configuration.
+func TestSharedStorageOptions(t *testing.T) {
+	config := configuration.Configuration{
+		Storage: configuration.Storage{
+			"testdriver": nil,
+			"blobpaths":  configuration.Parameters{"sharding": []interface{}{2, 2}},
+			"delete":     configuration.Parameters{"enabled": true, "softretention": "168h"},
+		},
+	}
+	options, err := SharedStorageOptions(&config)
+	if err != nil {
+		t.Fatalf("unexpected error reading shared storage options: %v", err)
+	}
+	if len(options) != 2 {
+		t.Fatalf("expected the blob path sharding and soft delete options, got %d options", len(options))
+	}
+	if _, err := storage.NewRegistry(context.Background(), testdriver.New(), options...); err != nil {
+		t.Fatalf("unexpected error applying shared storage options: %v", err)
+	}
+
+	config.Storage["delete"] = configuration.Parameters{"enabled": true, "softretention": "-1h"}
+	if _, err := SharedStorageOptions(&config); err == nil {
+		t.Fatalf("expected an error reading a negative soft delete retention")
+	}
+
+	config.Storage["blobpaths"] = configuration.Parameters{"sharding": "2,2"}
+	if _, err := SharedStorageOptions(&config); err == nil {
+		t.Fatalf("expected an error reading invalid blob path sharding")
+	}
+}
+
 // Test the access record accumulator
 func TestAppendAccessRecords(t *testing.T) {
 	repo := "testRepo"
@@ -277,3 +309,38 @@ func TestAppendAccessRecords(t *testing.T) {
 	}
 
 }
+
+// TestAppendCacheAccessRecord ensures that invalidating the blob descriptor
+// cache requires its own access rather than that of the catalog.
+func TestAppendCacheAccessRecord(t *testing.T) {
+	expectedCacheRecord := auth.Access{
+		Resource: auth.Resource{
+			Type: "registry",
+			Name: "cache",
+		},
+		Action: "delete",
+	}
+
+	for path, expectedResult := range map[string][]auth.Access{
+		"/v2/_cache":            {expectedCacheRecord},
+		"/v2/foo/bar/_cache":    {expectedCacheRecord},
+		"/v2/_catalog":          nil,
+		"/v2/foo/bar/tags/list": nil,
+	} {
+		var result []auth.Access
+		router := v2.Router()
+		router.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Fatalf("no route for %s", path)
+		})
+		for _, name := range []string{v2.RouteNameCache, v2.RouteNameRepositoryCache, v2.RouteNameCatalog, v2.RouteNameTags} {
+			router.GetRoute(name).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				result = appendCacheAccessRecord(nil, r)
+			}))
+		}
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("DELETE", path, nil))
+
+		if !reflect.DeepEqual(result, expectedResult) {
+			t.Fatalf("unexpected access records for %s: %#v != %#v", path, result, expectedResult)
+		}
+	}
+}
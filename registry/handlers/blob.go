@@ -7,6 +7,8 @@ import (
 	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/storage"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
 )
@@ -57,9 +59,13 @@ func (bh *blobHandler) GetBlob(w http.ResponseWriter, r *http.Request) {
 	context.GetLogger(bh).Debug("GetBlob")
 	blobs := bh.Repository.Blobs(bh)
 	desc, err := blobs.Stat(bh, bh.Digest)
+	if err == distribution.ErrBlobUnknown && r.Method == http.MethodHead && bh.mayMountFromGlobal() {
+		// pushers check for each layer before uploading it
+		desc, err = bh.mountFromGlobal()
+	}
 	if err != nil {
 		if err == distribution.ErrBlobUnknown {
-			bh.Errors = append(bh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(bh.Digest))
+			bh.blobUnknown(w)
 		} else {
 			bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		}
@@ -67,12 +73,63 @@ func (bh *blobHandler) GetBlob(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := blobs.ServeBlob(bh, w, r, desc.Digest); err != nil {
+		// the blob may be deleted from storage after it was found
+		if err == distribution.ErrBlobUnknown {
+			bh.blobUnknown(w)
+			return
+		}
 		context.GetLogger(bh).Debugf("unexpected error getting blob HTTP handler: %v", err)
 		bh.Errors = append(bh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
 	}
 }
 
+// blobUnknown answers a request for a blob the repository doesn't have, as
+// configured by the compatibility section.
+func (bh *blobHandler) blobUnknown(w http.ResponseWriter) {
+	notFound := bh.App.Config.Compatibility.BlobNotFound
+	if notFound.IncludeDigest {
+		w.Header().Set("Docker-Content-Digest", bh.Digest.String())
+	}
+	if notFound.Bare {
+		w.Header().Set("Content-Length", "0")
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	bh.Errors = append(bh.Errors, v2.ErrorCodeBlobUnknown.WithDetail(bh.Digest))
+}
+
+// mayMountFromGlobal reports whether a blob missing from the repository may
+// be linked into it from the global blob store. Linking a blob is a push, so
+// the request must be granted push access to the repository as well.
+func (bh *blobHandler) mayMountFromGlobal() bool {
+	if !bh.App.autoMountFromGlobal || bh.readOnly {
+		return false
+	}
+
+	return bh.App.authorizedTo(bh.Context, auth.Access{
+		Resource: auth.Resource{
+			Type: "repository",
+			Name: bh.Repository.Named().Name(),
+		},
+		Action: "push",
+	})
+}
+
+// mountFromGlobal links the blob of the request from the global blob store
+// into the repository, returning distribution.ErrBlobUnknown if the registry
+// doesn't have it.
+func (bh *blobHandler) mountFromGlobal() (distribution.Descriptor, error) {
+	// the request repository is wrapped for notifications, which hides the
+	// blob store of the underlying storage
+	repository, err := bh.registry.Repository(bh, bh.Repository.Named())
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	return storage.MountFromGlobal(bh, repository, bh.Digest)
+}
+
 // DeleteBlob deletes a layer blob
 func (bh *blobHandler) DeleteBlob(w http.ResponseWriter, r *http.Request) {
 	context.GetLogger(bh).Debug("DeleteBlob")
@@ -80,7 +137,15 @@ func (bh *blobHandler) DeleteBlob(w http.ResponseWriter, r *http.Request) {
 	blobs := bh.Repository.Blobs(bh)
 	err := blobs.Delete(bh, bh.Digest)
 	if err != nil {
+		if err, ok := err.(distribution.ErrBlobInUse); ok {
+			bh.Errors = append(bh.Errors, v2.ErrorCodeBlobInUse.WithDetail(err.Manifests))
+			return
+		}
+
 		switch err {
+		case distribution.ErrDeleteDisabled:
+			bh.Errors = append(bh.Errors, errDeleteDisabled)
+			return
 		case distribution.ErrUnsupported:
 			bh.Errors = append(bh.Errors, errcode.ErrorCodeUnsupported)
 			return
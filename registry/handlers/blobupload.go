@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 
 	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
@@ -15,6 +17,11 @@ import (
 	"github.com/opencontainers/go-digest"
 )
 
+// uploadLimitRetryAfter is the number of seconds a client is asked to wait
+// before starting an upload again after the repository reached its limit of
+// uploads in progress.
+const uploadLimitRetryAfter = "10"
+
 // blobUploadDispatcher constructs and returns the blob upload handler for the
 // given request context.
 func blobUploadDispatcher(ctx *Context, r *http.Request) http.Handler {
@@ -36,7 +43,15 @@ func blobUploadDispatcher(ctx *Context, r *http.Request) http.Handler {
 	}
 
 	if buh.UUID != "" {
-		state, err := hmacKey(ctx.Config.HTTP.Secret).unpackUploadState(r.FormValue("_state"))
+		token := r.FormValue("_state")
+		state, err := hmacKey(ctx.Config.HTTP.Secret).unpackUploadState(token)
+		// A state signed with a previous secret, before the secret was
+		// rotated, has its progress recovered from the upload in storage.
+		var fromStorage bool
+		if err == errInvalidSecret && len(ctx.Config.HTTP.PreviousSecrets) > 0 {
+			state, err = unpackRotatedUploadState(token, ctx.Config.HTTP.PreviousSecrets)
+			fromStorage = err == nil
+		}
 		if err != nil {
 			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				dcontext.GetLogger(ctx).Infof("error resolving upload: %v", err)
@@ -75,6 +90,12 @@ func blobUploadDispatcher(ctx *Context, r *http.Request) http.Handler {
 		}
 		buh.Upload = upload
 
+		if fromStorage {
+			dcontext.GetLogger(ctx).Infof("recovered state of upload %s from storage at offset %d", buh.UUID, upload.Size())
+			buh.State.Offset = upload.Size()
+			buh.State.StartedAt = upload.StartedAt()
+		}
+
 		if size := upload.Size(); size != buh.State.Offset {
 			defer upload.Close()
 			dcontext.GetLogger(ctx).Errorf("upload resumed at wrong offest: %d != %d", size, buh.State.Offset)
@@ -127,6 +148,9 @@ func (buh *blobUploadHandler) StartBlobUpload(w http.ResponseWriter, r *http.Req
 			}
 		} else if err == distribution.ErrUnsupported {
 			buh.Errors = append(buh.Errors, errcode.ErrorCodeUnsupported)
+		} else if err == distribution.ErrBlobUploadLimit {
+			w.Header().Set("Retry-After", uploadLimitRetryAfter)
+			buh.Errors = append(buh.Errors, errcode.ErrorCodeTooManyRequests.WithMessage(err.Error()))
 		} else {
 			buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		}
@@ -177,7 +201,19 @@ func (buh *blobUploadHandler) PatchBlobData(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	// TODO(dmcgowan): support Content-Range header to seek and write range
+	// chunks must be sent in order, each starting where the upload ends
+	if contentRange := r.Header.Get("Content-Range"); contentRange != "" {
+		start, end, err := parseContentRange(contentRange)
+		if err != nil || start != buh.Upload.Size() || (r.ContentLength >= 0 && end-start+1 != r.ContentLength) {
+			dcontext.GetLogger(buh).Infof("rejecting chunk with Content-Range %q at offset %d of upload", contentRange, buh.Upload.Size())
+			if err := buh.blobUploadResponse(w, r, false); err != nil {
+				buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+				return
+			}
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+	}
 
 	if err := copyFullPayload(buh, w, r, buh.Upload, -1, "blob PATCH"); err != nil {
 		buh.Errors = append(buh.Errors, errcode.ErrorCodeUnknown.WithDetail(err.Error()))
@@ -226,15 +262,23 @@ func (buh *blobUploadHandler) PutBlobUploadComplete(w http.ResponseWriter, r *ht
 	desc, err := buh.Upload.Commit(buh, distribution.Descriptor{
 		Digest: dgst,
 
-		// TODO(stevvooe): This isn't wildly important yet, but we should
-		// really set the mediatype. For now, we can let the backend take care
-		// of this.
+		// the storage may record it as the media type of the blob
+		MediaType: r.Header.Get("Content-Type"),
 	})
 
 	if err != nil {
 		switch err := err.(type) {
 		case distribution.ErrBlobInvalidDigest:
 			buh.Errors = append(buh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+			if err.Computed != "" {
+				buh.Errors = append(buh.Errors, v2.ErrorCodeBlobUploadInvalid.WithDetail(digestMismatch{
+					Expected: err.Digest,
+					Computed: err.Computed,
+					Size:     err.Size,
+				}))
+			}
+		case distribution.ErrQuotaExceeded:
+			buh.Errors = append(buh.Errors, v2.ErrorCodeQuotaExceeded.WithDetail(err))
 		case errcode.Error:
 			buh.Errors = append(buh.Errors, err)
 		default:
@@ -325,6 +369,35 @@ func (buh *blobUploadHandler) blobUploadResponse(w http.ResponseWriter, r *http.
 	return nil
 }
 
+// digestMismatch details an upload whose content does not match the digest
+// it was completed with.
+type digestMismatch struct {
+	Expected digest.Digest `json:"expected"`
+	Computed digest.Digest `json:"computed"`
+	Size     int64         `json:"size"`
+}
+
+// parseContentRange parses the inclusive range of a chunk, given as
+// "<start>-<end>" with an optional "bytes " prefix.
+func parseContentRange(contentRange string) (start, end int64, err error) {
+	parts := strings.SplitN(strings.TrimPrefix(contentRange, "bytes "), "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+	}
+	start, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q: %v", contentRange, err)
+	}
+	end, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q: %v", contentRange, err)
+	}
+	if start < 0 || end < start {
+		return 0, 0, fmt.Errorf("invalid Content-Range %q", contentRange)
+	}
+	return start, end, nil
+}
+
 // mountBlob attempts to mount a blob from another repository by its digest. If
 // successful, the blob is linked into the blob store and 201 Created is
 // returned with the canonical url of the blob.
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+const (
+	// maxBulkDeleteDigests limits the number of manifests a single bulk
+	// delete request may name.
+	maxBulkDeleteDigests = 1000
+
+	// bulkDeleteConcurrency bounds the number of manifests deleted at once.
+	bulkDeleteConcurrency = 8
+)
+
+// The outcomes of deleting a manifest in a bulk delete.
+const (
+	bulkDeleteStatusDeleted  = "deleted"
+	bulkDeleteStatusNotFound = "not_found"
+	bulkDeleteStatusInvalid  = "invalid"
+	bulkDeleteStatusError    = "error"
+)
+
+// bulkDeleteDispatcher constructs the handler deleting several manifests.
+func bulkDeleteDispatcher(ctx *Context, r *http.Request) http.Handler {
+	bulkDeleteHandler := &bulkDeleteHandler{
+		Context: ctx,
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		mhandler["POST"] = http.HandlerFunc(bulkDeleteHandler.DeleteManifests)
+	}
+
+	return mhandler
+}
+
+// bulkDeleteHandler handles requests deleting several manifests at once.
+type bulkDeleteHandler struct {
+	*Context
+}
+
+type bulkDeleteResult struct {
+	Digest string `json:"digest"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type bulkDeleteAPIResponse struct {
+	Results []bulkDeleteResult `json:"results"`
+}
+
+// DeleteManifests deletes each manifest digest listed in the JSON array
+// request body, untagging it as a single delete would. A result is returned
+// for every digest; the request only fails as a whole if it can't be
+// processed at all.
+func (bdh *bulkDeleteHandler) DeleteManifests(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(bdh).Debug("DeleteManifests")
+
+	if bdh.isCache {
+		bdh.Errors = append(bdh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+	if !bdh.deleteEnabled {
+		bdh.Errors = append(bdh.Errors, errDeleteDisabled)
+		return
+	}
+
+	var dgsts []string
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxManifestBodySize)).Decode(&dgsts); err != nil {
+		bdh.Errors = append(bdh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(fmt.Sprintf("request body must be a JSON array of digests: %v", err)))
+		return
+	}
+	if len(dgsts) > maxBulkDeleteDigests {
+		bdh.Errors = append(bdh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(fmt.Sprintf("at most %d digests may be deleted at once", maxBulkDeleteDigests)))
+		return
+	}
+
+	manifests, err := bdh.Repository.Manifests(bdh)
+	if err != nil {
+		bdh.Errors = append(bdh.Errors, err)
+		return
+	}
+
+	results := make([]bulkDeleteResult, len(dgsts))
+	sem := make(chan struct{}, bulkDeleteConcurrency)
+	var wg sync.WaitGroup
+	for i, dgst := range dgsts {
+		results[i].Digest = dgst
+
+		parsed, err := digest.Parse(dgst)
+		if err != nil {
+			results[i].Status = bulkDeleteStatusInvalid
+			results[i].Error = err.Error()
+			continue
+		}
+
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(result *bulkDeleteResult, dgst digest.Digest) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			switch err := bdh.deleteManifest(manifests, dgst); err {
+			case nil:
+				result.Status = bulkDeleteStatusDeleted
+			case distribution.ErrBlobUnknown:
+				result.Status = bulkDeleteStatusNotFound
+			default:
+				dcontext.GetLogger(bdh).Errorf("error deleting manifest %s: %v", dgst, err)
+				result.Status = bulkDeleteStatusError
+				result.Error = err.Error()
+			}
+		}(&results[i], parsed)
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	for _, result := range results {
+		if result.Status != bulkDeleteStatusDeleted {
+			status = http.StatusMultiStatus
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(bulkDeleteAPIResponse{Results: results}); err != nil {
+		dcontext.GetLogger(bdh).Errorf("error encoding bulk delete response: %v", err)
+	}
+}
+
+// deleteManifest deletes the manifest identified by dgst and removes the
+// tags referencing it.
+func (bdh *bulkDeleteHandler) deleteManifest(manifests distribution.ManifestService, dgst digest.Digest) error {
+	if err := manifests.Delete(bdh, dgst); err != nil {
+		return err
+	}
+
+	tagService := bdh.Repository.Tags(bdh)
+	referencedTags, err := tagService.Lookup(bdh, distribution.Descriptor{Digest: dgst})
+	if err != nil {
+		return err
+	}
+
+	for _, tag := range referencedTags {
+		if err := tagService.Untag(bdh, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/gorilla/handlers"
+)
+
+// blobDescriptorCacheInvalidator is implemented by registries which cache
+// blob descriptors.
+type blobDescriptorCacheInvalidator interface {
+	InvalidateBlobDescriptorCache(ctx context.Context, repo string) error
+}
+
+// cacheDispatcher constructs the handler invalidating the blob descriptor
+// cache of the registry, or of a repository if the route names one.
+func cacheDispatcher(ctx *Context, r *http.Request) http.Handler {
+	cacheHandler := &cacheHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"DELETE": http.HandlerFunc(cacheHandler.InvalidateCache),
+	}
+}
+
+// cacheHandler handles requests to invalidate cached blob descriptors.
+type cacheHandler struct {
+	*Context
+}
+
+// InvalidateCache drops the cached blob descriptors of the repository, or
+// all of them for the registry wide route.
+func (ch *cacheHandler) InvalidateCache(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(ch).Debug("InvalidateCache")
+
+	invalidator, ok := ch.registry.(blobDescriptorCacheInvalidator)
+	if !ok {
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnsupported.WithDetail("blob descriptors are not cached"))
+		return
+	}
+
+	var repo string
+	if ch.Repository != nil {
+		repo = ch.Repository.Named().Name()
+	}
+
+	if err := invalidator.InvalidateBlobDescriptorCache(ch, repo); err != nil {
+		if err == distribution.ErrUnsupported {
+			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnsupported.WithDetail("blob descriptors are not cached"))
+			return
+		}
+		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	if repo != "" {
+		dcontext.GetLogger(ch).Infof("invalidated blob descriptor cache of %s", repo)
+	} else {
+		dcontext.GetLogger(ch).Info("invalidated blob descriptor cache")
+	}
+
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusAccepted)
+}
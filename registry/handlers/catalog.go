@@ -7,14 +7,32 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"sync"
+	"time"
 
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/auth"
 	"github.com/docker/distribution/registry/storage/driver"
 	"github.com/gorilla/handlers"
 )
 
 const maximumReturnedEntries = 100
 
+const (
+	// defaultModTimeScanLimit is the number of links statted per repository
+	// to estimate its last push time when no limit is requested.
+	defaultModTimeScanLimit = 100
+
+	// modTimeCacheTTL is how long estimated push times are reused.
+	modTimeCacheTTL = 30 * time.Second
+
+	// modTimeCacheSize is the number of cached estimates above which expired
+	// ones are evicted.
+	modTimeCacheSize = 10000
+)
+
 func catalogDispatcher(ctx *Context, r *http.Request) http.Handler {
 	catalogHandler := &catalogHandler{
 		Context: ctx,
@@ -30,7 +48,15 @@ type catalogHandler struct {
 }
 
 type catalogAPIResponse struct {
-	Repositories []string `json:"repositories"`
+	Repositories []string                  `json:"repositories"`
+	Details      []catalogRepositoryDetail `json:"details,omitempty"`
+}
+
+// catalogRepositoryDetail holds the metadata returned for a repository when
+// the catalog is requested with detail=true.
+type catalogRepositoryDetail struct {
+	Name       string     `json:"name"`
+	LastPushed *time.Time `json:"lastPushed,omitempty"`
 }
 
 func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
@@ -38,6 +64,7 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 
 	q := r.URL.Query()
 	lastEntry := q.Get("last")
+	prefix := q.Get("prefix")
 	maxEntries, err := strconv.Atoi(q.Get("n"))
 	if err != nil || maxEntries < 0 {
 		maxEntries = maximumReturnedEntries
@@ -45,7 +72,23 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 
 	repos := make([]string, maxEntries)
 
-	filled, err := ch.App.registry.Repositories(ch.Context, repos, lastEntry)
+	var allowed func(name string) bool
+	if filterer, ok := ch.App.accessController.(auth.CatalogFilterer); ok {
+		allowed, err = filterer.CatalogFilter(ch.Context)
+		if err != nil {
+			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+	}
+
+	if prefix != "" {
+		if _, ok := ch.App.registry.(distribution.RepositoryPrefixLister); !ok {
+			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnsupported.WithDetail("the catalog can't be filtered by prefix"))
+			return
+		}
+	}
+
+	filled, err := ch.allowedRepositories(repos, prefix, lastEntry, allowed)
 	_, pathNotFound := err.(driver.PathNotFoundError)
 
 	if err == io.EOF || pathNotFound {
@@ -60,7 +103,7 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 	// Add a link header if there are more entries to retrieve
 	if moreEntries {
 		lastEntry = repos[len(repos)-1]
-		urlStr, err := createLinkEntry(r.URL.String(), maxEntries, lastEntry)
+		urlStr, err := createLinkEntry(r.URL.String(), maxEntries, lastEntry, prefix)
 		if err != nil {
 			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 			return
@@ -68,18 +111,169 @@ func (ch *catalogHandler) GetCatalog(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Link", urlStr)
 	}
 
-	enc := json.NewEncoder(w)
-	if err := enc.Encode(catalogAPIResponse{
+	response := catalogAPIResponse{
 		Repositories: repos[0:filled],
-	}); err != nil {
+	}
+
+	if q.Get("detail") == "true" {
+		limit, err := strconv.Atoi(q.Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = defaultModTimeScanLimit
+		}
+		response.Details, err = ch.repositoryDetails(response.Repositories, limit)
+		if err != nil {
+			ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(response); err != nil {
 		ch.Errors = append(ch.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
 	}
 }
 
+// allowedRepositories fills repos with the repositories after last whose
+// names start with prefix and, if allowed is not nil, which it allows. It
+// reads the catalog in pages of the size of repos until they are filled.
+func (ch *catalogHandler) allowedRepositories(repos []string, prefix, last string, allowed func(name string) bool) (int, error) {
+	list := func(page []string, last string) (int, error) {
+		if prefix != "" {
+			return ch.App.registry.(distribution.RepositoryPrefixLister).RepositoriesWithPrefix(ch.Context, page, prefix, last)
+		}
+		return ch.App.registry.Repositories(ch.Context, page, last)
+	}
+
+	if allowed == nil {
+		return list(repos, last)
+	}
+
+	filled := 0
+	page := make([]string, len(repos))
+	for {
+		n, err := list(page, last)
+		for _, repo := range page[:n] {
+			if allowed(repo) {
+				repos[filled] = repo
+				filled++
+				if filled == len(repos) {
+					// whether more are allowed is only known by listing on
+					return filled, nil
+				}
+			}
+		}
+		if err != nil {
+			return filled, err
+		}
+		if n == 0 {
+			return filled, io.EOF
+		}
+		last = page[n-1]
+	}
+}
+
+// repositoryDetails collects the catalog metadata of the given repositories.
+// Push times which were not recorded are estimated by statting at most limit
+// tag and manifest links of the repository.
+func (ch *catalogHandler) repositoryDetails(repos []string, limit int) ([]catalogRepositoryDetail, error) {
+	pushTimes, _ := ch.App.registry.(distribution.RepositoryPushTimeReader)
+	scanner, _ := ch.App.registry.(distribution.RepositoryModTimeScanner)
+
+	details := make([]catalogRepositoryDetail, 0, len(repos))
+	for _, repo := range repos {
+		detail := catalogRepositoryDetail{Name: repo}
+		named, err := reference.WithName(repo)
+		if err != nil {
+			return nil, err
+		}
+
+		var lastPushed time.Time
+		if pushTimes != nil {
+			lastPushed, err = pushTimes.LastPushed(ch.Context, named)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if lastPushed.IsZero() && scanner != nil {
+			lastPushed, err = ch.scanLastModified(scanner, named, limit)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if !lastPushed.IsZero() {
+			detail.LastPushed = &lastPushed
+		}
+		details = append(details, detail)
+	}
+
+	return details, nil
+}
+
+// scanLastModified returns the modification time of the named repository,
+// reusing a recent scan if there is one.
+func (ch *catalogHandler) scanLastModified(scanner distribution.RepositoryModTimeScanner, name reference.Named, limit int) (time.Time, error) {
+	key := modTimeCacheKey{name: name.Name(), limit: limit}
+	if modTime, ok := ch.App.modTimes.get(key, time.Now()); ok {
+		return modTime, nil
+	}
+
+	modTime, err := scanner.ScanLastModified(ch.Context, name, limit)
+	if err != nil {
+		return modTime, err
+	}
+	ch.App.modTimes.set(key, modTime, time.Now())
+	return modTime, nil
+}
+
+type modTimeCacheKey struct {
+	name  string
+	limit int
+}
+
+type modTimeCacheEntry struct {
+	modTime time.Time
+	expires time.Time
+}
+
+// modTimeCache holds the estimated push times of repositories for
+// modTimeCacheTTL. The zero value is ready for use.
+type modTimeCache struct {
+	mu      sync.Mutex
+	entries map[modTimeCacheKey]modTimeCacheEntry
+}
+
+func (c *modTimeCache) get(key modTimeCacheKey, now time.Time) (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || !now.Before(entry.expires) {
+		return time.Time{}, false
+	}
+	return entry.modTime, true
+}
+
+func (c *modTimeCache) set(key modTimeCacheKey, modTime time.Time, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil {
+		c.entries = make(map[modTimeCacheKey]modTimeCacheEntry)
+	}
+	if len(c.entries) >= modTimeCacheSize {
+		for k, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = modTimeCacheEntry{modTime: modTime, expires: now.Add(modTimeCacheTTL)}
+}
+
 // Use the original URL from the request to create a new URL for
 // the link header
-func createLinkEntry(origURL string, maxEntries int, lastEntry string) (string, error) {
+func createLinkEntry(origURL string, maxEntries int, lastEntry, prefix string) (string, error) {
 	calledURL, err := url.Parse(origURL)
 	if err != nil {
 		return "", err
@@ -88,6 +282,9 @@ func createLinkEntry(origURL string, maxEntries int, lastEntry string) (string,
 	v := url.Values{}
 	v.Add("n", strconv.Itoa(maxEntries))
 	v.Add("last", lastEntry)
+	if prefix != "" {
+		v.Add("prefix", prefix)
+	}
 
 	calledURL.RawQuery = v.Encode()
 
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"net/http"
+	"strconv"
+	"strings"
+
+	dcontext "github.com/docker/distribution/context"
+)
+
+// gzipMinSize is the smallest response body compressed by gzipDispatcher.
+// Smaller bodies don't shrink enough to be worth it.
+const gzipMinSize = 1024
+
+// gzipDispatcher wraps dispatch so that successful responses to GET requests
+// of clients accepting the gzip encoding are compressed once their body
+// reaches gzipMinSize. It is meant for JSON documents; routes serving blob
+// content, which is compressed already, must not use it.
+func gzipDispatcher(dispatch dispatchFunc) dispatchFunc {
+	return func(ctx *Context, r *http.Request) http.Handler {
+		handler := dispatch(ctx, r)
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != "GET" || !acceptsGzip(r) {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept-Encoding")
+			gw := &gzipResponseWriter{ResponseWriter: w}
+			handler.ServeHTTP(gw, r)
+			if err := gw.Close(); err != nil {
+				dcontext.GetLogger(ctx).Errorf("error writing compressed response: %v", err)
+			}
+		})
+	}
+}
+
+// acceptsGzip reports whether the Accept-Encoding header of r allows a gzip
+// encoded response.
+func acceptsGzip(r *http.Request) bool {
+	for _, value := range r.Header["Accept-Encoding"] {
+		for _, coding := range strings.Split(value, ",") {
+			params := strings.Split(coding, ";")
+			if strings.TrimSpace(params[0]) != "gzip" {
+				continue
+			}
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+						return false
+					}
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// gzipResponseWriter holds back the body of a response until it reaches
+// gzipMinSize, from when on it is compressed. Responses which are not
+// successful or already have a content encoding are written as is. Close
+// must be called once the handler returns.
+type gzipResponseWriter struct {
+	http.ResponseWriter
+	status int
+	buf    []byte
+	gz     *gzip.Writer
+
+	// direct is set when the response is passed through uncompressed
+	direct bool
+}
+
+func (w *gzipResponseWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+
+	if status != http.StatusOK || w.Header().Get("Content-Encoding") != "" {
+		w.direct = true
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *gzipResponseWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	switch {
+	case w.direct:
+		return w.ResponseWriter.Write(p)
+	case w.gz != nil:
+		return w.gz.Write(p)
+	}
+
+	w.buf = append(w.buf, p...)
+	if len(w.buf) < gzipMinSize {
+		return len(p), nil
+	}
+
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", "gzip")
+	w.ResponseWriter.WriteHeader(w.status)
+
+	w.gz = gzip.NewWriter(w.ResponseWriter)
+	if _, err := w.gz.Write(w.buf); err != nil {
+		return 0, err
+	}
+	w.buf = nil
+	return len(p), nil
+}
+
+// Close completes the response, writing a body too small to be compressed
+// as is.
+func (w *gzipResponseWriter) Close() error {
+	switch {
+	case w.gz != nil:
+		return w.gz.Close()
+	case w.direct || w.status == 0:
+		return nil
+	}
+
+	w.ResponseWriter.WriteHeader(w.status)
+	_, err := w.ResponseWriter.Write(w.buf)
+	return err
+}
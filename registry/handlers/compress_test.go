@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGzipDispatcher(t *testing.T) {
+	large := bytes.Repeat([]byte(`{"repositories":["foo/bar"]}`), 100)
+	small := []byte(`{"repositories":[]}`)
+
+	for _, tc := range []struct {
+		name           string
+		method         string
+		acceptEncoding string
+		status         int
+		body           []byte
+		compressed     bool
+	}{
+		{"large", "GET", "gzip, deflate", http.StatusOK, large, true},
+		{"small", "GET", "gzip", http.StatusOK, small, false},
+		{"no gzip", "GET", "deflate", http.StatusOK, large, false},
+		{"gzip refused", "GET", "deflate, gzip;q=0", http.StatusOK, large, false},
+		{"error", "GET", "gzip", http.StatusNotFound, large, false},
+		{"head", "HEAD", "gzip", http.StatusOK, large, false},
+	} {
+		dispatch := gzipDispatcher(func(ctx *Context, r *http.Request) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Length", fmt.Sprint(len(tc.body)))
+				w.WriteHeader(tc.status)
+				w.Write(tc.body)
+			})
+		})
+
+		req := httptest.NewRequest(tc.method, "/v2/_catalog", nil)
+		req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+		rec := httptest.NewRecorder()
+		dispatch(&Context{}, req).ServeHTTP(rec, req)
+
+		if rec.Code != tc.status {
+			t.Errorf("%s: unexpected status %d != %d", tc.name, rec.Code, tc.status)
+		}
+
+		body := rec.Body.Bytes()
+		if tc.compressed {
+			if rec.Header().Get("Content-Encoding") != "gzip" {
+				t.Fatalf("%s: expected gzip content encoding, got %q", tc.name, rec.Header().Get("Content-Encoding"))
+			}
+			if rec.Header().Get("Content-Length") != "" {
+				t.Errorf("%s: content length of the uncompressed body was kept", tc.name)
+			}
+			gz, err := gzip.NewReader(bytes.NewReader(body))
+			if err != nil {
+				t.Fatalf("%s: error reading compressed body: %v", tc.name, err)
+			}
+			if body, err = ioutil.ReadAll(gz); err != nil {
+				t.Fatalf("%s: error reading compressed body: %v", tc.name, err)
+			}
+		} else if rec.Header().Get("Content-Encoding") != "" {
+			t.Errorf("%s: unexpected content encoding %q", tc.name, rec.Header().Get("Content-Encoding"))
+		}
+
+		if !bytes.Equal(body, tc.body) {
+			t.Errorf("%s: unexpected body %q", tc.name, body)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// dedupStatsDispatcher constructs the handler reporting registry
+// deduplication statistics.
+func dedupStatsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dedupStatsHandler := &dedupStatsHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(dedupStatsHandler.GetDedupStats),
+	}
+}
+
+// dedupStatsHandler handles requests for the deduplication statistics of the
+// registry.
+type dedupStatsHandler struct {
+	*Context
+}
+
+// GetDedupStats returns the logical and physical size of the blobs linked
+// into all repositories.
+func (dh *dedupStatsHandler) GetDedupStats(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(dh).Debug("GetDedupStats")
+
+	stats, err := storage.RegistryDedupStats(dh, dh.registry)
+	if err != nil {
+		dh.Errors = append(dh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(stats); err != nil {
+		dh.Errors = append(dh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// diffIDsDispatcher constructs the handler mapping image configuration
+// diffIDs to layer blobs.
+func diffIDsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	diffIDsHandler := &diffIDsHandler{
+		Context: ctx,
+	}
+	reference := getReference(ctx)
+	dgst, err := digest.Parse(reference)
+	if err != nil {
+		diffIDsHandler.Tag = reference
+	} else {
+		diffIDsHandler.Digest = dgst
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(diffIDsHandler.GetDiffIDs),
+	}
+}
+
+// diffIDsHandler handles requests for the diffID mapping of an image.
+type diffIDsHandler struct {
+	*Context
+
+	// One of tag or digest gets set, depending on what is present in context.
+	Tag    string
+	Digest digest.Digest
+}
+
+type diffIDsAPIResponse struct {
+	Name   string                `json:"name"`
+	Digest digest.Digest         `json:"digest"`
+	Layers []storage.LayerDiffID `json:"layers"`
+}
+
+// GetDiffIDs returns the layers of an image manifest paired with the diffIDs
+// of its configuration.
+func (dh *diffIDsHandler) GetDiffIDs(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(dh).Debug("GetDiffIDs")
+
+	if dh.Tag != "" {
+		desc, err := dh.Repository.Tags(dh).Get(dh, dh.Tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				dh.Errors = append(dh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			} else {
+				dh.Errors = append(dh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			}
+			return
+		}
+		dh.Digest = desc.Digest
+	}
+
+	// the mapping is only cached when the registry may write to storage
+	resolver := storage.NewDiffIDResolver(dh.driver, !dh.readOnly)
+	layers, err := resolver.Resolve(dh, dh.Repository, dh.Digest)
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			dh.Errors = append(dh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		} else if err == distribution.ErrUnsupported {
+			dh.Errors = append(dh.Errors, errcode.ErrorCodeUnsupported.WithDetail("manifest does not reference an image configuration"))
+		} else {
+			dh.Errors = append(dh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Docker-Content-Digest", dh.Digest.String())
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(diffIDsAPIResponse{
+		Name:   dh.Repository.Named().Name(),
+		Digest: dh.Digest,
+		Layers: layers,
+	}); err != nil {
+		dh.Errors = append(dh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
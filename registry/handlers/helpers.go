@@ -6,9 +6,16 @@ import (
 	"io"
 	"net/http"
 
+	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
 )
 
+// errDeleteDisabled is the error returned for deletes when they are disabled
+// by configuration, telling it apart from operations the registry doesn't
+// implement.
+var errDeleteDisabled = errcode.ErrorCodeUnsupported.WithDetail(distribution.ErrDeleteDisabled.Error())
+
 // closeResources closes all the provided resources after running the target
 // handler.
 func closeResources(handler http.Handler, closers ...io.Closer) http.Handler {
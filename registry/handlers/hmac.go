@@ -58,6 +58,20 @@ func (secret hmacKey) unpackUploadState(token string) (blobUploadState, error) {
 	return state, nil
 }
 
+// unpackRotatedUploadState unpacks the blob upload state from a token which
+// failed to verify with the current secret, using the first of the previous
+// secrets it was signed with. errInvalidSecret is returned if none of them
+// signed it.
+func unpackRotatedUploadState(token string, previous []string) (blobUploadState, error) {
+	for _, secret := range previous {
+		state, err := hmacKey(secret).unpackUploadState(token)
+		if err != errInvalidSecret {
+			return state, err
+		}
+	}
+	return blobUploadState{}, errInvalidSecret
+}
+
 // packUploadState packs the upload state signed with and hmac digest using
 // the hmacKey secret, encoding to url safe base64. The resulting token can be
 // used to share data with minimized risk of external tampering.
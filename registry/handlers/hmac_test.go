@@ -104,6 +104,32 @@ func TestHMACValidation(t *testing.T) {
 	}
 }
 
+// TestHMACRotatedSecrets ensures that tokens signed with a previous secret
+// are accepted, and tokens signed with any other secret still are not.
+func TestHMACRotatedSecrets(t *testing.T) {
+	previous := []string{"old", "older"}
+	for _, testcase := range blobUploadStates {
+		token, err := hmacKey("older").packUploadState(testcase)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lus, err := unpackRotatedUploadState(token, previous)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertBlobUploadStateEquals(t, testcase, lus)
+
+		badToken, err := hmacKey("DifferentSecret").packUploadState(testcase)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := unpackRotatedUploadState(badToken, previous); err != errInvalidSecret {
+			t.Fatalf("Expected rotated secrets to fail at retrieving state from token: %s", badToken)
+		}
+	}
+}
+
 func assertBlobUploadStateEquals(t *testing.T, expected blobUploadState, received blobUploadState) {
 	if expected.Name != received.Name {
 		t.Fatalf("Expected Name=%q, Received Name=%q", expected.Name, received.Name)
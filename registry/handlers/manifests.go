@@ -16,6 +16,7 @@ import (
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
 	"github.com/docker/distribution/registry/auth"
+	"github.com/docker/distribution/registry/storage"
 	"github.com/gorilla/handlers"
 	"github.com/opencontainers/go-digest"
 	"github.com/opencontainers/image-spec/specs-go/v1"
@@ -50,6 +51,19 @@ func manifestDispatcher(ctx *Context, r *http.Request) http.Handler {
 	reference := getReference(ctx)
 	dgst, err := digest.Parse(reference)
 	if err != nil {
+		// Tags cannot contain a colon, so the client asked for a digest
+		// that is malformed or uses an unsupported algorithm.
+		if strings.Contains(reference, ":") {
+			dcontext.GetLogger(ctx).Errorf("error parsing digest=%q: %v", reference, err)
+			code := v2.ErrorCodeDigestInvalid
+			if err == digest.ErrDigestUnsupported {
+				code = v2.ErrorCodeDigestUnsupported
+			}
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				ctx.Errors = append(ctx.Errors, code.WithDetail(err))
+			})
+		}
+
 		// We just have a tag
 		manifestHandler.Tag = reference
 	} else {
@@ -142,11 +156,19 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 	var options []distribution.ManifestServiceOption
 	if imh.Tag != "" {
 		options = append(options, distribution.WithTag(imh.Tag))
+
+		// like the schema1 rewrite below, a converted manifest can only be
+		// served when fetched by tag
+		if supports[manifestSchema2] {
+			options = append(options, storage.WithSchema1Conversion())
+		}
 	}
 	manifest, err := manifests.Get(imh, imh.Digest, options...)
 	if err != nil {
 		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
 			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		} else if err == distribution.ErrSchemaV1Rejected {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithMessage(err.Error()))
 		} else {
 			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		}
@@ -210,6 +232,8 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 		if err != nil {
 			if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
 				imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+			} else if err == distribution.ErrSchemaV1Rejected {
+				imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown.WithMessage(err.Error()))
 			} else {
 				imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 			}
@@ -232,6 +256,11 @@ func (imh *manifestHandler) GetManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if _, ok := manifest.(*schema2.DeserializedManifest); ok && imh.Tag != "" {
+		// a stored schema1 manifest may have been converted
+		imh.Digest = imh.Digest.Algorithm().FromBytes(p)
+	}
+
 	w.Header().Set("Content-Type", ct)
 	w.Header().Set("Content-Length", fmt.Sprint(len(p)))
 	w.Header().Set("Docker-Content-Digest", imh.Digest.String())
@@ -312,8 +341,21 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 	}
 
 	if imh.Digest != "" {
-		if desc.Digest != imh.Digest {
-			dcontext.GetLogger(imh).Errorf("payload digest does match: %q != %q", desc.Digest, imh.Digest)
+		// verify the payload with the algorithm the client chose, which need
+		// not be the one the registry stores manifests under
+		payloadDigest := desc.Digest
+		if imh.Digest.Algorithm() != payloadDigest.Algorithm() {
+			payload := jsonBuf.Bytes()
+			if sm, ok := manifest.(*schema1.SignedManifest); ok {
+				// schema1 manifests are identified by their unsigned
+				// payload, which is served with different signatures
+				// whenever the registry signs them
+				payload = sm.Canonical
+			}
+			payloadDigest = imh.Digest.Algorithm().FromBytes(payload)
+		}
+		if payloadDigest != imh.Digest {
+			dcontext.GetLogger(imh).Errorf("payload digest does match: %q != %q", payloadDigest, imh.Digest)
 			imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid)
 			return
 		}
@@ -342,7 +384,7 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	_, err = manifests.Put(imh, manifest, options...)
+	revision, err := manifests.Put(imh, manifest, options...)
 	if err != nil {
 		// TODO(stevvooe): These error handling switches really need to be
 		// handled by an app global mapper.
@@ -354,6 +396,10 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 			imh.Errors = append(imh.Errors, errcode.ErrorCodeDenied)
 			return
 		}
+		if err == distribution.ErrSchemaV1Unsupported {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail("manifest schema v1 unsupported; push the image as a schema2 or OCI manifest"))
+			return
+		}
 		switch err := err.(type) {
 		case distribution.ErrManifestVerification:
 			for _, verificationError := range err {
@@ -364,6 +410,14 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 					imh.Errors = append(imh.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
 				case distribution.ErrManifestUnverified:
 					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnverified)
+				case distribution.ErrManifestConfigMediaTypeInvalid:
+					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(verificationError))
+				case distribution.ErrManifestTooLarge:
+					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(verificationError))
+				case distribution.ErrManifestTooManyReferences:
+					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(verificationError))
+				case distribution.ErrManifestAdmissionDenied:
+					imh.Errors = append(imh.Errors, v2.ErrorCodeManifestInvalid.WithDetail(verificationError))
 				default:
 					if verificationError == digest.ErrDigestInvalidFormat {
 						imh.Errors = append(imh.Errors, v2.ErrorCodeDigestInvalid)
@@ -372,6 +426,8 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 					}
 				}
 			}
+		case distribution.ErrQuotaExceeded:
+			imh.Errors = append(imh.Errors, v2.ErrorCodeQuotaExceeded.WithDetail(err))
 		case errcode.Error:
 			imh.Errors = append(imh.Errors, err)
 		default:
@@ -380,11 +436,21 @@ func (imh *manifestHandler) PutManifest(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// The registry may store manifests under a different digest algorithm
+	// than the payload was unmarshalled with, so refer to the revision it
+	// returned from here on.
+	desc.Digest = revision
+	imh.Digest = revision
+
 	// Tag this manifest
 	if imh.Tag != "" {
 		tags := imh.Repository.Tags(imh)
 		err = tags.Tag(imh, imh.Tag, desc)
 		if err != nil {
+			if _, ok := err.(distribution.ErrTagImmutable); ok {
+				imh.Errors = append(imh.Errors, v2.ErrorCodeTagImmutable.WithDetail(err))
+				return
+			}
 			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 			return
 		}
@@ -494,8 +560,14 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = manifests.Delete(imh, imh.Digest)
+	ctx := deleteContext(imh.Context, r)
+	err = manifests.Delete(ctx, imh.Digest)
 	if err != nil {
+		if err, ok := err.(distribution.ErrLastTagProtected); ok {
+			imh.Errors = append(imh.Errors, v2.ErrorCodeLastTagProtected.WithDetail(err.Tags))
+			return
+		}
+
 		switch err {
 		case digest.ErrDigestUnsupported:
 		case digest.ErrDigestInvalidFormat:
@@ -504,6 +576,9 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 		case distribution.ErrBlobUnknown:
 			imh.Errors = append(imh.Errors, v2.ErrorCodeManifestUnknown)
 			return
+		case distribution.ErrDeleteDisabled:
+			imh.Errors = append(imh.Errors, errDeleteDisabled)
+			return
 		case distribution.ErrUnsupported:
 			imh.Errors = append(imh.Errors, errcode.ErrorCodeUnsupported)
 			return
@@ -521,7 +596,7 @@ func (imh *manifestHandler) DeleteManifest(w http.ResponseWriter, r *http.Reques
 	}
 
 	for _, tag := range referencedTags {
-		if err := tagService.Untag(imh, tag); err != nil {
+		if err := tagService.Untag(ctx, tag); err != nil {
 			imh.Errors = append(imh.Errors, err)
 			return
 		}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// moveDispatcher constructs the handler renaming repositories.
+func moveDispatcher(ctx *Context, r *http.Request) http.Handler {
+	moveHandler := &moveHandler{
+		Context: ctx,
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		mhandler["POST"] = http.HandlerFunc(moveHandler.MoveRepository)
+	}
+
+	return mhandler
+}
+
+// moveHandler handles requests to move a repository to another name.
+type moveHandler struct {
+	*Context
+}
+
+// MoveRepository moves the repository to the name given by the to
+// parameter.
+func (mh *moveHandler) MoveRepository(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(mh).Debug("MoveRepository")
+
+	if mh.isCache {
+		mh.Errors = append(mh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+	if !mh.deleteEnabled {
+		mh.Errors = append(mh.Errors, errDeleteDisabled)
+		return
+	}
+
+	to, err := reference.WithName(r.FormValue("to"))
+	if err != nil {
+		mh.Errors = append(mh.Errors, v2.ErrorCodeNameInvalid.WithDetail(distribution.ErrRepositoryNameInvalid{
+			Name:   r.FormValue("to"),
+			Reason: err,
+		}))
+		return
+	}
+
+	if err := storage.MoveRepository(mh, mh.driver, mh.Repository.Named(), to); err != nil {
+		if err == storage.ErrNestedRepositories {
+			mh.Errors = append(mh.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
+			return
+		}
+		switch err := err.(type) {
+		case distribution.ErrRepositoryUnknown:
+			mh.Errors = append(mh.Errors, v2.ErrorCodeNameUnknown.WithDetail(err))
+		case distribution.ErrRepositoryNameInvalid:
+			mh.Errors = append(mh.Errors, v2.ErrorCodeNameInvalid.WithDetail(err))
+		case distribution.ErrRepositoryExists:
+			mh.Errors = append(mh.Errors, v2.ErrorCodeNameExists.WithDetail(err))
+		default:
+			mh.Errors = append(mh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	dcontext.GetLogger(mh).Infof("moved repository %s to %s", mh.Repository.Named().Name(), to.Name())
+
+	location, err := mh.urlBuilder.BuildTagsURL(to)
+	if err != nil {
+		dcontext.GetLogger(mh).Errorf("error building tags url: %v", err)
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Content-Length", "0")
+	w.WriteHeader(http.StatusCreated)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// orphansDispatcher constructs the handler listing unreferenced blobs.
+func orphansDispatcher(ctx *Context, r *http.Request) http.Handler {
+	orphansHandler := &orphansHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(orphansHandler.GetOrphans),
+	}
+}
+
+// orphansHandler handles requests for the blobs of a repository which no
+// manifest references.
+type orphansHandler struct {
+	*Context
+}
+
+type orphanedBlob struct {
+	Digest digest.Digest `json:"digest"`
+}
+
+// GetOrphans streams a JSON object for each blob linked into the repository
+// that garbage collection would leave unmarked.
+func (oh *orphansHandler) GetOrphans(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(oh).Debug("GetOrphans")
+
+	// the request repository is wrapped for notifications, which hides the
+	// enumerators of the underlying storage
+	repository, err := oh.registry.Repository(oh, oh.Repository.Named())
+	if err != nil {
+		oh.Errors = append(oh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	orphans := 0
+	err = storage.OrphanedBlobs(oh, repository, func(dgst digest.Digest) error {
+		orphans++
+		if err := enc.Encode(orphanedBlob{Digest: dgst}); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// the status has already been sent, so the error can only be logged
+		dcontext.GetLogger(oh).Errorf("error listing orphaned blobs after %d found: %v", orphans, err)
+		return
+	}
+
+	dcontext.GetLogger(oh).Infof("found %d orphaned blobs", orphans)
+}
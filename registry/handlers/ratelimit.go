@@ -0,0 +1,268 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution/configuration"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/auth"
+	"github.com/garyburd/redigo/redis"
+)
+
+// rateLimitStore keeps the token buckets of clients.
+type rateLimitStore interface {
+	// take removes a token from the bucket of key, which refills at rate
+	// tokens per second up to burst tokens. If the bucket is empty, it
+	// returns the time until a token is available instead.
+	take(key string, rate float64, burst int, now time.Time) (time.Duration, error)
+}
+
+// rateLimiter refuses requests of clients that exhausted their bucket.
+type rateLimiter struct {
+	rate           float64
+	burst          int
+	store          rateLimitStore
+	trustedProxies []*net.IPNet
+}
+
+// configureRateLimit sets up the rate limiter of the app, if it is enabled.
+func (app *App) configureRateLimit(config *configuration.Configuration) {
+	rateLimit := config.HTTP.RateLimit
+	if rateLimit.RequestsPerSecond <= 0 {
+		return
+	}
+
+	burst := rateLimit.Burst
+	if burst <= 0 {
+		burst = int(math.Ceil(rateLimit.RequestsPerSecond))
+	}
+
+	var store rateLimitStore
+	switch rateLimit.Store {
+	case "", "inmemory":
+		store = newMemoryRateLimitStore()
+	case "redis":
+		if app.redis == nil {
+			panic("redis configuration required to use for rate limiting")
+		}
+		store = &redisRateLimitStore{pool: app.redis}
+	default:
+		panic(fmt.Sprintf("unknown rate limit store %q", rateLimit.Store))
+	}
+
+	var trustedProxies []*net.IPNet
+	for _, proxy := range rateLimit.TrustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			panic(fmt.Sprintf("invalid rate limit trusted proxy %q: %v", proxy, err))
+		}
+		trustedProxies = append(trustedProxies, network)
+	}
+
+	app.rateLimiter = &rateLimiter{
+		rate:           rateLimit.RequestsPerSecond,
+		burst:          burst,
+		store:          store,
+		trustedProxies: trustedProxies,
+	}
+	dcontext.GetLogger(app).Infof("limiting clients to %g requests per second with bursts of %d", rateLimit.RequestsPerSecond, burst)
+}
+
+// allow takes a token for the client of the request. If none is left, it
+// responds with 429 Too Many Requests and returns false. Requests are let
+// through if the store fails.
+func (rl *rateLimiter) allow(ctx *Context, w http.ResponseWriter, r *http.Request) bool {
+	key := "ip:" + rl.clientIP(r)
+	if name := dcontext.GetStringValue(ctx, auth.UserNameKey); name != "" {
+		key = "user:" + name
+	}
+
+	wait, err := rl.store.take(key, rl.rate, rl.burst, time.Now())
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("error checking rate limit of %s: %v", key, err)
+		return true
+	}
+	if wait <= 0 {
+		return true
+	}
+
+	dcontext.GetLogger(ctx).Warnf("rate limit of %s exceeded", key)
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	if err := errcode.ServeJSON(w, errcode.ErrorCodeTooManyRequests); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error serving error json: %v", err)
+	}
+	return false
+}
+
+// clientIP returns the IP address of the client of the request. It is the
+// address the request comes from, unless that is a trusted proxy. Then the
+// last address of X-Forwarded-For which is not a trusted proxy is taken, or
+// X-Real-IP in the absence of X-Forwarded-For.
+func (rl *rateLimiter) clientIP(r *http.Request) string {
+	ip := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+	if !rl.trusted(ip) {
+		return ip
+	}
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			ip = hop
+			if !rl.trusted(hop) {
+				break
+			}
+		}
+		return ip
+	}
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-Ip")); net.ParseIP(realIP) != nil {
+		return realIP
+	}
+	return ip
+}
+
+// trusted reports whether ip is the address of a trusted proxy.
+func (rl *rateLimiter) trusted(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range rl.trustedProxies {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryRateLimitSweepInterval is how often buckets which have refilled are
+// dropped from a memoryRateLimitStore.
+const memoryRateLimitSweepInterval = time.Minute
+
+type tokenBucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// refill adds the tokens accrued since the bucket was last updated.
+func (b *tokenBucket) refill(rate float64, burst int, now time.Time) {
+	if elapsed := now.Sub(b.at).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed*rate)
+		b.at = now
+	}
+}
+
+// memoryRateLimitStore keeps buckets in the memory of a single registry.
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newMemoryRateLimitStore() *memoryRateLimitStore {
+	return &memoryRateLimitStore{
+		buckets:   make(map[string]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (s *memoryRateLimitStore) take(key string, rate float64, burst int, now time.Time) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now.Sub(s.lastSweep) >= memoryRateLimitSweepInterval {
+		for k, b := range s.buckets {
+			if b.refill(rate, burst, now); b.tokens >= float64(burst) {
+				delete(s.buckets, k)
+			}
+		}
+		s.lastSweep = now
+	}
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), at: now}
+		s.buckets[key] = b
+	}
+	b.refill(rate, burst, now)
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rate * float64(time.Second)), nil
+	}
+	b.tokens--
+	return 0, nil
+}
+
+// redisRateLimitScript updates a bucket kept as a hash of its tokens and the
+// time it was last updated, returning the seconds until a token is available
+// or zero once one was taken. The result is a string, since redis truncates
+// numbers returned by scripts to integers.
+var redisRateLimitScript = redis.NewScript(1, `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+
+local bucket = redis.call("HMGET", KEYS[1], "tokens", "at")
+local tokens = tonumber(bucket[1]) or burst
+local at = tonumber(bucket[2]) or now
+if now > at then
+	tokens = math.min(burst, tokens + (now - at) * rate)
+	at = now
+end
+
+local wait = 0
+if tokens < 1 then
+	wait = (1 - tokens) / rate
+else
+	tokens = tokens - 1
+end
+
+redis.call("HMSET", KEYS[1], "tokens", tostring(tokens), "at", tostring(at))
+redis.call("EXPIRE", KEYS[1], math.ceil(burst / rate) + 1)
+return tostring(wait)
+`)
+
+// redisRateLimitStore keeps buckets in redis, shared by all registries
+// using it.
+type redisRateLimitStore struct {
+	pool *redis.Pool
+}
+
+func (s *redisRateLimitStore) take(key string, rate float64, burst int, now time.Time) (time.Duration, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	seconds := float64(now.UnixNano()) / float64(time.Second)
+	reply, err := redis.String(redisRateLimitScript.Do(conn, "ratelimit::"+key,
+		strconv.FormatFloat(rate, 'f', -1, 64), burst, strconv.FormatFloat(seconds, 'f', 6, 64)))
+	if err != nil {
+		return 0, err
+	}
+
+	wait, err := strconv.ParseFloat(reply, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(wait * float64(time.Second)), nil
+}
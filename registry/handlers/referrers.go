@@ -0,0 +1,129 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// referrersDispatcher constructs the handler listing the manifests referring
+// to a digest.
+func referrersDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	referrersHandler := &referrersHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(referrersHandler.GetReferrers),
+	}
+}
+
+// referrersHandler handles requests for the referrers of a digest.
+type referrersHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+type referrerDescriptor struct {
+	MediaType    string            `json:"mediaType"`
+	Size         int64             `json:"size"`
+	Digest       digest.Digest     `json:"digest"`
+	ArtifactType string            `json:"artifactType,omitempty"`
+	Annotations  map[string]string `json:"annotations,omitempty"`
+}
+
+type referrersAPIResponse struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Manifests     []referrerDescriptor `json:"manifests"`
+}
+
+// GetReferrers returns an image index of the manifests whose subject is the
+// requested digest, optionally filtered by artifact type.
+func (rh *referrersHandler) GetReferrers(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(rh).Debug("GetReferrers")
+
+	referrers, err := storage.Referrers(rh, rh.driver, rh.Repository.Named(), rh.Digest)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	manifests, err := rh.Repository.Manifests(rh)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	artifactType := r.URL.Query().Get("artifactType")
+	response := referrersAPIResponse{
+		SchemaVersion: 2,
+		MediaType:     v1.MediaTypeImageIndex,
+		Manifests:     []referrerDescriptor{},
+	}
+	for _, dgst := range referrers {
+		manifest, err := manifests.Get(rh, dgst)
+		if err != nil {
+			// the referrer was deleted after it was linked
+			if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+				continue
+			}
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		m, ok := manifest.(*ocischema.DeserializedManifest)
+		if !ok {
+			continue
+		}
+
+		desc := referrerDescriptor{
+			Digest:       dgst,
+			ArtifactType: m.ArtifactType,
+			Annotations:  m.Annotations,
+		}
+		if desc.ArtifactType == "" {
+			desc.ArtifactType = m.Config.MediaType
+		}
+		if artifactType != "" && desc.ArtifactType != artifactType {
+			continue
+		}
+
+		mediaType, payload, err := m.Payload()
+		if err != nil {
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+			return
+		}
+		desc.MediaType = mediaType
+		desc.Size = int64(len(payload))
+		response.Manifests = append(response.Manifests, desc)
+	}
+
+	w.Header().Set("Content-Type", v1.MediaTypeImageIndex)
+	if artifactType != "" {
+		w.Header().Set("OCI-Filters-Applied", "artifactType")
+	}
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(response); err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
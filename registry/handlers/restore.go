@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// restoreDispatcher constructs the handler restoring soft deleted manifests.
+func restoreDispatcher(ctx *Context, r *http.Request) http.Handler {
+	dgst, err := getDigest(ctx)
+	if err != nil {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Errors = append(ctx.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		})
+	}
+
+	restoreHandler := &restoreHandler{
+		Context: ctx,
+		Digest:  dgst,
+	}
+
+	mhandler := handlers.MethodHandler{}
+	if !ctx.readOnly {
+		mhandler["POST"] = http.HandlerFunc(restoreHandler.RestoreManifest)
+	}
+
+	return mhandler
+}
+
+// restoreHandler handles requests to restore a soft deleted manifest.
+type restoreHandler struct {
+	*Context
+
+	Digest digest.Digest
+}
+
+// manifestRestorer is implemented by manifest services keeping deleted
+// manifests restorable.
+type manifestRestorer interface {
+	Restore(ctx context.Context, dgst digest.Digest) ([]string, error)
+}
+
+// RestoreManifest restores the soft deleted manifest and the tags that
+// referenced it.
+func (rh *restoreHandler) RestoreManifest(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(rh).Debug("RestoreManifest")
+
+	if rh.isCache {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+	if !rh.deleteEnabled {
+		rh.Errors = append(rh.Errors, errDeleteDisabled)
+		return
+	}
+
+	// the request repository is wrapped for notifications, which hides the
+	// restore support of the underlying storage
+	repository, err := rh.registry.Repository(rh, rh.Repository.Named())
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	manifests, err := repository.Manifests(rh)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	restorer, ok := manifests.(manifestRestorer)
+	if !ok {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported.WithDetail("manifest restore is not supported by the storage"))
+		return
+	}
+
+	tags, err := restorer.Restore(rh, rh.Digest)
+	if err != nil {
+		if err == distribution.ErrUnsupported {
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnsupported)
+			return
+		}
+		switch err := err.(type) {
+		case distribution.ErrManifestUnknownRevision:
+			rh.Errors = append(rh.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		default:
+			rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+	rh.notifyRestored(r, manifests, tags)
+
+	ref, err := reference.WithDigest(rh.Repository.Named(), rh.Digest)
+	if err != nil {
+		rh.Errors = append(rh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	location, err := rh.urlBuilder.BuildManifestURL(ref)
+	if err != nil {
+		dcontext.GetLogger(rh).Errorf("error building manifest url from digest: %v", err)
+	}
+
+	w.Header().Set("Location", location)
+	w.Header().Set("Docker-Content-Digest", rh.Digest.String())
+	w.WriteHeader(http.StatusCreated)
+}
+
+// notifyRestored reports the restored manifest to the notification endpoints
+// as pushed, once for each of the restored tags, since the restore bypasses
+// the event bridge of the request repository.
+func (rh *restoreHandler) notifyRestored(r *http.Request, manifests distribution.ManifestService, tags []string) {
+	manifest, err := manifests.Get(rh, rh.Digest)
+	if err != nil {
+		dcontext.GetLogger(rh).Errorf("error getting restored manifest %s: %v", rh.Digest, err)
+		return
+	}
+
+	listener := rh.App.eventBridge(rh.Context, r)
+	if len(tags) == 0 {
+		if err := listener.ManifestPushed(rh.Repository.Named(), manifest); err != nil {
+			dcontext.GetLogger(rh).Errorf("error dispatching manifest restore to listener: %v", err)
+		}
+		return
+	}
+	for _, tag := range tags {
+		if err := listener.ManifestPushed(rh.Repository.Named(), manifest, distribution.WithTag(tag)); err != nil {
+			dcontext.GetLogger(rh).Errorf("error dispatching manifest restore to listener: %v", err)
+		}
+	}
+}
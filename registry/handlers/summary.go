@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// summaryDispatcher constructs the handler summarizing repository content.
+func summaryDispatcher(ctx *Context, r *http.Request) http.Handler {
+	summaryHandler := &summaryHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(summaryHandler.GetSummary),
+	}
+}
+
+// summaryHandler handles requests for the summary of a repository.
+type summaryHandler struct {
+	*Context
+}
+
+// GetSummary returns the tags of the repository with the content they refer
+// to, and a digest of them.
+func (sh *summaryHandler) GetSummary(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(sh).Debug("GetSummary")
+
+	// the request repository is wrapped for notifications, which would
+	// report every manifest read as a pull
+	repository, err := sh.registry.Repository(sh, sh.Repository.Named())
+	if err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	summary, err := storage.RepositorySummary(sh, repository)
+	if err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(summary); err != nil {
+		sh.Errors = append(sh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
@@ -1,12 +1,15 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"net/http"
 
 	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry/api/errcode"
 	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
 	"github.com/gorilla/handlers"
 )
 
@@ -31,12 +34,34 @@ type tagsAPIResponse struct {
 	Tags []string `json:"tags"`
 }
 
-// GetTags returns a json list of tags for a specific image name.
+type tagsDetailAPIResponse struct {
+	Name string            `json:"name"`
+	Tags []storage.TagInfo `json:"tags"`
+}
+
+// tagMetadataLister is implemented by tag services able to report the
+// digest and modification time of each tag.
+type tagMetadataLister interface {
+	AllWithMetadata(ctx context.Context) ([]storage.TagInfo, error)
+}
+
+// GetTags returns a json list of tags for a specific image name. With
+// detail=true, each tag is returned with its digest and modification time.
 func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 	defer r.Body.Close()
 
-	tagService := th.Repository.Tags(th)
-	tags, err := tagService.All(th)
+	var response interface{}
+	var err error
+	if r.URL.Query().Get("detail") == "true" {
+		response, err = th.tagsDetail()
+	} else {
+		var tags []string
+		tags, err = th.Repository.Tags(th).All(th)
+		response = tagsAPIResponse{
+			Name: th.Repository.Named().Name(),
+			Tags: tags,
+		}
+	}
 	if err != nil {
 		switch err := err.(type) {
 		case distribution.ErrRepositoryUnknown:
@@ -52,11 +77,102 @@ func (th *tagsHandler) GetTags(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 
 	enc := json.NewEncoder(w)
-	if err := enc.Encode(tagsAPIResponse{
+	if err := enc.Encode(response); err != nil {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
+
+func (th *tagsHandler) tagsDetail() (tagsDetailAPIResponse, error) {
+	// the request repository is wrapped for notifications, which hides the
+	// tag metadata of the underlying storage
+	repository, err := th.registry.Repository(th, th.Repository.Named())
+	if err != nil {
+		return tagsDetailAPIResponse{}, err
+	}
+
+	lister, ok := repository.Tags(th).(tagMetadataLister)
+	if !ok {
+		return tagsDetailAPIResponse{}, errcode.ErrorCodeUnsupported.WithDetail("tag metadata is not available")
+	}
+
+	tags, err := lister.AllWithMetadata(th)
+	if err != nil {
+		return tagsDetailAPIResponse{}, err
+	}
+
+	return tagsDetailAPIResponse{
 		Name: th.Repository.Named().Name(),
 		Tags: tags,
-	}); err != nil {
+	}, nil
+}
+
+// tagDispatcher constructs the handler for an individual tag.
+func tagDispatcher(ctx *Context, r *http.Request) http.Handler {
+	tagHandler := &tagHandler{
+		Context: ctx,
+		Tag:     dcontext.GetStringValue(ctx, "vars.tag"),
+	}
+
+	thandler := handlers.MethodHandler{}
+
+	if !ctx.readOnly {
+		thandler["DELETE"] = http.HandlerFunc(tagHandler.DeleteTag)
+	}
+
+	return thandler
+}
+
+// tagHandler handles requests for an individual tag under a repository name.
+type tagHandler struct {
+	*Context
+
+	Tag string
+}
+
+// DeleteTag removes the tag, leaving the manifest it points to in place.
+func (th *tagHandler) DeleteTag(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(th).Debug("DeleteTag")
+
+	if th.isCache {
+		th.Errors = append(th.Errors, errcode.ErrorCodeUnsupported)
+		return
+	}
+	if !th.deleteEnabled {
+		th.Errors = append(th.Errors, errDeleteDisabled)
+		return
+	}
+
+	tagService := th.Repository.Tags(th)
+	if _, err := tagService.Get(th, th.Tag); err != nil {
+		switch err := err.(type) {
+		case distribution.ErrTagUnknown:
+			th.Errors = append(th.Errors, v2.ErrorCodeManifestUnknown.WithDetail(err))
+		case errcode.Error:
+			th.Errors = append(th.Errors, err)
+		default:
+			th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		}
+		return
+	}
+
+	if err := tagService.Untag(deleteContext(th.Context, r), th.Tag); err != nil {
+		if err, ok := err.(distribution.ErrLastTagProtected); ok {
+			th.Errors = append(th.Errors, v2.ErrorCodeLastTagProtected.WithDetail(err.Tags))
+			return
+		}
 		th.Errors = append(th.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
 		return
 	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// deleteContext returns the context for the deletes of a request, forcing
+// them if the request has force=true.
+func deleteContext(ctx *Context, r *http.Request) context.Context {
+	if r.URL.Query().Get("force") == "true" {
+		return storage.WithForceDelete(ctx)
+	}
+	return ctx
 }
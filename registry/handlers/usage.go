@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// usageDispatcher constructs the handler reporting repository storage usage.
+func usageDispatcher(ctx *Context, r *http.Request) http.Handler {
+	usageHandler := &usageHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(usageHandler.GetUsage),
+	}
+}
+
+// usageHandler handles requests for the storage usage of a repository.
+type usageHandler struct {
+	*Context
+}
+
+// GetUsage returns the size and count of the blobs and manifests linked into
+// the repository.
+func (uh *usageHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(uh).Debug("GetUsage")
+
+	// the request repository is wrapped for notifications, which hides the
+	// enumerators of the underlying storage
+	repository, err := uh.registry.Repository(uh, uh.Repository.Named())
+	if err != nil {
+		uh.Errors = append(uh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	usage, err := storage.RepositoryUsage(uh, repository)
+	if err != nil {
+		uh.Errors = append(uh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(usage); err != nil {
+		uh.Errors = append(uh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+)
+
+// verifyDispatcher constructs the handler verifying repository blob content.
+func verifyDispatcher(ctx *Context, r *http.Request) http.Handler {
+	verifyHandler := &verifyHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(verifyHandler.GetVerify),
+	}
+}
+
+// verifyHandler handles requests to verify the blobs of a repository.
+type verifyHandler struct {
+	*Context
+}
+
+// GetVerify re-hashes the blobs linked into the repository and streams a
+// JSON object for each one whose content does not match its digest.
+func (vh *verifyHandler) GetVerify(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(vh).Debug("GetVerify")
+
+	sample, err := strconv.ParseFloat(r.URL.Query().Get("sample"), 64)
+	if err != nil || sample <= 0 || sample > 1 {
+		sample = 1
+	}
+
+	// the request repository is wrapped for notifications, which hides the
+	// enumerators of the underlying storage
+	repository, err := vh.registry.Repository(vh, vh.Repository.Named())
+	if err != nil {
+		vh.Errors = append(vh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	verified, err := storage.VerifyRepositoryBlobs(vh, repository, sample, func(mismatch storage.BlobMismatch) error {
+		dcontext.GetLogger(vh).Warnf("blob %s does not match its content: %+v", mismatch.Digest, mismatch)
+		if err := enc.Encode(mismatch); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// the status has already been sent, so the error can only be logged
+		dcontext.GetLogger(vh).Errorf("error verifying repository blobs after %d verified: %v", verified, err)
+		return
+	}
+
+	dcontext.GetLogger(vh).Infof("verified %d blobs", verified)
+}
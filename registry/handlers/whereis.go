@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/api/errcode"
+	"github.com/docker/distribution/registry/api/v2"
+	"github.com/docker/distribution/registry/storage"
+	"github.com/gorilla/handlers"
+	"github.com/opencontainers/go-digest"
+)
+
+// whereIsDispatcher constructs the handler finding the tags referencing a
+// digest across repositories.
+func whereIsDispatcher(ctx *Context, r *http.Request) http.Handler {
+	whereIsHandler := &whereIsHandler{
+		Context: ctx,
+	}
+
+	return handlers.MethodHandler{
+		"GET": http.HandlerFunc(whereIsHandler.GetWhereIs),
+	}
+}
+
+// whereIsHandler handles requests for the tags referencing a digest.
+type whereIsHandler struct {
+	*Context
+}
+
+type whereIsAPIResponse struct {
+	Digest       digest.Digest       `json:"digest"`
+	Repositories map[string][]string `json:"repositories"`
+}
+
+// GetWhereIs returns the tags of every repository referencing the digest
+// given by the digest parameter.
+func (wh *whereIsHandler) GetWhereIs(w http.ResponseWriter, r *http.Request) {
+	dcontext.GetLogger(wh).Debug("GetWhereIs")
+
+	dgst, err := digest.Parse(r.FormValue("digest"))
+	if err != nil {
+		wh.Errors = append(wh.Errors, v2.ErrorCodeDigestInvalid.WithDetail(err))
+		return
+	}
+
+	repositories, err := storage.TagsReferencing(wh, wh.registry, dgst)
+	if err != nil {
+		wh.Errors = append(wh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(whereIsAPIResponse{
+		Digest:       dgst,
+		Repositories: repositories,
+	}); err != nil {
+		wh.Errors = append(wh.Errors, errcode.ErrorCodeUnknown.WithDetail(err))
+		return
+	}
+}
@@ -240,6 +240,7 @@ func (registry *Registry) ListenAndServe() error {
 		// shutdown the server with a grace period of configured timeout
 		c, cancel := context.WithTimeout(context.Background(), config.HTTP.DrainTimeout)
 		defer cancel()
+		defer registry.app.Shutdown()
 		return registry.server.Shutdown(c)
 	}
 }
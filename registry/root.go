@@ -3,8 +3,12 @@ package registry
 import (
 	"fmt"
 	"os"
+	"regexp"
+	"time"
 
 	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/notifications"
+	"github.com/docker/distribution/registry/handlers"
 	"github.com/docker/distribution/registry/storage"
 	"github.com/docker/distribution/registry/storage/driver/factory"
 	"github.com/docker/distribution/version"
@@ -19,6 +23,20 @@ func init() {
 	RootCmd.AddCommand(GCCmd)
 	GCCmd.Flags().BoolVarP(&dryRun, "dry-run", "d", false, "do everything except remove the blobs")
 	GCCmd.Flags().BoolVarP(&removeUntagged, "delete-untagged", "m", false, "delete manifests that are not currently referenced via tag")
+	GCCmd.Flags().BoolVar(&removeEmptyRepositories, "delete-empty-repositories", false, "delete repositories left without manifests or tags")
+	GCCmd.Flags().DurationVar(&activeUploadWindow, "active-upload-window", 0, "skip repositories with uploads started within this duration")
+	GCCmd.Flags().DurationVar(&staleUploadAge, "stale-upload-age", 0, "delete uploads started longer ago than this duration")
+	GCCmd.Flags().DurationVar(&untaggedGracePeriod, "untagged-grace-period", 0, "keep untagged manifests pushed within this duration")
+	GCCmd.Flags().BoolVar(&continueOnError, "continue-on-error", false, "skip unreadable manifests instead of aborting")
+	GCCmd.Flags().IntVar(&concurrency, "concurrency", 1, "number of blobs to delete in parallel")
+	GCCmd.Flags().StringVar(&repositoryAllow, "repository-allow", "", "only collect repositories matching this regular expression")
+	GCCmd.Flags().StringVar(&repositoryDeny, "repository-deny", "", "do not collect repositories matching this regular expression")
+	GCCmd.Flags().DurationVar(&lockTTL, "lock-ttl", 0, "hold a lock in storage while collecting and treat older locks as stale")
+	GCCmd.Flags().StringVar(&referrersPolicy, "referrers-policy", "independent", "how to collect manifests referring to a subject: independent, retain or follow-subject")
+	GCCmd.Flags().IntVar(&checkpointInterval, "checkpoint-interval", 0, "record marking progress whenever this many more blobs have been marked")
+	GCCmd.Flags().BoolVar(&resume, "resume", false, "resume marking from the checkpoint of an interrupted run")
+	GCCmd.Flags().Int64Var(&maxBytes, "max-bytes", 0, "stop deleting blobs once this many bytes have been reclaimed")
+	GCCmd.Flags().BoolVar(&streamingDeletes, "streaming-deletes", false, "delete the manifests of each repository once it is marked")
 	RootCmd.Flags().BoolVarP(&showVersion, "version", "v", false, "show the version and exit")
 }
 
@@ -38,6 +56,28 @@ var RootCmd = &cobra.Command{
 
 var dryRun bool
 var removeUntagged bool
+var removeEmptyRepositories bool
+var activeUploadWindow time.Duration
+var staleUploadAge time.Duration
+var untaggedGracePeriod time.Duration
+var continueOnError bool
+var concurrency int
+var repositoryAllow string
+var repositoryDeny string
+var lockTTL time.Duration
+var maxBytes int64
+var checkpointInterval int
+var resume bool
+var referrersPolicy string
+var streamingDeletes bool
+
+// referrersPolicies maps the values of the referrers-policy flag to the
+// policies they select.
+var referrersPolicies = map[string]storage.ReferrersPolicy{
+	"independent":    storage.ReferrersIndependent,
+	"retain":         storage.ReferrersRetain,
+	"follow-subject": storage.ReferrersFollowSubject,
+}
 
 // GCCmd is the cobra command that corresponds to the garbage-collect subcommand
 var GCCmd = &cobra.Command{
@@ -71,19 +111,71 @@ var GCCmd = &cobra.Command{
 			os.Exit(1)
 		}
 
-		registry, err := storage.NewRegistry(ctx, driver, storage.Schema1SigningKey(k))
+		policy, ok := referrersPolicies[referrersPolicy]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "invalid referrers policy: %s\n", referrersPolicy)
+			cmd.Usage()
+			os.Exit(1)
+		}
+
+		options := []storage.RegistryOption{storage.Schema1SigningKey(k), storage.ReferrersGCPolicy(policy)}
+		sharedOptions, err := handlers.SharedStorageOptions(config)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "configuration error: %v\n", err)
+			os.Exit(1)
+		}
+		options = append(options, sharedOptions...)
+		if streamingDeletes {
+			options = append(options, storage.GCStreamingDeletes)
+		}
+		registry, err := storage.NewRegistry(ctx, driver, options...)
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to construct registry: %v", err)
 			os.Exit(1)
 		}
 
-		err = storage.MarkAndSweep(ctx, driver, registry, storage.GCOpts{
-			DryRun:         dryRun,
-			RemoveUntagged: removeUntagged,
-		})
+		opts := storage.GCOpts{
+			DryRun:                  dryRun,
+			RemoveUntagged:          removeUntagged,
+			RemoveEmptyRepositories: removeEmptyRepositories,
+			ActiveUploadWindow:      activeUploadWindow,
+			StaleUploadAge:          staleUploadAge,
+			UntaggedGracePeriod:     untaggedGracePeriod,
+			ContinueOnError:         continueOnError,
+			Concurrency:             concurrency,
+			LockTTL:                 lockTTL,
+			MaxBytes:                maxBytes,
+			CheckpointInterval:      checkpointInterval,
+			Resume:                  resume,
+		}
+		if repositoryAllow != "" {
+			opts.RepositoryAllow, err = regexp.Compile(repositoryAllow)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid repository allow regexp: %v", err)
+				os.Exit(1)
+			}
+		}
+		if repositoryDeny != "" {
+			opts.RepositoryDeny, err = regexp.Compile(repositoryDeny)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "invalid repository deny regexp: %v", err)
+				os.Exit(1)
+			}
+		}
+
+		// report deletions to the notification endpoints of the registry
+		hostname, _ := os.Hostname()
+		events := handlers.NewEventSink(ctx, config)
+		opts.Listener = notifications.NewGCBridge(notifications.SourceRecord{Addr: hostname}, events)
+
+		summary, err := storage.MarkAndSweepSummary(ctx, driver, registry, opts)
+		events.Close()
 		if err != nil {
 			fmt.Fprintf(os.Stderr, "failed to garbage collect: %v", err)
 			os.Exit(1)
 		}
+		for _, err := range summary.Errors {
+			fmt.Fprintf(os.Stderr, "skipped: %v\n", err)
+		}
 	},
 }
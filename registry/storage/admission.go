@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/opencontainers/go-digest"
+)
+
+// maxAdmissionResponseSize limits the response body read from the admission
+// webhook.
+const maxAdmissionResponseSize = 64 << 10
+
+// manifestAdmission asks a webhook whether manifests may be stored.
+type manifestAdmission struct {
+	url      string
+	client   *http.Client
+	failOpen bool
+}
+
+// ManifestAdmissionRequest is the JSON body POSTed to the admission
+// webhook for each manifest put.
+type ManifestAdmissionRequest struct {
+	Repository string        `json:"repository"`
+	Digest     digest.Digest `json:"digest"`
+	MediaType  string        `json:"mediaType"`
+	Size       int           `json:"size"`
+}
+
+// ManifestAdmissionResponse is the JSON body the admission webhook answers
+// with. The manifest is rejected with Reason unless Allowed is set.
+type ManifestAdmissionResponse struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// ManifestAdmissionWebhook is a functional option for NewRegistry. Before
+// a manifest is stored, a ManifestAdmissionRequest describing it is POSTed
+// to url, which must answer with a ManifestAdmissionResponse within timeout.
+// Manifests that are not allowed are rejected as invalid. A webhook that
+// fails to answer rejects every manifest, unless ManifestAdmissionFailOpen
+// is set.
+func ManifestAdmissionWebhook(url string, timeout time.Duration) RegistryOption {
+	return func(registry *registry) error {
+		failOpen := registry.manifestAdmission != nil && registry.manifestAdmission.failOpen
+		registry.manifestAdmission = &manifestAdmission{
+			url:      url,
+			client:   &http.Client{Timeout: timeout},
+			failOpen: failOpen,
+		}
+		return nil
+	}
+}
+
+// ManifestAdmissionFailOpen is a functional option for NewRegistry. It
+// makes manifests be stored when the admission webhook fails to answer,
+// instead of rejecting them. It must follow ManifestAdmissionWebhook.
+func ManifestAdmissionFailOpen(registry *registry) error {
+	if registry.manifestAdmission == nil {
+		return fmt.Errorf("no manifest admission webhook configured")
+	}
+	registry.manifestAdmission.failOpen = true
+	return nil
+}
+
+// admit asks the webhook whether manifest, stored under the given
+// algorithm, may be put into the named repository.
+func (a *manifestAdmission) admit(ctx context.Context, name string, algorithm digest.Algorithm, manifest distribution.Manifest) error {
+	mediaType, payload, err := manifest.Payload()
+	if err != nil {
+		return err
+	}
+
+	response, err := a.ask(ctx, ManifestAdmissionRequest{
+		Repository: name,
+		Digest:     algorithm.FromBytes(payload),
+		MediaType:  mediaType,
+		Size:       len(payload),
+	})
+	if err != nil {
+		if a.failOpen {
+			dcontext.GetLogger(ctx).Errorf("admitting manifest after admission webhook failed: %v", err)
+			return nil
+		}
+		return distribution.ErrManifestVerification{distribution.ErrManifestAdmissionDenied{Reason: err.Error()}}
+	}
+	if !response.Allowed {
+		return distribution.ErrManifestVerification{distribution.ErrManifestAdmissionDenied{Reason: response.Reason}}
+	}
+	return nil
+}
+
+// ask POSTs request to the webhook and decodes its response.
+func (a *manifestAdmission) ask(ctx context.Context, request ManifestAdmissionRequest) (*ManifestAdmissionResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("admission webhook unavailable: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("admission webhook answered with status %d", resp.StatusCode)
+	}
+
+	var response ManifestAdmissionResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxAdmissionResponseSize)).Decode(&response); err != nil {
+		return nil, fmt.Errorf("invalid admission webhook response: %v", err)
+	}
+	return &response, nil
+}
@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestManifestAdmissionWebhook(t *testing.T) {
+	ctx := context.Background()
+
+	var requests []ManifestAdmissionRequest
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request ManifestAdmissionRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("error decoding admission request: %v", err)
+		}
+		requests = append(requests, request)
+
+		response := ManifestAdmissionResponse{Allowed: request.Repository == "foo/allowed"}
+		if !response.Allowed {
+			response.Reason = "unsigned image"
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer webhook.Close()
+
+	registry := createRegistry(t, inmemory.New(), ManifestAdmissionWebhook(webhook.URL, time.Second))
+	for _, name := range []string{"foo/allowed", "foo/denied"} {
+		repository := makeRepository(t, registry, name)
+		manifest := makeAdmissionManifest(t, repository)
+		_, payload, _ := manifest.Payload()
+
+		requests = nil
+		_, err := makeManifestService(t, repository).Put(ctx, manifest)
+		if len(requests) != 1 {
+			t.Fatalf("%s: expected 1 admission request, got %d", name, len(requests))
+		}
+		expected := ManifestAdmissionRequest{
+			Repository: name,
+			Digest:     digest.FromBytes(payload),
+			MediaType:  schema2.MediaTypeManifest,
+			Size:       len(payload),
+		}
+		if requests[0] != expected {
+			t.Errorf("%s: unexpected admission request: %#v != %#v", name, requests[0], expected)
+		}
+
+		if name == "foo/allowed" {
+			if err != nil {
+				t.Fatalf("unexpected error putting admitted manifest: %v", err)
+			}
+			continue
+		}
+		assertAdmissionDenied(t, err, "unsigned image")
+	}
+}
+
+func TestManifestAdmissionWebhookUnavailable(t *testing.T) {
+	ctx := context.Background()
+
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer webhook.Close()
+
+	registry := createRegistry(t, inmemory.New(), ManifestAdmissionWebhook(webhook.URL, time.Second))
+	repository := makeRepository(t, registry, "foo/closed")
+	_, err := makeManifestService(t, repository).Put(ctx, makeAdmissionManifest(t, repository))
+	assertAdmissionDenied(t, err, "status 500")
+
+	registry = createRegistry(t, inmemory.New(), ManifestAdmissionWebhook(webhook.URL, time.Second), ManifestAdmissionFailOpen)
+	repository = makeRepository(t, registry, "foo/open")
+	if _, err := makeManifestService(t, repository).Put(ctx, makeAdmissionManifest(t, repository)); err != nil {
+		t.Fatalf("unexpected error putting manifest with failing webhook open: %v", err)
+	}
+}
+
+func makeAdmissionManifest(t *testing.T, repository distribution.Repository) distribution.Manifest {
+	layers, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.UploadBlobs(repository, layers); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := testutil.MakeSchema2Manifest(repository, getKeys(layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return manifest
+}
+
+func assertAdmissionDenied(t *testing.T, err error, reason string) {
+	verificationErrs, ok := err.(distribution.ErrManifestVerification)
+	if !ok || len(verificationErrs) != 1 {
+		t.Fatalf("expected a manifest verification error, got %v", err)
+	}
+	denied, ok := verificationErrs[0].(distribution.ErrManifestAdmissionDenied)
+	if !ok {
+		t.Fatalf("expected ErrManifestAdmissionDenied, got %v", verificationErrs[0])
+	}
+	if !strings.Contains(denied.Reason, reason) {
+		t.Errorf("expected reason containing %q, got %q", reason, denied.Reason)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"path"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/reference"
@@ -244,8 +245,8 @@ func TestSimpleBlobUpload(t *testing.T) {
 	}
 	bs = repository.Blobs(ctx)
 	err = bs.Delete(ctx, desc.Digest)
-	if err == nil {
-		t.Errorf("Unexpected success deleting while disabled")
+	if err != distribution.ErrDeleteDisabled {
+		t.Errorf("expected ErrDeleteDisabled deleting while disabled, got %v", err)
 	}
 }
 
@@ -611,3 +612,386 @@ func addBlob(ctx context.Context, bs distribution.BlobIngester, desc distributio
 
 	return wr.Commit(ctx, desc)
 }
+
+// TestBlobStoreWalk pages through the blob store and checks that every blob
+// is visited exactly once, in enumeration order.
+func TestBlobStoreWalk(t *testing.T) {
+	ctx := context.Background()
+	imageName, _ := reference.WithName("foo/bar")
+	driver := testdriver.New()
+	reg, err := NewRegistry(ctx, driver, BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()), EnableDelete, EnableRedirect)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repository, err := reg.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+
+	layers, err := testutil.CreateRandomLayers(7)
+	if err != nil {
+		t.Fatalf("failed to create random layers: %v", err)
+	}
+	if err := testutil.UploadBlobs(repository, layers); err != nil {
+		t.Fatalf("failed to upload blobs: %v", err)
+	}
+
+	bs := reg.(*registry).blobStore
+	var expected []digest.Digest
+	if err := bs.Enumerate(ctx, func(dgst digest.Digest) error {
+		expected = append(expected, dgst)
+		return nil
+	}); err != nil {
+		t.Fatalf("failed to enumerate blobs: %v", err)
+	}
+
+	var walked []digest.Digest
+	var last digest.Digest
+	for {
+		next, err := bs.Walk(ctx, last, 3, func(dgst digest.Digest) error {
+			walked = append(walked, dgst)
+			return nil
+		})
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to walk blobs: %v", err)
+		}
+		last = next
+	}
+
+	if !reflect.DeepEqual(walked, expected) {
+		t.Fatalf("walked blobs do not match enumeration: %v != %v", walked, expected)
+	}
+}
+
+func TestNegativeStatCache(t *testing.T) {
+	ctx := context.Background()
+	imageName, _ := reference.WithName("foo/bar")
+	driver := testdriver.New()
+	reg, err := NewRegistry(ctx, driver, BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()), NegativeStatCacheTTL(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repository, err := reg.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	statter := reg.(*registry).blobStore.statter
+
+	content := []byte("negative stat cache")
+	dgst := digest.FromBytes(content)
+	if _, err := statter.Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected ErrBlobUnknown for absent blob, got %v", err)
+	}
+
+	// content written behind the registry's back stays unknown while the
+	// negative entry is live
+	blobPath, err := pathFor(blobDataPathSpec{digest: dgst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.PutContent(ctx, blobPath, content); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := statter.Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected cached ErrBlobUnknown, got %v", err)
+	}
+
+	// a put through the registry invalidates the negative entry
+	if _, err := repository.Blobs(ctx).Put(ctx, "application/octet-stream", content); err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	if desc, err := statter.Stat(ctx, dgst); err != nil || desc.Size != int64(len(content)) {
+		t.Fatalf("unexpected stat after put: %v, %v", desc, err)
+	}
+
+	// so does an upload
+	layers, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("failed to create random layers: %v", err)
+	}
+	for layerDigest := range layers {
+		if _, err := statter.Stat(ctx, layerDigest); err != distribution.ErrBlobUnknown {
+			t.Fatalf("expected ErrBlobUnknown for absent layer, got %v", err)
+		}
+	}
+	if err := testutil.UploadBlobs(repository, layers); err != nil {
+		t.Fatalf("failed to upload blobs: %v", err)
+	}
+	for layerDigest := range layers {
+		if _, err := statter.Stat(ctx, layerDigest); err != nil {
+			t.Fatalf("unexpected error stating uploaded layer: %v", err)
+		}
+	}
+}
+
+func TestInvalidateBlobDescriptorCache(t *testing.T) {
+	ctx := context.Background()
+	imageName, _ := reference.WithName("foo/bar")
+	driver := testdriver.New()
+	reg, err := NewRegistry(ctx, driver, BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()), NegativeStatCacheTTL(time.Hour))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	invalidator := reg.(*registry)
+	repository, err := reg.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	blobs := repository.Blobs(ctx)
+
+	content := []byte("invalidated descriptor cache")
+	desc, err := blobs.Put(ctx, "application/octet-stream", content)
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	blobPath, err := pathFor(blobDataPathSpec{digest: desc.Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the blob deleted behind the registry's back is still cached
+	if err := driver.Delete(ctx, blobPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blobs.Stat(ctx, desc.Digest); err != nil {
+		t.Fatalf("expected the cached descriptor, got %v", err)
+	}
+
+	// the repository cache is dropped, but the registry still caches the blob
+	if err := invalidator.InvalidateBlobDescriptorCache(ctx, imageName.Name()); err != nil {
+		t.Fatalf("unexpected error invalidating repository cache: %v", err)
+	}
+	if _, err := blobs.Stat(ctx, desc.Digest); err != nil {
+		t.Fatalf("expected the descriptor cached for the registry, got %v", err)
+	}
+
+	if err := invalidator.InvalidateBlobDescriptorCache(ctx, ""); err != nil {
+		t.Fatalf("unexpected error invalidating cache: %v", err)
+	}
+	if _, err := blobs.Stat(ctx, desc.Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected ErrBlobUnknown after invalidating cache, got %v", err)
+	}
+
+	// the blob restored behind the registry's back is remembered as unknown
+	// until the cache is invalidated, and then cached again
+	if err := driver.PutContent(ctx, blobPath, content); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blobs.Stat(ctx, desc.Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected cached ErrBlobUnknown, got %v", err)
+	}
+	if err := invalidator.InvalidateBlobDescriptorCache(ctx, ""); err != nil {
+		t.Fatalf("unexpected error invalidating cache: %v", err)
+	}
+	if _, err := blobs.Stat(ctx, desc.Digest); err != nil {
+		t.Fatalf("unexpected error statting restored blob: %v", err)
+	}
+	if _, err := invalidator.blobDescriptorCacheProvider.Stat(ctx, desc.Digest); err != nil {
+		t.Fatalf("expected the restored blob to be cached again, got %v", err)
+	}
+
+	uncached, err := NewRegistry(ctx, driver)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	if err := uncached.(*registry).InvalidateBlobDescriptorCache(ctx, ""); err != distribution.ErrUnsupported {
+		t.Fatalf("expected ErrUnsupported invalidating without a cache, got %v", err)
+	}
+}
+
+func TestDefaultDigestAlgorithm(t *testing.T) {
+	ctx := context.Background()
+	imageName, _ := reference.WithName("foo/bar")
+	driver := testdriver.New()
+	reg, err := NewRegistry(ctx, driver, DefaultDigestAlgorithm(digest.SHA512))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repository, err := reg.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	bs := repository.Blobs(ctx)
+
+	content := []byte("sha512 blob")
+	desc, err := bs.Put(ctx, "application/octet-stream", content)
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	if desc.Digest != digest.SHA512.FromBytes(content) {
+		t.Fatalf("expected sha512 digest, got %v", desc.Digest)
+	}
+
+	blobPath, err := pathFor(blobDataPathSpec{digest: desc.Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := driver.Stat(ctx, blobPath); err != nil {
+		t.Fatalf("expected blob data under %s: %v", blobPath, err)
+	}
+
+	// uploads digested by the client with sha256 are canonicalized to sha512
+	// but remain reachable by the client's digest
+	layer := []byte("sha512 layer")
+	canonical := digest.SHA512.FromBytes(layer)
+	for _, dgst := range []digest.Digest{canonical, digest.SHA256.FromBytes(layer)} {
+		upload, err := addBlob(ctx, bs, distribution.Descriptor{Digest: dgst, Size: int64(len(layer))}, bytes.NewReader(layer))
+		if err != nil {
+			t.Fatalf("unexpected error uploading %v: %v", dgst, err)
+		}
+		if upload.Digest != canonical {
+			t.Fatalf("expected canonical digest %v, got %v", canonical, upload.Digest)
+		}
+
+		stat, err := bs.Stat(ctx, dgst)
+		if err != nil {
+			t.Fatalf("unexpected error statting %v: %v", dgst, err)
+		}
+		if stat.Size != int64(len(layer)) {
+			t.Fatalf("unexpected size for %v: %d", dgst, stat.Size)
+		}
+
+		p, err := bs.Get(ctx, dgst)
+		if err != nil {
+			t.Fatalf("unexpected error getting %v: %v", dgst, err)
+		}
+		if !bytes.Equal(p, layer) {
+			t.Fatalf("unexpected content for %v: %q", dgst, p)
+		}
+	}
+
+	if _, err := NewRegistry(ctx, driver, DefaultDigestAlgorithm("bogus")); err == nil {
+		t.Fatalf("expected error for unavailable digest algorithm")
+	}
+}
+
+// TestBlobCommitDigestMismatch checks that committing content under a digest
+// it does not have reports the digest of the content, in the algorithm of
+// the expected digest.
+func TestBlobCommitDigestMismatch(t *testing.T) {
+	ctx := context.Background()
+	imageName, _ := reference.WithName("foo/mismatch")
+	registry, err := NewRegistry(ctx, testdriver.New())
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repository, err := registry.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	bs := repository.Blobs(ctx)
+
+	content := []byte("truncated upl")
+	for _, expected := range []digest.Digest{
+		digest.FromString("truncated upload"),
+		digest.SHA512.FromString("truncated upload"),
+	} {
+		_, err := addBlob(ctx, bs, distribution.Descriptor{Digest: expected, Size: int64(len(content))}, bytes.NewReader(content))
+		invalid, ok := err.(distribution.ErrBlobInvalidDigest)
+		if !ok {
+			t.Fatalf("expected ErrBlobInvalidDigest committing under %s, got %v", expected, err)
+		}
+		if computed := expected.Algorithm().FromBytes(content); invalid.Digest != expected || invalid.Computed != computed || invalid.Size != int64(len(content)) {
+			t.Fatalf("unexpected error committing under %s: %#v", expected, invalid)
+		}
+	}
+
+	// content matching a digest of another algorithm is still accepted
+	desc, err := addBlob(ctx, bs, distribution.Descriptor{Digest: digest.SHA512.FromBytes(content), Size: int64(len(content))}, bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("unexpected error committing under a sha512 digest: %v", err)
+	}
+	if desc.Digest != digest.FromBytes(content) {
+		t.Fatalf("unexpected canonical digest: %s", desc.Digest)
+	}
+}
+
+func TestBlobPathShardingReadsLegacyBlobs(t *testing.T) {
+	ctx := context.Background()
+	driver := testdriver.New()
+	imageName, _ := reference.WithName("foo/bar")
+
+	// the blob is written before the registry is sharded further
+	legacy, err := NewRegistry(ctx, driver)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	legacyRepo, err := legacy.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	legacyContent := []byte("written with the legacy layout")
+	legacyDesc, err := legacyRepo.Blobs(ctx).Put(ctx, "application/octet-stream", legacyContent)
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+
+	reg, err := NewRegistry(ctx, driver, BlobPathSharding([]int{2, 2}), BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repo, err := reg.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	blobs := repo.Blobs(ctx)
+
+	if desc, err := blobs.Stat(ctx, legacyDesc.Digest); err != nil || desc.Size != int64(len(legacyContent)) {
+		t.Fatalf("expected the legacy blob to be stated with size %d, got %v: %v", len(legacyContent), desc, err)
+	}
+	if p, err := blobs.Get(ctx, legacyDesc.Digest); err != nil || !bytes.Equal(p, legacyContent) {
+		t.Fatalf("expected the legacy blob to be read, got %q: %v", p, err)
+	}
+	rc, err := blobs.Open(ctx, legacyDesc.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error opening legacy blob: %v", err)
+	}
+	p, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || !bytes.Equal(p, legacyContent) {
+		t.Fatalf("expected the legacy blob to be opened, got %q: %v", p, err)
+	}
+
+	// new blobs are written with the configured layout only
+	shardedContent := []byte("written with the sharded layout")
+	desc, err := addBlob(ctx, blobs, distribution.Descriptor{Digest: digest.FromBytes(shardedContent), Size: int64(len(shardedContent))}, bytes.NewReader(shardedContent))
+	if err != nil {
+		t.Fatalf("unexpected error uploading blob: %v", err)
+	}
+	shardedPath, _ := pathFor(blobDataPathSpec{digest: desc.Digest, layout: blobPathLayout{2, 2}})
+	if _, err := driver.Stat(ctx, shardedPath); err != nil {
+		t.Fatalf("expected the blob to be written at %s: %v", shardedPath, err)
+	}
+	legacyPath, _ := pathFor(blobDataPathSpec{digest: desc.Digest})
+	if _, err := driver.Stat(ctx, legacyPath); err == nil {
+		t.Fatalf("expected no blob to be written at %s", legacyPath)
+	}
+
+	enumerated := make(map[digest.Digest]struct{})
+	if err := reg.Blobs().Enumerate(ctx, func(dgst digest.Digest) error {
+		enumerated[dgst] = struct{}{}
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error enumerating blobs: %v", err)
+	}
+	if _, ok := enumerated[legacyDesc.Digest]; !ok || len(enumerated) != 2 {
+		t.Fatalf("expected both blobs to be enumerated, got %v", enumerated)
+	}
+
+	vacuum := NewRegistryVacuum(ctx, driver, reg)
+	for _, dgst := range []digest.Digest{legacyDesc.Digest, desc.Digest} {
+		if err := vacuum.RemoveBlob(dgst.String()); err != nil {
+			t.Fatalf("unexpected error removing blob %v: %v", dgst, err)
+		}
+		if _, err := reg.BlobStatter().Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+			t.Fatalf("expected removed blob %v to be unknown, got %v", dgst, err)
+		}
+	}
+
+	if _, err := NewRegistry(ctx, driver, BlobPathSharding([]int{2, 0})); err == nil {
+		t.Fatalf("expected an empty prefix to be refused")
+	}
+}
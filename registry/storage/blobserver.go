@@ -3,10 +3,16 @@ package storage
 import (
 	"context"
 	"fmt"
+	"io"
 	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/cache"
 	"github.com/docker/distribution/registry/storage/driver"
 	"github.com/opencontainers/go-digest"
 )
@@ -19,8 +25,19 @@ const blobCacheControlMaxAge = 365 * 24 * time.Hour
 type blobServer struct {
 	driver   driver.StorageDriver
 	statter  distribution.BlobStatter
-	pathFn   func(dgst digest.Digest) (string, error)
+	pathFn   func(ctx context.Context, dgst digest.Digest) (string, error)
 	redirect bool // allows disabling URLFor redirects
+
+	// redirectDenyUserAgent, if set, matches the user agents of the
+	// requests always served directly
+	redirectDenyUserAgent *regexp.Regexp
+
+	// redirectVerifyExistence stats the blob in storage before redirecting
+	// to it
+	redirectVerifyExistence bool
+
+	// digests, if set, remembers the digests computed for Accept-Digest
+	digests cache.AlgorithmDigestCache
 }
 
 func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *http.Request, dgst digest.Digest) error {
@@ -29,13 +46,30 @@ func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *h
 		return err
 	}
 
-	path, err := bs.pathFn(desc.Digest)
+	path, err := bs.pathFn(ctx, desc.Digest)
 	if err != nil {
 		return err
 	}
 
-	if bs.redirect {
-		redirectURL, err := bs.driver.URLFor(ctx, path, map[string]interface{}{"method": r.Method})
+	if bs.redirect && (bs.redirectDenyUserAgent == nil || !bs.redirectDenyUserAgent.MatchString(r.UserAgent())) {
+		// a descriptor may be cached for a blob deleted from storage, which
+		// the backend would answer with an error of its own
+		if bs.redirectVerifyExistence {
+			if err := bs.verifyExistence(ctx, dgst, path); err != nil {
+				return err
+			}
+		}
+
+		// drivers able to override the headers the backend serves the blob
+		// with are asked for its media type; others ignore the option
+		mediaType := desc.MediaType
+		if mediaType == "" {
+			mediaType = "application/octet-stream"
+		}
+		redirectURL, err := bs.driver.URLFor(ctx, path, map[string]interface{}{
+			"method":              r.Method,
+			"responsecontenttype": mediaType,
+		})
 		switch err.(type) {
 		case nil:
 			// Redirect to storage URL.
@@ -50,14 +84,36 @@ func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *h
 		}
 	}
 
+	// the time the blob was stored is its Last-Modified, letting caches
+	// revalidate with If-Modified-Since
+	fi, err := bs.driver.Stat(ctx, path)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return distribution.ErrBlobUnknown
+		}
+		return err
+	}
+
 	br, err := newFileReader(ctx, bs.driver, path, desc.Size)
 	if err != nil {
 		return err
 	}
 	defer br.Close()
 
+	// blobs are addressed by their content, so they never change
 	w.Header().Set("ETag", fmt.Sprintf(`"%s"`, desc.Digest)) // If-None-Match handled by ServeContent
-	w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%.f", blobCacheControlMaxAge.Seconds()))
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, immutable, max-age=%.f", blobCacheControlMaxAge.Seconds()))
+
+	if alg := acceptedAlgorithm(r, desc.Digest.Algorithm()); alg != "" && w.Header().Get("Docker-Content-Digest") == "" {
+		// serving the stored digest is the fallback for any failure
+		alternate, err := bs.algorithmDigest(ctx, desc, path, alg)
+		if err != nil {
+			dcontext.GetLogger(ctx).Errorf("error computing %s digest of %s: %v", alg, desc.Digest, err)
+		} else {
+			w.Header().Set("Docker-Content-Digest", alternate.String())
+			w.Header().Add("Vary", "Accept-Digest")
+		}
+	}
 
 	if w.Header().Get("Docker-Content-Digest") == "" {
 		w.Header().Set("Docker-Content-Digest", desc.Digest.String())
@@ -73,6 +129,94 @@ func (bs *blobServer) ServeBlob(ctx context.Context, w http.ResponseWriter, r *h
 		w.Header().Set("Content-Length", fmt.Sprint(desc.Size))
 	}
 
-	http.ServeContent(w, r, desc.Digest.String(), time.Time{}, br)
+	// ServeContent answers Range requests with 206 or 416 and replaces the
+	// Content-Length, seeking the file reader to open the driver's reader at
+	// the requested offset. It sets Last-Modified and answers conditional
+	// requests with 304.
+	http.ServeContent(w, r, desc.Digest.String(), fi.ModTime(), br)
 	return nil
 }
+
+// verifyExistence returns distribution.ErrBlobUnknown if the blob dgst is
+// missing at path, dropping any descriptor cached for it.
+func (bs *blobServer) verifyExistence(ctx context.Context, dgst digest.Digest, path string) error {
+	_, err := bs.driver.Stat(ctx, path)
+	if _, ok := err.(driver.PathNotFoundError); !ok {
+		return err
+	}
+
+	if cached, ok := bs.statter.(distribution.BlobDescriptorService); ok {
+		if err := cached.Clear(ctx, dgst); err != nil && err != distribution.ErrUnsupported && err != distribution.ErrBlobUnknown {
+			dcontext.GetLogger(ctx).Errorf("error clearing cached descriptor (%v): %v", dgst, err)
+		}
+	}
+	return distribution.ErrBlobUnknown
+}
+
+// algorithmDigest returns the digest of the blob described by desc, stored
+// at path, computed with alg. The content is read unless the digest is
+// cached.
+func (bs *blobServer) algorithmDigest(ctx context.Context, desc distribution.Descriptor, path string, alg digest.Algorithm) (digest.Digest, error) {
+	if bs.digests != nil {
+		if alternate, err := bs.digests.AlgorithmDigest(ctx, desc.Digest, alg); err == nil {
+			return alternate, nil
+		}
+	}
+
+	br, err := newFileReader(ctx, bs.driver, path, desc.Size)
+	if err != nil {
+		return "", err
+	}
+	defer br.Close()
+
+	digester := alg.Digester()
+	if _, err := io.Copy(digester.Hash(), br); err != nil {
+		return "", err
+	}
+	alternate := digester.Digest()
+
+	if bs.digests != nil {
+		if err := bs.digests.SetAlgorithmDigest(ctx, desc.Digest, alternate); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error caching %s digest of %s: %v", alg, desc.Digest, err)
+		}
+	}
+	return alternate, nil
+}
+
+// acceptedAlgorithm returns the available algorithm the Accept-Digest
+// headers of r prefer, by their q values, or "" if they accept the stored
+// algorithm or name no available one.
+func acceptedAlgorithm(r *http.Request, stored digest.Algorithm) digest.Algorithm {
+	var preferred digest.Algorithm
+	preferredQ := 0.0
+	for _, header := range r.Header["Accept-Digest"] {
+		for _, accepted := range strings.Split(header, ",") {
+			params := strings.Split(accepted, ";")
+
+			// both sha256 and the sha-256 of RFC 3230 are understood
+			name := strings.ToLower(strings.TrimSpace(params[0]))
+			alg := digest.Algorithm(strings.Replace(name, "-", "", -1))
+
+			q := 1.0
+			for _, param := range params[1:] {
+				param = strings.TrimSpace(param)
+				if strings.HasPrefix(param, "q=") {
+					if v, err := strconv.ParseFloat(param[len("q="):], 64); err == nil {
+						q = v
+					}
+				}
+			}
+
+			if q <= 0 || !alg.Available() {
+				continue
+			}
+			if alg == stored {
+				return ""
+			}
+			if q > preferredQ {
+				preferred, preferredQ = alg, q
+			}
+		}
+	}
+	return preferred
+}
@@ -0,0 +1,378 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/cache"
+	"github.com/docker/distribution/registry/storage/cache/memory"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestBlobServerRange(t *testing.T) {
+	ctx := context.Background()
+	reg, err := NewRegistry(ctx, inmemory.New(), BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	registry := reg.(*registry)
+
+	content := []byte("0123456789abcdef")
+	desc, err := registry.blobStore.Put(ctx, "application/octet-stream", content)
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+
+	serve := func(rangeHeader string) *http.Response {
+		r := httptest.NewRequest("GET", "/", nil)
+		if rangeHeader != "" {
+			r.Header.Set("Range", rangeHeader)
+		}
+		w := httptest.NewRecorder()
+		if err := registry.blobServer.ServeBlob(ctx, w, r, desc.Digest); err != nil {
+			t.Fatalf("unexpected error serving blob: %v", err)
+		}
+		return w.Result()
+	}
+
+	for _, tc := range []struct {
+		rangeHeader  string
+		status       int
+		contentRange string
+		body         string
+	}{
+		{rangeHeader: "", status: http.StatusOK, body: string(content)},
+		{rangeHeader: "bytes=4-9", status: http.StatusPartialContent, contentRange: fmt.Sprintf("bytes 4-9/%d", len(content)), body: "456789"},
+		{rangeHeader: "bytes=10-", status: http.StatusPartialContent, contentRange: fmt.Sprintf("bytes 10-15/%d", len(content)), body: "abcdef"},
+		{rangeHeader: "bytes=-3", status: http.StatusPartialContent, contentRange: fmt.Sprintf("bytes 13-15/%d", len(content)), body: "def"},
+		{rangeHeader: "bytes=100-200", status: http.StatusRequestedRangeNotSatisfiable},
+		{rangeHeader: "bytes=9-4", status: http.StatusRequestedRangeNotSatisfiable},
+	} {
+		resp := serve(tc.rangeHeader)
+		if resp.StatusCode != tc.status {
+			t.Fatalf("unexpected status for range %q: %d != %d", tc.rangeHeader, resp.StatusCode, tc.status)
+		}
+		if resp.Header.Get("Content-Range") != tc.contentRange && tc.status != http.StatusRequestedRangeNotSatisfiable {
+			t.Fatalf("unexpected content range for range %q: %q != %q", tc.rangeHeader, resp.Header.Get("Content-Range"), tc.contentRange)
+		}
+		if tc.body == "" {
+			continue
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("unexpected error reading body: %v", err)
+		}
+		if string(body) != tc.body {
+			t.Fatalf("unexpected body for range %q: %q != %q", tc.rangeHeader, body, tc.body)
+		}
+		if resp.Header.Get("Content-Length") != fmt.Sprint(len(tc.body)) {
+			t.Fatalf("unexpected content length for range %q: %s", tc.rangeHeader, resp.Header.Get("Content-Length"))
+		}
+	}
+}
+
+func TestBlobServerAcceptDigest(t *testing.T) {
+	ctx := context.Background()
+	cacheProvider := memory.NewInMemoryBlobDescriptorCacheProvider()
+	reg, err := NewRegistry(ctx, inmemory.New(), BlobDescriptorCacheProvider(cacheProvider))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	registry := reg.(*registry)
+
+	content := []byte("0123456789abcdef")
+	desc, err := registry.blobStore.Put(ctx, "application/octet-stream", content)
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+	sha512Digest := digest.SHA512.FromBytes(content)
+
+	for _, tc := range []struct {
+		acceptDigest string
+		expected     digest.Digest
+	}{
+		{"", desc.Digest},
+		{"sha512", sha512Digest},
+		{"SHA-512", sha512Digest},
+		{"sha384;q=0.2, sha512;q=0.5", sha512Digest},
+		{"sha512;q=0.5, sha256;q=0.1", desc.Digest},
+		{"sha512;q=0, md5", desc.Digest},
+	} {
+		r := httptest.NewRequest("HEAD", "/", nil)
+		if tc.acceptDigest != "" {
+			r.Header.Set("Accept-Digest", tc.acceptDigest)
+		}
+		w := httptest.NewRecorder()
+		if err := registry.blobServer.ServeBlob(ctx, w, r, desc.Digest); err != nil {
+			t.Fatalf("unexpected error serving blob: %v", err)
+		}
+		if dgst := w.Result().Header.Get("Docker-Content-Digest"); dgst != tc.expected.String() {
+			t.Errorf("unexpected digest accepting %q: %s != %s", tc.acceptDigest, dgst, tc.expected)
+		}
+	}
+
+	cached, err := cacheProvider.(cache.AlgorithmDigestCache).AlgorithmDigest(ctx, desc.Digest, digest.SHA512)
+	if err != nil {
+		t.Fatalf("expected the computed digest to be cached: %v", err)
+	}
+	if cached != sha512Digest {
+		t.Fatalf("unexpected cached digest: %s != %s", cached, sha512Digest)
+	}
+}
+
+// redirectingDriver records the options of URLFor calls.
+type redirectingDriver struct {
+	storagedriver.StorageDriver
+	options map[string]interface{}
+}
+
+func (d *redirectingDriver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	d.options = options
+	return "https://storage.example.com" + path, nil
+}
+
+func (d *redirectingDriver) Capabilities() storagedriver.Capabilities {
+	capabilities := d.StorageDriver.Capabilities()
+	capabilities.URLFor = true
+	return capabilities
+}
+
+func TestBlobServerRedirectContentType(t *testing.T) {
+	ctx := context.Background()
+	d := &redirectingDriver{StorageDriver: inmemory.New()}
+	reg, err := NewRegistry(ctx, d, BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()), EnableRedirect)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	registry := reg.(*registry)
+
+	desc, err := registry.blobStore.Put(ctx, "application/octet-stream", []byte("content"))
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	if err := registry.blobServer.ServeBlob(ctx, w, httptest.NewRequest("GET", "/", nil), desc.Digest); err != nil {
+		t.Fatalf("unexpected error serving blob: %v", err)
+	}
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("unexpected status %d, expected a redirect", w.Code)
+	}
+	if contentType := d.options["responsecontenttype"]; contentType != "application/octet-stream" {
+		t.Fatalf("unexpected response content type requested: %v", contentType)
+	}
+	if method := d.options["method"]; method != "GET" {
+		t.Fatalf("unexpected method requested: %v", method)
+	}
+}
+
+func TestBlobServerRedirectDenyUserAgent(t *testing.T) {
+	ctx := context.Background()
+	d := &redirectingDriver{StorageDriver: inmemory.New()}
+	reg, err := NewRegistry(ctx, d, BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()), EnableRedirect, RedirectDenyUserAgentRegexp(regexp.MustCompile("^ci-runner/")))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	registry := reg.(*registry)
+
+	desc, err := registry.blobStore.Put(ctx, "application/octet-stream", []byte("content"))
+	if err != nil {
+		t.Fatalf("unexpected error putting blob: %v", err)
+	}
+
+	for _, tc := range []struct {
+		userAgent string
+		status    int
+	}{
+		{userAgent: "docker/18.09.0", status: http.StatusTemporaryRedirect},
+		{userAgent: "ci-runner/1.2", status: http.StatusOK},
+		{userAgent: "", status: http.StatusTemporaryRedirect},
+	} {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("User-Agent", tc.userAgent)
+		w := httptest.NewRecorder()
+		if err := registry.blobServer.ServeBlob(ctx, w, r, desc.Digest); err != nil {
+			t.Fatalf("unexpected error serving blob: %v", err)
+		}
+		if w.Code != tc.status {
+			t.Fatalf("unexpected status %d for user agent %q, expected %d", w.Code, tc.userAgent, tc.status)
+		}
+		if tc.status == http.StatusOK && w.Body.String() != "content" {
+			t.Fatalf("unexpected body for user agent %q: %q", tc.userAgent, w.Body.String())
+		}
+	}
+}
+
+func TestBlobServerRedirectVerifyExistence(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		options []RegistryOption
+		verify  bool
+	}{
+		{options: []RegistryOption{EnableRedirect}},
+		{options: []RegistryOption{EnableRedirect, RedirectVerifyExistence}, verify: true},
+	} {
+		d := &redirectingDriver{StorageDriver: inmemory.New()}
+		options := append([]RegistryOption{BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider())}, tc.options...)
+		reg, err := NewRegistry(ctx, d, options...)
+		if err != nil {
+			t.Fatalf("error creating registry: %v", err)
+		}
+		registry := reg.(*registry)
+
+		desc, err := registry.blobStore.Put(ctx, "application/octet-stream", []byte("content"))
+		if err != nil {
+			t.Fatalf("unexpected error putting blob: %v", err)
+		}
+		serve := func() (int, error) {
+			w := httptest.NewRecorder()
+			err := registry.blobServer.ServeBlob(ctx, w, httptest.NewRequest("GET", "/", nil), desc.Digest)
+			return w.Code, err
+		}
+		if code, err := serve(); err != nil || code != http.StatusTemporaryRedirect {
+			t.Fatalf("verify %v: expected a redirect to the stored blob, got %d: %v", tc.verify, code, err)
+		}
+
+		// the blob is deleted from the backend while its descriptor is cached
+		blobPath, err := pathFor(blobDataPathSpec{digest: desc.Digest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Delete(ctx, blobPath); err != nil {
+			t.Fatalf("unexpected error deleting blob: %v", err)
+		}
+
+		code, err := serve()
+		if !tc.verify {
+			if err != nil || code != http.StatusTemporaryRedirect {
+				t.Fatalf("expected a redirect without verifying, got %d: %v", code, err)
+			}
+			continue
+		}
+		if err != distribution.ErrBlobUnknown {
+			t.Fatalf("expected the deleted blob to be unknown, got %d: %v", code, err)
+		}
+		if _, err := registry.blobServer.statter.Stat(ctx, desc.Digest); err != distribution.ErrBlobUnknown {
+			t.Fatalf("expected the cached descriptor of the deleted blob to be dropped, got %v", err)
+		}
+	}
+}
+
+func TestBlobServerRedirectUnsupported(t *testing.T) {
+	ctx := context.Background()
+	reg, err := NewRegistry(ctx, inmemory.New(), BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider()), EnableRedirect)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	if reg.(*registry).blobServer.redirect {
+		t.Fatalf("redirect enabled on a driver unable to make URLs")
+	}
+
+	reg, err = NewRegistry(ctx, &redirectingDriver{StorageDriver: inmemory.New()}, EnableRedirect)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	if !reg.(*registry).blobServer.redirect {
+		t.Fatalf("redirect disabled on a driver making URLs")
+	}
+}
+
+func TestBlobServerRecordedMediaType(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		name       string
+		options    []RegistryOption
+		uploaded   string
+		referenced string
+	}{
+		{"uploaded", []RegistryOption{RecordBlobMediaTypes}, "application/vnd.example.artifact", "application/vnd.example.artifact"},
+		{"referenced", []RegistryOption{RecordBlobMediaTypes}, schema2.MediaTypeLayer, schema2.MediaTypeLayer},
+		{"disabled", nil, "application/octet-stream", "application/octet-stream"},
+	} {
+		options := append([]RegistryOption{BlobDescriptorCacheProvider(memory.NewInMemoryBlobDescriptorCacheProvider())}, tc.options...)
+		reg := createRegistry(t, inmemory.New(), options...)
+		repo := makeRepository(t, reg, "foo/mediatypes")
+		blobs := repo.Blobs(ctx)
+
+		// the layer is uploaded with the media type of the first case only
+		layers, err := testutil.CreateRandomLayers(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var layer digest.Digest
+		for dgst, rs := range layers {
+			layer = dgst
+			content, err := ioutil.ReadAll(rs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			declared := "application/octet-stream"
+			if tc.name == "uploaded" {
+				declared = tc.uploaded
+			}
+			wr, err := blobs.Create(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := wr.Write(content); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := wr.Commit(ctx, distribution.Descriptor{Digest: dgst, MediaType: declared}); err != nil {
+				t.Fatalf("%s: unexpected error committing blob: %v", tc.name, err)
+			}
+		}
+
+		serve := func() string {
+			w := httptest.NewRecorder()
+			if err := blobs.ServeBlob(ctx, w, httptest.NewRequest("GET", "/", nil), layer); err != nil {
+				t.Fatalf("%s: unexpected error serving blob: %v", tc.name, err)
+			}
+			return w.Header().Get("Content-Type")
+		}
+		if tc.name == "uploaded" {
+			if contentType := serve(); contentType != tc.uploaded {
+				t.Fatalf("%s: expected uploaded blob to be served as %q, got %q", tc.name, tc.uploaded, contentType)
+			}
+		}
+
+		// the manifest declares the layer with its schema2 media type, which
+		// only replaces the default one
+		desc, err := blobs.Stat(ctx, layer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		builder := schema2.NewManifestBuilder(blobs, schema2.MediaTypeImageConfig, []byte("{}"))
+		if err := builder.AppendReference(distribution.Descriptor{Digest: layer, Size: desc.Size, MediaType: schema2.MediaTypeLayer}); err != nil {
+			t.Fatal(err)
+		}
+		manifest, err := builder.Build(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := makeManifestService(t, repo).Put(ctx, manifest); err != nil {
+			t.Fatalf("%s: unexpected error putting manifest: %v", tc.name, err)
+		}
+		if contentType := serve(); contentType != tc.referenced {
+			t.Fatalf("%s: expected referenced blob to be served as %q, got %q", tc.name, tc.referenced, contentType)
+		}
+
+		// the recorded media type is also served for the registry as a whole
+		w := httptest.NewRecorder()
+		if err := reg.(*registry).blobServer.ServeBlob(ctx, w, httptest.NewRequest("GET", "/", nil), layer); err != nil {
+			t.Fatalf("%s: unexpected error serving blob: %v", tc.name, err)
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != tc.referenced {
+			t.Fatalf("%s: expected blob to be served as %q by the registry, got %q", tc.name, tc.referenced, contentType)
+		}
+	}
+}
@@ -2,7 +2,11 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"io"
+	"mime"
 	"path"
+	"strings"
 
 	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
@@ -17,13 +21,24 @@ import (
 type blobStore struct {
 	driver  driver.StorageDriver
 	statter distribution.BlobStatter
+
+	// algorithm addresses content written to the store. The zero value
+	// selects digest.Canonical.
+	algorithm digest.Algorithm
+
+	// mediaTypes records the media types blobs are declared with.
+	mediaTypes bool
+
+	// layout lays out the paths blobs are written to. Blobs written with
+	// the legacy layout are read as well.
+	layout blobPathLayout
 }
 
 var _ distribution.BlobProvider = &blobStore{}
 
 // Get implements the BlobReadService.Get call.
 func (bs *blobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
-	bp, err := bs.path(dgst)
+	bp, err := bs.readPath(ctx, dgst)
 	if err != nil {
 		return nil, err
 	}
@@ -47,7 +62,7 @@ func (bs *blobStore) Open(ctx context.Context, dgst digest.Digest) (distribution
 		return nil, err
 	}
 
-	path, err := bs.path(desc.Digest)
+	path, err := bs.readPath(ctx, desc.Digest)
 	if err != nil {
 		return nil, err
 	}
@@ -59,7 +74,7 @@ func (bs *blobStore) Open(ctx context.Context, dgst digest.Digest) (distribution
 // content is already present, only the digest will be returned. This should
 // only be used for small objects, such as manifests. This implemented as a convenience for other Put implementations
 func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distribution.Descriptor, error) {
-	dgst := digest.FromBytes(p)
+	dgst := bs.digestAlgorithm().FromBytes(p)
 	desc, err := bs.statter.Stat(ctx, dgst)
 	if err == nil {
 		// content already present
@@ -76,7 +91,7 @@ func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distr
 	}
 
 	// TODO(stevvooe): Write out mediatype here, as well.
-	return distribution.Descriptor{
+	desc = distribution.Descriptor{
 		Size: int64(len(p)),
 
 		// NOTE(stevvooe): The central blob store firewalls media types from
@@ -84,7 +99,106 @@ func (bs *blobStore) Put(ctx context.Context, mediaType string, p []byte) (distr
 		// for the specific repository.
 		MediaType: "application/octet-stream",
 		Digest:    dgst,
-	}, bs.driver.PutContent(ctx, bp, p)
+	}
+	if err := bs.driver.PutContent(ctx, bp, p); err != nil {
+		return desc, err
+	}
+
+	bs.setDescriptor(ctx, desc)
+	return desc, nil
+}
+
+// digestAlgorithm returns the algorithm addressing content written to the
+// store.
+func (bs *blobStore) digestAlgorithm() digest.Algorithm {
+	if bs.algorithm == "" {
+		return digest.Canonical
+	}
+	return bs.algorithm
+}
+
+// setDescriptor hands the descriptor of newly written content to the statter
+// when it is cached, replacing any cached knowledge that the blob is unknown.
+func (bs *blobStore) setDescriptor(ctx context.Context, desc distribution.Descriptor) {
+	cached, ok := bs.statter.(distribution.BlobDescriptorService)
+	if !ok {
+		return
+	}
+
+	if err := cached.SetDescriptor(ctx, desc.Digest, desc); err != nil && err != distribution.ErrUnsupported {
+		dcontext.GetLogger(ctx).Errorf("blobStore: error caching descriptor (%v): %v", desc.Digest, err)
+	}
+}
+
+// recordMediaType stores mediaType next to the blob dgst, if media types are
+// recorded and the blob has none yet, and reports whether it did. Failing to
+// record it is only logged, since the content is stored already.
+func (bs *blobStore) recordMediaType(ctx context.Context, dgst digest.Digest, mediaType string) bool {
+	if !bs.mediaTypes {
+		return false
+	}
+	if parsed, _, err := mime.ParseMediaType(mediaType); err != nil || parsed == "application/octet-stream" {
+		return false
+	}
+
+	written, err := bs.writeMediaType(ctx, dgst, mediaType)
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("blobStore: error recording media type of %v: %v", dgst, err)
+		return false
+	}
+	if !written {
+		return false
+	}
+
+	// drop the descriptor cached with the default media type
+	if cached, ok := bs.statter.(distribution.BlobDescriptorService); ok {
+		if err := cached.Clear(ctx, dgst); err != nil && err != distribution.ErrUnsupported && err != distribution.ErrBlobUnknown {
+			dcontext.GetLogger(ctx).Errorf("blobStore: error clearing cached descriptor (%v): %v", dgst, err)
+		}
+	}
+	return true
+}
+
+// writeMediaType writes the media type sidecar of the blob dgst, unless the
+// blob doesn't exist or has its media type recorded already. It reports
+// whether the sidecar was written.
+func (bs *blobStore) writeMediaType(ctx context.Context, dgst digest.Digest, mediaType string) (bool, error) {
+	// the sidecar would otherwise create the blob directory
+	layout, _, err := statBlobData(ctx, bs.driver, bs.layout, dgst)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+
+	mediaTypePath, err := pathFor(blobMediaTypePathSpec{digest: dgst, layout: layout})
+	if err != nil {
+		return false, err
+	}
+	if _, err := bs.driver.Stat(ctx, mediaTypePath); err == nil {
+		return false, nil
+	} else if _, ok := err.(driver.PathNotFoundError); !ok {
+		return false, err
+	}
+
+	if err := bs.driver.PutContent(ctx, mediaTypePath, []byte(mediaType)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// readMediaType returns the media type recorded at mediaTypePath, or an
+// empty string if there is none.
+func readMediaType(ctx context.Context, storageDriver driver.StorageDriver, mediaTypePath string) (string, error) {
+	content, err := storageDriver.GetContent(ctx, mediaTypePath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return "", nil
+		}
+		return "", err
+	}
+	return string(content), nil
 }
 
 func (bs *blobStore) Enumerate(ctx context.Context, ingester func(dgst digest.Digest) error) error {
@@ -115,11 +229,80 @@ func (bs *blobStore) Enumerate(ctx context.Context, ingester func(dgst digest.Di
 	})
 }
 
+// Walk calls fn for up to limit blobs, in the lexical order of the
+// underlying walk, starting after the blob last. An empty last starts at
+// the beginning. It returns the digest of the last blob visited, to be
+// passed as last on the next call, and io.EOF once no blobs remain.
+func (bs *blobStore) Walk(ctx context.Context, last digest.Digest, limit int, fn func(dgst digest.Digest) error) (digest.Digest, error) {
+	if limit <= 0 {
+		return "", errors.New("limit must be positive")
+	}
+
+	specPath, err := pathFor(blobsPathSpec{})
+	if err != nil {
+		return "", err
+	}
+
+	var lastPath string
+	if last != "" {
+		lastPath, err = bs.readPath(ctx, last)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var (
+		next    digest.Digest
+		visited int
+	)
+	err = bs.driver.Walk(ctx, specPath, func(fileInfo driver.FileInfo) error {
+		if visited == limit {
+			return driver.ErrSkipDir
+		}
+
+		currentPath := fileInfo.Path()
+		if fileInfo.IsDir() {
+			// skip directories entirely before the cursor
+			if currentPath < lastPath && !strings.HasPrefix(lastPath, currentPath+"/") {
+				return driver.ErrSkipDir
+			}
+			return nil
+		}
+
+		// we only want to parse paths that end with /data
+		_, fileName := path.Split(currentPath)
+		if fileName != "data" || currentPath <= lastPath {
+			return nil
+		}
+
+		dgst, err := digestFromPath(currentPath)
+		if err != nil {
+			return err
+		}
+		if err := fn(dgst); err != nil {
+			return err
+		}
+
+		next = dgst
+		visited++
+		return nil
+	})
+	if err != nil {
+		return next, err
+	}
+	if visited < limit {
+		return next, io.EOF
+	}
+
+	return next, nil
+}
+
 // path returns the canonical path for the blob identified by digest. The blob
 // may or may not exist.
 func (bs *blobStore) path(dgst digest.Digest) (string, error) {
 	bp, err := pathFor(blobDataPathSpec{
 		digest: dgst,
+		layout: bs.layout,
 	})
 
 	if err != nil {
@@ -129,6 +312,48 @@ func (bs *blobStore) path(dgst digest.Digest) (string, error) {
 	return bp, nil
 }
 
+// readPath returns the path the blob identified by digest is stored at,
+// which is its canonical path unless it was written with the legacy layout.
+func (bs *blobStore) readPath(ctx context.Context, dgst digest.Digest) (string, error) {
+	if bs.layout.legacy() {
+		return bs.path(dgst)
+	}
+
+	layout, _, err := statBlobData(ctx, bs.driver, bs.layout, dgst)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return bs.path(dgst)
+	} else if err != nil {
+		return "", err
+	}
+	return pathFor(blobDataPathSpec{digest: dgst, layout: layout})
+}
+
+// statBlobData stats the data of the blob dgst at its path laid out with
+// layout and, failing that, at its legacy path. It returns the layout the
+// data was found with, or a PathNotFoundError for the path of layout.
+func statBlobData(ctx context.Context, storageDriver driver.StorageDriver, layout blobPathLayout, dgst digest.Digest) (blobPathLayout, driver.FileInfo, error) {
+	dataPath, err := pathFor(blobDataPathSpec{digest: dgst, layout: layout})
+	if err != nil {
+		return nil, nil, err
+	}
+	fi, err := storageDriver.Stat(ctx, dataPath)
+	if _, ok := err.(driver.PathNotFoundError); !ok || layout.legacy() {
+		return layout, fi, err
+	}
+
+	legacyPath, legacyErr := pathFor(blobDataPathSpec{digest: dgst})
+	if legacyErr != nil {
+		return nil, nil, legacyErr
+	}
+	legacyFi, legacyErr := storageDriver.Stat(ctx, legacyPath)
+	if _, ok := legacyErr.(driver.PathNotFoundError); ok {
+		return layout, nil, err
+	} else if legacyErr != nil {
+		return nil, nil, legacyErr
+	}
+	return nil, legacyFi, nil
+}
+
 // link links the path to the provided digest by writing the digest into the
 // target file. Caller must ensure that the blob actually exists.
 func (bs *blobStore) link(ctx context.Context, path string, dgst digest.Digest) error {
@@ -154,6 +379,12 @@ func (bs *blobStore) readlink(ctx context.Context, path string) (digest.Digest,
 
 type blobStatter struct {
 	driver driver.StorageDriver
+
+	// mediaTypes resolves the media types recorded for blobs.
+	mediaTypes bool
+
+	// layout lays out the paths of blobs, as for blobStore.
+	layout blobPathLayout
 }
 
 var _ distribution.BlobDescriptorService = &blobStatter{}
@@ -162,15 +393,7 @@ var _ distribution.BlobDescriptorService = &blobStatter{}
 // in the main blob store. If this method returns successfully, there is
 // strong guarantee that the blob exists and is available.
 func (bs *blobStatter) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
-	path, err := pathFor(blobDataPathSpec{
-		digest: dgst,
-	})
-
-	if err != nil {
-		return distribution.Descriptor{}, err
-	}
-
-	fi, err := bs.driver.Stat(ctx, path)
+	layout, fi, err := statBlobData(ctx, bs.driver, bs.layout, dgst)
 	if err != nil {
 		switch err := err.(type) {
 		case driver.PathNotFoundError:
@@ -184,15 +407,11 @@ func (bs *blobStatter) Stat(ctx context.Context, dgst digest.Digest) (distributi
 		// NOTE(stevvooe): This represents a corruption situation. Somehow, we
 		// calculated a blob path and then detected a directory. We log the
 		// error and then error on the side of not knowing about the blob.
-		dcontext.GetLogger(ctx).Warnf("blob path should not be a directory: %q", path)
+		dcontext.GetLogger(ctx).Warnf("blob path should not be a directory: %q", fi.Path())
 		return distribution.Descriptor{}, distribution.ErrBlobUnknown
 	}
 
-	// TODO(stevvooe): Add method to resolve the mediatype. We can store and
-	// cache a "global" media type for the blob, even if a specific repo has a
-	// mediatype that overrides the main one.
-
-	return distribution.Descriptor{
+	desc := distribution.Descriptor{
 		Size: fi.Size(),
 
 		// NOTE(stevvooe): The central blob store firewalls media types from
@@ -200,7 +419,22 @@ func (bs *blobStatter) Stat(ctx context.Context, dgst digest.Digest) (distributi
 		// for the specific repository.
 		MediaType: "application/octet-stream",
 		Digest:    dgst,
-	}, nil
+	}
+
+	if bs.mediaTypes {
+		mediaTypePath, err := pathFor(blobMediaTypePathSpec{digest: dgst, layout: layout})
+		if err != nil {
+			return distribution.Descriptor{}, err
+		}
+		// a blob is still served if its media type can't be read
+		if mediaType, err := readMediaType(ctx, bs.driver, mediaTypePath); err != nil {
+			dcontext.GetLogger(ctx).Errorf("error reading media type of %v: %v", dgst, err)
+		} else if mediaType != "" {
+			desc.MediaType = mediaType
+		}
+	}
+
+	return desc, nil
 }
 
 func (bs *blobStatter) Clear(ctx context.Context, dgst digest.Digest) error {
@@ -71,10 +71,29 @@ func (bw *blobWriter) Commit(ctx context.Context, desc distribution.Descriptor)
 		return distribution.Descriptor{}, err
 	}
 
+	// a blob already linked into the repository adds nothing to its usage
+	quota, added := bw.blobStore.repositoryQuota(), canonical.Size
+	if quota != nil {
+		if _, err := bw.blobStore.blobAccessController.Stat(ctx, canonical.Digest); err == nil {
+			added = 0
+		}
+		if err := quota.check(ctx, bw.blobStore, added); err != nil {
+			return distribution.Descriptor{}, err
+		}
+	}
+
 	if err := bw.moveBlob(ctx, canonical); err != nil {
 		return distribution.Descriptor{}, err
 	}
 
+	// the central blob store firewalls media types from other users
+	bw.blobStore.blobStore.setDescriptor(ctx, distribution.Descriptor{
+		Size:      canonical.Size,
+		MediaType: "application/octet-stream",
+		Digest:    canonical.Digest,
+	})
+	bw.blobStore.blobStore.recordMediaType(ctx, canonical.Digest, canonical.MediaType)
+
 	if err := bw.blobStore.linkBlob(ctx, canonical, desc.Digest); err != nil {
 		return distribution.Descriptor{}, err
 	}
@@ -88,6 +107,10 @@ func (bw *blobWriter) Commit(ctx context.Context, desc distribution.Descriptor)
 		return distribution.Descriptor{}, err
 	}
 
+	if quota != nil {
+		quota.added(bw.blobStore.repository.Named().Name(), added)
+	}
+
 	bw.committed = true
 	return canonical, nil
 }
@@ -166,6 +189,10 @@ func (bw *blobWriter) validateBlob(ctx context.Context, desc distribution.Descri
 	var (
 		verified, fullHash bool
 		canonical          digest.Digest
+
+		// computed is the digest of the content in the algorithm of the
+		// provided digest, for reporting a mismatch
+		computed digest.Digest
 	)
 
 	if desc.Digest == "" {
@@ -216,7 +243,8 @@ func (bw *blobWriter) validateBlob(ctx context.Context, desc distribution.Descri
 
 		if canonical.Algorithm() == desc.Digest.Algorithm() {
 			// Common case: client and server prefer the same canonical digest
-			// algorithm - currently SHA256.
+			// algorithm - SHA256 unless configured otherwise.
+			computed = canonical
 			verified = desc.Digest == canonical
 		} else {
 			// The client wants to use a different digest algorithm. They'll just
@@ -236,8 +264,9 @@ func (bw *blobWriter) validateBlob(ctx context.Context, desc distribution.Descri
 		// the same, we don't need to read the data from the backend. This is
 		// because we've written the entire file in the lifecycle of the
 		// current instance.
-		if bw.written == size && digest.Canonical == desc.Digest.Algorithm() {
+		if bw.written == size && bw.blobStore.blobStore.digestAlgorithm() == desc.Digest.Algorithm() {
 			canonical = bw.digester.Digest()
+			computed = canonical
 			verified = desc.Digest == canonical
 		}
 
@@ -245,8 +274,8 @@ func (bw *blobWriter) validateBlob(ctx context.Context, desc distribution.Descri
 		// paths. We may be able to make the size-based check a stronger
 		// guarantee, so this may be defensive.
 		if !verified {
-			digester := digest.Canonical.Digester()
-			verifier := desc.Digest.Verifier()
+			digester := bw.blobStore.blobStore.digestAlgorithm().Digester()
+			provided := desc.Digest.Algorithm().Digester()
 
 			// Read the file from the backend driver and validate it.
 			fr, err := newFileReader(ctx, bw.driver, bw.path, desc.Size)
@@ -257,25 +286,31 @@ func (bw *blobWriter) validateBlob(ctx context.Context, desc distribution.Descri
 
 			tr := io.TeeReader(fr, digester.Hash())
 
-			if _, err := io.Copy(verifier, tr); err != nil {
+			if _, err := io.Copy(provided.Hash(), tr); err != nil {
 				return distribution.Descriptor{}, err
 			}
 
 			canonical = digester.Digest()
-			verified = verifier.Verified()
+			computed = provided.Digest()
+			verified = desc.Digest == computed
 		}
 	}
 
 	if !verified {
 		dcontext.GetLoggerWithFields(ctx,
 			map[interface{}]interface{}{
-				"canonical": canonical,
-				"provided":  desc.Digest,
-			}, "canonical", "provided").
+				"canonical":       canonical,
+				"provided":        desc.Digest,
+				"computed":        computed,
+				"upload.id":       bw.id,
+				"upload.received": size,
+			}, "canonical", "provided", "computed", "upload.id", "upload.received").
 			Errorf("canonical digest does match provided digest")
 		return distribution.Descriptor{}, distribution.ErrBlobInvalidDigest{
-			Digest: desc.Digest,
-			Reason: fmt.Errorf("content does not match digest"),
+			Digest:   desc.Digest,
+			Reason:   fmt.Errorf("content of %d bytes has digest %s", size, computed),
+			Computed: computed,
+			Size:     size,
 		}
 	}
 
@@ -293,16 +328,13 @@ func (bw *blobWriter) validateBlob(ctx context.Context, desc distribution.Descri
 // identified by dgst. The layer should be validated before commencing the
 // move.
 func (bw *blobWriter) moveBlob(ctx context.Context, desc distribution.Descriptor) error {
-	blobPath, err := pathFor(blobDataPathSpec{
-		digest: desc.Digest,
-	})
-
+	blobPath, err := bw.blobStore.blobStore.path(desc.Digest)
 	if err != nil {
 		return err
 	}
 
-	// Check for existence
-	if _, err := bw.blobStore.driver.Stat(ctx, blobPath); err != nil {
+	// Check for existence, with any layout
+	if _, _, err := statBlobData(ctx, bw.blobStore.driver, bw.blobStore.blobStore.layout, desc.Digest); err != nil {
 		switch err := err.(type) {
 		case storagedriver.PathNotFoundError:
 			break // ensure that it doesn't exist.
@@ -329,7 +361,7 @@ func (bw *blobWriter) moveBlob(ctx context.Context, desc distribution.Descriptor
 			// a zero-length blob into a nonzero-length blob location. To
 			// prevent this horrid thing, we employ the hack of only allowing
 			// to this happen for the digest of an empty blob.
-			if desc.Digest == digestSha256Empty {
+			if desc.Digest == desc.Digest.Algorithm().FromBytes(nil) {
 				return bw.blobStore.driver.PutContent(ctx, blobPath, []byte{})
 			}
 
@@ -351,6 +383,10 @@ func (bw *blobWriter) moveBlob(ctx context.Context, desc distribution.Descriptor
 // instance. An error will be returned if the clean up cannot proceed. If the
 // resources are already not present, no error will be returned.
 func (bw *blobWriter) removeResources(ctx context.Context) error {
+	if limiter := bw.blobStore.uploadLimiter(); limiter != nil {
+		limiter.release(bw.blobStore.repository.Named().Name(), bw.id)
+	}
+
 	dataPath, err := pathFor(uploadDataPathSpec{
 		name: bw.blobStore.repository.Named().Name(),
 		id:   bw.id,
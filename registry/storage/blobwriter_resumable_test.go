@@ -0,0 +1,50 @@
+// +build !noresumabledigest
+
+package storage
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestResumableDigestRepositoryDenyRegexp(t *testing.T) {
+	ctx := context.Background()
+	reg, err := NewRegistry(ctx, inmemory.New(), ResumableDigestRepositoryDenyRegexp(regexp.MustCompile("^proxied/")))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	for name, expectStates := range map[string]bool{
+		"proxied/foo": false,
+		"local/foo":   true,
+	} {
+		imageName, _ := reference.WithName(name)
+		repository, err := reg.Repository(ctx, imageName)
+		if err != nil {
+			t.Fatalf("unexpected error getting repo: %v", err)
+		}
+
+		wr, err := repository.Blobs(ctx).Create(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error starting upload to %s: %v", name, err)
+		}
+		if _, err := wr.Write([]byte("resumable")); err != nil {
+			t.Fatalf("unexpected error writing upload to %s: %v", name, err)
+		}
+		if err := wr.Close(); err != nil {
+			t.Fatalf("unexpected error closing upload to %s: %v", name, err)
+		}
+
+		hashStates, err := wr.(*blobWriter).getStoredHashStates(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error listing hash states of %s: %v", name, err)
+		}
+		if stored := len(hashStates) > 0; stored != expectStates {
+			t.Fatalf("unexpected hash state persistence for %s: %v != %v", name, stored, expectStates)
+		}
+	}
+}
@@ -3,9 +3,11 @@
 package cache
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/docker/distribution"
+	"github.com/opencontainers/go-digest"
 )
 
 // BlobDescriptorCacheProvider provides repository scoped
@@ -14,6 +16,26 @@ type BlobDescriptorCacheProvider interface {
 	distribution.BlobDescriptorService
 
 	RepositoryScoped(repo string) (distribution.BlobDescriptorService, error)
+
+	// Invalidate drops the descriptors cached for the repository repo, or
+	// all cached descriptors if repo is empty, so that they are read from
+	// storage again. Digests computed with other algorithms only depend on
+	// the content and are kept.
+	Invalidate(ctx context.Context, repo string) error
+}
+
+// AlgorithmDigestCache is implemented by providers which also remember the
+// digests of blobs computed with algorithms other than the one they are
+// stored under. Since a digest only depends on the content, entries never
+// need to be cleared.
+type AlgorithmDigestCache interface {
+	// AlgorithmDigest returns the digest computed with alg of the blob
+	// stored as dgst, or distribution.ErrBlobUnknown if it isn't cached.
+	AlgorithmDigest(ctx context.Context, dgst digest.Digest, alg digest.Algorithm) (digest.Digest, error)
+
+	// SetAlgorithmDigest remembers that the blob stored as dgst has the
+	// digest alternate.
+	SetAlgorithmDigest(ctx context.Context, dgst, alternate digest.Digest) error
 }
 
 // ValidateDescriptor provides a helper function to ensure that caches have
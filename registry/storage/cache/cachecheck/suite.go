@@ -3,6 +3,7 @@ package cachecheck
 import (
 	"context"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/docker/distribution"
@@ -19,6 +20,39 @@ func CheckBlobDescriptorCache(t *testing.T, provider cache.BlobDescriptorCachePr
 	checkBlobDescriptorCacheEmptyRepository(ctx, t, provider)
 	checkBlobDescriptorCacheSetAndRead(ctx, t, provider)
 	checkBlobDescriptorCacheClear(ctx, t, provider)
+	checkBlobDescriptorCacheInvalidate(ctx, t, provider)
+	if algorithmDigests, ok := provider.(cache.AlgorithmDigestCache); ok {
+		checkAlgorithmDigestCache(ctx, t, algorithmDigests)
+	}
+}
+
+func checkAlgorithmDigestCache(ctx context.Context, t *testing.T, algorithmDigests cache.AlgorithmDigestCache) {
+	dgst := digest.Digest("sha256:4d6c1b0e1d3b5e8a2f8c4e1b9a7d3c5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1c")
+	alternate := digest.Digest("sha512:" + "ab12" + strings.Repeat("0", 124))
+
+	if _, err := algorithmDigests.AlgorithmDigest(ctx, dgst, digest.SHA512); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected unknown blob error for uncached digest: %v", err)
+	}
+
+	if err := algorithmDigests.SetAlgorithmDigest(ctx, dgst, "sha512:abc"); err == nil {
+		t.Fatalf("expected error setting invalid digest")
+	}
+
+	if err := algorithmDigests.SetAlgorithmDigest(ctx, dgst, alternate); err != nil {
+		t.Fatalf("unexpected error setting digest: %v", err)
+	}
+
+	cached, err := algorithmDigests.AlgorithmDigest(ctx, dgst, digest.SHA512)
+	if err != nil {
+		t.Fatalf("unexpected error getting digest: %v", err)
+	}
+	if cached != alternate {
+		t.Fatalf("expected %v, got %v", alternate, cached)
+	}
+
+	if _, err := algorithmDigests.AlgorithmDigest(ctx, dgst, digest.SHA384); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected unknown blob error for another algorithm: %v", err)
+	}
 }
 
 func checkBlobDescriptorCacheEmptyRepository(ctx context.Context, t *testing.T, provider cache.BlobDescriptorCacheProvider) {
@@ -178,3 +212,58 @@ func checkBlobDescriptorCacheClear(ctx context.Context, t *testing.T, provider c
 		t.Fatalf("expected error statting deleted blob: %v", err)
 	}
 }
+
+func checkBlobDescriptorCacheInvalidate(ctx context.Context, t *testing.T, provider cache.BlobDescriptorCacheProvider) {
+	expected := distribution.Descriptor{
+		Digest:    "sha256:fed1111111111111111111111111111111111111111111111111111111111111",
+		Size:      10,
+		MediaType: "application/octet-stream"}
+
+	invalidated, err := provider.RepositoryScoped("foo/invalidated")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+	kept, err := provider.RepositoryScoped("foo/kept")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+	for _, scoped := range []distribution.BlobDescriptorService{invalidated, kept} {
+		if err := scoped.SetDescriptor(ctx, expected.Digest, expected); err != nil {
+			t.Fatalf("error setting descriptor: %v", err)
+		}
+	}
+
+	if err := provider.Invalidate(ctx, "foo/invalidated"); err != nil {
+		t.Fatalf("unexpected error invalidating repository: %v", err)
+	}
+	if _, err := invalidated.Stat(ctx, expected.Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected unknown blob error in invalidated repository: %v", err)
+	}
+	if _, err := kept.Stat(ctx, expected.Digest); err != nil {
+		t.Fatalf("unexpected error statting descriptor of another repository: %v", err)
+	}
+	if _, err := provider.Stat(ctx, expected.Digest); err != nil {
+		t.Fatalf("unexpected error statting global descriptor: %v", err)
+	}
+
+	// a miss repopulates the cache
+	repopulated, err := provider.RepositoryScoped("foo/invalidated")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+	if err := repopulated.SetDescriptor(ctx, expected.Digest, expected); err != nil {
+		t.Fatalf("error setting descriptor: %v", err)
+	}
+	if desc, err := repopulated.Stat(ctx, expected.Digest); err != nil || !reflect.DeepEqual(desc, expected) {
+		t.Fatalf("expected repopulated descriptor %#v, got %#v, %v", expected, desc, err)
+	}
+
+	if err := provider.Invalidate(ctx, ""); err != nil {
+		t.Fatalf("unexpected error invalidating cache: %v", err)
+	}
+	for _, scoped := range []distribution.BlobDescriptorService{repopulated, kept, provider} {
+		if _, err := scoped.Stat(ctx, expected.Digest); err != distribution.ErrBlobUnknown {
+			t.Fatalf("expected unknown blob error after invalidating cache: %v", err)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package cache
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/docker/distribution"
 	prometheus "github.com/docker/distribution/metrics"
@@ -37,8 +39,18 @@ type cachedBlobStatter struct {
 	cache   distribution.BlobDescriptorService
 	backend distribution.BlobDescriptorService
 	tracker MetricsTracker
+
+	// unknownTTL is how long an ErrBlobUnknown from the backend is
+	// remembered. Zero disables negative caching.
+	unknownTTL time.Duration
+	mu         sync.Mutex
+	unknown    map[digest.Digest]time.Time
 }
 
+// maxUnknownEntries bounds the number of remembered unknown digests so that
+// requests for many distinct absent blobs cannot grow the cache unbounded.
+const maxUnknownEntries = 10000
+
 var (
 	// cacheCount is the number of total cache request received/hits/misses
 	cacheCount = prometheus.StorageNamespace.NewLabeledCounter("cache", "The number of cache request received", "type")
@@ -63,6 +75,20 @@ func NewCachedBlobStatterWithMetrics(cache distribution.BlobDescriptorService, b
 	}
 }
 
+// NewCachedBlobStatterWithUnknownTTL creates a new statter which prefers a
+// cache and falls back to a backend. In addition, ErrBlobUnknown returned by
+// the backend is remembered in memory for ttl, so repeated requests for an
+// absent blob do not reach the backend. Setting a descriptor for the digest
+// drops the remembered error.
+func NewCachedBlobStatterWithUnknownTTL(cache distribution.BlobDescriptorService, backend distribution.BlobDescriptorService, ttl time.Duration) distribution.BlobDescriptorService {
+	return &cachedBlobStatter{
+		cache:      cache,
+		backend:    backend,
+		unknownTTL: ttl,
+		unknown:    make(map[digest.Digest]time.Time),
+	}
+}
+
 func (cbds *cachedBlobStatter) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
 	cacheCount.WithValues("Request").Inc(1)
 	desc, err := cbds.cache.Stat(ctx, dgst)
@@ -79,12 +105,22 @@ func (cbds *cachedBlobStatter) Stat(ctx context.Context, dgst digest.Digest) (di
 	}
 	return desc, nil
 fallback:
+	if cbds.isUnknown(dgst) {
+		cacheCount.WithValues("Hit").Inc(1)
+		if cbds.tracker != nil {
+			cbds.tracker.Hit()
+		}
+		return distribution.Descriptor{}, distribution.ErrBlobUnknown
+	}
 	cacheCount.WithValues("Miss").Inc(1)
 	if cbds.tracker != nil {
 		cbds.tracker.Miss()
 	}
 	desc, err = cbds.backend.Stat(ctx, dgst)
 	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			cbds.setUnknown(dgst)
+		}
 		return desc, err
 	}
 
@@ -97,6 +133,8 @@ fallback:
 }
 
 func (cbds *cachedBlobStatter) Clear(ctx context.Context, dgst digest.Digest) error {
+	cbds.forgetUnknown(dgst)
+
 	err := cbds.cache.Clear(ctx, dgst)
 	if err != nil {
 		return err
@@ -110,12 +148,79 @@ func (cbds *cachedBlobStatter) Clear(ctx context.Context, dgst digest.Digest) er
 }
 
 func (cbds *cachedBlobStatter) SetDescriptor(ctx context.Context, dgst digest.Digest, desc distribution.Descriptor) error {
+	cbds.forgetUnknown(dgst)
+
 	if err := cbds.cache.SetDescriptor(ctx, dgst, desc); err != nil {
 		logErrorf(ctx, cbds.tracker, "error adding descriptor %v to cache: %v", desc.Digest, err)
 	}
 	return nil
 }
 
+// isUnknown reports whether the backend recently reported dgst as unknown.
+func (cbds *cachedBlobStatter) isUnknown(dgst digest.Digest) bool {
+	if cbds.unknownTTL <= 0 {
+		return false
+	}
+
+	cbds.mu.Lock()
+	defer cbds.mu.Unlock()
+
+	expires, ok := cbds.unknown[dgst]
+	if !ok {
+		return false
+	}
+	if time.Now().After(expires) {
+		delete(cbds.unknown, dgst)
+		return false
+	}
+	return true
+}
+
+func (cbds *cachedBlobStatter) setUnknown(dgst digest.Digest) {
+	if cbds.unknownTTL <= 0 {
+		return
+	}
+
+	cbds.mu.Lock()
+	defer cbds.mu.Unlock()
+
+	now := time.Now()
+	if len(cbds.unknown) >= maxUnknownEntries {
+		for d, expires := range cbds.unknown {
+			if now.After(expires) {
+				delete(cbds.unknown, d)
+			}
+		}
+		if len(cbds.unknown) >= maxUnknownEntries {
+			return
+		}
+	}
+	cbds.unknown[dgst] = now.Add(cbds.unknownTTL)
+}
+
+func (cbds *cachedBlobStatter) forgetUnknown(dgst digest.Digest) {
+	if cbds.unknownTTL <= 0 {
+		return
+	}
+
+	cbds.mu.Lock()
+	delete(cbds.unknown, dgst)
+	cbds.mu.Unlock()
+}
+
+// ForgetUnknown drops the digests statter remembers as unknown, if it was
+// created by NewCachedBlobStatterWithUnknownTTL.
+func ForgetUnknown(statter distribution.BlobStatter) {
+	cbds, ok := statter.(*cachedBlobStatter)
+	if !ok || cbds.unknownTTL <= 0 {
+		return
+	}
+
+	cbds.mu.Lock()
+	cbds.unknown = make(map[digest.Digest]time.Time)
+	cbds.mu.Unlock()
+}
+
 func logErrorf(ctx context.Context, tracker MetricsTracker, format string, args ...interface{}) {
 	if tracker == nil {
 		return
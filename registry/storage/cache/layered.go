@@ -0,0 +1,142 @@
+package cache
+
+import (
+	"context"
+
+	"github.com/docker/distribution"
+	"github.com/opencontainers/go-digest"
+)
+
+// layeredBlobDescriptorCacheProvider composes a fast cache, usually held in
+// process memory, in front of a slow shared one such as redis.
+type layeredBlobDescriptorCacheProvider struct {
+	layeredBlobDescriptorService
+
+	fast BlobDescriptorCacheProvider
+	slow BlobDescriptorCacheProvider
+}
+
+// NewLayeredBlobDescriptorCacheProvider returns a BlobDescriptorCacheProvider
+// which answers from fast when it can and falls back to slow, copying
+// descriptors found there into fast. Descriptors are written through to both.
+// Since fast is only populated, never invalidated, by other processes sharing
+// slow, it should be bounded in size.
+func NewLayeredBlobDescriptorCacheProvider(fast, slow BlobDescriptorCacheProvider) BlobDescriptorCacheProvider {
+	return &layeredBlobDescriptorCacheProvider{
+		layeredBlobDescriptorService: layeredBlobDescriptorService{
+			fast: fast,
+			slow: slow,
+		},
+		fast: fast,
+		slow: slow,
+	}
+}
+
+// AlgorithmDigest answers from fast, falling back to slow, as far as they
+// remember digests computed with other algorithms.
+func (lbdcp *layeredBlobDescriptorCacheProvider) AlgorithmDigest(ctx context.Context, dgst digest.Digest, alg digest.Algorithm) (digest.Digest, error) {
+	fast, _ := lbdcp.fast.(AlgorithmDigestCache)
+	if fast != nil {
+		alternate, err := fast.AlgorithmDigest(ctx, dgst, alg)
+		if err != distribution.ErrBlobUnknown {
+			return alternate, err
+		}
+	}
+
+	slow, ok := lbdcp.slow.(AlgorithmDigestCache)
+	if !ok {
+		return "", distribution.ErrBlobUnknown
+	}
+	alternate, err := slow.AlgorithmDigest(ctx, dgst, alg)
+	if err != nil {
+		return "", err
+	}
+	if fast != nil {
+		fast.SetAlgorithmDigest(ctx, dgst, alternate)
+	}
+	return alternate, nil
+}
+
+// SetAlgorithmDigest writes through to those of fast and slow remembering
+// digests computed with other algorithms.
+func (lbdcp *layeredBlobDescriptorCacheProvider) SetAlgorithmDigest(ctx context.Context, dgst, alternate digest.Digest) error {
+	if slow, ok := lbdcp.slow.(AlgorithmDigestCache); ok {
+		if err := slow.SetAlgorithmDigest(ctx, dgst, alternate); err != nil {
+			return err
+		}
+	}
+	if fast, ok := lbdcp.fast.(AlgorithmDigestCache); ok {
+		return fast.SetAlgorithmDigest(ctx, dgst, alternate)
+	}
+	return nil
+}
+
+// Invalidate invalidates both caches. The fast caches of other processes
+// sharing slow are not reached and keep their descriptors.
+func (lbdcp *layeredBlobDescriptorCacheProvider) Invalidate(ctx context.Context, repo string) error {
+	if err := lbdcp.slow.Invalidate(ctx, repo); err != nil {
+		return err
+	}
+
+	return lbdcp.fast.Invalidate(ctx, repo)
+}
+
+// RepositoryScoped layers the repository scoped caches of both providers.
+func (lbdcp *layeredBlobDescriptorCacheProvider) RepositoryScoped(repo string) (distribution.BlobDescriptorService, error) {
+	fast, err := lbdcp.fast.RepositoryScoped(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	slow, err := lbdcp.slow.RepositoryScoped(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	return &layeredBlobDescriptorService{
+		fast: fast,
+		slow: slow,
+	}, nil
+}
+
+// layeredBlobDescriptorService implements the lookup and write through
+// between two descriptor services.
+type layeredBlobDescriptorService struct {
+	fast distribution.BlobDescriptorService
+	slow distribution.BlobDescriptorService
+}
+
+func (lbds *layeredBlobDescriptorService) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	desc, err := lbds.fast.Stat(ctx, dgst)
+	if err != distribution.ErrBlobUnknown {
+		return desc, err
+	}
+
+	desc, err = lbds.slow.Stat(ctx, dgst)
+	if err != nil {
+		return desc, err
+	}
+
+	// the descriptor was already admitted by the slow cache, so a failure
+	// to populate the fast one only costs a later round trip
+	lbds.fast.SetDescriptor(ctx, dgst, desc)
+	return desc, nil
+}
+
+func (lbds *layeredBlobDescriptorService) Clear(ctx context.Context, dgst digest.Digest) error {
+	// the fast cache may not have seen the descriptor, so only the result
+	// of the slow one is authoritative
+	if err := lbds.fast.Clear(ctx, dgst); err != nil && err != distribution.ErrBlobUnknown {
+		return err
+	}
+
+	return lbds.slow.Clear(ctx, dgst)
+}
+
+func (lbds *layeredBlobDescriptorService) SetDescriptor(ctx context.Context, dgst digest.Digest, desc distribution.Descriptor) error {
+	if err := lbds.slow.SetDescriptor(ctx, dgst, desc); err != nil {
+		return err
+	}
+
+	return lbds.fast.SetDescriptor(ctx, dgst, desc)
+}
@@ -0,0 +1,70 @@
+package memory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/cache"
+	"github.com/docker/distribution/registry/storage/cache/cachecheck"
+	"github.com/opencontainers/go-digest"
+)
+
+// TestLayeredBlobInfoCache checks a layered cache of in memory caches is
+// working correctly.
+func TestLayeredBlobInfoCache(t *testing.T) {
+	cachecheck.CheckBlobDescriptorCache(t, cache.NewLayeredBlobDescriptorCacheProvider(NewLRUBlobDescriptorCacheProvider(100), NewInMemoryBlobDescriptorCacheProvider()))
+}
+
+func TestLayeredBlobInfoCachePopulatesFast(t *testing.T) {
+	ctx := context.Background()
+	fast := NewLRUBlobDescriptorCacheProvider(100)
+	slow := NewInMemoryBlobDescriptorCacheProvider()
+	provider := cache.NewLayeredBlobDescriptorCacheProvider(fast, slow)
+
+	desc := distribution.Descriptor{
+		Digest:    digest.FromString("layered"),
+		Size:      7,
+		MediaType: "application/json",
+	}
+
+	slowRepo, err := slow.RepositoryScoped("foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+	if err := slowRepo.SetDescriptor(ctx, desc.Digest, desc); err != nil {
+		t.Fatalf("unexpected error setting descriptor: %v", err)
+	}
+
+	repo, err := provider.RepositoryScoped("foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+	if got, err := repo.Stat(ctx, desc.Digest); err != nil || !reflect.DeepEqual(got, desc) {
+		t.Fatalf("unexpected stat through layered cache: %#v, %v", got, err)
+	}
+
+	fastRepo, err := fast.RepositoryScoped("foo/bar")
+	if err != nil {
+		t.Fatalf("unexpected error getting scoped cache: %v", err)
+	}
+	if got, err := fastRepo.Stat(ctx, desc.Digest); err != nil || !reflect.DeepEqual(got, desc) {
+		t.Fatalf("expected fast cache to be populated: %#v, %v", got, err)
+	}
+
+	// writes go through to both tiers
+	other := distribution.Descriptor{
+		Digest:    digest.FromString("written"),
+		Size:      7,
+		MediaType: "application/octet-stream",
+	}
+	if err := provider.SetDescriptor(ctx, other.Digest, other); err != nil {
+		t.Fatalf("unexpected error setting descriptor: %v", err)
+	}
+	for name, tier := range map[string]cache.BlobDescriptorCacheProvider{"fast": fast, "slow": slow} {
+		if _, err := tier.Stat(ctx, other.Digest); err != nil {
+			t.Fatalf("expected descriptor in %s cache: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package memory
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	"github.com/docker/distribution"
+	prometheus "github.com/docker/distribution/metrics"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/cache"
+	"github.com/opencontainers/go-digest"
+)
+
+var (
+	// evictionCount is the number of descriptors evicted from LRU caches
+	evictionCount = prometheus.StorageNamespace.NewCounter("cache_evictions", "The number of descriptors evicted from the LRU blob descriptor cache")
+)
+
+// lruKey identifies a cached descriptor. The global cache uses an empty
+// repository name. Digests computed with another algorithm than the one the
+// blob is stored under are cached globally with that algorithm set.
+type lruKey struct {
+	repo string
+	dgst digest.Digest
+	alg  digest.Algorithm
+}
+
+type lruEntry struct {
+	key  lruKey
+	desc distribution.Descriptor
+}
+
+// lruBlobDescriptorCacheProvider bounds the number of descriptors cached
+// globally and for all repositories together, evicting the least recently
+// used ones first.
+type lruBlobDescriptorCacheProvider struct {
+	maxEntries int
+	entries    map[lruKey]*list.Element
+	order      *list.List // most recently used at the front
+	mu         sync.Mutex
+}
+
+var _ cache.AlgorithmDigestCache = &lruBlobDescriptorCacheProvider{}
+
+// NewLRUBlobDescriptorCacheProvider returns a new in-memory cache for storing
+// blob descriptor data that holds at most maxEntries descriptors, counting
+// the global and all repository scoped entries together.
+func NewLRUBlobDescriptorCacheProvider(maxEntries int) cache.BlobDescriptorCacheProvider {
+	return &lruBlobDescriptorCacheProvider{
+		maxEntries: maxEntries,
+		entries:    make(map[lruKey]*list.Element),
+		order:      list.New(),
+	}
+}
+
+func (lbdcp *lruBlobDescriptorCacheProvider) RepositoryScoped(repo string) (distribution.BlobDescriptorService, error) {
+	if _, err := reference.ParseNormalizedNamed(repo); err != nil {
+		return nil, err
+	}
+
+	return &repositoryScopedLRUBlobDescriptorCache{
+		repo:   repo,
+		parent: lbdcp,
+	}, nil
+}
+
+func (lbdcp *lruBlobDescriptorCacheProvider) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	return lbdcp.stat(lruKey{dgst: dgst})
+}
+
+func (lbdcp *lruBlobDescriptorCacheProvider) Clear(ctx context.Context, dgst digest.Digest) error {
+	return lbdcp.clear(lruKey{dgst: dgst})
+}
+
+func (lbdcp *lruBlobDescriptorCacheProvider) SetDescriptor(ctx context.Context, dgst digest.Digest, desc distribution.Descriptor) error {
+	_, err := lbdcp.Stat(ctx, dgst)
+	if err == distribution.ErrBlobUnknown {
+
+		if dgst.Algorithm() != desc.Digest.Algorithm() && dgst != desc.Digest {
+			// if the digests differ, set the other canonical mapping
+			if err := lbdcp.set(lruKey{dgst: desc.Digest}, desc); err != nil {
+				return err
+			}
+		}
+
+		// unknown, just set it
+		return lbdcp.set(lruKey{dgst: dgst}, desc)
+	}
+
+	// we already know it, do nothing
+	return err
+}
+
+func (lbdcp *lruBlobDescriptorCacheProvider) Invalidate(ctx context.Context, repo string) error {
+	lbdcp.mu.Lock()
+	defer lbdcp.mu.Unlock()
+
+	for key, elem := range lbdcp.entries {
+		if key.alg != "" || (repo != "" && key.repo != repo) {
+			continue
+		}
+		lbdcp.order.Remove(elem)
+		delete(lbdcp.entries, key)
+	}
+	return nil
+}
+
+func (lbdcp *lruBlobDescriptorCacheProvider) AlgorithmDigest(ctx context.Context, dgst digest.Digest, alg digest.Algorithm) (digest.Digest, error) {
+	desc, err := lbdcp.stat(lruKey{dgst: dgst, alg: alg})
+	if err != nil {
+		return "", err
+	}
+	return desc.Digest, nil
+}
+
+func (lbdcp *lruBlobDescriptorCacheProvider) SetAlgorithmDigest(ctx context.Context, dgst, alternate digest.Digest) error {
+	if err := alternate.Validate(); err != nil {
+		return err
+	}
+
+	// only the digest of the entry is used
+	return lbdcp.set(lruKey{dgst: dgst, alg: alternate.Algorithm()}, distribution.Descriptor{
+		Digest:    alternate,
+		MediaType: "application/octet-stream",
+	})
+}
+
+func (lbdcp *lruBlobDescriptorCacheProvider) stat(key lruKey) (distribution.Descriptor, error) {
+	if err := key.dgst.Validate(); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	lbdcp.mu.Lock()
+	defer lbdcp.mu.Unlock()
+
+	elem, ok := lbdcp.entries[key]
+	if !ok {
+		return distribution.Descriptor{}, distribution.ErrBlobUnknown
+	}
+	lbdcp.order.MoveToFront(elem)
+
+	return elem.Value.(*lruEntry).desc, nil
+}
+
+func (lbdcp *lruBlobDescriptorCacheProvider) clear(key lruKey) error {
+	lbdcp.mu.Lock()
+	defer lbdcp.mu.Unlock()
+
+	if elem, ok := lbdcp.entries[key]; ok {
+		lbdcp.order.Remove(elem)
+		delete(lbdcp.entries, key)
+	}
+	return nil
+}
+
+func (lbdcp *lruBlobDescriptorCacheProvider) set(key lruKey, desc distribution.Descriptor) error {
+	if err := key.dgst.Validate(); err != nil {
+		return err
+	}
+
+	if err := cache.ValidateDescriptor(desc); err != nil {
+		return err
+	}
+
+	lbdcp.mu.Lock()
+	defer lbdcp.mu.Unlock()
+
+	if elem, ok := lbdcp.entries[key]; ok {
+		elem.Value.(*lruEntry).desc = desc
+		lbdcp.order.MoveToFront(elem)
+		return nil
+	}
+
+	lbdcp.entries[key] = lbdcp.order.PushFront(&lruEntry{key: key, desc: desc})
+	for lbdcp.maxEntries > 0 && lbdcp.order.Len() > lbdcp.maxEntries {
+		oldest := lbdcp.order.Back()
+		lbdcp.order.Remove(oldest)
+		delete(lbdcp.entries, oldest.Value.(*lruEntry).key)
+		evictionCount.Inc(1)
+	}
+	return nil
+}
+
+// repositoryScopedLRUBlobDescriptorCache provides the request scoped
+// repository cache on top of the shared LRU.
+type repositoryScopedLRUBlobDescriptorCache struct {
+	repo   string
+	parent *lruBlobDescriptorCacheProvider
+}
+
+func (rslbdc *repositoryScopedLRUBlobDescriptorCache) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	return rslbdc.parent.stat(lruKey{repo: rslbdc.repo, dgst: dgst})
+}
+
+func (rslbdc *repositoryScopedLRUBlobDescriptorCache) Clear(ctx context.Context, dgst digest.Digest) error {
+	return rslbdc.parent.clear(lruKey{repo: rslbdc.repo, dgst: dgst})
+}
+
+func (rslbdc *repositoryScopedLRUBlobDescriptorCache) SetDescriptor(ctx context.Context, dgst digest.Digest, desc distribution.Descriptor) error {
+	if err := rslbdc.parent.set(lruKey{repo: rslbdc.repo, dgst: dgst}, desc); err != nil {
+		return err
+	}
+
+	return rslbdc.parent.SetDescriptor(ctx, dgst, desc)
+}
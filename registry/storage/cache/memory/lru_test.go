@@ -0,0 +1,95 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/cache/cachecheck"
+	"github.com/opencontainers/go-digest"
+)
+
+// TestLRUBlobInfoCache checks the LRU implementation is working correctly.
+func TestLRUBlobInfoCache(t *testing.T) {
+	cachecheck.CheckBlobDescriptorCache(t, NewLRUBlobDescriptorCacheProvider(100))
+}
+
+func TestLRUBlobInfoCacheEviction(t *testing.T) {
+	ctx := context.Background()
+	provider := NewLRUBlobDescriptorCacheProvider(2)
+
+	descs := make([]distribution.Descriptor, 3)
+	for i := range descs {
+		descs[i] = distribution.Descriptor{
+			Digest:    digest.FromString(fmt.Sprint(i)),
+			Size:      int64(i),
+			MediaType: "application/octet-stream",
+		}
+	}
+
+	for _, desc := range descs[:2] {
+		if err := provider.SetDescriptor(ctx, desc.Digest, desc); err != nil {
+			t.Fatalf("unexpected error setting descriptor: %v", err)
+		}
+	}
+
+	// touch the first descriptor so the second one is least recently used
+	if _, err := provider.Stat(ctx, descs[0].Digest); err != nil {
+		t.Fatalf("unexpected error statting descriptor: %v", err)
+	}
+
+	if err := provider.SetDescriptor(ctx, descs[2].Digest, descs[2]); err != nil {
+		t.Fatalf("unexpected error setting descriptor: %v", err)
+	}
+
+	if _, err := provider.Stat(ctx, descs[1].Digest); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected least recently used descriptor to be evicted: %v", err)
+	}
+	for _, desc := range []distribution.Descriptor{descs[0], descs[2]} {
+		if _, err := provider.Stat(ctx, desc.Digest); err != nil {
+			t.Fatalf("unexpected error statting retained descriptor %v: %v", desc.Digest, err)
+		}
+	}
+}
+
+func TestLRUBlobInfoCacheConcurrent(t *testing.T) {
+	ctx := context.Background()
+	provider := NewLRUBlobDescriptorCacheProvider(16)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			repo, err := provider.RepositoryScoped(fmt.Sprintf("foo/bar%d", i))
+			if err != nil {
+				t.Errorf("unexpected error getting scoped cache: %v", err)
+				return
+			}
+			for j := 0; j < 100; j++ {
+				desc := distribution.Descriptor{
+					Digest:    digest.FromString(fmt.Sprint(i, j)),
+					Size:      int64(j),
+					MediaType: "application/octet-stream",
+				}
+				if err := repo.SetDescriptor(ctx, desc.Digest, desc); err != nil {
+					t.Errorf("unexpected error setting descriptor: %v", err)
+					return
+				}
+				if _, err := repo.Stat(ctx, desc.Digest); err != nil && err != distribution.ErrBlobUnknown {
+					t.Errorf("unexpected error statting descriptor: %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	lru := provider.(*lruBlobDescriptorCacheProvider)
+	if lru.order.Len() != 16 || len(lru.entries) != 16 {
+		t.Fatalf("cache exceeded its bound: %d entries, %d indexed", lru.order.Len(), len(lru.entries))
+	}
+}
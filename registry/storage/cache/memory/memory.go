@@ -11,17 +11,28 @@ import (
 )
 
 type inMemoryBlobDescriptorCacheProvider struct {
-	global       *mapBlobDescriptorCache
-	repositories map[string]*mapBlobDescriptorCache
-	mu           sync.RWMutex
+	global           *mapBlobDescriptorCache
+	repositories     map[string]*mapBlobDescriptorCache
+	algorithmDigests map[algorithmDigestKey]digest.Digest
+	mu               sync.RWMutex
 }
 
+// algorithmDigestKey identifies the digest of a blob computed with another
+// algorithm.
+type algorithmDigestKey struct {
+	dgst digest.Digest
+	alg  digest.Algorithm
+}
+
+var _ cache.AlgorithmDigestCache = &inMemoryBlobDescriptorCacheProvider{}
+
 // NewInMemoryBlobDescriptorCacheProvider returns a new mapped-based cache for
 // storing blob descriptor data.
 func NewInMemoryBlobDescriptorCacheProvider() cache.BlobDescriptorCacheProvider {
 	return &inMemoryBlobDescriptorCacheProvider{
-		global:       newMapBlobDescriptorCache(),
-		repositories: make(map[string]*mapBlobDescriptorCache),
+		global:           newMapBlobDescriptorCache(),
+		repositories:     make(map[string]*mapBlobDescriptorCache),
+		algorithmDigests: make(map[algorithmDigestKey]digest.Digest),
 	}
 }
 
@@ -40,6 +51,26 @@ func (imbdcp *inMemoryBlobDescriptorCacheProvider) RepositoryScoped(repo string)
 	}, nil
 }
 
+func (imbdcp *inMemoryBlobDescriptorCacheProvider) Invalidate(ctx context.Context, repo string) error {
+	imbdcp.mu.Lock()
+	defer imbdcp.mu.Unlock()
+
+	// the maps are cleared rather than dropped, since scoped caches already
+	// handed out hold on to them
+	if repo != "" {
+		if repository, ok := imbdcp.repositories[repo]; ok {
+			repository.clearAll()
+		}
+		return nil
+	}
+
+	for _, repository := range imbdcp.repositories {
+		repository.clearAll()
+	}
+	imbdcp.global.clearAll()
+	return nil
+}
+
 func (imbdcp *inMemoryBlobDescriptorCacheProvider) Stat(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
 	return imbdcp.global.Stat(ctx, dgst)
 }
@@ -67,6 +98,32 @@ func (imbdcp *inMemoryBlobDescriptorCacheProvider) SetDescriptor(ctx context.Con
 	return err
 }
 
+func (imbdcp *inMemoryBlobDescriptorCacheProvider) AlgorithmDigest(ctx context.Context, dgst digest.Digest, alg digest.Algorithm) (digest.Digest, error) {
+	imbdcp.mu.RLock()
+	defer imbdcp.mu.RUnlock()
+
+	alternate, ok := imbdcp.algorithmDigests[algorithmDigestKey{dgst: dgst, alg: alg}]
+	if !ok {
+		return "", distribution.ErrBlobUnknown
+	}
+	return alternate, nil
+}
+
+func (imbdcp *inMemoryBlobDescriptorCacheProvider) SetAlgorithmDigest(ctx context.Context, dgst, alternate digest.Digest) error {
+	if err := dgst.Validate(); err != nil {
+		return err
+	}
+	if err := alternate.Validate(); err != nil {
+		return err
+	}
+
+	imbdcp.mu.Lock()
+	defer imbdcp.mu.Unlock()
+
+	imbdcp.algorithmDigests[algorithmDigestKey{dgst: dgst, alg: alternate.Algorithm()}] = alternate
+	return nil
+}
+
 // repositoryScopedInMemoryBlobDescriptorCache provides the request scoped
 // repository cache. Instances are not thread-safe but the delegated
 // operations are.
@@ -162,6 +219,14 @@ func (mbdc *mapBlobDescriptorCache) Clear(ctx context.Context, dgst digest.Diges
 	return nil
 }
 
+// clearAll drops every descriptor from the cache.
+func (mbdc *mapBlobDescriptorCache) clearAll() {
+	mbdc.mu.Lock()
+	defer mbdc.mu.Unlock()
+
+	mbdc.descriptors = make(map[digest.Digest]distribution.Descriptor)
+}
+
 func (mbdc *mapBlobDescriptorCache) SetDescriptor(ctx context.Context, dgst digest.Digest, desc distribution.Descriptor) error {
 	if err := dgst.Validate(); err != nil {
 		return err
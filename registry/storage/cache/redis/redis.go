@@ -3,6 +3,7 @@ package redis
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/reference"
@@ -31,6 +32,8 @@ type redisBlobDescriptorService struct {
 	// request objects, we can change this to a connection.
 }
 
+var _ cache.AlgorithmDigestCache = &redisBlobDescriptorService{}
+
 // NewRedisBlobDescriptorCacheProvider returns a new redis-based
 // BlobDescriptorCacheProvider using the provided redis connection pool.
 func NewRedisBlobDescriptorCacheProvider(pool *redis.Pool) cache.BlobDescriptorCacheProvider {
@@ -141,6 +144,122 @@ func (rbds *redisBlobDescriptorService) setDescriptor(ctx context.Context, conn
 	return nil
 }
 
+// AlgorithmDigest reads the digest computed with alg from the hash of the
+// blob stored as dgst.
+func (rbds *redisBlobDescriptorService) AlgorithmDigest(ctx context.Context, dgst digest.Digest, alg digest.Algorithm) (digest.Digest, error) {
+	if err := dgst.Validate(); err != nil {
+		return "", err
+	}
+
+	conn := rbds.pool.Get()
+	defer conn.Close()
+
+	alternate, err := redis.String(conn.Do("HGET", rbds.blobDescriptorHashKey(dgst), "digest:"+string(alg)))
+	if err == redis.ErrNil {
+		return "", distribution.ErrBlobUnknown
+	}
+	return digest.Digest(alternate), err
+}
+
+// SetAlgorithmDigest adds alternate to the hash of the blob stored as dgst,
+// under a field named after its algorithm.
+func (rbds *redisBlobDescriptorService) SetAlgorithmDigest(ctx context.Context, dgst, alternate digest.Digest) error {
+	if err := dgst.Validate(); err != nil {
+		return err
+	}
+	if err := alternate.Validate(); err != nil {
+		return err
+	}
+
+	conn := rbds.pool.Get()
+	defer conn.Close()
+
+	_, err := conn.Do("HSET", rbds.blobDescriptorHashKey(dgst), "digest:"+string(alternate.Algorithm()), alternate)
+	return err
+}
+
+// Invalidate deletes the blob set of repo and its descriptor hashes. Without
+// a repository, the keyspace is scanned for the blob sets of all
+// repositories, and the descriptor fields of the global hashes are deleted
+// as well.
+func (rbds *redisBlobDescriptorService) Invalidate(ctx context.Context, repo string) error {
+	conn := rbds.pool.Get()
+	defer conn.Close()
+
+	if repo != "" {
+		return rbds.invalidateRepository(conn, repo)
+	}
+
+	setKeys, err := scanKeys(conn, "repository::*::blobs")
+	if err != nil {
+		return err
+	}
+	for _, setKey := range setKeys {
+		repo := strings.TrimSuffix(strings.TrimPrefix(setKey, "repository::"), "::blobs")
+		if err := rbds.invalidateRepository(conn, repo); err != nil {
+			return err
+		}
+	}
+
+	hashKeys, err := scanKeys(conn, rbds.blobDescriptorHashKey("*"))
+	if err != nil {
+		return err
+	}
+	for _, hashKey := range hashKeys {
+		if _, err := conn.Do("HDEL", hashKey, "digest", "size", "mediatype"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rbds *redisBlobDescriptorService) invalidateRepository(conn redis.Conn, repo string) error {
+	scoped := &repositoryScopedRedisBlobDescriptorService{
+		repo:     repo,
+		upstream: rbds,
+	}
+	setKey := scoped.repositoryBlobSetKey(repo)
+
+	members, err := redis.Strings(conn.Do("SMEMBERS", setKey))
+	if err != nil {
+		return err
+	}
+
+	keys := []interface{}{setKey}
+	for _, member := range members {
+		keys = append(keys, scoped.blobDescriptorHashKey(digest.Digest(member)))
+	}
+	_, err = conn.Do("DEL", keys...)
+	return err
+}
+
+// scanKeys returns the keys matching pattern, iterating over the keyspace
+// with SCAN rather than blocking redis with KEYS.
+func scanKeys(conn redis.Conn, pattern string) ([]string, error) {
+	var keys []string
+	cursor := 0
+	for {
+		reply, err := redis.Values(conn.Do("SCAN", cursor, "MATCH", pattern, "COUNT", 1000))
+		if err != nil {
+			return nil, err
+		}
+		if len(reply) != 2 {
+			return nil, fmt.Errorf("redis cache: unexpected SCAN reply of length %d", len(reply))
+		}
+		if cursor, err = redis.Int(reply[0], nil); err != nil {
+			return nil, err
+		}
+		batch, err := redis.Strings(reply[1], nil)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, batch...)
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
 func (rbds *redisBlobDescriptorService) blobDescriptorHashKey(dgst digest.Digest) string {
 	return "blobs::" + dgst.String()
 }
@@ -15,6 +15,13 @@ import (
 // Because it's a quite expensive operation, it should only be used when building up
 // an initial set of repositories.
 func (reg *registry) Repositories(ctx context.Context, repos []string, last string) (n int, err error) {
+	return reg.RepositoriesWithPrefix(ctx, repos, "", last)
+}
+
+// RepositoriesWithPrefix returns a list, or partial list, of the
+// repositories whose names start with prefix. Only the directories which
+// may hold such repositories are walked.
+func (reg *registry) RepositoriesWithPrefix(ctx context.Context, repos []string, prefix, last string) (n int, err error) {
 	var finishedWalk bool
 	var foundRepos []string
 
@@ -27,9 +34,21 @@ func (reg *registry) Repositories(ctx context.Context, repos []string, last stri
 		return 0, err
 	}
 
-	err = reg.blobStore.driver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+	// start from the deepest directory containing every match
+	walkRoot := root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		walkRoot = path.Join(root, prefix[:i])
+	}
+
+	err = reg.blobStore.driver.Walk(ctx, walkRoot, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() && !mayContainPrefix(fileInfo.Path()[len(root)+1:], prefix) {
+			return driver.ErrSkipDir
+		}
+
 		err := handleRepository(fileInfo, root, last, func(repoPath string) error {
-			foundRepos = append(foundRepos, repoPath)
+			if strings.HasPrefix(repoPath, prefix) {
+				foundRepos = append(foundRepos, repoPath)
+			}
 			return nil
 		})
 		if err != nil {
@@ -57,6 +76,16 @@ func (reg *registry) Repositories(ctx context.Context, repos []string, last stri
 	return n, err
 }
 
+// mayContainPrefix reports whether the directory dir, relative to the
+// repositories root, may hold repositories whose names start with prefix.
+// Reserved directories of repositories are left to handleRepository.
+func mayContainPrefix(dir, prefix string) bool {
+	if strings.HasPrefix(dir, prefix) || strings.HasPrefix(path.Base(dir), "_") {
+		return true
+	}
+	return strings.HasPrefix(prefix, dir+"/")
+}
+
 // Enumerate applies ingester to each repository
 func (reg *registry) Enumerate(ctx context.Context, ingester func(string) error) error {
 	root, err := pathFor(repositoriesRootPathSpec{})
@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/reference"
@@ -195,6 +197,114 @@ func TestCatalogEnumerate(t *testing.T) {
 	}
 }
 
+func TestCatalogWithPrefix(t *testing.T) {
+	env := setupFS(t)
+
+	// record the directories walked by the registry
+	listed := &listRecordingDriver{StorageDriver: env.driver}
+	registry, err := NewRegistry(env.ctx, listed)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	lister := registry.(distribution.RepositoryPrefixLister)
+
+	for _, tc := range []struct {
+		prefix   string
+		expected []string
+	}{
+		{"foo/", []string{"foo/a", "foo/b", "foo/d/in"}},
+		{"foo", []string{"foo/a", "foo/b", "foo/d/in", "foo-bar/a", "foo-bar/b"}},
+		{"foo/d/", []string{"foo/d/in"}},
+		{"te", []string{"test"}},
+		{"baz/", nil},
+	} {
+		listed.paths = nil
+		p := make([]string, 50)
+		numFilled, err := lister.RepositoriesWithPrefix(env.ctx, p, tc.prefix, "")
+		if _, ok := err.(driver.PathNotFoundError); err != io.EOF && !ok {
+			t.Fatalf("prefix %q: unexpected error: %v", tc.prefix, err)
+		}
+		if numFilled != len(tc.expected) || !testEq(p, tc.expected, numFilled) {
+			t.Errorf("prefix %q: unexpected repositories %v, expected %v", tc.prefix, p[:numFilled], tc.expected)
+		}
+		for _, listedPath := range listed.paths {
+			if strings.Contains(listedPath, "/repositories/bar") {
+				t.Errorf("prefix %q: unrelated directory %s was listed", tc.prefix, listedPath)
+			}
+		}
+	}
+
+	// paginate within the prefix
+	p := make([]string, 2)
+	numFilled, err := lister.RepositoriesWithPrefix(env.ctx, p, "foo", "foo/b")
+	if err == io.EOF || numFilled != 2 || !testEq(p, []string{"foo/d/in", "foo-bar/a"}, numFilled) {
+		t.Errorf("unexpected second page %v: %v", p[:numFilled], err)
+	}
+	numFilled, err = lister.RepositoriesWithPrefix(env.ctx, p, "foo", "foo-bar/a")
+	if err != io.EOF || numFilled != 1 || p[0] != "foo-bar/b" {
+		t.Errorf("unexpected last page %v: %v", p[:numFilled], err)
+	}
+}
+
+// listRecordingDriver records the paths listed while walking.
+type listRecordingDriver struct {
+	driver.StorageDriver
+	paths []string
+}
+
+func (d *listRecordingDriver) List(ctx context.Context, path string) ([]string, error) {
+	d.paths = append(d.paths, path)
+	return d.StorageDriver.List(ctx, path)
+}
+
+func (d *listRecordingDriver) Walk(ctx context.Context, path string, f driver.WalkFn) error {
+	return driver.WalkFallback(ctx, d, path, f)
+}
+
+func TestCatalogScanLastModified(t *testing.T) {
+	env := setupFS(t)
+	scanner := env.registry.(distribution.RepositoryModTimeScanner)
+
+	named, _ := reference.WithName("foo/a")
+	before, err := scanner.ScanLastModified(env.ctx, named, 0)
+	if err != nil {
+		t.Fatalf("unexpected error scanning repository: %v", err)
+	}
+	if before.IsZero() {
+		t.Fatalf("expected the manifest link to have a modification time")
+	}
+
+	// a later tag is the most recent modification
+	time.Sleep(10 * time.Millisecond)
+	repo, _ := env.registry.Repository(env.ctx, named)
+	manifests, _ := repo.Manifests(env.ctx)
+	var dgst digest.Digest
+	err = manifests.(distribution.ManifestEnumerator).Enumerate(env.ctx, func(d digest.Digest) error {
+		dgst = d
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error enumerating manifests: %v", err)
+	}
+	if err := repo.Tags(env.ctx).Tag(env.ctx, "latest", distribution.Descriptor{Digest: dgst}); err != nil {
+		t.Fatalf("unexpected error tagging: %v", err)
+	}
+
+	after, err := scanner.ScanLastModified(env.ctx, named, 1)
+	if err != nil {
+		t.Fatalf("unexpected error scanning repository: %v", err)
+	}
+	if !after.After(before) {
+		t.Fatalf("expected the tag to be more recent: %v is not after %v", after, before)
+	}
+
+	unknown, _ := reference.WithName("foo/unknown")
+	modTime, err := scanner.ScanLastModified(env.ctx, unknown, 0)
+	if err != nil || !modTime.IsZero() {
+		t.Fatalf("unexpected result scanning unknown repository: %v, %v", modTime, err)
+	}
+}
+
 func testEq(a, b []string, size int) bool {
 	for cnt := 0; cnt < size-1; cnt++ {
 		if a[cnt] != b[cnt] {
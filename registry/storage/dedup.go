@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// DedupStats compares the size of the blobs linked into all repositories
+// with the size of the blob store backing them.
+type DedupStats struct {
+	Repositories int `json:"repositories"`
+	// Links is the number of repository links to blobs.
+	Links int `json:"links"`
+	// Blobs is the number of distinct blobs linked.
+	Blobs int `json:"blobs"`
+	// LogicalBytes sums the size of every link, as if each repository
+	// stored its own copy.
+	LogicalBytes int64 `json:"logical_bytes"`
+	// PhysicalBytes sums the size of each distinct blob once.
+	PhysicalBytes int64 `json:"physical_bytes"`
+}
+
+// RegistryDedupStats walks the layer links of every repository in registry
+// and reports how much space sharing blobs between repositories saves.
+func RegistryDedupStats(ctx context.Context, registry distribution.Namespace) (DedupStats, error) {
+	var stats DedupStats
+
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return stats, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	links := make(map[digest.Digest]int)
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+		}
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository: %v", err)
+		}
+
+		blobEnumerator, ok := repository.Blobs(ctx).(distribution.BlobEnumerator)
+		if !ok {
+			return fmt.Errorf("unable to convert BlobStore into BlobEnumerator")
+		}
+
+		stats.Repositories++
+		err = blobEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+			links[dgst]++
+			return nil
+		})
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	for dgst, n := range links {
+		desc, err := registry.BlobStatter().Stat(ctx, dgst)
+		if err != nil {
+			if err == distribution.ErrBlobUnknown {
+				continue
+			}
+			return stats, err
+		}
+		stats.Links += n
+		stats.Blobs++
+		stats.LogicalBytes += desc.Size * int64(n)
+		stats.PhysicalBytes += desc.Size
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,50 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+)
+
+func TestRegistryDedupStats(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New())
+
+	shared, err := testutil.CreateRandomLayers(2)
+	if err != nil {
+		t.Fatalf("failed to create random layers: %v", err)
+	}
+	var sharedSize int64
+	for _, name := range []string{"foo/a", "foo/b"} {
+		for _, rs := range shared {
+			n, err := rs.Seek(0, io.SeekEnd)
+			if err != nil {
+				t.Fatalf("failed to seek layer: %v", err)
+			}
+			if name == "foo/a" {
+				sharedSize += n
+			}
+			if _, err := rs.Seek(0, io.SeekStart); err != nil {
+				t.Fatalf("failed to seek layer: %v", err)
+			}
+		}
+		if err := testutil.UploadBlobs(makeRepository(t, registry, name), shared); err != nil {
+			t.Fatalf("failed to upload blobs: %v", err)
+		}
+	}
+
+	stats, err := RegistryDedupStats(ctx, registry)
+	if err != nil {
+		t.Fatalf("failed to compute dedup stats: %v", err)
+	}
+
+	if stats.Repositories != 2 || stats.Links != 4 || stats.Blobs != 2 {
+		t.Fatalf("unexpected counts: %+v", stats)
+	}
+	if stats.PhysicalBytes != sharedSize || stats.LogicalBytes != 2*sharedSize {
+		t.Fatalf("unexpected sizes, shared layers are %d bytes: %+v", sharedSize, stats)
+	}
+}
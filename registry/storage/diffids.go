@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// LayerDiffID pairs a layer blob with the digest of its uncompressed
+// content, as listed in the image configuration.
+type LayerDiffID struct {
+	Digest digest.Digest `json:"digest"`
+	DiffID digest.Digest `json:"diffID"`
+}
+
+// NewDiffIDResolver creates a new DiffIDResolver. If cache is set, resolved
+// mappings are stored next to the manifest revision and reused.
+func NewDiffIDResolver(driver driver.StorageDriver, cache bool) DiffIDResolver {
+	return DiffIDResolver{
+		driver: driver,
+		cache:  cache,
+	}
+}
+
+// DiffIDResolver maps the diffIDs of an image configuration back to the
+// layer blobs of its manifest.
+type DiffIDResolver struct {
+	driver driver.StorageDriver
+	cache  bool
+}
+
+// Resolve returns the layers of the manifest identified by dgst, in order,
+// paired with the diffIDs from the image configuration. Only schema2 and OCI
+// image manifests carry a configuration; distribution.ErrUnsupported is
+// returned for any other manifest.
+func (r DiffIDResolver) Resolve(ctx context.Context, repository distribution.Repository, dgst digest.Digest) ([]LayerDiffID, error) {
+	manifests, err := repository.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// the cached mapping outlives a deleted manifest revision link
+	exists, err := manifests.Exists(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, distribution.ErrManifestUnknownRevision{Name: repository.Named().Name(), Revision: dgst}
+	}
+
+	cachePath, err := pathFor(manifestDiffIDsPathSpec{name: repository.Named().Name(), revision: dgst})
+	if err != nil {
+		return nil, err
+	}
+
+	if r.cache {
+		content, err := r.driver.GetContent(ctx, cachePath)
+		if err == nil {
+			var layers []LayerDiffID
+			if err := json.Unmarshal(content, &layers); err == nil {
+				return layers, nil
+			}
+		} else if _, ok := err.(driver.PathNotFoundError); !ok {
+			return nil, err
+		}
+	}
+
+	m, err := manifests.Get(ctx, dgst)
+	if err != nil {
+		return nil, err
+	}
+
+	var config distribution.Descriptor
+	var layers []distribution.Descriptor
+	switch m := m.(type) {
+	case *schema2.DeserializedManifest:
+		config, layers = m.Config, m.Layers
+	case *ocischema.DeserializedManifest:
+		config, layers = m.Config, m.Layers
+	default:
+		return nil, distribution.ErrUnsupported
+	}
+
+	content, err := repository.Blobs(ctx).Get(ctx, config.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	var image struct {
+		RootFS struct {
+			DiffIDs []digest.Digest `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	if err := json.Unmarshal(content, &image); err != nil {
+		return nil, fmt.Errorf("failed to parse image configuration %s: %v", config.Digest, err)
+	}
+
+	if len(image.RootFS.DiffIDs) != len(layers) {
+		return nil, fmt.Errorf("image configuration %s lists %d diffIDs for %d layers", config.Digest, len(image.RootFS.DiffIDs), len(layers))
+	}
+
+	mapping := make([]LayerDiffID, 0, len(layers))
+	for i, layer := range layers {
+		mapping = append(mapping, LayerDiffID{
+			Digest: layer.Digest,
+			DiffID: image.RootFS.DiffIDs[i],
+		})
+	}
+
+	if r.cache {
+		if content, err := json.Marshal(mapping); err == nil {
+			if err := r.driver.PutContent(ctx, cachePath, content); err != nil {
+				dcontext.GetLogger(ctx).Errorf("error caching diffIDs for %s: %v", dgst, err)
+			}
+		}
+	}
+
+	return mapping, nil
+}
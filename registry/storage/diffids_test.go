@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestDiffIDResolver(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	registry := createRegistry(t, d)
+	repo := makeRepository(t, registry, "diffids")
+	manifests := makeManifestService(t, repo)
+
+	layers, err := testutil.CreateRandomLayers(3)
+	if err != nil {
+		t.Fatalf("failed to make layers: %v", err)
+	}
+	if err := testutil.UploadBlobs(repo, layers); err != nil {
+		t.Fatalf("failed to upload layers: %v", err)
+	}
+
+	var expected []LayerDiffID
+	var config struct {
+		RootFS struct {
+			Type    string          `json:"type"`
+			DiffIDs []digest.Digest `json:"diff_ids"`
+		} `json:"rootfs"`
+	}
+	config.RootFS.Type = "layers"
+	for i, dgst := range getKeys(layers) {
+		diffID := digest.FromString(string(rune('a' + i)))
+		config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+		expected = append(expected, LayerDiffID{Digest: dgst, DiffID: diffID})
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder := schema2.NewManifestBuilder(repo.Blobs(ctx), schema2.MediaTypeImageConfig, configJSON)
+	for _, layer := range expected {
+		builder.AppendReference(distribution.Descriptor{Digest: layer.Digest})
+	}
+	manifest, err := builder.Build(ctx)
+	if err != nil {
+		t.Fatalf("failed to build manifest: %v", err)
+	}
+	dgst, err := manifests.Put(ctx, manifest)
+	if err != nil {
+		t.Fatalf("failed to put manifest: %v", err)
+	}
+
+	resolver := NewDiffIDResolver(d, true)
+	for i := 0; i < 2; i++ {
+		mapping, err := resolver.Resolve(ctx, repo, dgst)
+		if err != nil {
+			t.Fatalf("failed to resolve diffIDs: %v", err)
+		}
+		if !reflect.DeepEqual(mapping, expected) {
+			t.Fatalf("unexpected mapping: %v != %v", mapping, expected)
+		}
+	}
+
+	schema1Image := uploadRandomSchema1Image(t, repo)
+	if _, err := resolver.Resolve(ctx, repo, schema1Image.manifestDigest); err != distribution.ErrUnsupported {
+		t.Fatalf("expected ErrUnsupported for schema1 manifest, got %v", err)
+	}
+
+	// the cached mapping must not be returned for a deleted manifest
+	if err := manifests.Delete(ctx, dgst); err != nil {
+		t.Fatalf("failed to delete manifest: %v", err)
+	}
+	if _, err := resolver.Resolve(ctx, repo, dgst); err == nil {
+		t.Fatalf("expected error resolving deleted manifest")
+	} else if _, ok := err.(distribution.ErrManifestUnknownRevision); !ok {
+		t.Fatalf("unexpected error resolving deleted manifest: %v", err)
+	}
+}
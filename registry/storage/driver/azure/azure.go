@@ -336,6 +336,15 @@ func (d *driver) Delete(ctx context.Context, path string) error {
 	return nil
 }
 
+// Capabilities reports that the driver makes Shared Access Signature URLs and
+// copies blobs within Azure. Listings filter all the blobs below a path.
+func (d *driver) Capabilities() storagedriver.Capabilities {
+	return storagedriver.Capabilities{
+		URLFor:         true,
+		ServerSideCopy: true,
+	}
+}
+
 // URLFor returns a publicly accessible URL for the blob stored at given path
 // for specified duration by making use of Azure Storage Shared Access Signatures (SAS).
 // See https://msdn.microsoft.com/en-us/library/azure/ee395415.aspx for more info.
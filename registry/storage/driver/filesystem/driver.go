@@ -283,6 +283,15 @@ func (d *driver) Delete(ctx context.Context, subPath string) error {
 	return err
 }
 
+// Capabilities reports that the driver renames files to move them and reads
+// directories to list them, but can't make URLs.
+func (d *driver) Capabilities() storagedriver.Capabilities {
+	return storagedriver.Capabilities{
+		ServerSideCopy:    true,
+		ListWithDelimiter: true,
+	}
+}
+
 // URLFor returns a URL which may be used to retrieve the content stored at the given path.
 // May return an UnsupportedMethodErr in certain StorageDriver implementations.
 func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
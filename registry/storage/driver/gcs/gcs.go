@@ -797,8 +797,20 @@ func storageCopyObject(context context.Context, srcBucket, srcName string, destB
 	return obj, err
 }
 
+// Capabilities reports that the driver copies objects within GCS and lists
+// them with a delimiter. It signs URLs only if it has a privateKey.
+func (d *driver) Capabilities() storagedriver.Capabilities {
+	return storagedriver.Capabilities{
+		URLFor:            d.privateKey != nil,
+		ServerSideCopy:    true,
+		ListWithDelimiter: true,
+	}
+}
+
 // URLFor returns a URL which may be used to retrieve the content stored at
-// the given path, possibly using the given options.
+// the given path, possibly using the given options. The responsecontenttype
+// and responsecontentdisposition options set the headers the content is
+// served with.
 // Returns ErrUnsupportedMethod if this driver has no privateKey
 func (d *driver) URLFor(context context.Context, path string, options map[string]interface{}) (string, error) {
 	if d.privateKey == nil {
@@ -830,7 +842,33 @@ func (d *driver) URLFor(context context.Context, path string, options map[string
 		Method:         methodString,
 		Expires:        expiresTime,
 	}
-	return storage.SignedURL(d.bucket, name, opts)
+	signedURL, err := storage.SignedURL(d.bucket, name, opts)
+	if err != nil {
+		return "", err
+	}
+
+	// response overrides are not part of the signature
+	query := url.Values{}
+	if contentType, ok := options["responsecontenttype"].(string); ok && contentType != "" {
+		query.Set("response-content-type", contentType)
+	}
+	if disposition, ok := options["responsecontentdisposition"].(string); ok && disposition != "" {
+		query.Set("response-content-disposition", disposition)
+	}
+	if len(query) == 0 {
+		return signedURL, nil
+	}
+
+	u, err := url.Parse(signedURL)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	for key, values := range query {
+		q[key] = values
+	}
+	u.RawQuery = q.Encode()
+	return u.String(), nil
 }
 
 // Walk traverses a filesystem defined within driver, starting
@@ -238,6 +238,15 @@ func (d *driver) Delete(ctx context.Context, path string) error {
 	}
 }
 
+// Capabilities reports that the driver moves and lists content in memory,
+// but can't make URLs.
+func (d *driver) Capabilities() storagedriver.Capabilities {
+	return storagedriver.Capabilities{
+		ServerSideCopy:    true,
+		ListWithDelimiter: true,
+	}
+}
+
 // URLFor returns a URL which may be used to retrieve the content stored at the given path.
 // May return an UnsupportedMethodErr in certain StorageDriver implementations.
 func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
@@ -224,18 +224,25 @@ func (d *dir) move(src, dst string) error {
 
 	delete(spd.children, srcFilename)
 
-	switch n := s.(type) {
-	case *dir:
-		n.p = dst
-	case *file:
-		n.p = dst
-	}
-
+	relocate(s, dst)
 	dp.add(s)
 
 	return nil
 }
 
+// relocate sets the path of n, and those of its descendants, to be under p.
+func relocate(n node, p string) {
+	switch n := n.(type) {
+	case *dir:
+		n.p = p
+		for name, child := range n.children {
+			relocate(child, path.Join(p, name))
+		}
+	case *file:
+		n.p = p
+	}
+}
+
 func (d *dir) delete(p string) error {
 	dirname, filename := path.Split(p)
 	parent := d.find(dirname)
@@ -198,6 +198,17 @@ func (lh *cloudFrontStorageMiddleware) URLFor(ctx context.Context, path string,
 	return cfURL, nil
 }
 
+// Capabilities reports that URLs are signed for any path of an S3 backend,
+// on top of the capabilities of the wrapped driver. Other backends are left
+// to make their own URLs.
+func (lh *cloudFrontStorageMiddleware) Capabilities() storagedriver.Capabilities {
+	capabilities := lh.StorageDriver.Capabilities()
+	if _, ok := lh.StorageDriver.(S3BucketKeyer); ok {
+		capabilities.URLFor = true
+	}
+	return capabilities
+}
+
 // init registers the cloudfront layerHandler backend.
 func init() {
 	storagemiddleware.Register("cloudfront", storagemiddleware.InitFunc(newCloudFrontStorageMiddleware))
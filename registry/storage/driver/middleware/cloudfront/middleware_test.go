@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"testing"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// s3KeyedDriver is an in-memory driver keyed like an S3 bucket.
+type s3KeyedDriver struct {
+	storagedriver.StorageDriver
+}
+
+func (d s3KeyedDriver) S3BucketKey(path string) string {
+	return path
+}
+
+func TestCapabilities(t *testing.T) {
+	driver := inmemory.New()
+	expected := driver.Capabilities()
+
+	lh := &cloudFrontStorageMiddleware{StorageDriver: driver}
+	assertEqual(t, expected, lh.Capabilities())
+
+	lh = &cloudFrontStorageMiddleware{StorageDriver: s3KeyedDriver{driver}}
+	expected.URLFor = true
+	assertEqual(t, expected, lh.Capabilities())
+}
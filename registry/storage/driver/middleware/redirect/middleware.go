@@ -45,6 +45,14 @@ func (r *redirectStorageMiddleware) URLFor(ctx context.Context, path string, opt
 	return u.String(), nil
 }
 
+// Capabilities reports that URLs are made for any path, on top of the
+// capabilities of the wrapped driver.
+func (r *redirectStorageMiddleware) Capabilities() storagedriver.Capabilities {
+	capabilities := r.StorageDriver.Capabilities()
+	capabilities.URLFor = true
+	return capabilities
+}
+
 func init() {
 	storagemiddleware.Register("redirect", storagemiddleware.InitFunc(newRedirectStorageMiddleware))
 }
@@ -461,6 +461,16 @@ func (d *driver) Delete(ctx context.Context, path string) error {
 	return nil
 }
 
+// Capabilities reports that the driver signs URLs, copies objects within OSS
+// and lists them with a delimiter.
+func (d *driver) Capabilities() storagedriver.Capabilities {
+	return storagedriver.Capabilities{
+		URLFor:            true,
+		ServerSideCopy:    true,
+		ListWithDelimiter: true,
+	}
+}
+
 // URLFor returns a URL which may be used to retrieve the content stored at the given path.
 // May return an UnsupportedMethodErr in certain StorageDriver implementations.
 func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
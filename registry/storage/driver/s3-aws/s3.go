@@ -861,7 +861,19 @@ ListLoop:
 	return nil
 }
 
+// Capabilities reports that the driver presigns URLs, copies objects within
+// S3 and lists them with a delimiter.
+func (d *driver) Capabilities() storagedriver.Capabilities {
+	return storagedriver.Capabilities{
+		URLFor:            true,
+		ServerSideCopy:    true,
+		ListWithDelimiter: true,
+	}
+}
+
 // URLFor returns a URL which may be used to retrieve the content stored at the given path.
+// The responsecontenttype and responsecontentdisposition options set the
+// headers the content is served with by a GET URL.
 // May return an UnsupportedMethodErr in certain StorageDriver implementations.
 func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
 	methodString := "GET"
@@ -886,10 +898,17 @@ func (d *driver) URLFor(ctx context.Context, path string, options map[string]int
 
 	switch methodString {
 	case "GET":
-		req, _ = d.S3.GetObjectRequest(&s3.GetObjectInput{
+		input := &s3.GetObjectInput{
 			Bucket: aws.String(d.Bucket),
 			Key:    aws.String(d.s3Path(path)),
-		})
+		}
+		if contentType, ok := options["responsecontenttype"].(string); ok && contentType != "" {
+			input.ResponseContentType = aws.String(contentType)
+		}
+		if disposition, ok := options["responsecontentdisposition"].(string); ok && disposition != "" {
+			input.ResponseContentDisposition = aws.String(disposition)
+		}
+		req, _ = d.S3.GetObjectRequest(input)
 	case "HEAD":
 		req, _ = d.S3.HeadObjectRequest(&s3.HeadObjectInput{
 			Bucket: aws.String(d.Bucket),
@@ -998,6 +1017,11 @@ func (d *driver) doWalk(parentCtx context.Context, objectCount *int64, path, pre
 		sort.SliceStable(walkInfos, func(i, j int) bool { return walkInfos[i].FileInfoFields.Path < walkInfos[j].FileInfoFields.Path })
 
 		for _, walkInfo := range walkInfos {
+			if err := ctx.Err(); err != nil {
+				retError = err
+				return false
+			}
+
 			err := f(walkInfo)
 
 			if err == storagedriver.ErrSkipDir {
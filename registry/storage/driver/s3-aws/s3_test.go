@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"io/ioutil"
 	"math/rand"
+	"net/url"
 	"os"
 	"strconv"
 	"testing"
@@ -237,6 +238,43 @@ func TestStorageClass(t *testing.T) {
 
 }
 
+func TestURLForResponseHeaders(t *testing.T) {
+	if skipS3() != "" {
+		t.Skip(skipS3())
+	}
+
+	rootDir, err := ioutil.TempDir("", "driver-")
+	if err != nil {
+		t.Fatalf("unexpected error creating temporary directory: %v", err)
+	}
+	defer os.Remove(rootDir)
+
+	driver, err := s3DriverConstructor(rootDir, s3.StorageClassStandard)
+	if err != nil {
+		t.Fatalf("unexpected error creating driver: %v", err)
+	}
+
+	signed, err := driver.URLFor(context.Background(), "/blob", map[string]interface{}{
+		"method":                     "GET",
+		"responsecontenttype":        "application/octet-stream",
+		"responsecontentdisposition": "attachment",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error creating url: %v", err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("unexpected error parsing url: %v", err)
+	}
+	if contentType := u.Query().Get("response-content-type"); contentType != "application/octet-stream" {
+		t.Fatalf("unexpected response content type %q in %s", contentType, signed)
+	}
+	if disposition := u.Query().Get("response-content-disposition"); disposition != "attachment" {
+		t.Fatalf("unexpected response content disposition %q in %s", disposition, signed)
+	}
+}
+
 func TestOverThousandBlobs(t *testing.T) {
 	if skipS3() != "" {
 		t.Skip(skipS3())
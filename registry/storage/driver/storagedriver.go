@@ -90,6 +90,34 @@ type StorageDriver interface {
 	// to a directory, the directory will not be entered and Walk
 	// will continue the traversal.  If fileInfo refers to a normal file, processing stops
 	Walk(ctx context.Context, path string, f WalkFn) error
+
+	// Capabilities reports the optional features the driver supports.
+	Capabilities() Capabilities
+}
+
+// Capabilities describes the optional features of a StorageDriver.
+type Capabilities struct {
+	// URLFor is set if URLFor returns URLs from which clients can fetch
+	// content, rather than ErrUnsupportedMethod.
+	URLFor bool
+
+	// ServerSideCopy is set if Move is carried out by the storage backend,
+	// without the content passing through the registry.
+	ServerSideCopy bool
+
+	// ListWithDelimiter is set if List asks the storage backend for the
+	// direct descendants of a path only, rather than filtering all the
+	// objects below it.
+	ListWithDelimiter bool
+}
+
+// NoCapabilities may be embedded in a StorageDriver to report none of the
+// optional features.
+type NoCapabilities struct{}
+
+// Capabilities reports that no optional feature is supported.
+func (NoCapabilities) Capabilities() Capabilities {
+	return Capabilities{}
 }
 
 // FileWriter provides an abstraction for an opened writable file-like object in
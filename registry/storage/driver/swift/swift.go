@@ -602,6 +602,16 @@ func (d *driver) Delete(ctx context.Context, path string) error {
 	return nil
 }
 
+// Capabilities reports that the driver moves objects within Swift and lists
+// them with a delimiter. It makes temporary URLs only if it has a secret key.
+func (d *driver) Capabilities() storagedriver.Capabilities {
+	return storagedriver.Capabilities{
+		URLFor:            d.SecretKey != "",
+		ServerSideCopy:    true,
+		ListWithDelimiter: true,
+	}
+}
+
 // URLFor returns a URL which may be used to retrieve the content stored at the given path.
 func (d *driver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
 	if d.SecretKey == "" {
@@ -21,6 +21,7 @@ type WalkFn func(fileInfo FileInfo) error
 // If the returned error from the WalkFn is ErrSkipDir and fileInfo refers
 // to a directory, the directory will not be entered and Walk
 // will continue the traversal.  If fileInfo refers to a normal file, processing stops
+// The walk also stops, returning the error of ctx, once ctx is done.
 func WalkFallback(ctx context.Context, driver StorageDriver, from string, f WalkFn) error {
 	children, err := driver.List(ctx, from)
 	if err != nil {
@@ -28,6 +29,9 @@ func WalkFallback(ctx context.Context, driver StorageDriver, from string, f Walk
 	}
 	sort.Stable(sort.StringSlice(children))
 	for _, child := range children {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		// TODO(stevvooe): Calling driver.Stat for every entry is quite
 		// expensive when running against backends with a slow Stat
 		// implementation, such as s3. This is very likely a serious
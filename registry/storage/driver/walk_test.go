@@ -45,3 +45,29 @@ func TestWalkFileRemoved(t *testing.T) {
 		t.Fatalf(err.Error())
 	}
 }
+
+func TestWalkCancelled(t *testing.T) {
+	d := &changingFileSystem{
+		fileset: []string{"bender", "fry", "zoidberg"},
+		keptFiles: map[string]bool{
+			"bender":   true,
+			"fry":      true,
+			"zoidberg": true,
+		},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	infos := []FileInfo{}
+	err := WalkFallback(ctx, d, "", func(fileInfo FileInfo) error {
+		infos = append(infos, fileInfo)
+		cancel()
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatalf("unexpected error walking with a cancelled context: %v", err)
+	}
+	if len(infos) != 1 {
+		t.Fatalf("walk went on for %d files after cancellation", len(infos)-1)
+	}
+}
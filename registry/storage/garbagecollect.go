@@ -2,22 +2,146 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"path"
+	"regexp"
+	"sync"
+	"time"
 
 	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/uuid"
 	"github.com/opencontainers/go-digest"
 )
 
-func emit(format string, a ...interface{}) {
-	fmt.Printf(format+"\n", a...)
+// emit logs msg on the logger of ctx. The remaining arguments are key/value
+// pairs added to the log entry as fields.
+func emit(ctx context.Context, msg string, fields ...interface{}) {
+	f := make(map[interface{}]interface{}, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		f[fields[i]] = fields[i+1]
+	}
+	dcontext.GetLoggerWithFields(ctx, f).Info(msg)
 }
 
 // GCOpts contains options for garbage collector
 type GCOpts struct {
 	DryRun         bool
 	RemoveUntagged bool
+
+	// ActiveUploadWindow, when non-zero, makes the garbage collector skip
+	// any repository with an upload started within the window. Everything
+	// linked into a skipped repository is marked and none of its manifests
+	// are deleted.
+	ActiveUploadWindow time.Duration
+
+	// StaleUploadAge, when non-zero, makes the garbage collector remove the
+	// upload sessions started longer ago than this, which were abandoned
+	// by their clients. Repositories excluded from collection are left
+	// alone.
+	StaleUploadAge time.Duration
+
+	// RemoveEmptyRepositories makes the garbage collector remove the
+	// directories of the repositories it leaves without manifests or tags,
+	// so that they no longer appear in the catalog. Repositories with an
+	// upload in progress are kept. Nothing is removed in dry run mode.
+	RemoveEmptyRepositories bool
+
+	// UntaggedGracePeriod, when non-zero, keeps untagged manifests whose
+	// revision link was written less than this long ago, so that a manifest
+	// pushed by digest ahead of its tag is not swept with RemoveUntagged.
+	UntaggedGracePeriod time.Duration
+
+	// ContinueOnError makes the garbage collector skip manifests that cannot
+	// be read instead of aborting. Skipped manifests are reported in
+	// GCSummary.Errors. Blobs referenced only by a manifest whose content is
+	// missing or corrupt are not marked and will be swept. If any other
+	// manifest failed to be read, as with a storage error, no blob is swept.
+	ContinueOnError bool
+
+	// Concurrency is the number of blobs removed in parallel during the
+	// sweep. Values below two sweep sequentially.
+	Concurrency int
+
+	// RepositoryAllow and RepositoryDeny restrict which repositories the
+	// garbage collector deletes manifests from. A repository must match
+	// RepositoryAllow, if set, and must not match RepositoryDeny, if set.
+	// Everything linked into an excluded repository is marked, so its
+	// blobs are kept.
+	RepositoryAllow *regexp.Regexp
+	RepositoryDeny  *regexp.Regexp
+
+	// LockTTL, when non-zero, makes the garbage collector hold a lock in
+	// storage for the duration of the run and fail with ErrGCLocked if
+	// another run holds one. Locks older than LockTTL are treated as
+	// abandoned and taken over.
+	LockTTL time.Duration
+
+	// Listener, if set, is notified of every manifest and blob removed. It
+	// is not called in dry run mode or for removals that fail. A Listener
+	// implementing GCReporter is told of the mark phase as well.
+	Listener GCListener
+
+	// CheckpointInterval, when non-zero, makes the garbage collector record
+	// its progress in storage after marking a repository, whenever at
+	// least this many blobs have been marked since the last checkpoint.
+	// The checkpoint is removed once marking completes.
+	CheckpointInterval int
+
+	// Resume makes the garbage collector pick up the mark phase from the
+	// checkpoint left by an interrupted run, if any, skipping the
+	// repositories it had finished. Content pushed to those repositories
+	// since is not marked, so the registry should stay read-only between
+	// the runs.
+	Resume bool
+
+	// MaxBytes, when non-zero, stops the sweep once at least this many
+	// bytes have been reclaimed. The remaining unreferenced blobs are left
+	// for a later run.
+	MaxBytes int64
+}
+
+// GCListener is notified of content removed by the garbage collector.
+type GCListener interface {
+	// ManifestDeleted is called after a manifest revision is removed
+	// from repo.
+	ManifestDeleted(repo string, desc distribution.Descriptor) error
+
+	// BlobDeleted is called after a blob is removed from the blob store.
+	BlobDeleted(desc distribution.Descriptor) error
+}
+
+// GCReporter is a GCListener which is also told of the progress of the
+// mark phase. If GCOpts.Listener implements it, the garbage collector calls
+// its methods as well, in dry run mode too.
+type GCReporter interface {
+	GCListener
+
+	// ManifestMarked is called after the manifest dgst of repo, possibly
+	// soft deleted, is marked with the blobs it references.
+	ManifestMarked(repo string, dgst digest.Digest)
+
+	// BlobMarked is called the first time a blob is marked, manifests
+	// included.
+	BlobMarked(dgst digest.Digest)
+
+	// Done is called with the summary of a run that completed.
+	Done(summary GCSummary)
+}
+
+// excludes returns why the repository named name is excluded from
+// collection, or an empty string if it is not.
+func (opts GCOpts) excludes(name string) string {
+	if opts.RepositoryAllow != nil && !opts.RepositoryAllow.MatchString(name) {
+		return "not matched by allow regexp"
+	}
+	if opts.RepositoryDeny != nil && opts.RepositoryDeny.MatchString(name) {
+		return "matched by deny regexp"
+	}
+	return ""
 }
 
 // ManifestDel contains manifest structure which will be deleted
@@ -25,20 +149,106 @@ type ManifestDel struct {
 	Name   string
 	Digest digest.Digest
 	Tags   []string
+
+	// MediaType is the media type of the manifest, or empty if it could
+	// not be read.
+	MediaType string
+
+	// untag lists the tags currently referencing the manifest, which are
+	// only removed along with referrers of a deleted subject.
+	untag []string
+}
+
+// GCSummary describes the outcome of a garbage collection run. In dry run
+// mode it counts what would have been deleted.
+type GCSummary struct {
+	ManifestsDeleted    int
+	BlobsDeleted        int
+	UploadsDeleted      int
+	RepositoriesDeleted int
+	BytesReclaimed      int64
+	Duration            time.Duration
+
+	// Manifests lists the manifests deleted, including their media type.
+	Manifests []ManifestDel
+
+	// Errors holds the failures skipped when GCOpts.ContinueOnError is set.
+	Errors []error
 }
 
 // MarkAndSweep performs a mark and sweep of registry data
 func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts GCOpts) error {
+	_, err := MarkAndSweepSummary(ctx, storageDriver, registry, opts)
+	return err
+}
+
+// MarkAndSweepSummary performs a mark and sweep of registry data and
+// returns a summary of the removed content.
+func MarkAndSweepSummary(ctx context.Context, storageDriver driver.StorageDriver, registry distribution.Namespace, opts GCOpts) (GCSummary, error) {
+	var summary GCSummary
+	start := time.Now()
+	id := uuid.Generate().String()
+	ctx = dcontext.WithLogger(ctx, dcontext.GetLoggerWithField(ctx, "gc.id", id))
+
+	if opts.LockTTL > 0 {
+		if err := acquireGCLock(ctx, storageDriver, id, opts.LockTTL); err != nil {
+			return summary, err
+		}
+		defer func() {
+			if err := releaseGCLock(ctx, storageDriver, id); err != nil {
+				dcontext.GetLogger(ctx).Errorf("failed to release garbage collection lock: %v", err)
+			}
+		}()
+	}
+
 	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
 	if !ok {
-		return fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+		return summary, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
 	}
 
+	gcRuns.Inc(1)
+	markStart := time.Now()
+	vacuum := NewRegistryVacuum(ctx, storageDriver, registry)
+	reporter, _ := opts.Listener.(GCReporter)
+
 	// mark
 	markSet := make(map[digest.Digest]struct{})
 	manifestArr := make([]ManifestDel, 0)
-	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
-		emit(repoName)
+	tombstoneArr := make([]ManifestDel, 0)
+	referrersArr := make([]ManifestDel, 0)
+	var collected []string
+	var finished []string
+	done := make(map[string]struct{})
+	if opts.Resume {
+		checkpoint, err := readGCCheckpoint(ctx, storageDriver)
+		if err != nil {
+			return summary, fmt.Errorf("failed to read checkpoint: %v", err)
+		}
+		if checkpoint != nil {
+			emit(ctx, "resuming from checkpoint", "repositories", len(checkpoint.Repositories), "blobs.marked", len(checkpoint.Marked))
+			finished = checkpoint.Repositories
+			for _, repoName := range finished {
+				done[repoName] = struct{}{}
+			}
+			for _, dgst := range checkpoint.Marked {
+				markSet[dgst] = struct{}{}
+			}
+			collected = checkpoint.Collected
+			manifestArr = append(manifestArr, restoreManifests(checkpoint.Manifests)...)
+			tombstoneArr = append(tombstoneArr, restoreManifests(checkpoint.Tombstones)...)
+			referrersArr = append(referrersArr, restoreManifests(checkpoint.Referrers)...)
+			summary.UploadsDeleted = checkpoint.UploadsDeleted
+		}
+	}
+	checkpointed := len(markSet)
+
+	// unmarked is set when a manifest that may still reference live blobs
+	// was skipped
+	unmarked := false
+
+	markRepository := func(repoName string) error {
+		ctx := dcontext.WithLogger(ctx, dcontext.GetLoggerWithField(ctx, "repository", repoName))
+		emit(ctx, "marking repository")
 
 		var err error
 		named, err := reference.WithName(repoName)
@@ -60,41 +270,147 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 			return fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
 		}
 
-		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
-			if opts.RemoveUntagged {
-				// fetch all tags where this manifest is the latest one
-				tags, err := repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: dgst})
+		skip := false
+		reason := opts.excludes(repoName)
+		if reason == "" && opts.StaleUploadAge > 0 {
+			removed, err := removeStaleUploads(ctx, storageDriver, repoName, opts)
+			if err != nil {
+				return fmt.Errorf("failed to remove stale uploads of repo %s: %v", repoName, err)
+			}
+			summary.UploadsDeleted += removed
+		}
+		if reason != "" {
+			emit(ctx, "skipping repository", "reason", reason)
+			skip = true
+		} else if opts.ActiveUploadWindow > 0 {
+			skip, err = hasActiveUploads(ctx, storageDriver, repoName, time.Now().Add(-opts.ActiveUploadWindow))
+			if err != nil {
+				return fmt.Errorf("failed to check uploads for repo %s: %v", repoName, err)
+			}
+			if skip {
+				emit(ctx, "skipping repository with active uploads")
+			}
+		}
+		if skip {
+			if err := markLinkedBlobs(ctx, repository, markSet, reporter); err != nil {
+				return err
+			}
+		} else {
+			collected = append(collected, repoName)
+		}
+
+		ms, ok := manifestService.(*manifestStore)
+		if !ok {
+			return fmt.Errorf("unable to convert ManifestService into manifestStore")
+		}
+		policy := ms.repository.registry.referrersGCPolicy
+		streaming := ms.repository.registry.gcStreamingDeletes && !opts.DryRun
+
+		// resolve the tags of every manifest in a single pass over the tags
+		var tagsByDigest map[digest.Digest][]string
+		var allTags []string
+		if (opts.RemoveUntagged || policy != ReferrersIndependent) && !skip {
+			tagStore, ok := repository.Tags(ctx).(*tagStore)
+			if !ok {
+				return fmt.Errorf("unable to convert TagService into tagStore")
+			}
+			tagsByDigest, err = tagStore.LookupAll(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve tags for repo %s: %v", repoName, err)
+			}
+		}
+
+		// kept reports whether the manifest dgst is kept, regardless of
+		// the referrers policy
+		kept := func(dgst digest.Digest) (bool, error) {
+			if !opts.RemoveUntagged || skip || len(tagsByDigest[dgst]) > 0 {
+				return true, nil
+			}
+			if opts.UntaggedGracePeriod > 0 {
+				recent, err := linkedSince(ctx, storageDriver, manifestRevisionLinkPathSpec{name: repoName, revision: dgst}, time.Now().Add(-opts.UntaggedGracePeriod))
 				if err != nil {
-					return fmt.Errorf("failed to retrieve tags for digest %v: %v", dgst, err)
+					return false, fmt.Errorf("failed to stat manifest %v: %v", dgst, err)
+				}
+				if recent {
+					emit(ctx, "keeping untagged manifest within grace period", "digest", dgst)
+					return true, nil
 				}
-				if len(tags) == 0 {
-					emit("manifest eligible for deletion: %s", dgst)
-					// fetch all tags from repository
-					// all of these tags could contain manifest in history
-					// which means that we need check (and delete) those references when deleting manifest
-					allTags, err := repository.Tags(ctx).All(ctx)
-					if err != nil {
-						return fmt.Errorf("failed to retrieve tags %v", err)
+			}
+			return false, nil
+		}
+
+		// deleteManifest deletes the manifest dgst right away when deletes
+		// are streamed, and holds it for the sweep otherwise
+		deleteManifest := func(dgst digest.Digest) error {
+			// fetch all tags from repository
+			// all of these tags could contain manifest in history
+			// which means that we need check (and delete) those references when deleting manifest
+			if allTags == nil {
+				allTags, err = repository.Tags(ctx).All(ctx)
+				if _, ok := err.(distribution.ErrRepositoryUnknown); ok {
+					// the repository has never been tagged
+					allTags, err = []string{}, nil
+				}
+				if err != nil {
+					return fmt.Errorf("failed to retrieve tags %v", err)
+				}
+			}
+			obj := ManifestDel{Name: repoName, Digest: dgst, Tags: allTags, untag: tagsByDigest[dgst]}
+			if manifest, err := manifestService.Get(ctx, dgst); err == nil {
+				obj.MediaType, _, _ = manifest.Payload()
+			}
+			emit(ctx, "manifest eligible for deletion", "digest", dgst, "mediatype", obj.MediaType)
+			if streaming {
+				if err := removeManifest(vacuum, obj, opts); err != nil {
+					return err
+				}
+				summary.ManifestsDeleted++
+				return nil
+			}
+			manifestArr = append(manifestArr, obj)
+			return nil
+		}
+
+		// keepManifest marks the manifest dgst and the blobs it references
+		keepManifest := func(dgst digest.Digest) error {
+			if err := markManifest(ctx, manifestService, dgst, markSet, reporter); err != nil {
+				if opts.ContinueOnError {
+					dcontext.GetLoggerWithField(ctx, "digest", dgst).Errorf("skipping manifest: %v", err)
+					summary.Errors = append(summary.Errors, err)
+					if !unreadableManifest(err) {
+						unmarked = true
 					}
-					manifestArr = append(manifestArr, ManifestDel{Name: repoName, Digest: dgst, Tags: allTags})
 					return nil
 				}
+				return err
 			}
-			// Mark the manifest's blob
-			emit("%s: marking manifest %s ", repoName, dgst)
-			markSet[dgst] = struct{}{}
+			if reporter != nil {
+				reporter.ManifestMarked(repoName, dgst)
+			}
+			return nil
+		}
 
-			manifest, err := manifestService.Get(ctx, dgst)
+		// Without a referrers policy, which needs to know whether every
+		// manifest of the repository is kept, streamed deletes are made as
+		// the manifests are enumerated, so that the memory used doesn't
+		// grow with the number of manifests. Otherwise, keep records, for
+		// each manifest of the repository, whether it is kept or deleted.
+		inline := streaming && policy == ReferrersIndependent
+		var enumerated []digest.Digest
+		keep := make(map[digest.Digest]bool)
+		err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+			k, err := kept(dgst)
 			if err != nil {
-				return fmt.Errorf("failed to retrieve manifest for digest %v: %v", dgst, err)
+				return err
 			}
-
-			descriptors := manifest.References()
-			for _, descriptor := range descriptors {
-				markSet[descriptor.Digest] = struct{}{}
-				emit("%s: marking blob %s", repoName, descriptor.Digest)
+			if inline {
+				if k {
+					return keepManifest(dgst)
+				}
+				return deleteManifest(dgst)
 			}
-
+			enumerated = append(enumerated, dgst)
+			keep[dgst] = k
 			return nil
 		})
 
@@ -104,23 +420,129 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 		//
 		// In these cases we can continue marking other manifests safely.
 		if _, ok := err.(driver.PathNotFoundError); ok {
+			err = nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// soft deleted manifests keep their content until their restore
+		// window has passed
+		tombstones, err := ms.repository.tombstones(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve tombstones for repo %s: %v", repoName, err)
+		}
+		restorable := make(map[digest.Digest]struct{})
+		for dgst, tombstone := range tombstones {
+			if !skip && ms.repository.tombstoneExpired(tombstone, time.Now()) {
+				emit(ctx, "tombstone eligible for deletion", "digest", dgst)
+				tombstoneArr = append(tombstoneArr, ManifestDel{Name: repoName, Digest: dgst})
+				continue
+			}
+			restorable[dgst] = struct{}{}
+			if err := markTombstoned(ctx, ms, dgst, markSet, reporter); err != nil {
+				return err
+			}
+			if reporter != nil {
+				reporter.ManifestMarked(repoName, dgst)
+			}
+		}
+
+		if policy != ReferrersIndependent && !skip {
+			dangling, err := applyReferrersPolicy(ctx, storageDriver, named, policy, keep, restorable)
+			if err != nil {
+				return fmt.Errorf("failed to retrieve referrers for repo %s: %v", repoName, err)
+			}
+			for _, subject := range dangling {
+				referrersArr = append(referrersArr, ManifestDel{Name: repoName, Digest: subject})
+			}
+		}
+
+		for _, dgst := range enumerated {
+			if !keep[dgst] {
+				err = deleteManifest(dgst)
+			} else {
+				err = keepManifest(dgst)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		if _, ok := done[repoName]; ok {
 			return nil
 		}
+		if err := markRepository(repoName); err != nil {
+			return err
+		}
+		finished = append(finished, repoName)
 
-		return err
+		if opts.CheckpointInterval <= 0 || len(markSet)-checkpointed < opts.CheckpointInterval {
+			return nil
+		}
+		checkpointed = len(markSet)
+		marked := make([]digest.Digest, 0, len(markSet))
+		for dgst := range markSet {
+			marked = append(marked, dgst)
+		}
+		emit(ctx, "writing checkpoint", "repositories", len(finished), "blobs.marked", len(marked))
+		return writeGCCheckpoint(ctx, storageDriver, &gcCheckpoint{
+			Repositories:   finished,
+			Collected:      collected,
+			Marked:         marked,
+			Manifests:      checkpointManifests(manifestArr),
+			Tombstones:     checkpointManifests(tombstoneArr),
+			Referrers:      checkpointManifests(referrersArr),
+			UploadsDeleted: summary.UploadsDeleted,
+		})
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to mark: %v", err)
+		return summary, fmt.Errorf("failed to mark: %v", err)
+	}
+	// an interrupted sweep starts over with a fresh mark
+	if opts.Resume || opts.CheckpointInterval > 0 {
+		if err := removeGCCheckpoint(ctx, storageDriver); err != nil {
+			return summary, fmt.Errorf("failed to remove checkpoint: %v", err)
+		}
 	}
+	gcDuration.WithValues("mark").UpdateSince(markStart)
+	sweepStart := time.Now()
 
 	// sweep
-	vacuum := NewVacuum(ctx, storageDriver)
 	if !opts.DryRun {
 		for _, obj := range manifestArr {
-			err = vacuum.RemoveManifest(obj.Name, obj.Digest, obj.Tags)
+			if err := removeManifest(vacuum, obj, opts); err != nil {
+				return summary, err
+			}
+		}
+	}
+	summary.ManifestsDeleted += len(manifestArr)
+	summary.Manifests = manifestArr
+	if !opts.DryRun {
+		for _, obj := range tombstoneArr {
+			if err := vacuum.RemoveManifestTombstone(obj.Name, obj.Digest); err != nil {
+				return summary, fmt.Errorf("failed to delete tombstone of manifest %s: %v", obj.Digest, err)
+			}
+		}
+		for _, obj := range referrersArr {
+			if err := vacuum.RemoveReferrers(obj.Name, obj.Digest); err != nil {
+				return summary, fmt.Errorf("failed to delete referrers of manifest %s: %v", obj.Digest, err)
+			}
+		}
+	}
+	if opts.RemoveEmptyRepositories && !opts.DryRun {
+		for _, repoName := range collected {
+			removed, err := vacuum.RemoveEmptyRepository(repoName)
 			if err != nil {
-				return fmt.Errorf("failed to delete manifest %s: %v", obj.Digest, err)
+				return summary, fmt.Errorf("failed to delete empty repository %s: %v", repoName, err)
+			}
+			if removed {
+				summary.RepositoriesDeleted++
 			}
 		}
 	}
@@ -134,19 +556,417 @@ func MarkAndSweep(ctx context.Context, storageDriver driver.StorageDriver, regis
 		return nil
 	})
 	if err != nil {
-		return fmt.Errorf("error enumerating blobs: %v", err)
+		return summary, fmt.Errorf("error enumerating blobs: %v", err)
 	}
-	emit("\n%d blobs marked, %d blobs and %d manifests eligible for deletion", len(markSet), len(deleteSet), len(manifestArr))
+	emit(ctx, "mark complete",
+		"blobs.marked", len(markSet),
+		"blobs.eligible", len(deleteSet),
+		"manifests.eligible", summary.ManifestsDeleted)
+	if unmarked {
+		// the blobs of the skipped manifests would be swept along with the
+		// unreferenced ones
+		dcontext.GetLogger(ctx).Errorf("not sweeping blobs after failing to mark %d manifests", len(summary.Errors))
+	} else if err := sweepBlobs(ctx, registry, vacuum, deleteSet, opts, &summary); err != nil {
+		return summary, err
+	}
+	gcDuration.WithValues("sweep").UpdateSince(sweepStart)
+
+	summary.Duration = time.Since(start)
+	emit(ctx, "sweep complete",
+		"manifests.deleted", summary.ManifestsDeleted,
+		"blobs.deleted", summary.BlobsDeleted,
+		"uploads.deleted", summary.UploadsDeleted,
+		"repositories.deleted", summary.RepositoriesDeleted,
+		"bytes.reclaimed", summary.BytesReclaimed,
+		"duration", summary.Duration)
+	if reporter != nil {
+		reporter.Done(summary)
+	}
+
+	return summary, nil
+}
+
+// removeManifest removes the manifest revision described by obj, with the
+// tags listed for removal, and notifies opts.Listener.
+func removeManifest(vacuum Vacuum, obj ManifestDel, opts GCOpts) error {
+	for _, tag := range obj.untag {
+		if err := vacuum.RemoveTag(obj.Name, tag); err != nil {
+			return fmt.Errorf("failed to delete tag %s of manifest %s: %v", tag, obj.Digest, err)
+		}
+	}
+	var err error
+	if len(obj.Tags) == 0 {
+		err = vacuum.RemoveManifestRevision(obj.Name, obj.Digest)
+	} else {
+		err = vacuum.RemoveManifest(obj.Name, obj.Digest, obj.Tags)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete manifest %s: %v", obj.Digest, err)
+	}
+	gcManifestsDeleted.WithValues(obj.Name).Inc(1)
+	if opts.Listener != nil {
+		desc := distribution.Descriptor{MediaType: obj.MediaType, Digest: obj.Digest}
+		if err := opts.Listener.ManifestDeleted(obj.Name, desc); err != nil {
+			dcontext.GetLogger(vacuum.ctx).Errorf("failed to notify manifest deletion: %v", err)
+		}
+	}
+	return nil
+}
+
+// hasActiveUploads reports whether the named repository has an upload that
+// was started after since. Uploads with an unreadable start time are
+// considered active.
+func hasActiveUploads(ctx context.Context, storageDriver driver.StorageDriver, name string, since time.Time) (bool, error) {
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return false, err
+	}
+
+	uploads, err := storageDriver.List(ctx, path.Join(root, name, "_uploads"))
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+
+	for _, upload := range uploads {
+		startedAt, err := readStartedAtFile(storageDriver, path.Join(upload, "startedat"))
+		if err != nil || startedAt.After(since) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// removeStaleUploads removes the upload sessions of the named repository
+// older than opts.StaleUploadAge and returns how many there were. In dry run
+// mode they are only counted.
+func removeStaleUploads(ctx context.Context, storageDriver driver.StorageDriver, name string, opts GCOpts) (int, error) {
+	if opts.DryRun {
+		uploads, err := staleUploads(ctx, storageDriver, name, time.Now().Add(-opts.StaleUploadAge))
+		for _, upload := range uploads {
+			emit(ctx, "upload eligible for deletion", "path", upload)
+		}
+		return len(uploads), err
+	}
+
+	return NewVacuum(ctx, storageDriver).RemoveStaleUploads(name, opts.StaleUploadAge)
+}
+
+// manifestsReferencing returns the manifests of the repository which
+// reference dgst, using the same reference walk as the mark phase.
+func manifestsReferencing(ctx context.Context, repository distribution.Repository, dgst digest.Digest) ([]digest.Digest, error) {
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct manifest service: %v", err)
+	}
+
+	manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+	}
+
+	var referencing []digest.Digest
+	err = manifestEnumerator.Enumerate(ctx, func(manifestDigest digest.Digest) error {
+		manifest, err := manifestService.Get(ctx, manifestDigest)
+		if err != nil {
+			return fmt.Errorf("failed to retrieve manifest for digest %v: %v", manifestDigest, err)
+		}
+
+		for _, descriptor := range manifest.References() {
+			if descriptor.Digest == dgst {
+				referencing = append(referencing, manifestDigest)
+				break
+			}
+		}
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil, nil
+	}
+
+	return referencing, err
+}
+
+// sweepBlobs removes the blobs in deleteSet using opts.Concurrency workers
+// and records the result in summary. The first failure, or reaching
+// opts.MaxBytes, stops the sweep.
+func sweepBlobs(ctx context.Context, registry distribution.Namespace, vacuum Vacuum, deleteSet map[digest.Digest]struct{}, opts GCOpts, summary *GCSummary) error {
+	workers := opts.Concurrency
+	if workers < 1 {
+		workers = 1
+	}
+
+	var (
+		mu          sync.Mutex
+		firstErr    error
+		lastPercent int
+		wg          sync.WaitGroup
+		stopOnce    sync.Once
+	)
+	work := make(chan digest.Digest)
+	done := make(chan struct{})
+	stop := func() { stopOnce.Do(func() { close(done) }) }
+
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		stop()
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for dgst := range work {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				emit(ctx, "blob eligible for deletion", "digest", dgst)
+				desc, err := registry.BlobStatter().Stat(ctx, dgst)
+				if err != nil && err != distribution.ErrBlobUnknown {
+					fail(fmt.Errorf("failed to stat blob %s: %v", dgst, err))
+					return
+				}
+				if !opts.DryRun {
+					if err := vacuum.RemoveBlob(string(dgst)); err != nil {
+						fail(fmt.Errorf("failed to delete blob %s: %v", dgst, err))
+						return
+					}
+					gcBlobsDeleted.Inc(1)
+					gcBytesReclaimed.Inc(float64(desc.Size))
+					if opts.Listener != nil {
+						desc.Digest = dgst
+						if err := opts.Listener.BlobDeleted(desc); err != nil {
+							dcontext.GetLogger(ctx).Errorf("failed to notify blob deletion: %v", err)
+						}
+					}
+				}
+
+				mu.Lock()
+				summary.BlobsDeleted++
+				summary.BytesReclaimed += desc.Size
+				if percent := summary.BlobsDeleted * 100 / len(deleteSet); percent > lastPercent {
+					emit(ctx, "sweep progress",
+						"blobs.swept", summary.BlobsDeleted,
+						"blobs.eligible", len(deleteSet),
+						"percent", percent)
+					lastPercent = percent
+				}
+				if opts.MaxBytes > 0 && summary.BytesReclaimed >= opts.MaxBytes {
+					emit(ctx, "byte budget reached", "bytes.reclaimed", summary.BytesReclaimed)
+					stop()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
 	for dgst := range deleteSet {
-		emit("blob eligible for deletion: %s", dgst)
-		if opts.DryRun {
-			continue
+		select {
+		case work <- dgst:
+		case <-done:
+			break feed
 		}
-		err = vacuum.RemoveBlob(string(dgst))
+	}
+	close(work)
+	wg.Wait()
+
+	return firstErr
+}
+
+// linkedSince reports whether the link at spec was modified after since.
+func linkedSince(ctx context.Context, storageDriver driver.StorageDriver, spec pathSpec, since time.Time) (bool, error) {
+	linkPath, err := pathFor(spec)
+	if err != nil {
+		return false, err
+	}
+	fi, err := storageDriver.Stat(ctx, linkPath)
+	if err != nil {
+		return false, err
+	}
+	return fi.ModTime().After(since), nil
+}
+
+// markTombstoned marks the content of the soft deleted manifest revision
+// dgst and the blobs it references. Content that has already been swept is
+// skipped.
+func markTombstoned(ctx context.Context, ms *manifestStore, dgst digest.Digest, markSet map[digest.Digest]struct{}, reporter GCReporter) error {
+	content, err := ms.blobStore.blobStore.Get(ctx, dgst)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			return nil
+		}
+		return fmt.Errorf("failed to retrieve tombstoned manifest %v: %v", dgst, err)
+	}
+
+	manifest, err := ms.unmarshal(ctx, dgst, content)
+	if err != nil {
+		return fmt.Errorf("failed to unmarshal tombstoned manifest %v: %v", dgst, err)
+	}
+
+	emit(ctx, "marking tombstoned manifest", "digest", dgst)
+	markBlob(markSet, dgst, reporter)
+	for _, descriptor := range manifest.References() {
+		markBlob(markSet, descriptor.Digest, reporter)
+		emit(ctx, "marking blob", "digest", descriptor.Digest)
+	}
+	return nil
+}
+
+// markManifest marks the manifest dgst and the blobs it references.
+func markManifest(ctx context.Context, manifestService distribution.ManifestService, dgst digest.Digest, markSet map[digest.Digest]struct{}, reporter GCReporter) error {
+	// Mark the manifest's blob
+	emit(ctx, "marking manifest", "digest", dgst)
+	markBlob(markSet, dgst, reporter)
+
+	manifest, err := manifestService.Get(ctx, dgst)
+	if err != nil {
+		return manifestMarkError{Digest: dgst, Err: err}
+	}
+
+	descriptors := manifest.References()
+	for _, descriptor := range descriptors {
+		markBlob(markSet, descriptor.Digest, reporter)
+		emit(ctx, "marking blob", "digest", descriptor.Digest)
+	}
+	return nil
+}
+
+// manifestMarkError is returned by markManifest when the manifest to mark
+// can't be retrieved.
+type manifestMarkError struct {
+	Digest digest.Digest
+	Err    error
+}
+
+func (err manifestMarkError) Error() string {
+	return fmt.Sprintf("failed to retrieve manifest for digest %v: %v", err.Digest, err.Err)
+}
+
+// unreadableManifest reports whether err, returned by markManifest, means
+// that the content of the manifest is missing or corrupt, so that retrying
+// won't tell which blobs it references.
+func unreadableManifest(err error) bool {
+	markErr, ok := err.(manifestMarkError)
+	if !ok {
+		return false
+	}
+
+	switch markErr.Err.(type) {
+	case distribution.ErrManifestUnknownRevision, driver.PathNotFoundError,
+		distribution.ErrManifestVerification, *json.SyntaxError, *json.UnmarshalTypeError:
+		return true
+	}
+	return markErr.Err == distribution.ErrBlobUnknown
+}
+
+// markBlob adds dgst to markSet and, if it was not marked yet, tells
+// reporter, if any.
+func markBlob(markSet map[digest.Digest]struct{}, dgst digest.Digest, reporter GCReporter) {
+	if _, ok := markSet[dgst]; ok {
+		return
+	}
+	markSet[dgst] = struct{}{}
+	if reporter != nil {
+		reporter.BlobMarked(dgst)
+	}
+}
+
+// applyReferrersPolicy updates keep, which records whether each manifest of
+// the named repository is kept, for the referrers of its manifests according
+// to policy. Restorable subjects keep their referrers as kept ones do. It
+// returns the subjects, kept by neither, whose referrers are all deleted
+// under ReferrersFollowSubject.
+func applyReferrersPolicy(ctx context.Context, storageDriver driver.StorageDriver, named reference.Named, policy ReferrersPolicy, keep map[digest.Digest]bool, restorable map[digest.Digest]struct{}) ([]digest.Digest, error) {
+	subjects, err := referrerSubjects(ctx, storageDriver, named.Name())
+	if err != nil {
+		return nil, err
+	}
+	referrers := make(map[digest.Digest][]digest.Digest, len(subjects))
+	for _, subject := range subjects {
+		referrers[subject], err = Referrers(ctx, storageDriver, named, subject)
 		if err != nil {
-			return fmt.Errorf("failed to delete blob %s: %v", dgst, err)
+			return nil, err
 		}
 	}
 
+	alive := func(dgst digest.Digest) bool {
+		_, ok := restorable[dgst]
+		return ok || keep[dgst]
+	}
+
+	// the referrers of a kept manifest are kept, and so are theirs
+	var queue []digest.Digest
+	for _, subject := range subjects {
+		if alive(subject) {
+			queue = append(queue, subject)
+		}
+	}
+	for len(queue) > 0 {
+		subject := queue[0]
+		queue = queue[1:]
+		for _, referrer := range referrers[subject] {
+			if kept, ok := keep[referrer]; ok && !kept {
+				emit(ctx, "keeping referrer of kept manifest", "digest", referrer, "subject", subject)
+				keep[referrer] = true
+				queue = append(queue, referrer)
+			}
+		}
+	}
+
+	if policy != ReferrersFollowSubject {
+		return nil, nil
+	}
+
+	// the referrers of a deleted manifest are deleted, and so are theirs
+	var dangling []digest.Digest
+	for _, subject := range subjects {
+		if !alive(subject) {
+			dangling = append(dangling, subject)
+			queue = append(queue, subject)
+		}
+	}
+	for len(queue) > 0 {
+		subject := queue[0]
+		queue = queue[1:]
+		for _, referrer := range referrers[subject] {
+			if keep[referrer] {
+				emit(ctx, "referrer of deleted manifest eligible for deletion", "digest", referrer, "subject", subject)
+				keep[referrer] = false
+				queue = append(queue, referrer)
+				if _, ok := referrers[referrer]; ok {
+					dangling = append(dangling, referrer)
+				}
+			}
+		}
+	}
+
+	return dangling, nil
+}
+
+// markLinkedBlobs marks every blob linked into the repository.
+func markLinkedBlobs(ctx context.Context, repository distribution.Repository, markSet map[digest.Digest]struct{}, reporter GCReporter) error {
+	blobEnumerator, ok := repository.Blobs(ctx).(distribution.BlobEnumerator)
+	if !ok {
+		return fmt.Errorf("unable to convert BlobStore into BlobEnumerator")
+	}
+
+	err := blobEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+		markBlob(markSet, dgst, reporter)
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
 	return err
 }
@@ -1,18 +1,28 @@
 package storage
 
 import (
+	"context"
+	"fmt"
 	"io"
 	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
-	"github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/ocischema"
+	"github.com/docker/distribution/manifest/schema2"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/distribution/registry/storage/driver/inmemory"
 	"github.com/docker/distribution/testutil"
 	"github.com/docker/libtrust"
 	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 type image struct {
@@ -500,3 +510,1049 @@ func TestOrphanBlobDeleted(t *testing.T) {
 		}
 	}
 }
+
+func TestGCShardedBlobPaths(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	// content written before the registry was sharded further
+	legacy := createRegistry(t, inmemoryDriver)
+	legacyRepo := makeRepository(t, legacy, "sharded")
+	legacyImage := uploadRandomSchema2Image(t, legacyRepo)
+	legacyOrphans, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(legacyRepo, legacyOrphans); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+
+	registry := createRegistry(t, inmemoryDriver, BlobPathSharding([]int{2, 2}))
+	repo := makeRepository(t, registry, "sharded")
+	image := uploadRandomSchema2Image(t, repo)
+	orphans, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo, orphans); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         false,
+		RemoveUntagged: false,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	blobs := allBlobs(t, registry)
+	for _, layers := range []map[digest.Digest]io.ReadSeeker{legacyOrphans, orphans} {
+		for dgst := range layers {
+			if _, ok := blobs[dgst]; ok {
+				t.Fatalf("Orphan layer is present: %v", dgst)
+			}
+		}
+	}
+	for _, layers := range []map[digest.Digest]io.ReadSeeker{legacyImage.layers, image.layers} {
+		for dgst := range layers {
+			if _, ok := blobs[dgst]; !ok {
+				t.Fatalf("Referenced layer is missing: %v", dgst)
+			}
+			if _, err := registry.BlobStatter().Stat(ctx, dgst); err != nil {
+				t.Fatalf("Referenced layer can't be stated: %v", err)
+			}
+		}
+	}
+}
+
+func TestGCSkipsRepositoryWithActiveUploads(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "uploading")
+
+	// an untagged image would normally be removed with RemoveUntagged
+	image := uploadRandomSchema2Image(t, repo)
+	tagged := uploadRandomSchema2Image(t, repo)
+	err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest})
+	if err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	wr, err := repo.Blobs(ctx).Create(ctx)
+	if err != nil {
+		t.Fatalf("failed to start upload: %v", err)
+	}
+	defer wr.Cancel(ctx)
+
+	before := allBlobs(t, registry)
+
+	err = MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
+		DryRun:             false,
+		RemoveUntagged:     true,
+		ActiveUploadWindow: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	after := allBlobs(t, registry)
+	if len(before) != len(after) {
+		t.Fatalf("Garbage collection affected storage: %d != %d", len(before), len(after))
+	}
+	if _, ok := allManifests(t, makeManifestService(t, repo))[image.manifestDigest]; !ok {
+		t.Fatalf("manifest of repository with active uploads was deleted")
+	}
+
+	// without the window the untagged image is collected
+	err = MarkAndSweep(context.Background(), inmemoryDriver, registry, GCOpts{
+		DryRun:         false,
+		RemoveUntagged: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	after = allBlobs(t, registry)
+	for layer := range image.layers {
+		if _, ok := after[layer]; ok {
+			t.Fatalf("layer of untagged manifest is present: %v", layer)
+		}
+	}
+}
+
+func TestGCRemovesStaleUploads(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "uploading")
+	uploadRandomSchema2Image(t, repo)
+	blobs := repo.Blobs(ctx)
+
+	stale, err := blobs.Create(ctx)
+	if err != nil {
+		t.Fatalf("failed to start upload: %v", err)
+	}
+	startedAtPath, err := pathFor(uploadStartedAtPathSpec{name: repo.Named().Name(), id: stale.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	startedAt := time.Now().Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	if err := inmemoryDriver.PutContent(ctx, startedAtPath, []byte(startedAt)); err != nil {
+		t.Fatalf("failed to backdate upload: %v", err)
+	}
+
+	fresh, err := blobs.Create(ctx)
+	if err != nil {
+		t.Fatalf("failed to start upload: %v", err)
+	}
+	defer fresh.Cancel(ctx)
+
+	summary, err := MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         true,
+		StaleUploadAge: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if summary.UploadsDeleted != 1 {
+		t.Fatalf("expected 1 stale upload in dry run, got %d", summary.UploadsDeleted)
+	}
+	if _, err := blobs.Resume(ctx, stale.ID()); err != nil {
+		t.Fatalf("dry run removed stale upload: %v", err)
+	}
+
+	summary, err = MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{
+		StaleUploadAge: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if summary.UploadsDeleted != 1 {
+		t.Fatalf("expected 1 stale upload deleted, got %d", summary.UploadsDeleted)
+	}
+	if _, err := blobs.Resume(ctx, stale.ID()); err != distribution.ErrBlobUploadUnknown {
+		t.Fatalf("expected stale upload to be removed, got %v", err)
+	}
+	if _, err := blobs.Resume(ctx, fresh.ID()); err != nil {
+		t.Fatalf("upload within the window was removed: %v", err)
+	}
+}
+
+func TestGCRemovesEmptyRepositories(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	tagged := func(name string) {
+		repo := makeRepository(t, registry, name)
+		image := uploadRandomSchema2Image(t, repo)
+		if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+	}
+
+	uploadRandomSchema2Image(t, makeRepository(t, registry, "emptied"))
+	tagged("emptied/nested")
+	tagged("kept")
+
+	uploading := makeRepository(t, registry, "uploading")
+	uploadRandomSchema2Image(t, uploading)
+	wr, err := uploading.Blobs(ctx).Create(ctx)
+	if err != nil {
+		t.Fatalf("failed to start upload: %v", err)
+	}
+	defer wr.Cancel(ctx)
+
+	summary, err := MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged:          true,
+		RemoveEmptyRepositories: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if summary.RepositoriesDeleted != 1 {
+		t.Fatalf("expected 1 repository deleted, got %d", summary.RepositoriesDeleted)
+	}
+
+	var repos []string
+	err = registry.(distribution.RepositoryEnumerator).Enumerate(ctx, func(repoName string) error {
+		repos = append(repos, repoName)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("failed to enumerate repositories: %v", err)
+	}
+	expected := []string{"emptied/nested", "kept", "uploading"}
+	if !reflect.DeepEqual(repos, expected) {
+		t.Fatalf("unexpected repositories after collection: %v != %v", repos, expected)
+	}
+}
+
+func TestGCSummary(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "summary")
+	manifests := makeManifestService(t, repo)
+
+	uploadRandomSchema2Image(t, repo)
+	image := uploadRandomSchema2Image(t, repo)
+	if err := manifests.Delete(ctx, image.manifestDigest); err != nil {
+		t.Fatalf("failed to delete manifest: %v", err)
+	}
+
+	sizes := make(map[digest.Digest]int64)
+	for dgst := range allBlobs(t, registry) {
+		desc, err := registry.BlobStatter().Stat(ctx, dgst)
+		if err != nil {
+			t.Fatalf("failed to stat blob: %v", err)
+		}
+		sizes[dgst] = desc.Size
+	}
+
+	summary, err := MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         false,
+		RemoveUntagged: false,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	after := allBlobs(t, registry)
+	var reclaimed int64
+	for dgst, size := range sizes {
+		if _, ok := after[dgst]; !ok {
+			reclaimed += size
+		}
+	}
+
+	if summary.BlobsDeleted != len(sizes)-len(after) {
+		t.Fatalf("unexpected number of deleted blobs: %d != %d", summary.BlobsDeleted, len(sizes)-len(after))
+	}
+	if summary.BytesReclaimed != reclaimed {
+		t.Fatalf("unexpected number of reclaimed bytes: %d != %d", summary.BytesReclaimed, reclaimed)
+	}
+	if summary.ManifestsDeleted != 0 {
+		t.Fatalf("unexpected number of deleted manifests: %d", summary.ManifestsDeleted)
+	}
+}
+
+func TestGCUntaggedGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "grace")
+
+	image := uploadRandomSchema2Image(t, repo)
+	tagged := uploadRandomSchema2Image(t, repo)
+	err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest})
+	if err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged:      true,
+		UntaggedGracePeriod: time.Hour,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if _, ok := allManifests(t, makeManifestService(t, repo))[image.manifestDigest]; !ok {
+		t.Fatalf("untagged manifest within grace period was deleted")
+	}
+
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged:      true,
+		UntaggedGracePeriod: time.Nanosecond,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if _, ok := allManifests(t, makeManifestService(t, repo))[image.manifestDigest]; ok {
+		t.Fatalf("untagged manifest past grace period was not deleted")
+	}
+}
+
+func TestGCStreamingDeletes(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver, GCStreamingDeletes)
+	repo := makeRepository(t, registry, "streaming")
+
+	image := uploadRandomSchema2Image(t, repo)
+	tagged := uploadRandomSchema2Image(t, repo)
+	err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest})
+	if err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	summary, err := MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{RemoveUntagged: true})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if summary.ManifestsDeleted != 1 || len(summary.Manifests) != 0 {
+		t.Fatalf("unexpected summary of streamed deletes: %+v", summary)
+	}
+
+	manifests := allManifests(t, makeManifestService(t, repo))
+	if _, ok := manifests[image.manifestDigest]; ok {
+		t.Fatalf("untagged manifest was not deleted")
+	}
+	if _, ok := manifests[tagged.manifestDigest]; !ok {
+		t.Fatalf("tagged manifest was deleted")
+	}
+
+	blobs := allBlobs(t, registry)
+	for dgst := range image.layers {
+		if _, ok := blobs[dgst]; ok {
+			t.Fatalf("layer %s of the deleted manifest was not swept", dgst)
+		}
+	}
+	for dgst := range tagged.layers {
+		if _, ok := blobs[dgst]; !ok {
+			t.Fatalf("layer %s of the tagged manifest was swept", dgst)
+		}
+	}
+}
+
+// revisionWalkDriver records, for each removal of a manifest revision, how
+// many manifest revision links had been walked.
+type revisionWalkDriver struct {
+	driver.StorageDriver
+	walked  int
+	deletes []int
+}
+
+func (d *revisionWalkDriver) Walk(ctx context.Context, path string, f driver.WalkFn) error {
+	return driver.WalkFallback(ctx, d, path, func(fileInfo driver.FileInfo) error {
+		if strings.Contains(fileInfo.Path(), "/_manifests/revisions/") && strings.HasSuffix(fileInfo.Path(), "/link") {
+			d.walked++
+		}
+		return f(fileInfo)
+	})
+}
+
+func (d *revisionWalkDriver) Delete(ctx context.Context, path string) error {
+	if strings.Contains(path, "/_manifests/revisions/") {
+		d.deletes = append(d.deletes, d.walked)
+	}
+	return d.StorageDriver.Delete(ctx, path)
+}
+
+func TestGCStreamingDeletesDuringEnumeration(t *testing.T) {
+	ctx := context.Background()
+	recording := &revisionWalkDriver{StorageDriver: inmemory.New()}
+
+	registry := createRegistry(t, recording, GCStreamingDeletes)
+	repo := makeRepository(t, registry, "streaming")
+	for i := 0; i < 3; i++ {
+		uploadRandomSchema2Image(t, repo)
+	}
+	tagged := uploadRandomSchema2Image(t, repo)
+	err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest})
+	if err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	recording.walked = 0
+	summary, err := MarkAndSweepSummary(ctx, recording, registry, GCOpts{RemoveUntagged: true})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if summary.ManifestsDeleted != 3 {
+		t.Fatalf("expected 3 manifests deleted, got %d", summary.ManifestsDeleted)
+	}
+	if len(recording.deletes) == 0 || recording.deletes[0] >= 4 {
+		t.Fatalf("expected manifests to be deleted while they are enumerated, got deletes after %v walked links", recording.deletes)
+	}
+	if _, ok := allManifests(t, makeManifestService(t, repo))[tagged.manifestDigest]; !ok {
+		t.Fatalf("tagged manifest was deleted")
+	}
+}
+
+func TestGCContinueOnError(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "corrupt")
+	image := uploadRandomSchema2Image(t, repo)
+
+	dataPath, err := pathFor(blobDataPathSpec{digest: image.manifestDigest})
+	if err != nil {
+		t.Fatalf("failed to resolve manifest path: %v", err)
+	}
+	if err := inmemoryDriver.PutContent(ctx, dataPath, []byte("not a manifest")); err != nil {
+		t.Fatalf("failed to corrupt manifest: %v", err)
+	}
+
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{DryRun: true})
+	if err == nil {
+		t.Fatalf("expected mark and sweep to fail on a corrupt manifest")
+	}
+
+	summary, err := MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:          true,
+		ContinueOnError: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if len(summary.Errors) != 1 {
+		t.Fatalf("expected 1 skipped manifest, got %d: %v", len(summary.Errors), summary.Errors)
+	}
+}
+
+// failingReadDriver fails to read the content at fail, as a storage backend
+// timing out would.
+type failingReadDriver struct {
+	driver.StorageDriver
+	fail string
+}
+
+func (d *failingReadDriver) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	if path == d.fail {
+		return nil, fmt.Errorf("reading %s timed out", path)
+	}
+	return d.StorageDriver.Reader(ctx, path, offset)
+}
+
+func (d *failingReadDriver) Walk(ctx context.Context, path string, f driver.WalkFn) error {
+	return driver.WalkFallback(ctx, d, path, f)
+}
+
+func TestGCContinueOnStorageError(t *testing.T) {
+	ctx := context.Background()
+	failing := &failingReadDriver{StorageDriver: inmemory.New()}
+
+	registry := createRegistry(t, failing)
+	repo := makeRepository(t, registry, "unavailable")
+	image := uploadRandomSchema2Image(t, repo)
+	orphans, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatalf("failed to create random layer: %v", err)
+	}
+	if err := testutil.UploadBlobs(repo, orphans); err != nil {
+		t.Fatalf("failed to upload layer: %v", err)
+	}
+
+	failing.fail, err = pathFor(blobDataPathSpec{digest: image.manifestDigest})
+	if err != nil {
+		t.Fatalf("failed to resolve manifest path: %v", err)
+	}
+
+	summary, err := MarkAndSweepSummary(ctx, failing, registry, GCOpts{
+		ContinueOnError: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if len(summary.Errors) != 1 {
+		t.Fatalf("expected 1 skipped manifest, got %d: %v", len(summary.Errors), summary.Errors)
+	}
+	if summary.BlobsDeleted != 0 {
+		t.Fatalf("expected no blob swept, got %d", summary.BlobsDeleted)
+	}
+
+	blobs := allBlobs(t, registry)
+	for dgst := range image.layers {
+		if _, ok := blobs[dgst]; !ok {
+			t.Fatalf("layer %s of the unreadable manifest was swept", dgst)
+		}
+	}
+	for dgst := range orphans {
+		if _, ok := blobs[dgst]; !ok {
+			t.Fatalf("orphan layer %s was swept", dgst)
+		}
+	}
+}
+
+func TestGCConcurrentSweep(t *testing.T) {
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "concurrent")
+
+	digests, err := testutil.CreateRandomLayers(20)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo, digests); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+	image := uploadRandomSchema2Image(t, repo)
+
+	summary, err := MarkAndSweepSummary(context.Background(), inmemoryDriver, registry, GCOpts{
+		Concurrency: 4,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if summary.BlobsDeleted != len(digests) {
+		t.Fatalf("expected %d blobs deleted, got %d", len(digests), summary.BlobsDeleted)
+	}
+
+	blobs := allBlobs(t, registry)
+	for dgst := range digests {
+		if _, ok := blobs[dgst]; ok {
+			t.Fatalf("Orphan layer is present: %v", dgst)
+		}
+	}
+	for layer := range image.layers {
+		if _, ok := blobs[layer]; !ok {
+			t.Fatalf("Referenced layer was deleted: %v", layer)
+		}
+	}
+}
+
+func TestGCRepositoryFilter(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	staging := makeRepository(t, registry, "staging/app")
+	prod := makeRepository(t, registry, "prod/app")
+
+	uploads := make(map[string]image)
+	for name, repo := range map[string]distribution.Repository{"staging": staging, "prod": prod} {
+		uploads[name] = uploadRandomSchema2Image(t, repo)
+		tagged := uploadRandomSchema2Image(t, repo)
+		err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest})
+		if err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+	}
+
+	err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		RepositoryDeny: regexp.MustCompile(`^staging/`),
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	if _, ok := allManifests(t, makeManifestService(t, staging))[uploads["staging"].manifestDigest]; !ok {
+		t.Fatalf("untagged manifest in denied repository was deleted")
+	}
+	if _, ok := allManifests(t, makeManifestService(t, prod))[uploads["prod"].manifestDigest]; ok {
+		t.Fatalf("untagged manifest in collected repository was not deleted")
+	}
+
+	blobs := allBlobs(t, registry)
+	for layer := range uploads["staging"].layers {
+		if _, ok := blobs[layer]; !ok {
+			t.Fatalf("layer of denied repository was deleted: %v", layer)
+		}
+	}
+}
+
+func TestGCLock(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "locked")
+	uploadRandomSchema2Image(t, repo)
+
+	if err := acquireGCLock(ctx, inmemoryDriver, "other", time.Hour); err != nil {
+		t.Fatalf("failed to acquire lock: %v", err)
+	}
+
+	err := MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{LockTTL: time.Hour})
+	if err != ErrGCLocked {
+		t.Fatalf("expected %v, got %v", ErrGCLocked, err)
+	}
+
+	// the lock is stale with respect to a shorter TTL and is taken over
+	time.Sleep(time.Millisecond)
+	err = MarkAndSweep(ctx, inmemoryDriver, registry, GCOpts{LockTTL: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	lockPath, err := pathFor(gcLockPathSpec{})
+	if err != nil {
+		t.Fatalf("failed to resolve lock path: %v", err)
+	}
+	if _, err := inmemoryDriver.Stat(ctx, lockPath); err == nil {
+		t.Fatalf("lock was not released")
+	} else if _, ok := err.(driver.PathNotFoundError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+type recordingGCListener struct {
+	sync.Mutex
+	manifests []digest.Digest
+	blobs     []digest.Digest
+}
+
+func (l *recordingGCListener) ManifestDeleted(repo string, desc distribution.Descriptor) error {
+	l.Lock()
+	defer l.Unlock()
+	l.manifests = append(l.manifests, desc.Digest)
+	return nil
+}
+
+func (l *recordingGCListener) BlobDeleted(desc distribution.Descriptor) error {
+	l.Lock()
+	defer l.Unlock()
+	l.blobs = append(l.blobs, desc.Digest)
+	return nil
+}
+
+func TestGCListener(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "notified")
+
+	image := uploadRandomSchema2Image(t, repo)
+	tagged := uploadRandomSchema2Image(t, repo)
+	err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest})
+	if err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	listener := &recordingGCListener{}
+	summary, err := MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         true,
+		RemoveUntagged: true,
+		Listener:       listener,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if len(listener.manifests) != 0 || len(listener.blobs) != 0 {
+		t.Fatalf("listener notified in dry run mode")
+	}
+
+	summary, err = MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		Listener:       listener,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if len(listener.manifests) != 1 || listener.manifests[0] != image.manifestDigest {
+		t.Fatalf("unexpected manifest notifications: %v", listener.manifests)
+	}
+	if len(listener.blobs) != summary.BlobsDeleted {
+		t.Fatalf("expected %d blob notifications, got %d", summary.BlobsDeleted, len(listener.blobs))
+	}
+}
+
+type recordingGCReporter struct {
+	recordingGCListener
+	marked      map[digest.Digest]string
+	blobsMarked map[digest.Digest]int
+	summaries   []GCSummary
+}
+
+func (r *recordingGCReporter) ManifestMarked(repo string, dgst digest.Digest) {
+	r.marked[dgst] = repo
+}
+
+func (r *recordingGCReporter) BlobMarked(dgst digest.Digest) {
+	r.blobsMarked[dgst]++
+}
+
+func (r *recordingGCReporter) Done(summary GCSummary) {
+	r.summaries = append(r.summaries, summary)
+}
+
+func TestGCReporter(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "reported")
+
+	image := uploadRandomSchema2Image(t, repo)
+	tagged := uploadRandomSchema2Image(t, repo)
+	err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: tagged.manifestDigest})
+	if err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	reporter := &recordingGCReporter{
+		marked:      make(map[digest.Digest]string),
+		blobsMarked: make(map[digest.Digest]int),
+	}
+	summary, err := MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{
+		RemoveUntagged: true,
+		Listener:       reporter,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+
+	if len(reporter.marked) != 1 || reporter.marked[tagged.manifestDigest] != "reported" {
+		t.Fatalf("unexpected manifests marked: %v", reporter.marked)
+	}
+	for dgst := range tagged.layers {
+		if reporter.blobsMarked[dgst] != 1 {
+			t.Fatalf("layer %s of the tagged manifest reported marked %d times", dgst, reporter.blobsMarked[dgst])
+		}
+	}
+	if reporter.blobsMarked[tagged.manifestDigest] != 1 {
+		t.Fatalf("tagged manifest blob reported marked %d times", reporter.blobsMarked[tagged.manifestDigest])
+	}
+	for dgst := range image.layers {
+		if _, ok := reporter.blobsMarked[dgst]; ok {
+			t.Fatalf("layer %s of the untagged manifest reported marked", dgst)
+		}
+	}
+	if len(reporter.manifests) != 1 || reporter.manifests[0] != image.manifestDigest {
+		t.Fatalf("unexpected manifest deletions reported: %v", reporter.manifests)
+	}
+	if len(reporter.blobs) != summary.BlobsDeleted {
+		t.Fatalf("expected %d blob deletions reported, got %d", summary.BlobsDeleted, len(reporter.blobs))
+	}
+	if len(reporter.summaries) != 1 || !reflect.DeepEqual(reporter.summaries[0], summary) {
+		t.Fatalf("unexpected summaries reported: %+v", reporter.summaries)
+	}
+}
+
+func TestGCSummaryManifests(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "audited")
+	image := uploadRandomSchema2Image(t, repo)
+
+	summary, err := MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{
+		DryRun:         true,
+		RemoveUntagged: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if len(summary.Manifests) != 1 {
+		t.Fatalf("expected 1 manifest eligible for deletion, got %+v", summary.Manifests)
+	}
+	if obj := summary.Manifests[0]; obj.Digest != image.manifestDigest || obj.MediaType != schema2.MediaTypeManifest {
+		t.Fatalf("unexpected manifest eligible for deletion: %+v", obj)
+	}
+}
+
+func TestGCMaxBytes(t *testing.T) {
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "budget")
+
+	digests, err := testutil.CreateRandomLayers(5)
+	if err != nil {
+		t.Fatalf("Failed to create random digest: %v", err)
+	}
+	if err = testutil.UploadBlobs(repo, digests); err != nil {
+		t.Fatalf("Failed to upload blob: %v", err)
+	}
+	uploadRandomSchema2Image(t, repo)
+
+	summary, err := MarkAndSweepSummary(context.Background(), inmemoryDriver, registry, GCOpts{
+		MaxBytes: 1,
+	})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if summary.BlobsDeleted != 1 {
+		t.Fatalf("expected the sweep to stop after 1 blob, deleted %d", summary.BlobsDeleted)
+	}
+
+	remaining := 0
+	blobs := allBlobs(t, registry)
+	for dgst := range digests {
+		if _, ok := blobs[dgst]; ok {
+			remaining++
+		}
+	}
+	if remaining != len(digests)-1 {
+		t.Fatalf("expected %d orphan blobs left, found %d", len(digests)-1, remaining)
+	}
+}
+
+// gcCounter returns the current value of the named garbage collection
+// counter, summed over all label values.
+func gcCounter(t *testing.T, name string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	if err != nil {
+		t.Fatalf("failed to gather metrics: %v", err)
+	}
+
+	var value float64
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			value += metric.GetCounter().GetValue()
+		}
+	}
+	return value
+}
+
+func TestGCMetrics(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "metrics")
+	manifests := makeManifestService(t, repo)
+
+	image := uploadRandomSchema2Image(t, repo)
+	if err := manifests.Delete(ctx, image.manifestDigest); err != nil {
+		t.Fatalf("failed to delete manifest: %v", err)
+	}
+
+	runs := gcCounter(t, "registry_gc_runs_total")
+	blobs := gcCounter(t, "registry_gc_blobs_deleted_total")
+	bytes := gcCounter(t, "registry_gc_bytes_reclaimed_total")
+
+	if _, err := MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{DryRun: true}); err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if gcCounter(t, "registry_gc_blobs_deleted_total") != blobs || gcCounter(t, "registry_gc_bytes_reclaimed_total") != bytes {
+		t.Fatalf("dry run must not count deletions")
+	}
+
+	summary, err := MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{})
+	if err != nil {
+		t.Fatalf("Failed mark and sweep: %v", err)
+	}
+	if summary.BlobsDeleted == 0 {
+		t.Fatalf("expected blobs to be deleted")
+	}
+
+	if got := gcCounter(t, "registry_gc_runs_total") - runs; got != 2 {
+		t.Fatalf("unexpected number of counted runs: %v", got)
+	}
+	if got := gcCounter(t, "registry_gc_blobs_deleted_total") - blobs; got != float64(summary.BlobsDeleted) {
+		t.Fatalf("unexpected number of counted blob deletions: %v != %d", got, summary.BlobsDeleted)
+	}
+	if got := gcCounter(t, "registry_gc_bytes_reclaimed_total") - bytes; got != float64(summary.BytesReclaimed) {
+		t.Fatalf("unexpected number of counted bytes: %v != %d", got, summary.BytesReclaimed)
+	}
+}
+
+func TestGCReferrersPolicy(t *testing.T) {
+	for _, tc := range []struct {
+		policy      ReferrersPolicy
+		keepSigned  bool
+		keepOrphans bool
+	}{
+		{policy: ReferrersIndependent, keepSigned: false, keepOrphans: true},
+		{policy: ReferrersRetain, keepSigned: true, keepOrphans: true},
+		{policy: ReferrersFollowSubject, keepSigned: true, keepOrphans: false},
+	} {
+		ctx := context.Background()
+		inmemoryDriver := inmemory.New()
+
+		registry := createRegistry(t, inmemoryDriver, ReferrersGCPolicy(tc.policy))
+		repo := makeRepository(t, registry, "signed")
+		manifestService := makeManifestService(t, repo)
+
+		config, err := repo.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		putReferrer := func(subject image) digest.Digest {
+			_, payload, _ := subject.manifest.Payload()
+			dm, err := ocischema.FromStruct(ocischema.Manifest{
+				Versioned:    ocischema.SchemaVersion,
+				Config:       config,
+				ArtifactType: "application/vnd.example.signature",
+				Subject: &distribution.Descriptor{
+					MediaType: schema2.MediaTypeManifest,
+					Digest:    subject.manifestDigest,
+					Size:      int64(len(payload)),
+				},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			dgst, err := manifestService.Put(ctx, dm)
+			if err != nil {
+				t.Fatalf("failed to put referrer: %v", err)
+			}
+			return dgst
+		}
+
+		signed := uploadRandomSchema2Image(t, repo)
+		if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: signed.manifestDigest}); err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+		signature := putReferrer(signed)
+
+		untagged := uploadRandomSchema2Image(t, repo)
+		orphan := putReferrer(untagged)
+		if err := repo.Tags(ctx).Tag(ctx, "untagged.sig", distribution.Descriptor{Digest: orphan}); err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+
+		_, err = MarkAndSweepSummary(ctx, inmemoryDriver, registry, GCOpts{RemoveUntagged: true})
+		if err != nil {
+			t.Fatalf("%v: failed mark and sweep: %v", tc.policy, err)
+		}
+
+		for _, c := range []struct {
+			dgst digest.Digest
+			kept bool
+		}{
+			{signed.manifestDigest, true},
+			{signature, tc.keepSigned},
+			{untagged.manifestDigest, false},
+			{orphan, tc.keepOrphans},
+		} {
+			exists, err := manifestService.Exists(ctx, c.dgst)
+			if err != nil {
+				t.Fatalf("%v: unexpected error checking manifest: %v", tc.policy, err)
+			}
+			if exists != c.kept {
+				t.Errorf("%v: manifest %v exists = %t, expected %t", tc.policy, c.dgst, exists, c.kept)
+			}
+		}
+
+		_, err = repo.Tags(ctx).Get(ctx, "untagged.sig")
+		if _, unknown := err.(distribution.ErrTagUnknown); unknown == tc.keepOrphans {
+			t.Errorf("%v: unexpected error getting tag of orphaned referrer: %v", tc.policy, err)
+		}
+
+		referrers, err := Referrers(ctx, inmemoryDriver, repo.Named(), untagged.manifestDigest)
+		if err != nil {
+			t.Fatalf("%v: unexpected error listing referrers: %v", tc.policy, err)
+		}
+		if len(referrers) == 0 == tc.keepOrphans {
+			t.Errorf("%v: unexpected referrers of deleted manifest: %v", tc.policy, referrers)
+		}
+	}
+}
+
+// failingListDriver fails to list the paths containing fail.
+type failingListDriver struct {
+	driver.StorageDriver
+	fail string
+}
+
+func (d *failingListDriver) List(ctx context.Context, path string) ([]string, error) {
+	if strings.Contains(path, d.fail) {
+		return nil, fmt.Errorf("listing %s failed", path)
+	}
+	return d.StorageDriver.List(ctx, path)
+}
+
+func (d *failingListDriver) Walk(ctx context.Context, path string, f driver.WalkFn) error {
+	return driver.WalkFallback(ctx, d, path, f)
+}
+
+func TestGCResumeFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	failing := &failingListDriver{StorageDriver: inmemory.New(), fail: "/repositories/b/_manifests"}
+	registry := createRegistry(t, failing)
+
+	var tagged, untagged []digest.Digest
+	for _, name := range []string{"a", "b"} {
+		repo := makeRepository(t, registry, name)
+		image := uploadRandomSchema2Image(t, repo)
+		if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: image.manifestDigest}); err != nil {
+			t.Fatalf("failed to tag manifest: %v", err)
+		}
+		tagged = append(tagged, image.manifestDigest)
+		untagged = append(untagged, uploadRandomSchema2Image(t, repo).manifestDigest)
+	}
+
+	_, err := MarkAndSweepSummary(ctx, failing, registry, GCOpts{
+		RemoveUntagged:     true,
+		CheckpointInterval: 1,
+	})
+	if err == nil {
+		t.Fatalf("expected mark and sweep to fail")
+	}
+	checkpoint, err := readGCCheckpoint(ctx, failing)
+	if err != nil {
+		t.Fatalf("unexpected error reading checkpoint: %v", err)
+	}
+	if checkpoint == nil || !reflect.DeepEqual(checkpoint.Repositories, []string{"a"}) {
+		t.Fatalf("unexpected checkpoint: %+v", checkpoint)
+	}
+
+	// the finished repository must not be marked again
+	failing.fail = "/repositories/a/_manifests"
+	summary, err := MarkAndSweepSummary(ctx, failing, registry, GCOpts{
+		RemoveUntagged:     true,
+		CheckpointInterval: 1,
+		Resume:             true,
+	})
+	if err != nil {
+		t.Fatalf("failed to resume mark and sweep: %v", err)
+	}
+	if summary.ManifestsDeleted != 2 {
+		t.Errorf("expected 2 manifests deleted, got %d", summary.ManifestsDeleted)
+	}
+
+	failing.fail = "/nothing/"
+	for i, name := range []string{"a", "b"} {
+		manifestService := makeManifestService(t, makeRepository(t, registry, name))
+		if exists, err := manifestService.Exists(ctx, tagged[i]); err != nil || !exists {
+			t.Errorf("tagged manifest of %s was deleted: %v", name, err)
+		}
+		if exists, err := manifestService.Exists(ctx, untagged[i]); err != nil || exists {
+			t.Errorf("untagged manifest of %s was kept: %v", name, err)
+		}
+	}
+
+	checkpoint, err = readGCCheckpoint(ctx, failing)
+	if err != nil || checkpoint != nil {
+		t.Fatalf("expected checkpoint to be removed, got %+v: %v", checkpoint, err)
+	}
+}
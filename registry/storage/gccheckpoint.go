@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// gcCheckpoint records the progress of the mark phase of a garbage
+// collection, so that an interrupted run can resume without marking the
+// repositories it has finished again.
+type gcCheckpoint struct {
+	Repositories   []string             `json:"repositories"`
+	Collected      []string             `json:"collected,omitempty"`
+	Marked         []digest.Digest      `json:"marked"`
+	Manifests      []checkpointManifest `json:"manifests,omitempty"`
+	Tombstones     []checkpointManifest `json:"tombstones,omitempty"`
+	Referrers      []checkpointManifest `json:"referrers,omitempty"`
+	UploadsDeleted int                  `json:"uploadsdeleted,omitempty"`
+}
+
+// checkpointManifest is the form in which a ManifestDel is checkpointed.
+type checkpointManifest struct {
+	Name      string        `json:"name"`
+	Digest    digest.Digest `json:"digest"`
+	Tags      []string      `json:"tags,omitempty"`
+	MediaType string        `json:"mediatype,omitempty"`
+	Untag     []string      `json:"untag,omitempty"`
+}
+
+func checkpointManifests(objs []ManifestDel) []checkpointManifest {
+	manifests := make([]checkpointManifest, len(objs))
+	for i, obj := range objs {
+		manifests[i] = checkpointManifest{
+			Name:      obj.Name,
+			Digest:    obj.Digest,
+			Tags:      obj.Tags,
+			MediaType: obj.MediaType,
+			Untag:     obj.untag,
+		}
+	}
+	return manifests
+}
+
+func restoreManifests(manifests []checkpointManifest) []ManifestDel {
+	objs := make([]ManifestDel, len(manifests))
+	for i, m := range manifests {
+		objs[i] = ManifestDel{
+			Name:      m.Name,
+			Digest:    m.Digest,
+			Tags:      m.Tags,
+			MediaType: m.MediaType,
+			untag:     m.Untag,
+		}
+	}
+	return objs
+}
+
+// readGCCheckpoint returns the checkpoint left by an interrupted garbage
+// collection, or nil if there is none.
+func readGCCheckpoint(ctx context.Context, storageDriver driver.StorageDriver) (*gcCheckpoint, error) {
+	checkpointPath, err := pathFor(gcCheckpointPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := storageDriver.GetContent(ctx, checkpointPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var checkpoint gcCheckpoint
+	if err := json.Unmarshal(content, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// writeGCCheckpoint replaces the stored checkpoint with checkpoint.
+func writeGCCheckpoint(ctx context.Context, storageDriver driver.StorageDriver, checkpoint *gcCheckpoint) error {
+	checkpointPath, err := pathFor(gcCheckpointPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	return storageDriver.PutContent(ctx, checkpointPath, content)
+}
+
+// removeGCCheckpoint removes the stored checkpoint, if any.
+func removeGCCheckpoint(ctx context.Context, storageDriver driver.StorageDriver) error {
+	checkpointPath, err := pathFor(gcCheckpointPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	err = storageDriver.Delete(ctx, checkpointPath)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
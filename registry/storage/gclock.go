@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// ErrGCLocked is returned when garbage collection is already running
+// against the storage.
+var ErrGCLocked = errors.New("garbage collection already in progress")
+
+// acquireGCLock writes a lock file owned by id. An existing lock younger
+// than ttl causes ErrGCLocked; an older one is considered stale and taken
+// over. The storage drivers offer no compare-and-swap, so the lock is
+// advisory: it keeps scheduled runs apart but cannot exclude two runs that
+// start at the same instant.
+func acquireGCLock(ctx context.Context, storageDriver driver.StorageDriver, id string, ttl time.Duration) error {
+	lockPath, err := pathFor(gcLockPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	content, err := storageDriver.GetContent(ctx, lockPath)
+	switch err.(type) {
+	case nil:
+		if _, acquired, err := parseGCLock(content); err == nil && time.Since(acquired) < ttl {
+			return ErrGCLocked
+		}
+	case driver.PathNotFoundError:
+	default:
+		return err
+	}
+
+	return storageDriver.PutContent(ctx, lockPath, []byte(id+" "+time.Now().UTC().Format(time.RFC3339Nano)))
+}
+
+// releaseGCLock removes the lock file if it is still owned by id.
+func releaseGCLock(ctx context.Context, storageDriver driver.StorageDriver, id string) error {
+	lockPath, err := pathFor(gcLockPathSpec{})
+	if err != nil {
+		return err
+	}
+
+	content, err := storageDriver.GetContent(ctx, lockPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+	if owner, _, err := parseGCLock(content); err != nil || owner != id {
+		return nil
+	}
+
+	return storageDriver.Delete(ctx, lockPath)
+}
+
+// parseGCLock returns the owner and acquisition time stored in a lock file.
+func parseGCLock(content []byte) (string, time.Time, error) {
+	parts := strings.SplitN(string(content), " ", 2)
+	if len(parts) != 2 {
+		return "", time.Time{}, errors.New("malformed garbage collection lock")
+	}
+	acquired, err := time.Parse(time.RFC3339Nano, parts[1])
+	return parts[0], acquired, err
+}
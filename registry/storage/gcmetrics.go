@@ -0,0 +1,27 @@
+package storage
+
+import (
+	prometheus "github.com/docker/distribution/metrics"
+	"github.com/docker/go-metrics"
+)
+
+var (
+	// gcRuns is the number of garbage collection runs started
+	gcRuns = prometheus.GCNamespace.NewCounter("runs", "The number of garbage collection runs")
+
+	// gcDuration is the time spent in each garbage collection phase
+	gcDuration = prometheus.GCNamespace.NewLabeledTimer("duration", "The number of seconds each garbage collection phase takes", "phase")
+
+	// gcManifestsDeleted is the number of manifests removed from each repository
+	gcManifestsDeleted = prometheus.GCNamespace.NewLabeledCounter("manifests_deleted", "The number of manifests deleted by garbage collection", "repository")
+
+	// gcBlobsDeleted is the number of blobs removed from the blob store
+	gcBlobsDeleted = prometheus.GCNamespace.NewCounter("blobs_deleted", "The number of blobs deleted by garbage collection")
+
+	// gcBytesReclaimed is the size of the blobs removed from the blob store
+	gcBytesReclaimed = prometheus.GCNamespace.NewCounter("bytes_reclaimed", "The number of bytes reclaimed by garbage collection")
+)
+
+func init() {
+	metrics.Register(prometheus.GCNamespace)
+}
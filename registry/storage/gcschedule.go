@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"context"
+	"expvar"
+	"math/rand"
+	"sync"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+)
+
+// gcScheduler runs garbage collection at an interval while a registry is
+// serving.
+type gcScheduler struct {
+	interval time.Duration
+	opts     GCOpts
+
+	mu     sync.Mutex
+	status GCStatus
+}
+
+// GCStatus describes the most recent run of scheduled garbage collection.
+type GCStatus struct {
+	Runs     int       `json:"runs"`
+	Started  time.Time `json:"started,omitempty"`
+	Finished time.Time `json:"finished,omitempty"`
+	Error    string    `json:"error,omitempty"`
+
+	ManifestsDeleted    int   `json:"manifests_deleted"`
+	BlobsDeleted        int   `json:"blobs_deleted"`
+	UploadsDeleted      int   `json:"uploads_deleted"`
+	RepositoriesDeleted int   `json:"repositories_deleted"`
+	BytesReclaimed      int64 `json:"bytes_reclaimed"`
+}
+
+// GCSchedule is a functional option for NewRegistry. If interval is
+// positive, it runs garbage collection with opts every interval, starting
+// after a random delay of up to one interval, until the context given to
+// NewRegistry is cancelled. The runs hold the garbage collection lock, so
+// that they don't collide with one started from the command line; unless
+// opts.LockTTL is set, a lock is considered stale after one interval. The
+// status of the last run is published with expvar as registry.gc.
+func GCSchedule(interval time.Duration, opts GCOpts) RegistryOption {
+	return func(registry *registry) error {
+		if interval <= 0 {
+			registry.gcScheduler = nil
+			return nil
+		}
+		if opts.LockTTL <= 0 {
+			opts.LockTTL = interval
+		}
+		registry.gcScheduler = &gcScheduler{
+			interval: interval,
+			opts:     opts,
+		}
+		return nil
+	}
+}
+
+// start runs garbage collection of reg in a goroutine until ctx is done.
+func (s *gcScheduler) start(ctx context.Context, reg *registry) {
+	registryVars := expvar.Get("registry")
+	if registryVars == nil {
+		registryVars = expvar.NewMap("registry")
+	}
+	registryVars.(*expvar.Map).Set("gc", expvar.Func(func() interface{} {
+		return s.lastStatus()
+	}))
+
+	go func() {
+		jitter := time.Duration(rand.Int63n(int64(s.interval)))
+		log := dcontext.GetLogger(ctx)
+		for {
+			log.Infof("Starting garbage collection in %s", jitter)
+			select {
+			case <-ctx.Done():
+				log.Infof("Stopping scheduled garbage collection")
+				return
+			case <-time.After(jitter):
+			}
+
+			s.run(ctx, reg)
+			jitter = s.interval
+		}
+	}()
+}
+
+// run collects the garbage of reg once and records the outcome.
+func (s *gcScheduler) run(ctx context.Context, reg *registry) {
+	status := GCStatus{Started: time.Now()}
+	summary, err := MarkAndSweepSummary(ctx, reg.driver, reg, s.opts)
+	switch err {
+	case nil:
+	case ErrGCLocked:
+		dcontext.GetLogger(ctx).Infof("skipping scheduled garbage collection: %v", err)
+		status.Error = err.Error()
+	default:
+		dcontext.GetLogger(ctx).Errorf("scheduled garbage collection failed: %v", err)
+		status.Error = err.Error()
+	}
+	status.Finished = time.Now()
+	status.ManifestsDeleted = summary.ManifestsDeleted
+	status.BlobsDeleted = summary.BlobsDeleted
+	status.UploadsDeleted = summary.UploadsDeleted
+	status.RepositoriesDeleted = summary.RepositoriesDeleted
+	status.BytesReclaimed = summary.BytesReclaimed
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status.Runs = s.status.Runs + 1
+	s.status = status
+}
+
+// lastStatus returns the status of the last run.
+func (s *gcScheduler) lastStatus() GCStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.status
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+func TestGCSchedule(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	inmemoryDriver := inmemory.New()
+
+	repo := makeRepository(t, createRegistry(t, inmemoryDriver), "scheduled")
+	image := uploadRandomSchema2Image(t, repo)
+
+	scheduled, err := NewRegistry(ctx, inmemoryDriver, GCSchedule(10*time.Millisecond, GCOpts{RemoveUntagged: true}))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	scheduler := scheduled.(*registry).gcScheduler
+
+	deadline := time.Now().Add(5 * time.Second)
+	for scheduler.lastStatus().Runs == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("garbage collection was not run")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+
+	// a later run may have found nothing left to delete
+	status := scheduler.lastStatus()
+	if status.Error != "" {
+		t.Fatalf("unexpected status of scheduled garbage collection: %+v", status)
+	}
+	if exists, err := makeManifestService(t, repo).Exists(context.Background(), image.manifestDigest); err != nil || exists {
+		t.Fatalf("untagged manifest was not collected: %v", err)
+	}
+}
@@ -50,6 +50,44 @@ func (lbs *linkedBlobStore) Stat(ctx context.Context, dgst digest.Digest) (distr
 	return lbs.blobAccessController.Stat(ctx, dgst)
 }
 
+// MountFromGlobal links the blob dgst of the global blob store into
+// repository, as if it had been mounted from another repository, and returns
+// its descriptor. It returns ErrBlobUnknown if the registry doesn't have the
+// blob, and ErrUnsupported unless the registry was created with
+// AutoMountFromGlobal. Callers must check that the blob may be pushed to
+// repository.
+func MountFromGlobal(ctx context.Context, repository distribution.Repository, dgst digest.Digest) (distribution.Descriptor, error) {
+	lbs, ok := repository.Blobs(ctx).(*linkedBlobStore)
+	if !ok {
+		return distribution.Descriptor{}, fmt.Errorf("unable to convert BlobStore into linkedBlobStore")
+	}
+	if !lbs.registry.autoMountFromGlobal {
+		return distribution.Descriptor{}, distribution.ErrUnsupported
+	}
+
+	return lbs.mountFromGlobal(ctx, dgst)
+}
+
+// mountFromGlobal links the blob dgst of the global blob store into the
+// repository, as if it had been mounted from another repository, returning
+// ErrBlobUnknown if the registry doesn't have it.
+func (lbs *linkedBlobStore) mountFromGlobal(ctx context.Context, dgst digest.Digest) (distribution.Descriptor, error) {
+	desc, err := lbs.blobStore.statter.Stat(ctx, dgst)
+	if err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	if err := lbs.linkBlob(ctx, desc); err != nil {
+		return distribution.Descriptor{}, err
+	}
+	if err := lbs.blobAccessController.SetDescriptor(ctx, dgst, desc); err != nil {
+		return distribution.Descriptor{}, err
+	}
+
+	dcontext.GetLogger(ctx).Infof("mounted blob %s into %s from the global blob store", dgst, lbs.repository.Named().Name())
+	return desc, nil
+}
+
 func (lbs *linkedBlobStore) Get(ctx context.Context, dgst digest.Digest) ([]byte, error) {
 	canonical, err := lbs.Stat(ctx, dgst) // access check
 	if err != nil {
@@ -83,7 +121,7 @@ func (lbs *linkedBlobStore) ServeBlob(ctx context.Context, w http.ResponseWriter
 }
 
 func (lbs *linkedBlobStore) Put(ctx context.Context, mediaType string, p []byte) (distribution.Descriptor, error) {
-	dgst := digest.FromBytes(p)
+	dgst := lbs.blobStore.digestAlgorithm().FromBytes(p)
 	// Place the data in the blob store first.
 	desc, err := lbs.blobStore.Put(ctx, mediaType, p)
 	if err != nil {
@@ -166,8 +204,16 @@ func (lbs *linkedBlobStore) Create(ctx context.Context, options ...distribution.
 		return nil, err
 	}
 
+	limiter := lbs.uploadLimiter()
+	if limiter != nil && !limiter.acquire(lbs.repository.Named().Name(), uuid, startedAt) {
+		return nil, distribution.ErrBlobUploadLimit
+	}
+
 	// Write a startedat file for this upload
 	if err := lbs.blobStore.driver.PutContent(ctx, startedAtPath, []byte(startedAt.Format(time.RFC3339))); err != nil {
+		if limiter != nil {
+			limiter.release(lbs.repository.Named().Name(), uuid)
+		}
 		return nil, err
 	}
 
@@ -210,12 +256,25 @@ func (lbs *linkedBlobStore) Resume(ctx context.Context, id string) (distribution
 		return nil, err
 	}
 
+	if limiter := lbs.uploadLimiter(); limiter != nil {
+		limiter.touch(lbs.repository.Named().Name(), id, time.Now())
+	}
+
 	return lbs.newBlobUpload(ctx, id, path, startedAt, true)
 }
 
+// uploadLimiter returns the limiter of upload sessions in progress, or nil if
+// they are unlimited.
+func (lbs *linkedBlobStore) uploadLimiter() *uploadLimiter {
+	if lbs.registry == nil {
+		return nil
+	}
+	return lbs.registry.uploadLimiter
+}
+
 func (lbs *linkedBlobStore) Delete(ctx context.Context, dgst digest.Digest) error {
 	if !lbs.deleteEnabled {
-		return distribution.ErrUnsupported
+		return distribution.ErrDeleteDisabled
 	}
 
 	// Ensure the blob is available for deletion
@@ -224,6 +283,16 @@ func (lbs *linkedBlobStore) Delete(ctx context.Context, dgst digest.Digest) erro
 		return err
 	}
 
+	if lbs.registry != nil && lbs.registry.deleteReferenceCheck {
+		manifests, err := manifestsReferencing(ctx, lbs.repository, dgst)
+		if err != nil {
+			return err
+		}
+		if len(manifests) > 0 {
+			return distribution.ErrBlobInUse{Digest: dgst, Manifests: manifests}
+		}
+	}
+
 	err = lbs.blobAccessController.Clear(ctx, dgst)
 	if err != nil {
 		return err
@@ -316,7 +385,7 @@ func (lbs *linkedBlobStore) newBlobUpload(ctx context.Context, uuid, path string
 		blobStore:              lbs,
 		id:                     uuid,
 		startedAt:              startedAt,
-		digester:               digest.Canonical.Digester(),
+		digester:               lbs.blobStore.digestAlgorithm().Digester(),
 		fileWriter:             fw,
 		driver:                 lbs.driver,
 		path:                   path,
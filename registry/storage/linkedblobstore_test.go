@@ -10,6 +10,7 @@ import (
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
 	"github.com/docker/distribution/testutil"
 	"github.com/opencontainers/go-digest"
 )
@@ -213,3 +214,76 @@ func (f statCrossMountCreateOption) Apply(v interface{}) error {
 
 	return nil
 }
+
+func TestLinkedBlobStoreDeleteReferenceCheck(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New(), EnableDeleteReferenceCheck)
+	repo := makeRepository(t, registry, "referenced")
+
+	image := uploadRandomSchema2Image(t, repo)
+	layer := getAnyKey(image.layers)
+
+	err := repo.Blobs(ctx).Delete(ctx, layer)
+	inUse, ok := err.(distribution.ErrBlobInUse)
+	if !ok {
+		t.Fatalf("expected ErrBlobInUse deleting referenced layer, got %v", err)
+	}
+	if len(inUse.Manifests) != 1 || inUse.Manifests[0] != image.manifestDigest {
+		t.Fatalf("unexpected referencing manifests: %v", inUse.Manifests)
+	}
+
+	if err := makeManifestService(t, repo).Delete(ctx, image.manifestDigest); err != nil {
+		t.Fatalf("failed to delete manifest: %v", err)
+	}
+
+	if err := repo.Blobs(ctx).Delete(ctx, layer); err != nil {
+		t.Fatalf("unexpected error deleting unreferenced layer: %v", err)
+	}
+}
+
+func TestAutoMountFromGlobal(t *testing.T) {
+	ctx := context.Background()
+	driver := inmemory.New()
+
+	layers, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.UploadBlobs(makeRepository(t, createRegistry(t, driver), "foo/source"), layers); err != nil {
+		t.Fatal(err)
+	}
+	dgst := getKeys(layers)[0]
+	unknown := digest.FromString("not in the registry")
+
+	target := makeRepository(t, createRegistry(t, driver), "foo/target")
+	if _, err := MountFromGlobal(ctx, target, dgst); err != distribution.ErrUnsupported {
+		t.Fatalf("expected ErrUnsupported without auto mount, got %v", err)
+	}
+
+	target = makeRepository(t, createRegistry(t, driver, AutoMountFromGlobal), "foo/target")
+	if _, err := target.Blobs(ctx).Stat(ctx, dgst); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected stat not to mount the blob, got %v", err)
+	}
+	if _, err := MountFromGlobal(ctx, target, unknown); err != distribution.ErrBlobUnknown {
+		t.Fatalf("expected ErrBlobUnknown for a blob missing from the registry, got %v", err)
+	}
+	desc, err := MountFromGlobal(ctx, target, dgst)
+	if err != nil {
+		t.Fatalf("unexpected error mounting blob of the global store: %v", err)
+	}
+	if desc.Digest != dgst {
+		t.Fatalf("unexpected descriptor: %v", desc)
+	}
+
+	// the blob is now linked, without auto mount too
+	target = makeRepository(t, createRegistry(t, driver), "foo/target")
+	if _, err := target.Blobs(ctx).Stat(ctx, dgst); err != nil {
+		t.Fatalf("expected blob linked into the repository, got %v", err)
+	}
+
+	// layers are not mounted as manifests
+	manifests := makeManifestService(t, makeRepository(t, createRegistry(t, driver, AutoMountFromGlobal), "foo/manifests"))
+	if exists, err := manifests.Exists(ctx, dgst); err != nil || exists {
+		t.Fatalf("expected layer not to exist as a manifest, got %v, %v", exists, err)
+	}
+}
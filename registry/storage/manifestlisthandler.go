@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
@@ -15,6 +16,13 @@ type manifestListHandler struct {
 	repository distribution.Repository
 	blobStore  distribution.BlobStore
 	ctx        context.Context
+
+	// maxEntries, if not zero, limits the number of manifests a list may
+	// reference.
+	maxEntries int
+
+	// lazy skips checking that the referenced manifests are present.
+	lazy bool
 }
 
 var _ ManifestHandler = &manifestListHandler{}
@@ -67,10 +75,17 @@ func (ms *manifestListHandler) verifyManifest(ctx context.Context, mnfst manifes
 		return fmt.Errorf("unrecognized manifest list schema version %d", mnfst.SchemaVersion)
 	}
 
-	if !skipDependencyVerification {
+	if count := len(mnfst.References()); ms.maxEntries > 0 && count > ms.maxEntries {
+		errs = append(errs, distribution.ErrManifestTooManyReferences{Count: count, Limit: ms.maxEntries})
+		return errs
+	}
+
+	if !skipDependencyVerification && !ms.lazy {
 		// This manifest service is different from the blob service
 		// returned by Blob. It uses a linked blob store to ensure that
 		// only manifests are accessible.
+		defer observeManifestVerification(ctx, "list", len(mnfst.References()), time.Now())
+		manifestListReferencesVerified.Inc(float64(len(mnfst.References())))
 
 		manifestService, err := ms.repository.Manifests(ctx)
 		if err != nil {
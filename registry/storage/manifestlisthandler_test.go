@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestVerifyManifestListEntries(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	repo := makeRepository(t, createRegistry(t, d), "test")
+	image := uploadRandomSchema2Image(t, repo)
+
+	missing := digest.FromString("missing manifest")
+	complete, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{
+		{Descriptor: distribution.Descriptor{Digest: image.manifestDigest, MediaType: schema2.MediaTypeManifest}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	incomplete, err := manifestlist.FromDescriptors([]manifestlist.ManifestDescriptor{
+		{Descriptor: distribution.Descriptor{Digest: image.manifestDigest, MediaType: schema2.MediaTypeManifest}},
+		{Descriptor: distribution.Descriptor{Digest: missing, MediaType: schema2.MediaTypeManifest}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms := makeManifestService(t, repo)
+	if _, err := ms.Put(ctx, complete); err != nil {
+		t.Fatalf("unexpected error putting complete manifest list: %v", err)
+	}
+
+	_, err = ms.Put(ctx, incomplete)
+	verr, ok := err.(distribution.ErrManifestVerification)
+	if !ok || len(verr) != 1 {
+		t.Fatalf("expected verification error putting incomplete manifest list, got %v", err)
+	}
+	if unknown, ok := verr[0].(distribution.ErrManifestBlobUnknown); !ok || unknown.Digest != missing {
+		t.Fatalf("unexpected verification error: %v", verr[0])
+	}
+
+	lazy := makeManifestService(t, makeRepository(t, createRegistry(t, d, AllowLazyManifestList), "test"))
+	if _, err := lazy.Put(ctx, incomplete); err != nil {
+		t.Fatalf("unexpected error putting incomplete manifest list lazily: %v", err)
+	}
+}
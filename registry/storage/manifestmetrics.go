@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+	prometheus "github.com/docker/distribution/metrics"
+)
+
+// slowManifestVerification is the verification time above which the
+// verification of a manifest is logged.
+const slowManifestVerification = time.Second
+
+var (
+	// manifestVerifyDuration is the time spent checking that the content
+	// referenced by a pushed manifest exists
+	manifestVerifyDuration = prometheus.StorageNamespace.NewLabeledTimer("manifest_verify_duration", "The number of seconds spent verifying the references of a manifest", "type")
+
+	// manifestListReferencesVerified is the number of sub-manifests checked
+	// while verifying manifest lists
+	manifestListReferencesVerified = prometheus.StorageNamespace.NewCounter("manifest_list_references_verified", "The number of manifests verified as references of manifest lists")
+)
+
+// observeManifestVerification records the duration of a reference check
+// started at start for a manifest of the given kind, logging it when slow.
+func observeManifestVerification(ctx context.Context, kind string, references int, start time.Time) {
+	elapsed := time.Since(start)
+	manifestVerifyDuration.WithValues(kind).Update(elapsed)
+
+	if elapsed >= slowManifestVerification {
+		dcontext.GetLoggerWithFields(ctx, map[interface{}]interface{}{
+			"manifest.type":       kind,
+			"manifest.references": references,
+			"duration":            elapsed,
+		}).Warn("slow manifest verification")
+	}
+}
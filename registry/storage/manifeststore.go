@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
@@ -41,6 +42,10 @@ func (o skipLayerOption) Apply(m distribution.ManifestService) error {
 	return fmt.Errorf("skip layer verification only valid for manifestStore")
 }
 
+// defaultMaxManifestBytes is the largest manifest payload accepted unless
+// configured otherwise.
+const defaultMaxManifestBytes = 4 << 20
+
 type manifestStore struct {
 	repository *repository
 	blobStore  *linkedBlobStore
@@ -89,8 +94,27 @@ func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ..
 		return nil, err
 	}
 
+	manifest, err := ms.unmarshal(ctx, dgst, content)
+	if err != nil {
+		return nil, err
+	}
+	if sm, ok := manifest.(*schema1.SignedManifest); ok {
+		if ms.repository.schema1ConversionEnabled && schema1ConversionRequested(options) {
+			return ms.convertSchema1(ctx, dgst, sm)
+		}
+		if ms.repository.schema1PullRejected {
+			return nil, distribution.ErrSchemaV1Rejected
+		}
+	}
+
+	return manifest, nil
+}
+
+// unmarshal unmarshals the manifest content with the handler for its schema
+// version and media type.
+func (ms *manifestStore) unmarshal(ctx context.Context, dgst digest.Digest, content []byte) (distribution.Manifest, error) {
 	var versioned manifest.Versioned
-	if err = json.Unmarshal(content, &versioned); err != nil {
+	if err := json.Unmarshal(content, &versioned); err != nil {
 		return nil, err
 	}
 
@@ -129,23 +153,104 @@ func (ms *manifestStore) Get(ctx context.Context, dgst digest.Digest, options ..
 func (ms *manifestStore) Put(ctx context.Context, manifest distribution.Manifest, options ...distribution.ManifestServiceOption) (digest.Digest, error) {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Put")
 
+	var handler ManifestHandler
 	switch manifest.(type) {
 	case *schema1.SignedManifest:
-		return ms.schema1Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema1Handler
 	case *schema2.DeserializedManifest:
-		return ms.schema2Handler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.schema2Handler
 	case *ocischema.DeserializedManifest:
-		return ms.ocischemaHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.ocischemaHandler
 	case *manifestlist.DeserializedManifestList:
-		return ms.manifestListHandler.Put(ctx, manifest, ms.skipDependencyVerification)
+		handler = ms.manifestListHandler
+	default:
+		return "", fmt.Errorf("unrecognized manifest type %T", manifest)
+	}
+
+	if limit := ms.repository.maxManifestBytes; limit > 0 {
+		_, payload, err := manifest.Payload()
+		if err != nil {
+			return "", err
+		}
+		if size := int64(len(payload)); size > limit {
+			return "", distribution.ErrManifestVerification{distribution.ErrManifestTooLarge{Size: size, Limit: limit}}
+		}
+	}
+
+	if quota := ms.repository.repositoryQuota; quota != nil {
+		if err := quota.check(ctx, ms.repository.Blobs(ctx).(*linkedBlobStore), 0); err != nil {
+			return "", err
+		}
+	}
+
+	if admission := ms.repository.manifestAdmission; admission != nil {
+		if err := admission.admit(ctx, ms.repository.Named().Name(), ms.blobStore.blobStore.digestAlgorithm(), manifest); err != nil {
+			return "", err
+		}
+	}
+
+	dgst, err := handler.Put(ctx, manifest, ms.skipDependencyVerification)
+	if err != nil {
+		return dgst, err
+	}
+
+	if m, ok := manifest.(*ocischema.DeserializedManifest); ok && m.Subject != nil {
+		if err := ms.repository.linkReferrer(ctx, m.Subject.Digest, dgst); err != nil {
+			return dgst, err
+		}
 	}
 
-	return "", fmt.Errorf("unrecognized manifest type %T", manifest)
+	if ms.repository.registry.pushTimestampsEnabled {
+		if err := ms.repository.recordPushTime(ctx, time.Now()); err != nil {
+			dcontext.GetLogger(ms.ctx).Errorf("error recording push time: %v", err)
+		}
+	}
+
+	// the references of an index are manifests, served with their own type
+	if _, isIndex := manifest.(*manifestlist.DeserializedManifestList); !isIndex {
+		for _, desc := range manifest.References() {
+			if !ms.blobStore.blobStore.recordMediaType(ctx, desc.Digest, desc.MediaType) || ms.repository.descriptorCache == nil {
+				continue
+			}
+			// the repository cached the descriptor the blob was uploaded with
+			recorded, err := ms.blobStore.blobStore.statter.Stat(ctx, desc.Digest)
+			if err != nil {
+				continue
+			}
+			if err := ms.repository.descriptorCache.SetDescriptor(ctx, desc.Digest, recorded); err != nil {
+				dcontext.GetLogger(ctx).Errorf("error caching descriptor %v: %v", desc.Digest, err)
+			}
+		}
+	}
+
+	return dgst, nil
 }
 
 // Delete removes the revision of the specified manifest.
 func (ms *manifestStore) Delete(ctx context.Context, dgst digest.Digest) error {
 	dcontext.GetLogger(ms.ctx).Debug("(*manifestStore).Delete")
+
+	if ms.repository.protectLastTag {
+		ts := ms.repository.Tags(ctx).(*tagStore)
+		tags, err := ts.Lookup(ctx, distribution.Descriptor{Digest: dgst})
+		if err != nil {
+			return err
+		}
+		if err := ts.checkLastTag(ctx, tags); err != nil {
+			return err
+		}
+	}
+
+	if ms.repository.softDeleteRetention > 0 && ms.blobStore.deleteEnabled {
+		// check the revision exists before recording it as deleted
+		if _, err := ms.blobStore.Stat(ctx, dgst); err != nil {
+			return err
+		}
+		if err := ms.tombstone(ctx, dgst); err != nil {
+			return err
+		}
+	}
+
 	return ms.blobStore.Delete(ctx, dgst)
 }
 
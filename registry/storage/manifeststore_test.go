@@ -575,3 +575,209 @@ func TestLinkPathFuncs(t *testing.T) {
 		}
 	}
 }
+
+func TestMaxManifestBytes(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	repoName, _ := reference.WithName("foo/bar")
+
+	repository := makeRepository(t, createRegistry(t, d), repoName.Name())
+	layers, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.UploadBlobs(repository, layers); err != nil {
+		t.Fatal(err)
+	}
+	m, err := testutil.MakeSchema2Manifest(repository, getKeys(layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, payload, err := m.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := int64(len(payload))
+
+	for _, tc := range []struct {
+		limit    int64
+		rejected bool
+	}{
+		{limit: size - 1, rejected: true},
+		{limit: size},
+		{limit: 0},
+	} {
+		env := makeRepository(t, createRegistry(t, d, MaxManifestBytes(tc.limit)), repoName.Name())
+		ms, err := env.Manifests(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = ms.Put(ctx, m)
+		if !tc.rejected {
+			if err != nil {
+				t.Fatalf("unexpected error putting %d byte manifest with limit %d: %v", size, tc.limit, err)
+			}
+			continue
+		}
+
+		verificationErrs, ok := err.(distribution.ErrManifestVerification)
+		if !ok || len(verificationErrs) != 1 {
+			t.Fatalf("expected a verification error with limit %d, got %v", tc.limit, err)
+		}
+		if tooLarge, ok := verificationErrs[0].(distribution.ErrManifestTooLarge); !ok || tooLarge.Size != size || tooLarge.Limit != tc.limit {
+			t.Fatalf("unexpected verification error: %v", verificationErrs[0])
+		}
+	}
+}
+
+func TestRejectSchema1OnPull(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	repoName, _ := reference.WithName("foo/bar")
+
+	repository := makeRepository(t, createRegistry(t, d), repoName.Name())
+	layers, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.UploadBlobs(repository, layers); err != nil {
+		t.Fatal(err)
+	}
+
+	ms := makeManifestService(t, repository)
+	v1, err := testutil.MakeSchema1Manifest(getKeys(layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1Digest, err := ms.Put(ctx, v1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2, err := testutil.MakeSchema2Manifest(repository, getKeys(layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2Digest, err := ms.Put(ctx, v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rejecting := makeManifestService(t, makeRepository(t, createRegistry(t, d, RejectSchema1OnPull), repoName.Name()))
+	if _, err := rejecting.Get(ctx, v1Digest); err != distribution.ErrSchemaV1Rejected {
+		t.Fatalf("expected ErrSchemaV1Rejected fetching schema1 manifest, got %v", err)
+	}
+	if _, err := rejecting.Get(ctx, v2Digest); err != nil {
+		t.Fatalf("unexpected error fetching schema2 manifest: %v", err)
+	}
+}
+
+func TestSchema1TrustedKeys(t *testing.T) {
+	ctx := context.Background()
+	trustedKey, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	untrustedKey, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registry := createRegistry(t, inmemory.New(), Schema1TrustedKeys([]libtrust.PublicKey{trustedKey.PublicKey()}))
+	repository := makeRepository(t, registry, "foo/trusted")
+	layers, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.UploadBlobs(repository, layers); err != nil {
+		t.Fatal(err)
+	}
+	ms := makeManifestService(t, repository)
+
+	sign := func(key libtrust.PrivateKey) *schema1.SignedManifest {
+		m := schema1.Manifest{
+			Versioned: manifest.Versioned{SchemaVersion: 1},
+			Name:      "foo/trusted",
+			Tag:       "latest",
+		}
+		for _, dgst := range getKeys(layers) {
+			m.FSLayers = append(m.FSLayers, schema1.FSLayer{BlobSum: dgst})
+			m.History = append(m.History, schema1.History{V1Compatibility: "{}"})
+		}
+		sm, err := schema1.Sign(&m, key)
+		if err != nil {
+			t.Fatalf("error signing manifest: %v", err)
+		}
+		return sm
+	}
+
+	if _, err := ms.Put(ctx, sign(trustedKey)); err != nil {
+		t.Fatalf("unexpected error putting manifest signed by a trusted key: %v", err)
+	}
+
+	// rewrite the tag without changing the length of the signed content
+	_, payload, _ := sign(trustedKey).Payload()
+	var tampered schema1.SignedManifest
+	if err := tampered.UnmarshalJSON(bytes.Replace(payload, []byte(`"latest"`), []byte(`"lat3st"`), 1)); err != nil {
+		t.Fatalf("error unmarshaling tampered manifest: %v", err)
+	}
+
+	for name, sm := range map[string]*schema1.SignedManifest{
+		"untrusted": sign(untrustedKey),
+		"tampered":  &tampered,
+	} {
+		_, err := ms.Put(ctx, sm)
+		verr, ok := err.(distribution.ErrManifestVerification)
+		if !ok || len(verr) != 1 {
+			t.Fatalf("%s: expected verification error, got %v", name, err)
+		}
+		if _, ok := verr[0].(distribution.ErrManifestUnverified); !ok {
+			t.Errorf("%s: expected ErrManifestUnverified, got %v", name, verr[0])
+		}
+	}
+}
+
+func TestSchema1DigestAcrossSigningKeys(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	repoName := "foo/signed"
+
+	repository := makeRepository(t, createRegistry(t, d), repoName)
+	layers, err := testutil.CreateRandomLayers(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.UploadBlobs(repository, layers); err != nil {
+		t.Fatal(err)
+	}
+	sm, err := testutil.MakeSchema1Manifest(getKeys(layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dgst, err := makeManifestService(t, repository).Put(ctx, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each registry signs manifests with a key of its own
+	var payloads [][]byte
+	for i := 0; i < 2; i++ {
+		ms := makeManifestService(t, makeRepository(t, createRegistry(t, d), repoName))
+		fetched, err := ms.Get(ctx, dgst)
+		if err != nil {
+			t.Fatalf("unexpected error fetching manifest: %v", err)
+		}
+		signed := fetched.(*schema1.SignedManifest)
+		if canonical := digest.FromBytes(signed.Canonical); canonical != dgst {
+			t.Fatalf("unexpected digest of re-signed manifest: %s != %s", canonical, dgst)
+		}
+		_, payload, err := signed.Payload()
+		if err != nil {
+			t.Fatal(err)
+		}
+		payloads = append(payloads, payload)
+	}
+	if bytes.Equal(payloads[0], payloads[1]) {
+		t.Fatalf("expected manifests signed by different keys to differ")
+	}
+}
@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	dcontext "github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// NewMirrorDriver returns a driver writing to both primary and secondary,
+// for moving a registry between storage backends while it is online. Reads
+// are served from primary, falling back to secondary for content not found
+// there, and directory listings merge both. Write errors of primary are
+// returned; those of secondary are only logged. URLs are always made by
+// primary.
+func NewMirrorDriver(primary, secondary storagedriver.StorageDriver) storagedriver.StorageDriver {
+	return &mirrorDriver{
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+type mirrorDriver struct {
+	primary   storagedriver.StorageDriver
+	secondary storagedriver.StorageDriver
+}
+
+var _ storagedriver.StorageDriver = &mirrorDriver{}
+
+func isPathNotFound(err error) bool {
+	_, ok := err.(storagedriver.PathNotFoundError)
+	return ok
+}
+
+// Name returns the human-readable "name" of the driver.
+func (m *mirrorDriver) Name() string {
+	return "mirror(" + m.primary.Name() + ", " + m.secondary.Name() + ")"
+}
+
+// GetContent retrieves the content stored at "path" as a []byte.
+func (m *mirrorDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	content, err := m.primary.GetContent(ctx, path)
+	if isPathNotFound(err) {
+		return m.secondary.GetContent(ctx, path)
+	}
+	return content, err
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+func (m *mirrorDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	if err := m.primary.PutContent(ctx, path, content); err != nil {
+		return err
+	}
+
+	if err := m.secondary.PutContent(ctx, path, content); err != nil {
+		dcontext.GetLogger(ctx).Errorf("mirror: error putting %s to secondary: %v", path, err)
+	}
+	return nil
+}
+
+// Reader retrieves an io.ReadCloser for the content stored at "path"
+// with a given byte offset.
+func (m *mirrorDriver) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	rc, err := m.primary.Reader(ctx, path, offset)
+	if isPathNotFound(err) {
+		return m.secondary.Reader(ctx, path, offset)
+	}
+	return rc, err
+}
+
+// Writer returns a FileWriter writing to both backends. Once writing to
+// secondary fails, or if it can't be appended to like primary, its write is
+// cancelled and only primary is written.
+func (m *mirrorDriver) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
+	primary, err := m.primary.Writer(ctx, path, append)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &mirrorFileWriter{
+		ctx:     ctx,
+		path:    path,
+		primary: primary,
+	}
+
+	secondary, err := m.secondary.Writer(ctx, path, append)
+	if err != nil {
+		dcontext.GetLogger(ctx).Errorf("mirror: error opening %s for writing on secondary: %v", path, err)
+		return w, nil
+	}
+	w.secondary = secondary
+
+	// appending to content the secondary only has part of would corrupt it
+	if secondary.Size() != primary.Size() {
+		w.abandonSecondary("appending to", fmt.Errorf("size %d differs from primary size %d", secondary.Size(), primary.Size()))
+	}
+
+	return w, nil
+}
+
+// Stat retrieves the FileInfo for the given path.
+func (m *mirrorDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	fi, err := m.primary.Stat(ctx, path)
+	if isPathNotFound(err) {
+		return m.secondary.Stat(ctx, path)
+	}
+	return fi, err
+}
+
+// List returns the objects that are direct descendants of the given path
+// in either backend.
+func (m *mirrorDriver) List(ctx context.Context, path string) ([]string, error) {
+	primary, primaryErr := m.primary.List(ctx, path)
+	if primaryErr != nil && !isPathNotFound(primaryErr) {
+		return nil, primaryErr
+	}
+
+	secondary, err := m.secondary.List(ctx, path)
+	if err != nil && (primaryErr != nil || !isPathNotFound(err)) {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{}, len(primary))
+	children := make([]string, 0, len(primary)+len(secondary))
+	for _, child := range append(primary, secondary...) {
+		if _, ok := seen[child]; ok {
+			continue
+		}
+		seen[child] = struct{}{}
+		children = append(children, child)
+	}
+	sort.Strings(children)
+
+	return children, nil
+}
+
+// Move moves an object stored at sourcePath to destPath in both backends.
+// The move succeeds if the object was found in either of them.
+func (m *mirrorDriver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	primaryErr := m.primary.Move(ctx, sourcePath, destPath)
+	if primaryErr != nil && !isPathNotFound(primaryErr) {
+		return primaryErr
+	}
+
+	secondaryErr := m.secondary.Move(ctx, sourcePath, destPath)
+	if primaryErr != nil {
+		return secondaryErr
+	}
+	if secondaryErr != nil && !isPathNotFound(secondaryErr) {
+		dcontext.GetLogger(ctx).Errorf("mirror: error moving %s to %s on secondary: %v", sourcePath, destPath, secondaryErr)
+	}
+	return nil
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths
+// from both backends. The delete succeeds if the path was found in either of
+// them.
+func (m *mirrorDriver) Delete(ctx context.Context, path string) error {
+	primaryErr := m.primary.Delete(ctx, path)
+	if primaryErr != nil && !isPathNotFound(primaryErr) {
+		return primaryErr
+	}
+
+	secondaryErr := m.secondary.Delete(ctx, path)
+	if primaryErr != nil {
+		return secondaryErr
+	}
+	if secondaryErr != nil && !isPathNotFound(secondaryErr) {
+		dcontext.GetLogger(ctx).Errorf("mirror: error deleting %s on secondary: %v", path, secondaryErr)
+	}
+	return nil
+}
+
+// URLFor returns a URL for the content stored at the given path by the
+// primary backend.
+func (m *mirrorDriver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	return m.primary.URLFor(ctx, path, options)
+}
+
+// Capabilities reports that URLs are made like primary makes them. Moves
+// and listings are only as capable as those of the weaker backend.
+func (m *mirrorDriver) Capabilities() storagedriver.Capabilities {
+	primary, secondary := m.primary.Capabilities(), m.secondary.Capabilities()
+	return storagedriver.Capabilities{
+		URLFor:            primary.URLFor,
+		ServerSideCopy:    primary.ServerSideCopy && secondary.ServerSideCopy,
+		ListWithDelimiter: primary.ListWithDelimiter && secondary.ListWithDelimiter,
+	}
+}
+
+// Walk traverses the merged listings of both backends.
+func (m *mirrorDriver) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
+	return storagedriver.WalkFallback(ctx, m, path, f)
+}
+
+// mirrorFileWriter writes to a primary FileWriter and, as long as that
+// succeeds, to a secondary one.
+type mirrorFileWriter struct {
+	ctx       context.Context
+	path      string
+	primary   storagedriver.FileWriter
+	secondary storagedriver.FileWriter
+}
+
+// abandonSecondary logs err and stops writing to the secondary backend.
+func (w *mirrorFileWriter) abandonSecondary(op string, err error) {
+	dcontext.GetLogger(w.ctx).Errorf("mirror: error %s %s on secondary: %v", op, w.path, err)
+	if err := w.secondary.Cancel(); err != nil {
+		dcontext.GetLogger(w.ctx).Errorf("mirror: error cancelling %s on secondary: %v", w.path, err)
+	}
+	w.secondary = nil
+}
+
+func (w *mirrorFileWriter) Write(p []byte) (int, error) {
+	n, err := w.primary.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	if w.secondary != nil {
+		if _, err := w.secondary.Write(p); err != nil {
+			w.abandonSecondary("writing", err)
+		}
+	}
+	return n, nil
+}
+
+func (w *mirrorFileWriter) Size() int64 {
+	return w.primary.Size()
+}
+
+func (w *mirrorFileWriter) Close() error {
+	if w.secondary != nil {
+		if err := w.secondary.Close(); err != nil {
+			dcontext.GetLogger(w.ctx).Errorf("mirror: error closing %s on secondary: %v", w.path, err)
+		}
+	}
+	return w.primary.Close()
+}
+
+func (w *mirrorFileWriter) Cancel() error {
+	if w.secondary != nil {
+		if err := w.secondary.Cancel(); err != nil {
+			dcontext.GetLogger(w.ctx).Errorf("mirror: error cancelling %s on secondary: %v", w.path, err)
+		}
+	}
+	return w.primary.Cancel()
+}
+
+func (w *mirrorFileWriter) Commit() error {
+	if err := w.primary.Commit(); err != nil {
+		return err
+	}
+
+	if w.secondary != nil {
+		if err := w.secondary.Commit(); err != nil {
+			w.abandonSecondary("committing", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// readOnlyDriver fails every PutContent call.
+type readOnlyDriver struct {
+	storagedriver.StorageDriver
+}
+
+func (readOnlyDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	return errors.New("read only")
+}
+
+func TestMirrorDriver(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := inmemory.New(), inmemory.New()
+	d := NewMirrorDriver(primary, secondary)
+
+	// writes reach both backends
+	if err := d.PutContent(ctx, "/dir/both", []byte("both")); err != nil {
+		t.Fatal(err)
+	}
+	fw, err := d.Writer(ctx, "/dir/written", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write([]byte("written")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for name, backend := range map[string]storagedriver.StorageDriver{"primary": primary, "secondary": secondary} {
+		for path, expected := range map[string]string{"/dir/both": "both", "/dir/written": "written"} {
+			if content, err := backend.GetContent(ctx, path); err != nil || string(content) != expected {
+				t.Fatalf("unexpected %s content at %s: %q, %v", name, path, content, err)
+			}
+		}
+	}
+
+	// content only in the secondary is read from it
+	if err := secondary.PutContent(ctx, "/dir/old", []byte("old")); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := d.GetContent(ctx, "/dir/old"); err != nil || string(content) != "old" {
+		t.Fatalf("unexpected content falling back to secondary: %q, %v", content, err)
+	}
+	rc, err := d.Reader(ctx, "/dir/old", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(content) != "ld" {
+		t.Fatalf("unexpected content reading from secondary: %q, %v", content, err)
+	}
+	if fi, err := d.Stat(ctx, "/dir/old"); err != nil || fi.Size() != 3 {
+		t.Fatalf("unexpected stat falling back to secondary: %v, %v", fi, err)
+	}
+
+	// listings merge both backends
+	if err := primary.PutContent(ctx, "/dir/new", []byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"/dir/both", "/dir/new", "/dir/old", "/dir/written"}
+	if children, err := d.List(ctx, "/dir"); err != nil || !reflect.DeepEqual(children, expected) {
+		t.Fatalf("unexpected listing %v, expected %v: %v", children, expected, err)
+	}
+	var walked []string
+	if err := d.Walk(ctx, "/dir", func(fi storagedriver.FileInfo) error {
+		walked = append(walked, fi.Path())
+		return nil
+	}); err != nil || !reflect.DeepEqual(walked, expected) {
+		t.Fatalf("unexpected walk %v, expected %v: %v", walked, expected, err)
+	}
+	if _, err := d.List(ctx, "/missing"); err == nil {
+		t.Fatal("expected error listing missing directory")
+	}
+
+	// content only in the secondary can be moved and deleted
+	if err := d.Move(ctx, "/dir/old", "/dir/moved"); err != nil {
+		t.Fatalf("unexpected error moving secondary content: %v", err)
+	}
+	if content, err := secondary.GetContent(ctx, "/dir/moved"); err != nil || string(content) != "old" {
+		t.Fatalf("unexpected moved content: %q, %v", content, err)
+	}
+	if err := d.Delete(ctx, "/dir/moved"); err != nil {
+		t.Fatalf("unexpected error deleting secondary content: %v", err)
+	}
+	if _, err := d.Stat(ctx, "/dir/moved"); err == nil {
+		t.Fatal("expected deleted content to be gone")
+	}
+	if err := d.Delete(ctx, "/dir/moved"); err == nil {
+		t.Fatal("expected error deleting missing content")
+	}
+
+	if err := d.Delete(ctx, "/dir/both"); err != nil {
+		t.Fatal(err)
+	}
+	for name, backend := range map[string]storagedriver.StorageDriver{"primary": primary, "secondary": secondary} {
+		if _, err := backend.Stat(ctx, "/dir/both"); err == nil {
+			t.Fatalf("expected content deleted from %s", name)
+		}
+	}
+}
+
+func TestMirrorDriverWriteErrors(t *testing.T) {
+	ctx := context.Background()
+	readOnly := readOnlyDriver{inmemory.New()}
+
+	if err := NewMirrorDriver(inmemory.New(), readOnly).PutContent(ctx, "/a", []byte("a")); err != nil {
+		t.Fatalf("unexpected error from secondary: %v", err)
+	}
+	if err := NewMirrorDriver(readOnly, inmemory.New()).PutContent(ctx, "/a", []byte("a")); err == nil {
+		t.Fatal("expected error from primary")
+	}
+
+	// an upload that the secondary only has part of is not appended to
+	primary, secondary := inmemory.New(), inmemory.New()
+	for backend, written := range map[storagedriver.StorageDriver]string{primary: "partial", secondary: "par"} {
+		fw, err := backend.Writer(ctx, "/upload", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fw.Write([]byte(written)); err != nil {
+			t.Fatal(err)
+		}
+		if err := fw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fw, err := NewMirrorDriver(primary, secondary).Writer(ctx, "/upload", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write([]byte(" content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := primary.GetContent(ctx, "/upload"); err != nil || string(content) != "partial content" {
+		t.Fatalf("unexpected primary content: %q, %v", content, err)
+	}
+	if content, err := secondary.GetContent(ctx, "/upload"); err == nil {
+		t.Fatalf("expected no secondary content, got %q", content)
+	}
+}
+
+func TestMirrorDriverRegistry(t *testing.T) {
+	ctx := context.Background()
+	primary, secondary := inmemory.New(), inmemory.New()
+
+	repo := makeRepository(t, createRegistry(t, NewMirrorDriver(primary, secondary)), "test")
+	image := uploadRandomSchema2Image(t, repo)
+
+	// the image is complete in either backend
+	for name, backend := range map[string]storagedriver.StorageDriver{"primary": primary, "secondary": secondary} {
+		repo := makeRepository(t, createRegistry(t, backend), "test")
+		if _, err := makeManifestService(t, repo).Get(ctx, image.manifestDigest); err != nil {
+			t.Fatalf("unexpected error getting manifest from %s: %v", name, err)
+		}
+		for dgst := range image.layers {
+			if _, err := repo.Blobs(ctx).Stat(ctx, dgst); err != nil {
+				t.Fatalf("unexpected error statting layer %s in %s: %v", dgst, name, err)
+			}
+		}
+	}
+}
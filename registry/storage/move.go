@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// ErrNestedRepositories is returned when moving a repository whose name is
+// the prefix of other repositories, which would be moved along with it.
+var ErrNestedRepositories = errors.New("repository contains nested repositories")
+
+// MoveRepository renames the repository from to to, with its manifests,
+// tags, blob links and uploads. The blobs themselves are shared by all
+// repositories and stay where they are. It fails with
+// distribution.ErrRepositoryExists if anything is stored under to.
+//
+// The repository directory is moved with a single driver Move, which
+// filesystem-like drivers do atomically. Drivers which can only move single
+// objects have every file copied before the source is deleted, so that an
+// interrupted copy leaves the source intact. Pushes to the repository should
+// be stopped while it is moved.
+func MoveRepository(ctx context.Context, storageDriver driver.StorageDriver, from, to reference.Named) error {
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return err
+	}
+	fromPath := path.Join(root, from.Name())
+	toPath := path.Join(root, to.Name())
+
+	if strings.HasPrefix(to.Name()+"/", from.Name()+"/") {
+		return distribution.ErrRepositoryNameInvalid{
+			Name:   to.Name(),
+			Reason: errors.New("destination is within the moved repository"),
+		}
+	}
+
+	children, err := storageDriver.List(ctx, fromPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return distribution.ErrRepositoryUnknown{Name: from.Name()}
+		}
+		return err
+	}
+	owned, nested := false, false
+	for _, child := range children {
+		if strings.HasPrefix(path.Base(child), "_") {
+			owned = true
+		} else {
+			nested = true
+		}
+	}
+	if !owned {
+		return distribution.ErrRepositoryUnknown{Name: from.Name()}
+	}
+	if nested {
+		return ErrNestedRepositories
+	}
+
+	if _, err := storageDriver.Stat(ctx, toPath); err == nil {
+		return distribution.ErrRepositoryExists{Name: to.Name()}
+	} else if _, ok := err.(driver.PathNotFoundError); !ok {
+		return err
+	}
+
+	err = storageDriver.Move(ctx, fromPath, toPath)
+	if _, ok := err.(driver.PathNotFoundError); !ok {
+		return err
+	}
+
+	// the driver only moves objects, not the prefixes holding them
+	if err := copyTree(ctx, storageDriver, fromPath, toPath); err != nil {
+		if err := storageDriver.Delete(ctx, toPath); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); !ok {
+				dcontext.GetLogger(ctx).Errorf("error removing partial copy of %s at %s: %v", from.Name(), to.Name(), err)
+			}
+		}
+		return err
+	}
+	return storageDriver.Delete(ctx, fromPath)
+}
+
+// copyTree copies every file stored under fromPath to the same path under
+// toPath.
+func copyTree(ctx context.Context, storageDriver driver.StorageDriver, fromPath, toPath string) error {
+	return storageDriver.Walk(ctx, fromPath, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+		return copyFile(ctx, storageDriver, fileInfo.Path(), toPath+strings.TrimPrefix(fileInfo.Path(), fromPath))
+	})
+}
+
+func copyFile(ctx context.Context, storageDriver driver.StorageDriver, sourcePath, destPath string) error {
+	reader, err := storageDriver.Reader(ctx, sourcePath, 0)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	writer, err := storageDriver.Writer(ctx, destPath, false)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(writer, reader); err != nil {
+		writer.Cancel()
+		return err
+	}
+	if err := writer.Commit(); err != nil {
+		writer.Cancel()
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// objectMoveDriver moves single objects only, like object storage does.
+type objectMoveDriver struct {
+	driver.StorageDriver
+}
+
+func (d *objectMoveDriver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	fi, err := d.StorageDriver.Stat(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return driver.PathNotFoundError{Path: sourcePath}
+	}
+	return d.StorageDriver.Move(ctx, sourcePath, destPath)
+}
+
+func testMoveRepository(t *testing.T, storageDriver driver.StorageDriver) {
+	ctx := context.Background()
+	reg := createRegistry(t, storageDriver)
+	from, _ := reference.WithName("team-a/app")
+	to, _ := reference.WithName("team-b/app")
+
+	repo := makeRepository(t, reg, from.Name())
+	img := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: img.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+
+	if err := MoveRepository(ctx, storageDriver, from, to); err != nil {
+		t.Fatalf("unexpected error moving repository: %v", err)
+	}
+
+	moved := makeRepository(t, reg, to.Name())
+	desc, err := moved.Tags(ctx).Get(ctx, "latest")
+	if err != nil {
+		t.Fatalf("unexpected error getting moved tag: %v", err)
+	}
+	if desc.Digest != img.manifestDigest {
+		t.Fatalf("expected moved tag to reference %v, got %v", img.manifestDigest, desc.Digest)
+	}
+	manifests := makeManifestService(t, moved)
+	if _, err := manifests.Get(ctx, img.manifestDigest); err != nil {
+		t.Fatalf("unexpected error getting moved manifest: %v", err)
+	}
+	for layer := range img.layers {
+		if _, err := moved.Blobs(ctx).Stat(ctx, layer); err != nil {
+			t.Fatalf("unexpected error stating moved layer %v: %v", layer, err)
+		}
+	}
+
+	if _, err := repo.Tags(ctx).Get(ctx, "latest"); err == nil {
+		t.Fatalf("expected the tag to be gone from the source repository")
+	}
+	if err := MoveRepository(ctx, storageDriver, from, to); err != (distribution.ErrRepositoryUnknown{Name: from.Name()}) {
+		t.Fatalf("expected unknown repository moving it again, got %v", err)
+	}
+}
+
+func TestMoveRepository(t *testing.T) {
+	testMoveRepository(t, inmemory.New())
+}
+
+func TestMoveRepositoryCopyingObjects(t *testing.T) {
+	testMoveRepository(t, &objectMoveDriver{inmemory.New()})
+}
+
+func TestMoveRepositoryRefused(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	reg := createRegistry(t, inmemoryDriver)
+	for _, name := range []string{"team-a/app", "team-a/app/nested", "team-b/app"} {
+		uploadRandomSchema2Image(t, makeRepository(t, reg, name))
+	}
+
+	for _, tc := range []struct {
+		from, to string
+		err      error
+	}{
+		{"team-a/app/nested", "team-b/app", distribution.ErrRepositoryExists{Name: "team-b/app"}},
+		{"team-a/app/nested", "team-b", distribution.ErrRepositoryExists{Name: "team-b"}},
+		{"team-a/app", "team-c/app", ErrNestedRepositories},
+		{"team-c/app", "team-d/app", distribution.ErrRepositoryUnknown{Name: "team-c/app"}},
+		{"team-a", "team-d", distribution.ErrRepositoryUnknown{Name: "team-a"}},
+	} {
+		from, _ := reference.WithName(tc.from)
+		to, _ := reference.WithName(tc.to)
+		if err := MoveRepository(ctx, inmemoryDriver, from, to); err != tc.err {
+			t.Errorf("moving %s to %s: expected %v, got %v", tc.from, tc.to, tc.err, err)
+		}
+	}
+
+	from, _ := reference.WithName("team-b/app")
+	to, _ := reference.WithName("team-b/app/nested")
+	if _, ok := MoveRepository(ctx, inmemoryDriver, from, to).(distribution.ErrRepositoryNameInvalid); !ok {
+		t.Errorf("expected moving a repository into itself to be refused")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
@@ -18,6 +19,14 @@ type ocischemaManifestHandler struct {
 	blobStore    distribution.BlobStore
 	ctx          context.Context
 	manifestURLs manifestURLs
+
+	// allowedConfigMediaTypes, if not nil, holds the only config media
+	// types accepted.
+	allowedConfigMediaTypes map[string]struct{}
+
+	// maxReferences, if not zero, limits the number of blobs a manifest
+	// may reference.
+	maxReferences int
 }
 
 var _ ManifestHandler = &ocischemaManifestHandler{}
@@ -69,9 +78,22 @@ func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst oc
 		return fmt.Errorf("unrecognized manifest schema version %d", mnfst.Manifest.SchemaVersion)
 	}
 
+	if ms.allowedConfigMediaTypes != nil {
+		if _, ok := ms.allowedConfigMediaTypes[mnfst.Config.MediaType]; !ok {
+			errs = append(errs, distribution.ErrManifestConfigMediaTypeInvalid{MediaType: mnfst.Config.MediaType})
+			return errs
+		}
+	}
+
+	if count := len(mnfst.References()); ms.maxReferences > 0 && count > ms.maxReferences {
+		errs = append(errs, distribution.ErrManifestTooManyReferences{Count: count, Limit: ms.maxReferences})
+		return errs
+	}
+
 	if skipDependencyVerification {
 		return nil
 	}
+	defer observeManifestVerification(ctx, "oci", len(mnfst.References()), time.Now())
 
 	manifestService, err := ms.repository.Manifests(ctx)
 	if err != nil {
@@ -85,8 +107,7 @@ func (ms *ocischemaManifestHandler) verifyManifest(ctx context.Context, mnfst oc
 
 		switch descriptor.MediaType {
 		case v1.MediaTypeImageLayer, v1.MediaTypeImageLayerGzip, v1.MediaTypeImageLayerNonDistributable, v1.MediaTypeImageLayerNonDistributableGzip:
-			allow := ms.manifestURLs.allow
-			deny := ms.manifestURLs.deny
+			allow, deny := ms.manifestURLs.rulesFor(mnfst.Config.MediaType)
 			for _, u := range descriptor.URLs {
 				var pu *url.URL
 				pu, err = url.Parse(u)
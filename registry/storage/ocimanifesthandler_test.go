@@ -136,3 +136,173 @@ func TestVerifyOCIManifestNonDistributableLayer(t *testing.T) {
 		}
 	}
 }
+
+func TestVerifyOCIManifestURLsForMediaType(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	artifactType := "application/vnd.example.artifact.config.v1+json"
+	registry := createRegistry(t, inmemoryDriver,
+		ManifestURLsAllowRegexp(regexp.MustCompile("^https?://foo")),
+		ManifestURLsAllowRegexpFor(artifactType, regexp.MustCompile("^https://bar")))
+	repo := makeRepository(t, registry, "test")
+	manifestService := makeManifestService(t, repo)
+
+	imageConfig, err := repo.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	imageConfig.MediaType = v1.MediaTypeImageConfig
+
+	artifactConfig, err := repo.Blobs(ctx).Put(ctx, artifactType, []byte(`{"artifact":true}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifactConfig.MediaType = artifactType
+
+	nonDistributableLayer := distribution.Descriptor{
+		Digest:    "sha256:463435349086340864309863409683460843608348608934092322395278926a",
+		Size:      6323,
+		MediaType: v1.MediaTypeImageLayerNonDistributableGzip,
+	}
+
+	cases := []struct {
+		Config distribution.Descriptor
+		URL    string
+		Err    error
+	}{
+		{imageConfig, "http://foo/bar", nil},
+		{imageConfig, "https://bar/baz", errInvalidURL},
+		{artifactConfig, "https://bar/baz", nil},
+		{artifactConfig, "http://foo/bar", errInvalidURL},
+	}
+
+	for _, c := range cases {
+		l := nonDistributableLayer
+		l.URLs = []string{c.URL}
+		dm, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: manifest.Versioned{
+				SchemaVersion: 2,
+				MediaType:     v1.MediaTypeImageManifest,
+			},
+			Config: c.Config,
+			Layers: []distribution.Descriptor{l},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = manifestService.Put(ctx, dm)
+		if verr, ok := err.(distribution.ErrManifestVerification); ok {
+			// Extract the first error
+			if len(verr) == 2 {
+				if _, ok = verr[1].(distribution.ErrManifestBlobUnknown); ok {
+					err = verr[0]
+				}
+			} else if len(verr) == 1 {
+				err = verr[0]
+			}
+		}
+		if err != c.Err {
+			t.Errorf("%s with config %s: expected %v, got %v", c.URL, c.Config.MediaType, c.Err, err)
+		}
+	}
+}
+
+func TestVerifyOCIManifestConfigMediaType(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	registry := createRegistry(t, inmemoryDriver,
+		OCIAllowedConfigMediaTypes([]string{v1.MediaTypeImageConfig}))
+	repo := makeRepository(t, registry, "test")
+	manifestService := makeManifestService(t, repo)
+
+	for _, c := range []struct {
+		MediaType string
+		Allowed   bool
+	}{
+		{v1.MediaTypeImageConfig, true},
+		{"application/vnd.example.unknown+json", false},
+	} {
+		config, err := repo.Blobs(ctx).Put(ctx, c.MediaType, []byte(c.MediaType))
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.MediaType = c.MediaType
+
+		dm, err := ocischema.FromStruct(ocischema.Manifest{
+			Versioned: manifest.Versioned{
+				SchemaVersion: 2,
+				MediaType:     v1.MediaTypeImageManifest,
+			},
+			Config: config,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = manifestService.Put(ctx, dm)
+		if c.Allowed {
+			if err != nil {
+				t.Errorf("%s: unexpected error: %v", c.MediaType, err)
+			}
+			continue
+		}
+
+		verr, ok := err.(distribution.ErrManifestVerification)
+		if !ok || len(verr) != 1 {
+			t.Fatalf("%s: expected verification error, got %v", c.MediaType, err)
+		}
+		if _, ok := verr[0].(distribution.ErrManifestConfigMediaTypeInvalid); !ok {
+			t.Errorf("%s: unexpected error: %v", c.MediaType, verr[0])
+		}
+	}
+}
+
+func TestOCIManifestReferrers(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "test")
+	manifestService := makeManifestService(t, repo)
+
+	config, err := repo.Blobs(ctx).Put(ctx, v1.MediaTypeImageConfig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	putManifest := func(m ocischema.Manifest) distribution.Descriptor {
+		m.Versioned = ocischema.SchemaVersion
+		m.Config = config
+		dm, err := ocischema.FromStruct(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dgst, err := manifestService.Put(ctx, dm)
+		if err != nil {
+			t.Fatalf("unexpected error putting manifest: %v", err)
+		}
+		_, payload, _ := dm.Payload()
+		return distribution.Descriptor{MediaType: v1.MediaTypeImageManifest, Digest: dgst, Size: int64(len(payload))}
+	}
+
+	subject := putManifest(ocischema.Manifest{})
+	referrers, err := Referrers(ctx, inmemoryDriver, repo.Named(), subject.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error listing referrers: %v", err)
+	}
+	if len(referrers) != 0 {
+		t.Fatalf("expected no referrers, got %v", referrers)
+	}
+
+	artifact := putManifest(ocischema.Manifest{
+		ArtifactType: "application/vnd.example.signature",
+		Subject:      &subject,
+	})
+	referrers, err = Referrers(ctx, inmemoryDriver, repo.Named(), subject.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error listing referrers: %v", err)
+	}
+	if len(referrers) != 1 || referrers[0] != artifact.Digest {
+		t.Fatalf("expected referrers [%v], got %v", artifact.Digest, referrers)
+	}
+}
@@ -0,0 +1,62 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// OrphanedBlobs marks the blobs referenced by the manifests of repository,
+// including those soft deleted within their restore window, as the mark
+// phase of garbage collection does. It then calls fn with each blob linked
+// into the repository which is left unmarked. Nothing is deleted.
+func OrphanedBlobs(ctx context.Context, repository distribution.Repository, fn func(digest.Digest) error) error {
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return err
+	}
+	ms, ok := manifestService.(*manifestStore)
+	if !ok {
+		return fmt.Errorf("unable to convert ManifestService into manifestStore")
+	}
+
+	markSet := make(map[digest.Digest]struct{})
+	err = ms.Enumerate(ctx, func(dgst digest.Digest) error {
+		return markManifest(ctx, ms, dgst, markSet, nil)
+	})
+	if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+		return err
+	}
+
+	tombstones, err := ms.repository.tombstones(ctx)
+	if err != nil {
+		return err
+	}
+	for dgst, tombstone := range tombstones {
+		if ms.repository.tombstoneExpired(tombstone, time.Now()) {
+			continue
+		}
+		if err := markTombstoned(ctx, ms, dgst, markSet, nil); err != nil {
+			return err
+		}
+	}
+
+	blobEnumerator, ok := repository.Blobs(ctx).(distribution.BlobEnumerator)
+	if !ok {
+		return fmt.Errorf("unable to convert BlobStore into BlobEnumerator")
+	}
+	err = blobEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+		if _, ok := markSet[dgst]; ok {
+			return nil
+		}
+		return fn(dgst)
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
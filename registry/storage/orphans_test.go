@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestOrphanedBlobs(t *testing.T) {
+	ctx := context.Background()
+	inmemoryDriver := inmemory.New()
+
+	registry := createRegistry(t, inmemoryDriver)
+	repo := makeRepository(t, registry, "orphans")
+	uploadRandomSchema2Image(t, repo)
+
+	content := []byte("unreferenced")
+	orphan, err := addBlob(ctx, repo.Blobs(ctx), distribution.Descriptor{Digest: digest.FromBytes(content), Size: int64(len(content))}, bytes.NewReader(content))
+	if err != nil {
+		t.Fatalf("unexpected error uploading blob: %v", err)
+	}
+
+	var orphans []digest.Digest
+	err = OrphanedBlobs(ctx, repo, func(dgst digest.Digest) error {
+		orphans = append(orphans, dgst)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error listing orphaned blobs: %v", err)
+	}
+	if len(orphans) != 1 || orphans[0] != orphan.Digest {
+		t.Fatalf("expected orphans [%v], got %v", orphan.Digest, orphans)
+	}
+
+	// nothing has been deleted
+	if _, err := repo.Blobs(ctx).Stat(ctx, orphan.Digest); err != nil {
+		t.Fatalf("unexpected error stating orphaned blob: %v", err)
+	}
+}
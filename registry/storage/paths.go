@@ -74,18 +74,31 @@ const (
 // 	manifestRevisionsPathSpec:      <root>/v2/repositories/<name>/_manifests/revisions/
 // 	manifestRevisionPathSpec:      <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/
 // 	manifestRevisionLinkPathSpec:  <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/link
+// 	manifestDiffIDsPathSpec:       <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/diffids
+// 	manifestConversionPathSpec:    <root>/v2/repositories/<name>/_manifests/revisions/<algorithm>/<hex digest>/schema2
+// 	manifestPushedAtPathSpec:      <root>/v2/repositories/<name>/_manifests/pushedat
+// 	manifestTombstonesPathSpec:    <root>/v2/repositories/<name>/_manifests/tombstones/
+// 	manifestTombstonePathSpec:     <root>/v2/repositories/<name>/_manifests/tombstones/<algorithm>/<hex digest>
+//
+//	Referrers:
+//
+// 	manifestSubjectsPathSpec:      <root>/v2/repositories/<name>/_manifests/referrers/
+// 	manifestReferrersPathSpec:     <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/
+// 	manifestReferrerLinkPathSpec:  <root>/v2/repositories/<name>/_manifests/referrers/<algorithm>/<hex digest>/<algorithm>/<hex digest>/link
 //
 //	Tags:
 //
 // 	manifestTagsPathSpec:                  <root>/v2/repositories/<name>/_manifests/tags/
 // 	manifestTagPathSpec:                   <root>/v2/repositories/<name>/_manifests/tags/<tag>/
 // 	manifestTagCurrentPathSpec:            <root>/v2/repositories/<name>/_manifests/tags/<tag>/current/link
+// 	manifestTagAliasPathSpec:              <root>/v2/repositories/<name>/_manifests/tags/<tag>/alias
 // 	manifestTagIndexPathSpec:              <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/
 // 	manifestTagIndexEntryPathSpec:         <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/<algorithm>/<hex digest>/
 // 	manifestTagIndexEntryLinkPathSpec:     <root>/v2/repositories/<name>/_manifests/tags/<tag>/index/<algorithm>/<hex digest>/link
 //
 // 	Blobs:
 //
+// 	layersPathSpec:               <root>/v2/repositories/<name>/_layers/
 // 	layerLinkPathSpec:            <root>/v2/repositories/<name>/_layers/<algorithm>/<hex digest>/link
 //
 //	Uploads:
@@ -99,7 +112,17 @@ const (
 //	blobsPathSpec:                  <root>/v2/blobs/
 // 	blobPathSpec:                   <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>
 // 	blobDataPathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
-// 	blobMediaTypePathSpec:               <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/data
+// 	blobMediaTypePathSpec:          <root>/v2/blobs/<algorithm>/<first two hex bytes of digest>/<hex digest>/mediatype
+//
+//	The blob paths fan out by further prefixes of the hex digest when
+//	configured with a blobPathLayout, such as 2+2 characters:
+//
+// 	blobDataPathSpec:               <root>/v2/blobs/<algorithm>/<hex bytes 0-1>/<hex bytes 2-3>/<hex digest>/data
+//
+//	Garbage Collection:
+//
+//	gcLockPathSpec:                 <root>/v2/gclock
+//	gcCheckpointPathSpec:           <root>/v2/gccheckpoint
 //
 // For more information on the semantic meaning of each path and their
 // contents, please see the path spec documentation.
@@ -122,8 +145,33 @@ func pathFor(spec pathSpec) (string, error) {
 
 	switch v := spec.(type) {
 
+	case manifestDiffIDsPathSpec:
+		root, err := pathFor(manifestRevisionPathSpec(v))
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "diffids"), nil
+	case manifestConversionPathSpec:
+		root, err := pathFor(manifestRevisionPathSpec(v))
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "schema2"), nil
+	case manifestPushedAtPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_manifests", "pushedat")...), nil
 	case manifestRevisionsPathSpec:
 		return path.Join(append(repoPrefix, v.name, "_manifests", "revisions")...), nil
+	case manifestTombstonesPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_manifests", "tombstones")...), nil
+	case manifestTombstonePathSpec:
+		components, err := digestPathComponents(v.revision, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(repoPrefix, v.name, "_manifests", "tombstones"), components...)...), nil
 
 	case manifestRevisionPathSpec:
 		components, err := digestPathComponents(v.revision, false)
@@ -140,6 +188,30 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, "link"), nil
+	case manifestSubjectsPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_manifests", "referrers")...), nil
+	case manifestReferrersPathSpec:
+		components, err := digestPathComponents(v.subject, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(append(append(repoPrefix, v.name, "_manifests", "referrers"), components...)...), nil
+	case manifestReferrerLinkPathSpec:
+		root, err := pathFor(manifestReferrersPathSpec{
+			name:    v.name,
+			subject: v.subject,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		components, err := digestPathComponents(v.referrer, false)
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, path.Join(components...), "link"), nil
 	case manifestTagsPathSpec:
 		return path.Join(append(repoPrefix, v.name, "_manifests", "tags")...), nil
 	case manifestTagPathSpec:
@@ -160,6 +232,14 @@ func pathFor(spec pathSpec) (string, error) {
 		}
 
 		return path.Join(root, "current", "link"), nil
+	case manifestTagAliasPathSpec:
+		root, err := pathFor(manifestTagPathSpec(v))
+
+		if err != nil {
+			return "", err
+		}
+
+		return path.Join(root, "alias"), nil
 	case manifestTagIndexPathSpec:
 		root, err := pathFor(manifestTagPathSpec(v))
 
@@ -206,11 +286,13 @@ func pathFor(spec pathSpec) (string, error) {
 		blobLinkPathComponents := append(repoPrefix, v.name, "_layers")
 
 		return path.Join(path.Join(append(blobLinkPathComponents, components...)...), "link"), nil
+	case layersPathSpec:
+		return path.Join(append(repoPrefix, v.name, "_layers")...), nil
 	case blobsPathSpec:
 		blobsPathPrefix := append(rootPrefix, "blobs")
 		return path.Join(blobsPathPrefix...), nil
 	case blobPathSpec:
-		components, err := digestPathComponents(v.digest, true)
+		components, err := blobDigestPathComponents(v.digest, v.layout)
 		if err != nil {
 			return "", err
 		}
@@ -218,7 +300,7 @@ func pathFor(spec pathSpec) (string, error) {
 		blobPathPrefix := append(rootPrefix, "blobs")
 		return path.Join(append(blobPathPrefix, components...)...), nil
 	case blobDataPathSpec:
-		components, err := digestPathComponents(v.digest, true)
+		components, err := blobDigestPathComponents(v.digest, v.layout)
 		if err != nil {
 			return "", err
 		}
@@ -226,6 +308,15 @@ func pathFor(spec pathSpec) (string, error) {
 		components = append(components, "data")
 		blobPathPrefix := append(rootPrefix, "blobs")
 		return path.Join(append(blobPathPrefix, components...)...), nil
+	case blobMediaTypePathSpec:
+		components, err := blobDigestPathComponents(v.digest, v.layout)
+		if err != nil {
+			return "", err
+		}
+
+		components = append(components, "mediatype")
+		blobPathPrefix := append(rootPrefix, "blobs")
+		return path.Join(append(blobPathPrefix, components...)...), nil
 
 	case uploadDataPathSpec:
 		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "data")...), nil
@@ -239,6 +330,10 @@ func pathFor(spec pathSpec) (string, error) {
 		return path.Join(append(repoPrefix, v.name, "_uploads", v.id, "hashstates", string(v.alg), offset)...), nil
 	case repositoriesRootPathSpec:
 		return path.Join(repoPrefix...), nil
+	case gcLockPathSpec:
+		return path.Join(append(rootPrefix, "gclock")...), nil
+	case gcCheckpointPathSpec:
+		return path.Join(append(rootPrefix, "gccheckpoint")...), nil
 	default:
 		// TODO(sday): This is an internal error. Ensure it doesn't escape (panic?).
 		return "", fmt.Errorf("unknown path spec: %#v", v)
@@ -252,6 +347,49 @@ type pathSpec interface {
 	pathSpec()
 }
 
+// manifestDiffIDsPathSpec describes the path of the cached mapping between
+// the layers of a manifest revision and the diffIDs of its configuration.
+type manifestDiffIDsPathSpec struct {
+	name     string
+	revision digest.Digest
+}
+
+func (manifestDiffIDsPathSpec) pathSpec() {}
+
+// manifestConversionPathSpec describes the path of the file recording the
+// digest of the schema2 manifest a schema1 manifest revision was converted to.
+type manifestConversionPathSpec struct {
+	name     string
+	revision digest.Digest
+}
+
+func (manifestConversionPathSpec) pathSpec() {}
+
+// manifestPushedAtPathSpec describes the path of the file recording the time
+// of the most recent manifest push to a repository.
+type manifestPushedAtPathSpec struct {
+	name string
+}
+
+func (manifestPushedAtPathSpec) pathSpec() {}
+
+// manifestTombstonesPathSpec describes the directory holding the tombstones
+// of the manifests soft deleted from a repository.
+type manifestTombstonesPathSpec struct {
+	name string
+}
+
+func (manifestTombstonesPathSpec) pathSpec() {}
+
+// manifestTombstonePathSpec describes the path of the file recording when,
+// and from which tags, a manifest revision was soft deleted.
+type manifestTombstonePathSpec struct {
+	name     string
+	revision digest.Digest
+}
+
+func (manifestTombstonePathSpec) pathSpec() {}
+
 // manifestRevisionsPathSpec describes the directory path for
 // a manifest revision.
 type manifestRevisionsPathSpec struct {
@@ -280,6 +418,33 @@ type manifestRevisionLinkPathSpec struct {
 
 func (manifestRevisionLinkPathSpec) pathSpec() {}
 
+// manifestSubjectsPathSpec describes the directory holding the referrers of
+// every subject in a repository.
+type manifestSubjectsPathSpec struct {
+	name string
+}
+
+func (manifestSubjectsPathSpec) pathSpec() {}
+
+// manifestReferrersPathSpec describes the directory holding the links to
+// the manifests whose subject is the given digest.
+type manifestReferrersPathSpec struct {
+	name    string
+	subject digest.Digest
+}
+
+func (manifestReferrersPathSpec) pathSpec() {}
+
+// manifestReferrerLinkPathSpec describes the path of the link recording that
+// the manifest referrer has the given subject.
+type manifestReferrerLinkPathSpec struct {
+	name     string
+	subject  digest.Digest
+	referrer digest.Digest
+}
+
+func (manifestReferrerLinkPathSpec) pathSpec() {}
+
 // manifestTagsPathSpec describes the path elements required to point to the
 // manifest tags directory.
 type manifestTagsPathSpec struct {
@@ -307,6 +472,15 @@ type manifestTagCurrentPathSpec struct {
 
 func (manifestTagCurrentPathSpec) pathSpec() {}
 
+// manifestTagAliasPathSpec describes the file naming the tag which a tag
+// without a current revision is an alias of.
+type manifestTagAliasPathSpec struct {
+	name string
+	tag  string
+}
+
+func (manifestTagAliasPathSpec) pathSpec() {}
+
 // manifestTagCurrentPathSpec describes the link to the index of revisions
 // with the given tag.
 type manifestTagIndexPathSpec struct {
@@ -354,6 +528,13 @@ type layerLinkPathSpec struct {
 
 func (layerLinkPathSpec) pathSpec() {}
 
+// layersPathSpec contains the path for the layer links of a repository.
+type layersPathSpec struct {
+	name string
+}
+
+func (layersPathSpec) pathSpec() {}
+
 // blobAlgorithmReplacer does some very simple path sanitization for user
 // input. Paths should be "safe" before getting this far due to strict digest
 // requirements but we can add further path conversion here, if needed.
@@ -371,6 +552,7 @@ func (blobsPathSpec) pathSpec() {}
 // blobPathSpec contains the path for the registry global blob store.
 type blobPathSpec struct {
 	digest digest.Digest
+	layout blobPathLayout
 }
 
 func (blobPathSpec) pathSpec() {}
@@ -379,10 +561,20 @@ func (blobPathSpec) pathSpec() {}
 // now, this contains layer data, exclusively.
 type blobDataPathSpec struct {
 	digest digest.Digest
+	layout blobPathLayout
 }
 
 func (blobDataPathSpec) pathSpec() {}
 
+// blobMediaTypePathSpec contains the path of the media type recorded for a
+// blob of the registry global blob store.
+type blobMediaTypePathSpec struct {
+	digest digest.Digest
+	layout blobPathLayout
+}
+
+func (blobMediaTypePathSpec) pathSpec() {}
+
 // uploadDataPathSpec defines the path parameters of the data file for
 // uploads.
 type uploadDataPathSpec struct {
@@ -426,6 +618,18 @@ type repositoriesRootPathSpec struct {
 
 func (repositoriesRootPathSpec) pathSpec() {}
 
+// gcLockPathSpec defines the path of the lock held while the garbage
+// collector runs.
+type gcLockPathSpec struct{}
+
+func (gcLockPathSpec) pathSpec() {}
+
+// gcCheckpointPathSpec defines the path of the progress recorded by the
+// garbage collector while marking.
+type gcCheckpointPathSpec struct{}
+
+func (gcCheckpointPathSpec) pathSpec() {}
+
 // digestPathComponents provides a consistent path breakdown for a given
 // digest. For a generic digest, it will be as follows:
 //
@@ -456,22 +660,67 @@ func digestPathComponents(dgst digest.Digest, multilevel bool) ([]string, error)
 	return append(prefix, suffix...), nil
 }
 
+// blobPathLayout lists the lengths of the successive hex digest prefixes
+// blob paths fan out by. The zero value is the legacy layout, fanning out by
+// the first two characters only.
+type blobPathLayout []int
+
+// legacy reports whether the layout is the legacy one.
+func (layout blobPathLayout) legacy() bool {
+	return len(layout) == 0 || len(layout) == 1 && layout[0] == 2
+}
+
+// blobDigestPathComponents breaks the path of a blob down as
+// digestPathComponents does for multilevel paths, with the hex digest
+// prefixes given by layout:
+//
+// 	<algorithm>/<first prefix>/<second prefix>/.../<hex digest>
+//
+func blobDigestPathComponents(dgst digest.Digest, layout blobPathLayout) ([]string, error) {
+	if layout.legacy() {
+		return digestPathComponents(dgst, true)
+	}
+
+	components, err := digestPathComponents(dgst, false)
+	if err != nil {
+		return nil, err
+	}
+
+	hex := dgst.Hex()
+	prefixes := []string{}
+	offset := 0
+	for _, length := range layout {
+		if length <= 0 || offset+length >= len(hex) {
+			return nil, fmt.Errorf("invalid blob path layout %v for digest %v", layout, dgst)
+		}
+		prefixes = append(prefixes, hex[offset:offset+length])
+		offset += length
+	}
+
+	last := len(components) - 1
+	return append(append(components[:last:last], prefixes...), components[last]), nil
+}
+
 // Reconstructs a digest from a path
 func digestFromPath(digestPath string) (digest.Digest, error) {
 
 	digestPath = strings.TrimSuffix(digestPath, "/data")
 	dir, hex := path.Split(digestPath)
 	dir = path.Dir(dir)
-	dir, next := path.Split(dir)
-
-	// next is either the algorithm OR the first two characters in the hex string
-	var algo string
-	if next == hex[:2] {
-		algo = path.Base(dir)
-	} else {
-		algo = next
+
+	// the directories between the algorithm and the hex digest are prefixes
+	// of it, however many the path was laid out with
+	var prefixes string
+	next := path.Base(dir)
+	for next != "" && len(next) < len(hex) && strings.Trim(next, "0123456789abcdef") == "" {
+		prefixes = next + prefixes
+		dir = path.Dir(dir)
+		next = path.Base(dir)
+	}
+	if !strings.HasPrefix(hex, prefixes) {
+		return "", fmt.Errorf("invalid blob path %s", digestPath)
 	}
 
-	dgst := digest.NewDigestFromHex(algo, hex)
+	dgst := digest.NewDigestFromHex(next, hex)
 	return dgst, dgst.Validate()
 }
@@ -25,6 +25,44 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/revisions/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/link",
 		},
+		{
+			spec: manifestDiffIDsPathSpec{
+				name:     "foo/bar",
+				revision: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/revisions/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/diffids",
+		},
+		{
+			spec: manifestPushedAtPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/pushedat",
+		},
+		{
+			spec: layersPathSpec{
+				name: "foo/bar",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_layers",
+		},
+		{
+			spec: manifestReferrersPathSpec{
+				name:    "foo/bar",
+				subject: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/referrers/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+		},
+		{
+			spec: manifestReferrerLinkPathSpec{
+				name:     "foo/bar",
+				subject:  "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				referrer: "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/referrers/sha256/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/sha256/0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef/link",
+		},
+		{
+			spec:     gcLockPathSpec{},
+			expected: "/docker/registry/v2/gclock",
+		},
 		{
 			spec: manifestTagsPathSpec{
 				name: "foo/bar",
@@ -45,6 +83,13 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags/thetag/current/link",
 		},
+		{
+			spec: manifestTagAliasPathSpec{
+				name: "foo/bar",
+				tag:  "thetag",
+			},
+			expected: "/docker/registry/v2/repositories/foo/bar/_manifests/tags/thetag/alias",
+		},
 		{
 			spec: manifestTagIndexPathSpec{
 				name: "foo/bar",
@@ -83,6 +128,26 @@ func TestPathMapper(t *testing.T) {
 			},
 			expected: "/docker/registry/v2/repositories/foo/bar/_uploads/asdf-asdf-asdf-adsf/startedat",
 		},
+		{
+			spec: blobMediaTypePathSpec{
+				digest: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+			},
+			expected: "/docker/registry/v2/blobs/sha256/ab/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/mediatype",
+		},
+		{
+			spec: blobDataPathSpec{
+				digest: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				layout: blobPathLayout{2, 2},
+			},
+			expected: "/docker/registry/v2/blobs/sha256/ab/cd/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789/data",
+		},
+		{
+			spec: blobPathSpec{
+				digest: "sha256:abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+				layout: blobPathLayout{1, 3},
+			},
+			expected: "/docker/registry/v2/blobs/sha256/a/bcd/abcdef0123456789abcdef0123456789abcdef0123456789abcdef0123456789",
+		},
 	} {
 		p, err := pathFor(testcase.spec)
 		if err != nil {
@@ -120,6 +185,17 @@ func TestDigestFromPath(t *testing.T) {
 			expected:   "sha256:9943fffae777400c0344c58869c4c2619c329ca3ad4df540feda74d291dd7c86",
 			err:        nil,
 		},
+		{
+			path:       "/docker/registry/v2/blobs/sha256/99/43/9943fffae777400c0344c58869c4c2619c329ca3ad4df540feda74d291dd7c86/data",
+			multilevel: true,
+			expected:   "sha256:9943fffae777400c0344c58869c4c2619c329ca3ad4df540feda74d291dd7c86",
+			err:        nil,
+		},
+		{
+			path:     "/docker/registry/v2/repositories/foo/_manifests/tombstones/sha256/9943fffae777400c0344c58869c4c2619c329ca3ad4df540feda74d291dd7c86",
+			expected: "sha256:9943fffae777400c0344c58869c4c2619c329ca3ad4df540feda74d291dd7c86",
+			err:      nil,
+		},
 	} {
 		result, err := digestFromPath(testcase.path)
 		if err != testcase.err {
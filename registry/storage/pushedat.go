@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+)
+
+// recordPushTime stores t as the time of the most recent manifest push to
+// the repository.
+func (repo *repository) recordPushTime(ctx context.Context, t time.Time) error {
+	pushedAtPath, err := pathFor(manifestPushedAtPathSpec{name: repo.name.Name()})
+	if err != nil {
+		return err
+	}
+
+	return repo.driver.PutContent(ctx, pushedAtPath, []byte(t.UTC().Format(time.RFC3339Nano)))
+}
+
+// LastPushed returns the time of the most recent manifest push to the named
+// repository, as recorded when push timestamps are enabled. A zero time is
+// returned if no push has been recorded.
+func (reg *registry) LastPushed(ctx context.Context, name reference.Named) (time.Time, error) {
+	pushedAtPath, err := pathFor(manifestPushedAtPathSpec{name: name.Name()})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	content, err := reg.driver.GetContent(ctx, pushedAtPath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return time.Time{}, nil
+		}
+		return time.Time{}, err
+	}
+
+	return time.Parse(time.RFC3339Nano, string(content))
+}
+
+// ScanLastModified returns the most recent modification time of the current
+// link of a tag or of a manifest revision link of the named repository,
+// statting at most limit links, or all of them if limit is zero. The tags are
+// examined first, as they are moved by every push by tag.
+func (reg *registry) ScanLastModified(ctx context.Context, name reference.Named, limit int) (time.Time, error) {
+	var lastModified time.Time
+	remaining := limit
+
+	statLink := func(linkPath string) error {
+		fi, err := reg.driver.Stat(ctx, linkPath)
+		if err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				return nil
+			}
+			return err
+		}
+		if fi.ModTime().After(lastModified) {
+			lastModified = fi.ModTime()
+		}
+		remaining--
+		return nil
+	}
+
+	tagsPath, err := pathFor(manifestTagsPathSpec{name: name.Name()})
+	if err != nil {
+		return lastModified, err
+	}
+	tags, err := listIfExists(ctx, reg.driver, tagsPath)
+	if err != nil {
+		return lastModified, err
+	}
+	for _, tag := range tags {
+		if limit > 0 && remaining <= 0 {
+			return lastModified, nil
+		}
+		if err := statLink(path.Join(tag, "current", "link")); err != nil {
+			return lastModified, err
+		}
+	}
+
+	revisionsPath, err := pathFor(manifestRevisionsPathSpec{name: name.Name()})
+	if err != nil {
+		return lastModified, err
+	}
+	algorithms, err := listIfExists(ctx, reg.driver, revisionsPath)
+	if err != nil {
+		return lastModified, err
+	}
+	for _, algorithm := range algorithms {
+		revisions, err := listIfExists(ctx, reg.driver, algorithm)
+		if err != nil {
+			return lastModified, err
+		}
+		for _, revision := range revisions {
+			if limit > 0 && remaining <= 0 {
+				return lastModified, nil
+			}
+			if err := statLink(path.Join(revision, "link")); err != nil {
+				return lastModified, err
+			}
+		}
+	}
+
+	return lastModified, nil
+}
+
+// listIfExists lists the directory at p, which is treated as empty if it
+// doesn't exist.
+func listIfExists(ctx context.Context, storageDriver driver.StorageDriver, p string) ([]string, error) {
+	children, err := storageDriver.List(ctx, p)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil, nil
+	}
+	return children, err
+}
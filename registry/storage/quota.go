@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// QuotaProvider configures how many bytes of blobs each repository may
+// hold.
+type QuotaProvider interface {
+	// Limit returns the number of bytes the named repository may hold, or
+	// zero if it is unlimited.
+	Limit(ctx context.Context, name string) (int64, error)
+}
+
+// UsageProvider may be implemented by a QuotaProvider that accounts for the
+// usage of repositories itself. Without it, the usage of a repository is the
+// total size of the blobs linked into it.
+type UsageProvider interface {
+	// Usage returns the number of bytes the named repository holds.
+	Usage(ctx context.Context, name string) (int64, error)
+}
+
+// RepositoryQuotaProvider is a functional option for NewRegistry. It
+// rejects committing blob uploads to a repository that would take its
+// usage past the limit returned by provider, and putting manifests into a
+// repository that is already over it. The usage of each repository is
+// cached for cacheTTL, adding the blobs committed in the meantime.
+func RepositoryQuotaProvider(provider QuotaProvider, cacheTTL time.Duration) RegistryOption {
+	return func(registry *registry) error {
+		registry.repositoryQuota = &repositoryQuota{
+			provider: provider,
+			cacheTTL: cacheTTL,
+			usage:    make(map[string]cachedUsage),
+		}
+		return nil
+	}
+}
+
+// repositoryQuota enforces the limits of a QuotaProvider.
+type repositoryQuota struct {
+	provider QuotaProvider
+	cacheTTL time.Duration
+
+	mu    sync.Mutex
+	usage map[string]cachedUsage
+}
+
+type cachedUsage struct {
+	bytes    int64
+	computed time.Time
+}
+
+// check returns ErrQuotaExceeded if adding size bytes to the repository
+// of lbs would take it over its limit.
+func (q *repositoryQuota) check(ctx context.Context, lbs *linkedBlobStore, size int64) error {
+	name := lbs.repository.Named().Name()
+	limit, err := q.provider.Limit(ctx, name)
+	if err != nil {
+		return err
+	}
+	if limit <= 0 {
+		return nil
+	}
+
+	usage, err := q.usageOf(ctx, lbs)
+	if err != nil {
+		return err
+	}
+	if usage+size > limit {
+		return distribution.ErrQuotaExceeded{
+			Name:  name,
+			Usage: usage,
+			Size:  size,
+			Limit: limit,
+		}
+	}
+	return nil
+}
+
+// added accounts for size bytes committed to the named repository until its
+// usage is next computed.
+func (q *repositoryQuota) added(name string, size int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if cached, ok := q.usage[name]; ok {
+		cached.bytes += size
+		q.usage[name] = cached
+	}
+}
+
+// usageOf returns the usage of the repository of lbs, computing it if the
+// cached value is missing or stale.
+func (q *repositoryQuota) usageOf(ctx context.Context, lbs *linkedBlobStore) (int64, error) {
+	name := lbs.repository.Named().Name()
+	now := time.Now()
+
+	q.mu.Lock()
+	cached, ok := q.usage[name]
+	q.mu.Unlock()
+	if ok && now.Sub(cached.computed) < q.cacheTTL {
+		return cached.bytes, nil
+	}
+
+	var usage int64
+	var err error
+	if provider, ok := q.provider.(UsageProvider); ok {
+		usage, err = provider.Usage(ctx, name)
+	} else {
+		usage, err = linkedBlobsSize(ctx, lbs)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	q.mu.Lock()
+	q.usage[name] = cachedUsage{bytes: usage, computed: now}
+	q.mu.Unlock()
+	return usage, nil
+}
+
+// linkedBlobsSize returns the total size of the blobs linked into the
+// repository of lbs.
+func linkedBlobsSize(ctx context.Context, lbs *linkedBlobStore) (int64, error) {
+	var size int64
+	err := lbs.Enumerate(ctx, func(dgst digest.Digest) error {
+		desc, err := lbs.blobStore.statter.Stat(ctx, dgst)
+		switch err {
+		case nil:
+			size += desc.Size
+		case distribution.ErrBlobUnknown:
+			// the link outlived its blob, which takes no space
+			dcontext.GetLogger(ctx).Debugf("quota: skipping dangling link to %s", dgst)
+		default:
+			return err
+		}
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return 0, nil
+	}
+	return size, err
+}
+
+// repositoryQuota returns the quota of the repository, or nil if it is
+// unlimited.
+func (lbs *linkedBlobStore) repositoryQuota() *repositoryQuota {
+	if lbs.registry == nil {
+		return nil
+	}
+	return lbs.registry.repositoryQuota
+}
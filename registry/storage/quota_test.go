@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+type staticQuota map[string]int64
+
+func (q staticQuota) Limit(ctx context.Context, name string) (int64, error) {
+	return q[name], nil
+}
+
+func TestRepositoryQuota(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New(), RepositoryQuotaProvider(staticQuota{"foo/limited": 100}, time.Hour))
+
+	push := func(bs distribution.BlobStore, content []byte) error {
+		desc := distribution.Descriptor{Digest: digest.FromBytes(content), Size: int64(len(content))}
+		_, err := addBlob(ctx, bs, desc, bytes.NewReader(content))
+		return err
+	}
+
+	limited := makeRepository(t, registry, "foo/limited")
+	first := bytes.Repeat([]byte("a"), 60)
+	if err := push(limited.Blobs(ctx), first); err != nil {
+		t.Fatalf("unexpected error pushing blob within quota: %v", err)
+	}
+	if err := push(limited.Blobs(ctx), first); err != nil {
+		t.Fatalf("unexpected error pushing blob already in the repository: %v", err)
+	}
+
+	err := push(limited.Blobs(ctx), bytes.Repeat([]byte("b"), 60))
+	quotaErr, ok := err.(distribution.ErrQuotaExceeded)
+	if !ok {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+	if quotaErr.Usage != 60 || quotaErr.Size != 60 || quotaErr.Limit != 100 {
+		t.Errorf("unexpected quota error: %#v", quotaErr)
+	}
+	if _, err := limited.Blobs(ctx).Stat(ctx, digest.FromBytes(bytes.Repeat([]byte("b"), 60))); err != distribution.ErrBlobUnknown {
+		t.Errorf("expected blob over quota not to be linked, got %v", err)
+	}
+
+	// the cached usage accounts for blobs committed since it was computed
+	if err := push(limited.Blobs(ctx), bytes.Repeat([]byte("c"), 30)); err != nil {
+		t.Fatalf("unexpected error pushing blob within quota: %v", err)
+	}
+	if err := push(limited.Blobs(ctx), bytes.Repeat([]byte("d"), 30)); err == nil {
+		t.Fatalf("expected error pushing blob past quota")
+	}
+
+	if err := push(makeRepository(t, registry, "foo/unlimited").Blobs(ctx), bytes.Repeat([]byte("b"), 200)); err != nil {
+		t.Fatalf("unexpected error pushing blob to unlimited repository: %v", err)
+	}
+}
+
+func TestRepositoryQuotaManifestPut(t *testing.T) {
+	ctx := context.Background()
+
+	// compute the usage of the repository anew on every request
+	quota := staticQuota{}
+	registry := createRegistry(t, inmemory.New(), RepositoryQuotaProvider(quota, 0))
+	repository := makeRepository(t, registry, "foo/manifests")
+
+	layers, err := testutil.CreateRandomLayers(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := testutil.UploadBlobs(repository, layers); err != nil {
+		t.Fatal(err)
+	}
+	manifest, err := testutil.MakeSchema2Manifest(repository, getKeys(layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	quota["foo/manifests"] = 1
+	if _, err := makeManifestService(t, repository).Put(ctx, manifest); err == nil {
+		t.Fatalf("expected error putting manifest into repository over quota")
+	} else if _, ok := err.(distribution.ErrQuotaExceeded); !ok {
+		t.Fatalf("expected ErrQuotaExceeded, got %v", err)
+	}
+
+	quota["foo/manifests"] = 1 << 30
+	if _, err := makeManifestService(t, repository).Put(ctx, manifest); err != nil {
+		t.Fatalf("unexpected error putting manifest within quota: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"path"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// linkReferrer records that the manifest referrer has subject as its
+// subject.
+func (repo *repository) linkReferrer(ctx context.Context, subject, referrer digest.Digest) error {
+	linkPath, err := pathFor(manifestReferrerLinkPathSpec{
+		name:     repo.name.Name(),
+		subject:  subject,
+		referrer: referrer,
+	})
+	if err != nil {
+		return err
+	}
+
+	return repo.blobStore.link(ctx, linkPath, referrer)
+}
+
+// Referrers returns the digests of the manifests in the named repository
+// whose subject is the given digest. The referring manifests may have been
+// deleted since they were linked; callers should skip those that are
+// unknown.
+func Referrers(ctx context.Context, storageDriver driver.StorageDriver, name reference.Named, subject digest.Digest) ([]digest.Digest, error) {
+	root, err := pathFor(manifestReferrersPathSpec{
+		name:    name.Name(),
+		subject: subject,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bs := &blobStore{driver: storageDriver}
+	var referrers []digest.Digest
+	err = storageDriver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+		if _, fileName := path.Split(fileInfo.Path()); fileName != "link" {
+			return nil
+		}
+
+		referrer, err := bs.readlink(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+		referrers = append(referrers, referrer)
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil, nil
+	}
+
+	return referrers, err
+}
+
+// referrerSubjects returns the digests of the manifests which have had
+// referrers linked in the named repository. The subjects need not exist.
+func referrerSubjects(ctx context.Context, storageDriver driver.StorageDriver, name string) ([]digest.Digest, error) {
+	root, err := pathFor(manifestSubjectsPathSpec{name: name})
+	if err != nil {
+		return nil, err
+	}
+
+	algorithms, err := storageDriver.List(ctx, root)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var subjects []digest.Digest
+	for _, algorithm := range algorithms {
+		hexes, err := storageDriver.List(ctx, algorithm)
+		if err != nil {
+			return nil, err
+		}
+		for _, hex := range hexes {
+			subject := digest.NewDigestFromHex(path.Base(algorithm), path.Base(hex))
+			if err := subject.Validate(); err != nil {
+				continue
+			}
+			subjects = append(subjects, subject)
+		}
+	}
+
+	return subjects, nil
+}
@@ -2,13 +2,18 @@ package storage
 
 import (
 	"context"
+	_ "crypto/sha512" // make digest.SHA512 available to DefaultDigestAlgorithm
+	"fmt"
 	"regexp"
+	"time"
 
 	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/cache"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
 	"github.com/docker/libtrust"
+	"github.com/opencontainers/go-digest"
 )
 
 // registry is the top-level implementation of Registry for use in the storage
@@ -18,19 +23,70 @@ type registry struct {
 	blobServer                   *blobServer
 	statter                      *blobStatter // global statter service.
 	blobDescriptorCacheProvider  cache.BlobDescriptorCacheProvider
+	negativeStatCacheTTL         time.Duration
 	deleteEnabled                bool
+	immutableTags                *regexp.Regexp
+	softDeleteRetention          time.Duration
+	referrersGCPolicy            ReferrersPolicy
+	gcStreamingDeletes           bool
+	maxManifestBytes             int64
+	maxManifestReferences        int
+	maxManifestListEntries       int
+	lazyManifestLists            bool
+	uploadLimiter                *uploadLimiter
+	manifestAdmission            *manifestAdmission
+	repositoryQuota              *repositoryQuota
+	gcScheduler                  *gcScheduler
+	uploadStagingDriver          storagedriver.StorageDriver
+	autoMountFromGlobal          bool
 	schema1Enabled               bool
+	schema1PullRejected          bool
+	schema1ConversionEnabled     bool
 	resumableDigestEnabled       bool
+	resumableDigestDeny          *regexp.Regexp
 	schema1SigningKey            libtrust.PrivateKey
+	schema1TrustedKeys           map[string]libtrust.PublicKey
 	blobDescriptorServiceFactory distribution.BlobDescriptorServiceFactory
 	manifestURLs                 manifestURLs
 	driver                       storagedriver.StorageDriver
+	pushTimestampsEnabled        bool
+	deleteReferenceCheck         bool
+	protectLastTag               bool
+	ociAllowedConfigMediaTypes   map[string]struct{}
 }
 
 // manifestURLs holds regular expressions for controlling manifest URL whitelisting
 type manifestURLs struct {
 	allow *regexp.Regexp
 	deny  *regexp.Regexp
+
+	// mediaTypes overrides allow and deny for manifests whose config has
+	// the media type of the key.
+	mediaTypes map[string]manifestURLs
+}
+
+// rulesFor returns the allow and deny expressions for a manifest whose
+// config has the given media type. Expressions not set for the media type
+// fall back to the defaults.
+func (m manifestURLs) rulesFor(mediaType string) (allow, deny *regexp.Regexp) {
+	allow, deny = m.allow, m.deny
+	if rules, ok := m.mediaTypes[mediaType]; ok {
+		if rules.allow != nil {
+			allow = rules.allow
+		}
+		if rules.deny != nil {
+			deny = rules.deny
+		}
+	}
+	return allow, deny
+}
+
+// forMediaType returns the rules for mediaType, creating them if needed.
+func (m *manifestURLs) forMediaType(mediaType string) manifestURLs {
+	if m.mediaTypes == nil {
+		m.mediaTypes = make(map[string]manifestURLs)
+	}
+	return m.mediaTypes[mediaType]
 }
 
 // RegistryOption is the type used for functional options for NewRegistry.
@@ -38,11 +94,31 @@ type RegistryOption func(*registry) error
 
 // EnableRedirect is a functional option for NewRegistry. It causes the backend
 // blob server to attempt using (StorageDriver).URLFor to serve all blobs.
+// It has no effect if the driver doesn't report URLFor in its Capabilities.
 func EnableRedirect(registry *registry) error {
 	registry.blobServer.redirect = true
 	return nil
 }
 
+// RedirectDenyUserAgentRegexp is a functional option for NewRegistry. Blobs
+// requested by clients whose User-Agent matches r are served directly instead
+// of redirecting, for clients unable to reach the storage backend.
+func RedirectDenyUserAgentRegexp(r *regexp.Regexp) RegistryOption {
+	return func(registry *registry) error {
+		registry.blobServer.redirectDenyUserAgent = r
+		return nil
+	}
+}
+
+// RedirectVerifyExistence is a functional option for NewRegistry. Blobs are
+// looked up in storage before redirecting to them, so that a blob deleted
+// from the backend is reported as unknown by the registry instead of by the
+// backend, at the cost of a driver Stat per redirect.
+func RedirectVerifyExistence(registry *registry) error {
+	registry.blobServer.redirectVerifyExistence = true
+	return nil
+}
+
 // EnableDelete is a functional option for NewRegistry. It enables deletion on
 // the registry.
 func EnableDelete(registry *registry) error {
@@ -50,6 +126,48 @@ func EnableDelete(registry *registry) error {
 	return nil
 }
 
+// EnableDeleteReferenceCheck is a functional option for NewRegistry. It
+// causes blob deletion to fail with distribution.ErrBlobInUse while a
+// manifest in the repository still references the blob.
+func EnableDeleteReferenceCheck(registry *registry) error {
+	registry.deleteReferenceCheck = true
+	return nil
+}
+
+// ImmutableTagsRegexp is a functional option for NewRegistry. Tags matching
+// r can't be moved once they reference a manifest: tagging another manifest
+// with them fails with distribution.ErrTagImmutable, while tagging the same
+// manifest again succeeds. Other tags, such as latest, can still be moved.
+func ImmutableTagsRegexp(r *regexp.Regexp) RegistryOption {
+	return func(registry *registry) error {
+		registry.immutableTags = r
+		return nil
+	}
+}
+
+// ProtectLastTag is a functional option for NewRegistry. It causes deleting
+// a tag, or a manifest by digest, to fail with
+// distribution.ErrLastTagProtected when it would leave the repository
+// without tags, unless the context comes from WithForceDelete.
+func ProtectLastTag(registry *registry) error {
+	registry.protectLastTag = true
+	return nil
+}
+
+// DefaultDigestAlgorithm is a functional option for NewRegistry. It sets the
+// algorithm used to address content written to the registry. Content pushed
+// with a digest of another algorithm is still accepted and linked under that
+// digest as well. The default is digest.Canonical.
+func DefaultDigestAlgorithm(algorithm digest.Algorithm) RegistryOption {
+	return func(registry *registry) error {
+		if !algorithm.Available() {
+			return fmt.Errorf("digest algorithm %q is not available", algorithm)
+		}
+		registry.blobStore.algorithm = algorithm
+		return nil
+	}
+}
+
 // EnableSchema1 is a functional option for NewRegistry. It enables pushing of
 // schema1 manifests.
 func EnableSchema1(registry *registry) error {
@@ -57,6 +175,196 @@ func EnableSchema1(registry *registry) error {
 	return nil
 }
 
+// RejectSchema1OnPull is a functional option for NewRegistry. It causes
+// fetching a stored schema1 manifest to fail with ErrSchemaV1Rejected, so that
+// together with schema1 pushes being disabled no schema1 manifest is served.
+// Garbage collection reads every manifest and must run without this option.
+func RejectSchema1OnPull(registry *registry) error {
+	registry.schema1PullRejected = true
+	return nil
+}
+
+// EnableSchema1Conversion is a functional option for NewRegistry. It allows a
+// stored schema1 manifest fetched with WithSchema1Conversion to be returned as
+// an equivalent schema2 manifest. Converted manifests are stored in the
+// repository and reused, and take precedence over RejectSchema1OnPull.
+func EnableSchema1Conversion(registry *registry) error {
+	registry.schema1ConversionEnabled = true
+	return nil
+}
+
+// EnablePushTimestamps is a functional option for NewRegistry. It causes the
+// time of the most recent manifest push to be recorded for each repository.
+func EnablePushTimestamps(registry *registry) error {
+	registry.pushTimestampsEnabled = true
+	return nil
+}
+
+// BlobPathSharding is a functional option for NewRegistry. Blobs are written
+// to paths fanning out by successive prefixes of their hex digest, of the
+// given lengths, instead of by its first two characters only. Blobs written
+// with the legacy layout are still read, so the option can be set on an
+// existing registry, at the cost of a driver Stat for reading each blob.
+func BlobPathSharding(prefixes []int) RegistryOption {
+	return func(registry *registry) error {
+		total := 0
+		for _, length := range prefixes {
+			if length <= 0 {
+				return fmt.Errorf("invalid blob path prefix length: %d", length)
+			}
+			total += length
+		}
+		// sha256 digests have the shortest hex of the supported algorithms
+		if total >= len(digest.SHA256.FromString("").Hex()) {
+			return fmt.Errorf("blob path prefixes %v are longer than digests", prefixes)
+		}
+
+		registry.blobStore.layout = blobPathLayout(prefixes)
+		registry.statter.layout = blobPathLayout(prefixes)
+		return nil
+	}
+}
+
+// RecordBlobMediaTypes is a functional option for NewRegistry. The media type
+// a blob is first declared with, by the Content-Type of the request
+// completing its upload or by a manifest referencing it, is stored next to
+// the blob and served as its Content-Type. Without it, blobs are served as
+// application/octet-stream.
+func RecordBlobMediaTypes(registry *registry) error {
+	registry.blobStore.mediaTypes = true
+	registry.statter.mediaTypes = true
+	return nil
+}
+
+// SoftDeleteRetention is a functional option for NewRegistry. Deleted
+// manifests are tombstoned instead of being forgotten, and can be restored
+// with their tags for the given duration. Garbage collection keeps the
+// content of tombstoned manifests until the retention has passed, so it must
+// run with the same option; without it, tombstones and their content are
+// kept.
+func SoftDeleteRetention(d time.Duration) RegistryOption {
+	return func(registry *registry) error {
+		registry.softDeleteRetention = d
+		return nil
+	}
+}
+
+// ReferrersPolicy selects how garbage collection treats the manifests
+// referring to another manifest of their repository as their subject, such as
+// signatures and SBOMs.
+type ReferrersPolicy int
+
+const (
+	// ReferrersIndependent collects referrers like any other manifest.
+	ReferrersIndependent ReferrersPolicy = iota
+
+	// ReferrersRetain keeps the referrers of every manifest that is kept,
+	// whether they are tagged or not.
+	ReferrersRetain
+
+	// ReferrersFollowSubject keeps the referrers of every manifest that is
+	// kept and deletes, along with their tags, those whose subject has been
+	// deleted.
+	ReferrersFollowSubject
+)
+
+// ReferrersGCPolicy is a functional option for NewRegistry. It sets how
+// garbage collection treats referrers; the default is ReferrersIndependent.
+func ReferrersGCPolicy(policy ReferrersPolicy) RegistryOption {
+	return func(registry *registry) error {
+		registry.referrersGCPolicy = policy
+		return nil
+	}
+}
+
+// GCStreamingDeletes is a functional option for NewRegistry. It makes garbage
+// collection delete each manifest eligible for deletion as soon as it is
+// enumerated, instead of holding them in memory until the sweep. With a
+// ReferrersGCPolicy other than ReferrersIndependent, which decides on the
+// manifests of a repository together, they are deleted once the repository
+// is marked. A run failing then
+// leaves manifests deleted while the blobs only they referenced remain, to
+// be swept by the next run. GCSummary.Manifests is not filled in.
+func GCStreamingDeletes(registry *registry) error {
+	registry.gcStreamingDeletes = true
+	return nil
+}
+
+// MaxManifestBytes is a functional option for NewRegistry. It sets the
+// largest manifest payload, in bytes, that is accepted on put. Zero means
+// unlimited. The default matches the size of the request body accepted by
+// the API.
+func MaxManifestBytes(n int64) RegistryOption {
+	return func(registry *registry) error {
+		registry.maxManifestBytes = n
+		return nil
+	}
+}
+
+// MaxManifestReferences is a functional option for NewRegistry. It sets the
+// largest number of blobs an image manifest may reference, counting its
+// config and layers. Zero means unlimited.
+func MaxManifestReferences(n int) RegistryOption {
+	return func(registry *registry) error {
+		registry.maxManifestReferences = n
+		return nil
+	}
+}
+
+// MaxManifestListEntries is a functional option for NewRegistry. It sets the
+// largest number of manifests a manifest list may reference. Zero means
+// unlimited.
+func MaxManifestListEntries(n int) RegistryOption {
+	return func(registry *registry) error {
+		registry.maxManifestListEntries = n
+		return nil
+	}
+}
+
+// MaxConcurrentUploadsPerRepo is a functional option for NewRegistry. It
+// sets the largest number of blob uploads which may be in progress at once in
+// a repository. An upload stops counting once it is committed or cancelled,
+// or once it has been idle for 15 minutes. Zero means unlimited.
+func MaxConcurrentUploadsPerRepo(n int) RegistryOption {
+	return func(registry *registry) error {
+		if n > 0 {
+			registry.uploadLimiter = newUploadLimiter(n, uploadSessionTimeout)
+		} else {
+			registry.uploadLimiter = nil
+		}
+		return nil
+	}
+}
+
+// AutoMountFromGlobal is a functional option for NewRegistry. It enables
+// MountFromGlobal, linking a blob which is present in the registry into a
+// repository it isn't linked into, so that clients checking for a layer
+// before pushing it skip the upload. Anyone allowed to push to a repository
+// can then pull every blob of the registry whose digest they know.
+func AutoMountFromGlobal(registry *registry) error {
+	registry.autoMountFromGlobal = true
+	return nil
+}
+
+// UploadStagingDriver is a functional option for NewRegistry. It keeps the
+// working data of blob uploads in progress on driver, such as a fast local
+// filesystem, rather than on the storage of the registry. Committed blobs are
+// copied into the storage of the registry and removed from driver.
+func UploadStagingDriver(driver storagedriver.StorageDriver) RegistryOption {
+	return func(registry *registry) error {
+		registry.uploadStagingDriver = driver
+		return nil
+	}
+}
+
+// AllowLazyManifestList is a functional option for NewRegistry. Manifest lists
+// are accepted without checking that the manifests they reference are
+// present, for setups where those manifests arrive after the list.
+func AllowLazyManifestList(registry *registry) error {
+	registry.lazyManifestLists = true
+	return nil
+}
+
 // DisableDigestResumption is a functional option for NewRegistry. It should be
 // used if the registry is acting as a caching proxy.
 func DisableDigestResumption(registry *registry) error {
@@ -64,6 +372,16 @@ func DisableDigestResumption(registry *registry) error {
 	return nil
 }
 
+// ResumableDigestRepositoryDenyRegexp is a functional option for NewRegistry.
+// It disables digest resumption for the repositories whose name matches r,
+// such as those served as a caching proxy, leaving it enabled for the rest.
+func ResumableDigestRepositoryDenyRegexp(r *regexp.Regexp) RegistryOption {
+	return func(registry *registry) error {
+		registry.resumableDigestDeny = r
+		return nil
+	}
+}
+
 // ManifestURLsAllowRegexp is a functional option for NewRegistry.
 func ManifestURLsAllowRegexp(r *regexp.Regexp) RegistryOption {
 	return func(registry *registry) error {
@@ -80,6 +398,47 @@ func ManifestURLsDenyRegexp(r *regexp.Regexp) RegistryOption {
 	}
 }
 
+// ManifestURLsAllowRegexpFor is a functional option for NewRegistry. It
+// replaces the allow expression for manifests whose config has the given
+// media type, such as the type of an OCI artifact.
+func ManifestURLsAllowRegexpFor(mediaType string, r *regexp.Regexp) RegistryOption {
+	return func(registry *registry) error {
+		rules := registry.manifestURLs.forMediaType(mediaType)
+		rules.allow = r
+		registry.manifestURLs.mediaTypes[mediaType] = rules
+		return nil
+	}
+}
+
+// ManifestURLsDenyRegexpFor is a functional option for NewRegistry. It
+// replaces the deny expression for manifests whose config has the given
+// media type, such as the type of an OCI artifact.
+func ManifestURLsDenyRegexpFor(mediaType string, r *regexp.Regexp) RegistryOption {
+	return func(registry *registry) error {
+		rules := registry.manifestURLs.forMediaType(mediaType)
+		rules.deny = r
+		registry.manifestURLs.mediaTypes[mediaType] = rules
+		return nil
+	}
+}
+
+// OCIAllowedConfigMediaTypes is a functional option for NewRegistry. It
+// restricts the config media types accepted in OCI image manifests to
+// mediaTypes. Any config media type is accepted if mediaTypes is empty.
+func OCIAllowedConfigMediaTypes(mediaTypes []string) RegistryOption {
+	return func(registry *registry) error {
+		if len(mediaTypes) == 0 {
+			registry.ociAllowedConfigMediaTypes = nil
+			return nil
+		}
+		registry.ociAllowedConfigMediaTypes = make(map[string]struct{}, len(mediaTypes))
+		for _, mediaType := range mediaTypes {
+			registry.ociAllowedConfigMediaTypes[mediaType] = struct{}{}
+		}
+		return nil
+	}
+}
+
 // Schema1SigningKey returns a functional option for NewRegistry. It sets the
 // key for signing  all schema1 manifests.
 func Schema1SigningKey(key libtrust.PrivateKey) RegistryOption {
@@ -89,6 +448,19 @@ func Schema1SigningKey(key libtrust.PrivateKey) RegistryOption {
 	}
 }
 
+// Schema1TrustedKeys returns a functional option for NewRegistry. Schema1
+// manifests are only accepted on put if one of their signatures was made
+// with one of the given keys.
+func Schema1TrustedKeys(keys []libtrust.PublicKey) RegistryOption {
+	return func(registry *registry) error {
+		registry.schema1TrustedKeys = make(map[string]libtrust.PublicKey, len(keys))
+		for _, key := range keys {
+			registry.schema1TrustedKeys[key.KeyID()] = key
+		}
+		return nil
+	}
+}
+
 // BlobDescriptorServiceFactory returns a functional option for NewRegistry. It sets the
 // factory to create BlobDescriptorServiceFactory middleware.
 func BlobDescriptorServiceFactory(factory distribution.BlobDescriptorServiceFactory) RegistryOption {
@@ -109,15 +481,23 @@ func BlobDescriptorCacheProvider(blobDescriptorCacheProvider cache.BlobDescripto
 	// blobDescriptorCacheProvider.
 	return func(registry *registry) error {
 		if blobDescriptorCacheProvider != nil {
-			statter := cache.NewCachedBlobStatter(blobDescriptorCacheProvider, registry.statter)
-			registry.blobStore.statter = statter
-			registry.blobServer.statter = statter
 			registry.blobDescriptorCacheProvider = blobDescriptorCacheProvider
 		}
 		return nil
 	}
 }
 
+// NegativeStatCacheTTL is a functional option for NewRegistry. When a blob
+// descriptor cache provider is configured, the cached blob statter also
+// remembers blobs missing from storage for ttl, so repeated requests for an
+// absent blob are answered without reaching the storage driver.
+func NegativeStatCacheTTL(ttl time.Duration) RegistryOption {
+	return func(registry *registry) error {
+		registry.negativeStatCacheTTL = ttl
+		return nil
+	}
+}
+
 // NewRegistry creates a new registry instance from the provided driver. The
 // resulting registry may be shared by multiple goroutines but is cheap to
 // allocate. If the Redirect option is specified, the backend blob server will
@@ -138,10 +518,11 @@ func NewRegistry(ctx context.Context, driver storagedriver.StorageDriver, option
 		blobServer: &blobServer{
 			driver:  driver,
 			statter: statter,
-			pathFn:  bs.path,
+			pathFn:  bs.readPath,
 		},
 		statter:                statter,
 		resumableDigestEnabled: true,
+		maxManifestBytes:       defaultMaxManifestBytes,
 		driver:                 driver,
 	}
 
@@ -151,6 +532,35 @@ func NewRegistry(ctx context.Context, driver storagedriver.StorageDriver, option
 		}
 	}
 
+	if registry.uploadStagingDriver != nil {
+		driver = newStagingDriver(driver, registry.uploadStagingDriver)
+		registry.driver = driver
+		bs.driver = driver
+		statter.driver = driver
+		registry.blobServer.driver = driver
+	}
+
+	if registry.blobServer.redirect && !driver.Capabilities().URLFor {
+		dcontext.GetLogger(ctx).Warn("storage driver can't make URLs, serving blobs without redirects")
+		registry.blobServer.redirect = false
+	}
+
+	if registry.blobDescriptorCacheProvider != nil {
+		var statter distribution.BlobDescriptorService
+		if registry.negativeStatCacheTTL > 0 {
+			statter = cache.NewCachedBlobStatterWithUnknownTTL(registry.blobDescriptorCacheProvider, registry.statter, registry.negativeStatCacheTTL)
+		} else {
+			statter = cache.NewCachedBlobStatter(registry.blobDescriptorCacheProvider, registry.statter)
+		}
+		registry.blobStore.statter = statter
+		registry.blobServer.statter = statter
+		registry.blobServer.digests, _ = registry.blobDescriptorCacheProvider.(cache.AlgorithmDigestCache)
+	}
+
+	if registry.gcScheduler != nil {
+		registry.gcScheduler.start(ctx, registry)
+	}
+
 	return registry, nil
 }
 
@@ -189,6 +599,25 @@ func (reg *registry) BlobStatter() distribution.BlobStatter {
 	return reg.statter
 }
 
+// InvalidateBlobDescriptorCache drops the blob descriptors cached for the
+// repository named repo, so that they are read from storage again. If repo
+// is empty, all cached descriptors and the blobs remembered as unknown are
+// dropped, which is needed after blobs themselves changed in storage. It
+// returns distribution.ErrUnsupported if descriptors aren't cached.
+func (reg *registry) InvalidateBlobDescriptorCache(ctx context.Context, repo string) error {
+	if reg.blobDescriptorCacheProvider == nil {
+		return distribution.ErrUnsupported
+	}
+
+	if err := reg.blobDescriptorCacheProvider.Invalidate(ctx, repo); err != nil {
+		return err
+	}
+	if repo == "" {
+		cache.ForgetUnknown(reg.blobStore.statter)
+	}
+	return nil
+}
+
 // repository provides name-scoped access to various services.
 type repository struct {
 	*registry
@@ -206,6 +635,7 @@ func (repo *repository) Tags(ctx context.Context) distribution.TagService {
 	tags := &tagStore{
 		repository: repo,
 		blobStore:  repo.registry.blobStore,
+		immutable:  repo.registry.immutableTags,
 	}
 
 	return tags
@@ -250,18 +680,20 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 	var v1Handler ManifestHandler
 	if repo.schema1Enabled {
 		v1Handler = &signedManifestHandler{
-			ctx:               ctx,
-			schema1SigningKey: repo.schema1SigningKey,
-			repository:        repo,
-			blobStore:         blobStore,
+			ctx:                ctx,
+			schema1SigningKey:  repo.schema1SigningKey,
+			schema1TrustedKeys: repo.schema1TrustedKeys,
+			repository:         repo,
+			blobStore:          blobStore,
 		}
 	} else {
 		v1Handler = &v1UnsupportedHandler{
 			innerHandler: &signedManifestHandler{
-				ctx:               ctx,
-				schema1SigningKey: repo.schema1SigningKey,
-				repository:        repo,
-				blobStore:         blobStore,
+				ctx:                ctx,
+				schema1SigningKey:  repo.schema1SigningKey,
+				schema1TrustedKeys: repo.schema1TrustedKeys,
+				repository:         repo,
+				blobStore:          blobStore,
 			},
 		}
 	}
@@ -272,21 +704,26 @@ func (repo *repository) Manifests(ctx context.Context, options ...distribution.M
 		blobStore:      blobStore,
 		schema1Handler: v1Handler,
 		schema2Handler: &schema2ManifestHandler{
-			ctx:          ctx,
-			repository:   repo,
-			blobStore:    blobStore,
-			manifestURLs: repo.registry.manifestURLs,
+			ctx:           ctx,
+			repository:    repo,
+			blobStore:     blobStore,
+			manifestURLs:  repo.registry.manifestURLs,
+			maxReferences: repo.registry.maxManifestReferences,
 		},
 		manifestListHandler: &manifestListHandler{
 			ctx:        ctx,
 			repository: repo,
 			blobStore:  blobStore,
+			maxEntries: repo.registry.maxManifestListEntries,
+			lazy:       repo.registry.lazyManifestLists,
 		},
 		ocischemaHandler: &ocischemaManifestHandler{
-			ctx:          ctx,
-			repository:   repo,
-			blobStore:    blobStore,
-			manifestURLs: repo.registry.manifestURLs,
+			ctx:                     ctx,
+			repository:              repo,
+			blobStore:               blobStore,
+			manifestURLs:            repo.registry.manifestURLs,
+			allowedConfigMediaTypes: repo.registry.ociAllowedConfigMediaTypes,
+			maxReferences:           repo.registry.maxManifestReferences,
 		},
 	}
 
@@ -330,7 +767,17 @@ func (repo *repository) Blobs(ctx context.Context) distribution.BlobStore {
 		// TODO(stevvooe): linkPath limits this blob store to only layers.
 		// This instance cannot be used for manifest checks.
 		linkPathFns:            []linkPathFunc{blobLinkPath},
+		linkDirectoryPathSpec:  layersPathSpec{name: repo.name.Name()},
 		deleteEnabled:          repo.registry.deleteEnabled,
-		resumableDigestEnabled: repo.resumableDigestEnabled,
+		resumableDigestEnabled: repo.resumableDigest(),
+	}
+}
+
+// resumableDigest reports whether uploads to the repository may persist the
+// state of their digest to resume it later.
+func (repo *repository) resumableDigest() bool {
+	if repo.resumableDigestDeny != nil && repo.resumableDigestDeny.MatchString(repo.name.Name()) {
+		return false
 	}
+	return repo.resumableDigestEnabled
 }
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"net"
+	"time"
+
+	dcontext "github.com/docker/distribution/context"
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+const (
+	defaultRetryMaxAttempts    = 3
+	defaultRetryInitialBackoff = 100 * time.Millisecond
+	defaultRetryMaxBackoff     = 2 * time.Second
+)
+
+// throttlingErrorCodes are the error codes, as reported by a Code method, of
+// cloud storage errors which are expected to clear up on their own.
+var throttlingErrorCodes = map[string]struct{}{
+	"InternalError":        {},
+	"OperationTimedOut":    {},
+	"RequestLimitExceeded": {},
+	"RequestTimeout":       {},
+	"ServerBusy":           {},
+	"ServiceUnavailable":   {},
+	"SlowDown":             {},
+	"Throttling":           {},
+	"ThrottlingException":  {},
+}
+
+// RetryDriverOptions configures the retries of a driver created by
+// NewRetryDriver. Zero values select the defaults.
+type RetryDriverOptions struct {
+	// MaxAttempts is the number of times a call is made before its error
+	// is returned. It defaults to 3.
+	MaxAttempts int
+
+	// InitialBackoff is the delay before the first retry, doubled for each
+	// following one. It defaults to 100ms.
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the delay between retries. It defaults to 2s.
+	MaxBackoff time.Duration
+
+	// Retryable reports whether err is transient. It defaults to
+	// IsTransientDriverError.
+	Retryable func(err error) bool
+}
+
+// IsTransientDriverError reports whether err, returned by a storage driver,
+// is a network timeout or a throttling or availability error of the storage
+// service, which makes it worth retrying the call.
+func IsTransientDriverError(err error) bool {
+	if driverErr, ok := err.(storagedriver.Error); ok {
+		err = driverErr.Enclosed
+	}
+
+	switch err := err.(type) {
+	case nil:
+		return false
+	case net.Error:
+		return err.Timeout() || err.Temporary()
+	case interface {
+		Code() string
+	}:
+		_, ok := throttlingErrorCodes[err.Code()]
+		return ok
+	}
+	return false
+}
+
+// NewRetryDriver wraps the given driver so that reads, writes of whole
+// content, stats, moves and deletes failing with a transient error are
+// retried with exponential backoff. Streamed writes are never retried.
+func NewRetryDriver(driver storagedriver.StorageDriver, options RetryDriverOptions) storagedriver.StorageDriver {
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = defaultRetryMaxAttempts
+	}
+	if options.InitialBackoff <= 0 {
+		options.InitialBackoff = defaultRetryInitialBackoff
+	}
+	if options.MaxBackoff <= 0 {
+		options.MaxBackoff = defaultRetryMaxBackoff
+	}
+	if options.Retryable == nil {
+		options.Retryable = IsTransientDriverError
+	}
+
+	return &retryDriver{
+		StorageDriver: driver,
+		options:       options,
+	}
+}
+
+type retryDriver struct {
+	storagedriver.StorageDriver
+	options RetryDriverOptions
+}
+
+// retry calls fn until it succeeds, fails with an error that is not
+// transient, or the attempts are exhausted. The error of the last call is
+// returned.
+func (r *retryDriver) retry(ctx context.Context, op, path string, fn func() error) error {
+	backoff := r.options.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= r.options.MaxAttempts || !r.options.Retryable(err) {
+			return err
+		}
+
+		dcontext.GetLogger(ctx).Warnf("retrying %s %s after transient error (attempt %d of %d): %v", op, path, attempt, r.options.MaxAttempts, err)
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > r.options.MaxBackoff {
+			backoff = r.options.MaxBackoff
+		}
+	}
+}
+
+// GetContent retrieves the content stored at "path" as a []byte.
+func (r *retryDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	var content []byte
+	err := r.retry(ctx, "GetContent", path, func() error {
+		var err error
+		content, err = r.StorageDriver.GetContent(ctx, path)
+		return err
+	})
+	return content, err
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+// The content is replaced as a whole, so a failed attempt can be repeated.
+func (r *retryDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	return r.retry(ctx, "PutContent", path, func() error {
+		return r.StorageDriver.PutContent(ctx, path, content)
+	})
+}
+
+// Reader retrieves an io.ReadCloser for the content stored at "path" with a
+// given byte offset. Only opening the content is retried.
+func (r *retryDriver) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	var rc io.ReadCloser
+	err := r.retry(ctx, "Reader", path, func() error {
+		var err error
+		rc, err = r.StorageDriver.Reader(ctx, path, offset)
+		return err
+	})
+	return rc, err
+}
+
+// Stat retrieves the FileInfo for the given path.
+func (r *retryDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	var fi storagedriver.FileInfo
+	err := r.retry(ctx, "Stat", path, func() error {
+		var err error
+		fi, err = r.StorageDriver.Stat(ctx, path)
+		return err
+	})
+	return fi, err
+}
+
+// Move moves an object stored at sourcePath to destPath. A move that failed
+// after the object was moved, leaving no source behind, is not repeated.
+func (r *retryDriver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	attempted := false
+	return r.retry(ctx, "Move", sourcePath, func() error {
+		if attempted {
+			if _, err := r.StorageDriver.Stat(ctx, sourcePath); err != nil {
+				if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+					return err
+				}
+				// the failed attempt went through if the object arrived
+				_, err := r.StorageDriver.Stat(ctx, destPath)
+				return err
+			}
+		}
+		attempted = true
+		return r.StorageDriver.Move(ctx, sourcePath, destPath)
+	})
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths.
+// A path found missing when retrying was removed by the failed attempt.
+func (r *retryDriver) Delete(ctx context.Context, path string) error {
+	attempted := false
+	return r.retry(ctx, "Delete", path, func() error {
+		err := r.StorageDriver.Delete(ctx, path)
+		if _, ok := err.(storagedriver.PathNotFoundError); ok && attempted {
+			return nil
+		}
+		attempted = true
+		return err
+	})
+}
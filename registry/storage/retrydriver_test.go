@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+type codedError string
+
+func (err codedError) Error() string { return "coded error " + string(err) }
+func (err codedError) Code() string  { return string(err) }
+
+// flakyDriver fails its first failures GetContent and Move calls with a
+// throttling error. With moveFirst, a failing Move still moves the object.
+type flakyDriver struct {
+	storagedriver.StorageDriver
+	failures  int
+	moveFirst bool
+	calls     int
+}
+
+func (d *flakyDriver) fail() error {
+	d.calls++
+	if d.failures > 0 {
+		d.failures--
+		return storagedriver.Error{DriverName: "flaky", Enclosed: codedError("SlowDown")}
+	}
+	return nil
+}
+
+func (d *flakyDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	if err := d.fail(); err != nil {
+		return nil, err
+	}
+	return d.StorageDriver.GetContent(ctx, path)
+}
+
+func (d *flakyDriver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	if d.moveFirst && d.failures > 0 {
+		if err := d.StorageDriver.Move(ctx, sourcePath, destPath); err != nil {
+			return err
+		}
+	}
+	if err := d.fail(); err != nil {
+		return err
+	}
+	return d.StorageDriver.Move(ctx, sourcePath, destPath)
+}
+
+func TestRetryDriver(t *testing.T) {
+	ctx := context.Background()
+	options := RetryDriverOptions{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	for _, tc := range []struct {
+		failures int
+		calls    int
+		fails    bool
+	}{
+		{failures: 0, calls: 1},
+		{failures: 2, calls: 3},
+		{failures: 3, calls: 3, fails: true},
+	} {
+		flaky := &flakyDriver{StorageDriver: inmemory.New(), failures: tc.failures}
+		if err := flaky.PutContent(ctx, "/a", []byte("content")); err != nil {
+			t.Fatal(err)
+		}
+
+		content, err := NewRetryDriver(flaky, options).GetContent(ctx, "/a")
+		if tc.fails {
+			if err == nil {
+				t.Fatalf("expected error after %d failures", tc.failures)
+			}
+		} else if err != nil || string(content) != "content" {
+			t.Fatalf("unexpected result after %d failures: %q, %v", tc.failures, content, err)
+		}
+		if flaky.calls != tc.calls {
+			t.Fatalf("expected %d calls after %d failures, got %d", tc.calls, tc.failures, flaky.calls)
+		}
+	}
+
+	// errors that aren't transient are returned at once
+	flaky := &flakyDriver{StorageDriver: inmemory.New()}
+	if _, err := NewRetryDriver(flaky, options).GetContent(ctx, "/missing"); err == nil {
+		t.Fatal("expected error getting missing content")
+	} else if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if flaky.calls != 1 {
+		t.Fatalf("expected a single call for a missing path, got %d", flaky.calls)
+	}
+
+	// the predicate can be overridden
+	flaky = &flakyDriver{StorageDriver: inmemory.New(), failures: 1}
+	never := options
+	never.Retryable = func(error) bool { return false }
+	if _, err := NewRetryDriver(flaky, never).GetContent(ctx, "/a"); err == nil || flaky.calls != 1 {
+		t.Fatalf("expected a single failed call, got %d calls: %v", flaky.calls, err)
+	}
+}
+
+func TestRetryDriverMove(t *testing.T) {
+	ctx := context.Background()
+	options := RetryDriverOptions{InitialBackoff: time.Millisecond}
+
+	// a move reported as failed after it went through is not repeated
+	flaky := &flakyDriver{StorageDriver: inmemory.New(), failures: 1, moveFirst: true}
+	if err := flaky.PutContent(ctx, "/src", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewRetryDriver(flaky, options).Move(ctx, "/src", "/dst"); err != nil {
+		t.Fatalf("unexpected error moving: %v", err)
+	}
+	if flaky.calls != 1 {
+		t.Fatalf("expected the move not to be repeated, got %d calls", flaky.calls)
+	}
+	if content, err := flaky.GetContent(ctx, "/dst"); err != nil || string(content) != "content" {
+		t.Fatalf("unexpected moved content: %q, %v", content, err)
+	}
+
+	// a move failed before anything happened is repeated
+	flaky = &flakyDriver{StorageDriver: inmemory.New(), failures: 1}
+	if err := flaky.PutContent(ctx, "/src", []byte("content")); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewRetryDriver(flaky, options).Move(ctx, "/src", "/dst"); err != nil {
+		t.Fatalf("unexpected error moving: %v", err)
+	}
+	if flaky.calls != 2 {
+		t.Fatalf("expected the move to be repeated, got %d calls", flaky.calls)
+	}
+}
+
+func TestIsTransientDriverError(t *testing.T) {
+	for _, tc := range []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{errors.New("unknown"), false},
+		{storagedriver.PathNotFoundError{Path: "/a"}, false},
+		{codedError("SlowDown"), true},
+		{codedError("AccessDenied"), false},
+		{storagedriver.Error{DriverName: "s3aws", Enclosed: codedError("ServiceUnavailable")}, true},
+	} {
+		if transient := IsTransientDriverError(tc.err); transient != tc.transient {
+			t.Errorf("%v: expected transient %v, got %v", tc.err, tc.transient, transient)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package storage
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution"
+	dcontext "github.com/docker/distribution/context"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// WithSchema1Conversion is a ManifestServiceOption for Get asking for a
+// stored schema1 manifest to be returned converted to schema2. It has no
+// effect unless the registry was created with EnableSchema1Conversion.
+func WithSchema1Conversion() distribution.ManifestServiceOption {
+	return schema1ConversionOption{}
+}
+
+type schema1ConversionOption struct{}
+
+// Apply conforms to the ManifestServiceOption interface
+func (schema1ConversionOption) Apply(distribution.ManifestService) error {
+	// no implementation
+	return nil
+}
+
+// schema1ConversionRequested reports whether options include
+// WithSchema1Conversion.
+func schema1ConversionRequested(options []distribution.ManifestServiceOption) bool {
+	for _, option := range options {
+		if _, ok := option.(schema1ConversionOption); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// convertSchema1 returns the schema2 manifest equivalent to the schema1
+// manifest revision dgst. The converted manifest and its configuration are
+// stored in the repository like a pushed image, so they can be fetched by
+// digest, and the conversion is remembered next to the schema1 revision.
+func (ms *manifestStore) convertSchema1(ctx context.Context, dgst digest.Digest, sm *schema1.SignedManifest) (distribution.Manifest, error) {
+	cachePath, err := pathFor(manifestConversionPathSpec{name: ms.repository.Named().Name(), revision: dgst})
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ms.repository.driver.GetContent(ctx, cachePath)
+	if err == nil {
+		if converted, err := digest.Parse(strings.TrimSpace(string(content))); err == nil {
+			// the converted revision may have been garbage collected since
+			if content, err := ms.blobStore.Get(ctx, converted); err == nil {
+				return ms.unmarshal(ctx, converted, content)
+			}
+		}
+	} else if _, ok := err.(driver.PathNotFoundError); !ok {
+		return nil, err
+	}
+
+	m, err := convertSchema1Manifest(ctx, ms.repository.Blobs(ctx), sm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert schema1 manifest %s: %v", dgst, err)
+	}
+
+	converted, err := ms.schema2Handler.Put(ctx, m, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ms.repository.driver.PutContent(ctx, cachePath, []byte(converted)); err != nil {
+		dcontext.GetLogger(ctx).Errorf("error caching schema2 conversion of %s: %v", dgst, err)
+	}
+
+	return m, nil
+}
+
+// convertSchema1Manifest builds a schema2 manifest from the layers and
+// history of sm. The image configuration is made from the topmost v1
+// compatibility entry, with the diffIDs computed from the layer content, and
+// is put into blobs.
+func convertSchema1Manifest(ctx context.Context, blobs distribution.BlobStore, sm *schema1.SignedManifest) (*schema2.DeserializedManifest, error) {
+	type v1Compatibility struct {
+		Created         time.Time `json:"created"`
+		Author          string    `json:"author,omitempty"`
+		Comment         string    `json:"comment,omitempty"`
+		ContainerConfig struct {
+			Cmd []string
+		} `json:"container_config,omitempty"`
+		ThrowAway bool `json:"throwaway,omitempty"`
+	}
+
+	type imageRootFS struct {
+		Type    string          `json:"type"`
+		DiffIDs []digest.Digest `json:"diff_ids"`
+	}
+
+	type imageHistory struct {
+		Created    time.Time `json:"created"`
+		Author     string    `json:"author,omitempty"`
+		CreatedBy  string    `json:"created_by,omitempty"`
+		Comment    string    `json:"comment,omitempty"`
+		EmptyLayer bool      `json:"empty_layer,omitempty"`
+	}
+
+	if len(sm.History) == 0 || len(sm.History) != len(sm.FSLayers) {
+		return nil, fmt.Errorf("%d history entries for %d layers", len(sm.History), len(sm.FSLayers))
+	}
+
+	rootFS := imageRootFS{Type: "layers"}
+	var history []imageHistory
+	var layers []distribution.Descriptor
+
+	// schema1 lists the topmost layer first
+	for i := len(sm.History) - 1; i >= 0; i-- {
+		var v1 v1Compatibility
+		if err := json.Unmarshal([]byte(sm.History[i].V1Compatibility), &v1); err != nil {
+			return nil, fmt.Errorf("failed to parse v1 compatibility entry %d: %v", i, err)
+		}
+
+		history = append(history, imageHistory{
+			Created:    v1.Created,
+			Author:     v1.Author,
+			CreatedBy:  strings.Join(v1.ContainerConfig.Cmd, " "),
+			Comment:    v1.Comment,
+			EmptyLayer: v1.ThrowAway,
+		})
+		if v1.ThrowAway {
+			continue
+		}
+
+		desc, err := blobs.Stat(ctx, sm.FSLayers[i].BlobSum)
+		if err != nil {
+			return nil, err
+		}
+		diffID, err := layerDiffID(ctx, blobs, desc.Digest)
+		if err != nil {
+			return nil, err
+		}
+
+		rootFS.DiffIDs = append(rootFS.DiffIDs, diffID)
+		layers = append(layers, distribution.Descriptor{
+			MediaType: schema2.MediaTypeLayer,
+			Size:      desc.Size,
+			Digest:    desc.Digest,
+		})
+	}
+
+	var config map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(sm.History[0].V1Compatibility), &config); err != nil {
+		return nil, fmt.Errorf("failed to parse image configuration: %v", err)
+	}
+
+	// drop the fields that only exist in v1 compatibility entries
+	for _, field := range []string{"id", "parent", "parent_id", "layer_id", "throwaway", "Size"} {
+		delete(config, field)
+	}
+	for field, value := range map[string]interface{}{"rootfs": rootFS, "history": history} {
+		p, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		config[field] = p
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	configDesc, err := blobs.Put(ctx, schema2.MediaTypeImageConfig, configJSON)
+	if err != nil {
+		return nil, err
+	}
+	configDesc.MediaType = schema2.MediaTypeImageConfig
+
+	return schema2.FromStruct(schema2.Manifest{
+		Versioned: schema2.SchemaVersion,
+		Config:    configDesc,
+		Layers:    layers,
+	})
+}
+
+// layerDiffID returns the digest of the uncompressed content of the layer
+// dgst.
+func layerDiffID(ctx context.Context, blobs distribution.BlobProvider, dgst digest.Digest) (digest.Digest, error) {
+	rc, err := blobs.Open(ctx, dgst)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	br := bufio.NewReader(rc)
+	var r io.Reader = br
+	if magic, err := br.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return "", err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	digester := digest.Canonical.Digester()
+	if _, err := io.Copy(digester.Hash(), r); err != nil {
+		return "", err
+	}
+	return digester.Digest(), nil
+}
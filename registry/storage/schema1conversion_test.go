@@ -0,0 +1,175 @@
+package storage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/manifest/schema1"
+	"github.com/docker/distribution/manifest/schema2"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/libtrust"
+	"github.com/opencontainers/go-digest"
+)
+
+func gzipped(t *testing.T, p []byte) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(p); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestSchema1Conversion(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+	repo := makeRepository(t, createRegistry(t, d), "test")
+	blobs := repo.Blobs(ctx)
+
+	base, err := blobs.Put(ctx, schema2.MediaTypeLayer, gzipped(t, []byte("base layer")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err := blobs.Put(ctx, schema2.MediaTypeLayer, gzipped(t, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, err := blobs.Put(ctx, schema2.MediaTypeLayer, []byte("uncompressed layer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pk, err := libtrust.GenerateECP256PrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sm, err := schema1.Sign(&schema1.Manifest{
+		Versioned: manifest.Versioned{
+			SchemaVersion: 1,
+		},
+		Name:         "test",
+		Tag:          "latest",
+		Architecture: "amd64",
+		FSLayers: []schema1.FSLayer{
+			{BlobSum: top.Digest},
+			{BlobSum: empty.Digest},
+			{BlobSum: base.Digest},
+		},
+		History: []schema1.History{
+			{V1Compatibility: `{"id":"3","parent":"2","created":"2018-01-03T00:00:00Z","architecture":"amd64","os":"linux","config":{"Cmd":["/bin/sh"]},"container_config":{"Cmd":["/bin/sh","-c","#(nop) ADD file"]}}`},
+			{V1Compatibility: `{"id":"2","parent":"1","created":"2018-01-02T00:00:00Z","container_config":{"Cmd":["/bin/sh","-c","#(nop) ENV A=b"]},"throwaway":true}`},
+			{V1Compatibility: `{"id":"1","created":"2018-01-01T00:00:00Z","container_config":{"Cmd":["/bin/sh","-c","#(nop) ADD base"]}}`},
+		},
+	}, pk)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ms := makeManifestService(t, repo)
+	dgst, err := ms.Put(ctx, sm)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// conversion is only done when requested
+	m, err := ms.Get(ctx, dgst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.(*schema1.SignedManifest); !ok {
+		t.Fatalf("expected schema1 manifest without conversion, got %T", m)
+	}
+	m, err = ms.Get(ctx, dgst, WithSchema1Conversion())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.(*schema1.SignedManifest); !ok {
+		t.Fatalf("expected schema1 manifest with conversion disabled, got %T", m)
+	}
+
+	converting := makeManifestService(t, makeRepository(t, createRegistry(t, d, EnableSchema1Conversion, RejectSchema1OnPull), "test"))
+	if _, err := converting.Get(ctx, dgst); err != distribution.ErrSchemaV1Rejected {
+		t.Fatalf("expected ErrSchemaV1Rejected without conversion, got %v", err)
+	}
+	m, err = converting.Get(ctx, dgst, WithSchema1Conversion())
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted, ok := m.(*schema2.DeserializedManifest)
+	if !ok {
+		t.Fatalf("expected converted schema2 manifest, got %T", m)
+	}
+
+	if len(converted.Layers) != 2 || converted.Layers[0].Digest != base.Digest || converted.Layers[1].Digest != top.Digest {
+		t.Fatalf("unexpected converted layers: %v", converted.Layers)
+	}
+	for _, layer := range converted.Layers {
+		if layer.MediaType != schema2.MediaTypeLayer || layer.Size == 0 {
+			t.Fatalf("unexpected converted layer: %v", layer)
+		}
+	}
+
+	content, err := blobs.Get(ctx, converted.Config.Digest)
+	if err != nil {
+		t.Fatalf("expected converted configuration in repository: %v", err)
+	}
+	var config struct {
+		ID           string `json:"id"`
+		Architecture string `json:"architecture"`
+		RootFS       struct {
+			DiffIDs []digest.Digest `json:"diff_ids"`
+		} `json:"rootfs"`
+		History []struct {
+			CreatedBy  string `json:"created_by"`
+			EmptyLayer bool   `json:"empty_layer"`
+		} `json:"history"`
+	}
+	if err := json.Unmarshal(content, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.ID != "" || config.Architecture != "amd64" {
+		t.Fatalf("unexpected converted configuration: %s", content)
+	}
+	expectedDiffIDs := []digest.Digest{digest.FromString("base layer"), digest.FromString("uncompressed layer")}
+	if len(config.RootFS.DiffIDs) != 2 || config.RootFS.DiffIDs[0] != expectedDiffIDs[0] || config.RootFS.DiffIDs[1] != expectedDiffIDs[1] {
+		t.Fatalf("unexpected diffIDs %v, expected %v", config.RootFS.DiffIDs, expectedDiffIDs)
+	}
+	if len(config.History) != 3 || config.History[0].CreatedBy != "/bin/sh -c #(nop) ADD base" || !config.History[1].EmptyLayer || config.History[2].EmptyLayer {
+		t.Fatalf("unexpected converted history: %+v", config.History)
+	}
+
+	// the converted manifest is stored and reused
+	_, payload, err := converted.Payload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	convertedDigest := digest.FromBytes(payload)
+	if exists, err := converting.Exists(ctx, convertedDigest); err != nil || !exists {
+		t.Fatalf("expected converted manifest to be stored: %v, %v", exists, err)
+	}
+
+	cachePath, err := pathFor(manifestConversionPathSpec{name: "test", revision: dgst})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached, err := d.GetContent(ctx, cachePath)
+	if err != nil || digest.Digest(cached) != convertedDigest {
+		t.Fatalf("unexpected cached conversion %q: %v", cached, err)
+	}
+
+	m, err = converting.Get(ctx, dgst, WithSchema1Conversion())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, again, _ := m.Payload(); !bytes.Equal(again, payload) {
+		t.Fatalf("expected the cached conversion to be returned")
+	}
+}
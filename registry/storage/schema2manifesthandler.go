@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
@@ -24,6 +25,10 @@ type schema2ManifestHandler struct {
 	blobStore    distribution.BlobStore
 	ctx          context.Context
 	manifestURLs manifestURLs
+
+	// maxReferences, if not zero, limits the number of blobs a manifest
+	// may reference.
+	maxReferences int
 }
 
 var _ ManifestHandler = &schema2ManifestHandler{}
@@ -75,9 +80,15 @@ func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst sche
 		return fmt.Errorf("unrecognized manifest schema version %d", mnfst.Manifest.SchemaVersion)
 	}
 
+	if count := len(mnfst.References()); ms.maxReferences > 0 && count > ms.maxReferences {
+		errs = append(errs, distribution.ErrManifestTooManyReferences{Count: count, Limit: ms.maxReferences})
+		return errs
+	}
+
 	if skipDependencyVerification {
 		return nil
 	}
+	defer observeManifestVerification(ctx, "schema2", len(mnfst.References()), time.Now())
 
 	manifestService, err := ms.repository.Manifests(ctx)
 	if err != nil {
@@ -96,8 +107,7 @@ func (ms *schema2ManifestHandler) verifyManifest(ctx context.Context, mnfst sche
 			if len(descriptor.URLs) == 0 {
 				err = errMissingURL
 			}
-			allow := ms.manifestURLs.allow
-			deny := ms.manifestURLs.deny
+			allow, deny := ms.manifestURLs.rulesFor(mnfst.Config.MediaType)
 			for _, u := range descriptor.URLs {
 				var pu *url.URL
 				pu, err = url.Parse(u)
@@ -7,8 +7,10 @@ import (
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/context"
 	"github.com/docker/distribution/manifest"
+	"github.com/docker/distribution/manifest/manifestlist"
 	"github.com/docker/distribution/manifest/schema2"
 	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestVerifyManifestForeignLayer(t *testing.T) {
@@ -134,3 +136,125 @@ func TestVerifyManifestForeignLayer(t *testing.T) {
 		}
 	}
 }
+
+func TestVerifyManifestMetrics(t *testing.T) {
+	verifications := func() uint64 {
+		families, err := prometheus.DefaultGatherer.Gather()
+		if err != nil {
+			t.Fatalf("failed to gather metrics: %v", err)
+		}
+		for _, family := range families {
+			if family.GetName() != "registry_storage_manifest_verify_duration_seconds" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "type" && label.GetValue() == "schema2" {
+						return metric.GetHistogram().GetSampleCount()
+					}
+				}
+			}
+		}
+		return 0
+	}
+
+	registry := createRegistry(t, inmemory.New())
+	repo := makeRepository(t, registry, "test")
+
+	before := verifications()
+	uploadRandomSchema2Image(t, repo)
+	if got := verifications() - before; got != 1 {
+		t.Fatalf("expected one recorded schema2 verification, got %d", got)
+	}
+}
+
+func TestVerifyManifestReferenceLimits(t *testing.T) {
+	ctx := context.Background()
+	registry := createRegistry(t, inmemory.New(),
+		MaxManifestReferences(2),
+		MaxManifestListEntries(1))
+	repo := makeRepository(t, registry, "test")
+	manifestService := makeManifestService(t, repo)
+
+	config, err := repo.Blobs(ctx).Put(ctx, schema2.MediaTypeImageConfig, []byte("{}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var layers []distribution.Descriptor
+	for _, content := range []string{"first", "second"} {
+		layer, err := repo.Blobs(ctx).Put(ctx, schema2.MediaTypeLayer, []byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		layers = append(layers, layer)
+	}
+
+	expectTooMany := func(err error, limit int) {
+		t.Helper()
+		verr, ok := err.(distribution.ErrManifestVerification)
+		if !ok || len(verr) != 1 {
+			t.Fatalf("expected verification error, got %v", err)
+		}
+		tooMany, ok := verr[0].(distribution.ErrManifestTooManyReferences)
+		if !ok {
+			t.Fatalf("unexpected error: %v", verr[0])
+		}
+		if tooMany.Limit != limit {
+			t.Fatalf("unexpected limit %d, expected %d", tooMany.Limit, limit)
+		}
+	}
+
+	var images []distribution.Descriptor
+	for i, c := range []struct {
+		Layers  []distribution.Descriptor
+		Allowed bool
+	}{
+		{layers[:1], true},
+		{layers[1:], true},
+		{layers, false},
+	} {
+		dm, err := schema2.FromStruct(schema2.Manifest{
+			Versioned: manifest.Versioned{
+				SchemaVersion: 2,
+				MediaType:     schema2.MediaTypeManifest,
+			},
+			Config: config,
+			Layers: c.Layers,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dgst, err := manifestService.Put(ctx, dm)
+		if !c.Allowed {
+			expectTooMany(err, 2)
+			continue
+		}
+		if err != nil {
+			t.Fatalf("case %d: unexpected error: %v", i, err)
+		}
+		images = append(images, distribution.Descriptor{
+			Digest:    dgst,
+			MediaType: schema2.MediaTypeManifest,
+		})
+	}
+
+	for i := range images {
+		var descriptors []manifestlist.ManifestDescriptor
+		for _, image := range images[:i+1] {
+			descriptors = append(descriptors, manifestlist.ManifestDescriptor{Descriptor: image})
+		}
+		ml, err := manifestlist.FromDescriptors(descriptors)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = manifestService.Put(ctx, ml)
+		if len(descriptors) > 1 {
+			expectTooMany(err, 1)
+		} else if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
@@ -16,10 +16,11 @@ import (
 // signedManifestHandler is a ManifestHandler that covers schema1 manifests. It
 // can unmarshal and put schema1 manifests that have been signed by libtrust.
 type signedManifestHandler struct {
-	repository        distribution.Repository
-	schema1SigningKey libtrust.PrivateKey
-	blobStore         distribution.BlobStore
-	ctx               context.Context
+	repository         distribution.Repository
+	schema1SigningKey  libtrust.PrivateKey
+	schema1TrustedKeys map[string]libtrust.PublicKey
+	blobStore          distribution.BlobStore
+	ctx                context.Context
 }
 
 var _ ManifestHandler = &signedManifestHandler{}
@@ -108,7 +109,11 @@ func (ms *signedManifestHandler) verifyManifest(ctx context.Context, mnfst schem
 			len(mnfst.History), len(mnfst.FSLayers)))
 	}
 
-	if _, err := schema1.Verify(&mnfst); err != nil {
+	if keys, err := schema1.Verify(&mnfst); err == nil {
+		if !ms.signedByTrustedKey(keys) {
+			errs = append(errs, distribution.ErrManifestUnverified{})
+		}
+	} else {
 		switch err {
 		case libtrust.ErrMissingSignatureKey, libtrust.ErrInvalidJSONContent, libtrust.ErrMissingSignatureKey:
 			errs = append(errs, distribution.ErrManifestUnverified{})
@@ -140,3 +145,18 @@ func (ms *signedManifestHandler) verifyManifest(ctx context.Context, mnfst schem
 
 	return nil
 }
+
+// signedByTrustedKey reports whether one of the keys which signed a
+// manifest is trusted. Every key is trusted unless trusted keys are
+// configured.
+func (ms *signedManifestHandler) signedByTrustedKey(keys []libtrust.PublicKey) bool {
+	if ms.schema1TrustedKeys == nil {
+		return true
+	}
+	for _, key := range keys {
+		if _, ok := ms.schema1TrustedKeys[key.KeyID()]; ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,210 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"sort"
+	"strings"
+
+	storagedriver "github.com/docker/distribution/registry/storage/driver"
+)
+
+// newStagingDriver returns a driver keeping the working data of uploads in
+// progress, everything under the _uploads directories of repositories, on
+// staging and everything else on main. Moving a committed upload into the
+// blob store copies it from staging to main.
+func newStagingDriver(main, staging storagedriver.StorageDriver) storagedriver.StorageDriver {
+	return &stagingDriver{
+		main:    main,
+		staging: staging,
+	}
+}
+
+type stagingDriver struct {
+	main    storagedriver.StorageDriver
+	staging storagedriver.StorageDriver
+}
+
+var _ storagedriver.StorageDriver = &stagingDriver{}
+
+// isStaged reports whether path is kept on the staging driver. Repository
+// names can't have components starting with an underscore, so an _uploads
+// component always belongs to the layout.
+func isStaged(path string) bool {
+	return strings.Contains(path+"/", "/_uploads/")
+}
+
+// isMainOnly reports whether no path under path is kept on the staging
+// driver.
+func isMainOnly(path string) bool {
+	return !isStaged(path) && (strings.Contains(path, "/_") || strings.Contains(path+"/", "/docker/registry/v2/blobs/"))
+}
+
+func (d *stagingDriver) driverFor(path string) storagedriver.StorageDriver {
+	if isStaged(path) {
+		return d.staging
+	}
+	return d.main
+}
+
+// Name returns the human-readable "name" of the driver.
+func (d *stagingDriver) Name() string {
+	return "staging(" + d.main.Name() + ", " + d.staging.Name() + ")"
+}
+
+// GetContent retrieves the content stored at "path" as a []byte.
+func (d *stagingDriver) GetContent(ctx context.Context, path string) ([]byte, error) {
+	return d.driverFor(path).GetContent(ctx, path)
+}
+
+// PutContent stores the []byte content at a location designated by "path".
+func (d *stagingDriver) PutContent(ctx context.Context, path string, content []byte) error {
+	return d.driverFor(path).PutContent(ctx, path, content)
+}
+
+// Reader retrieves an io.ReadCloser for the content stored at "path"
+// with a given byte offset.
+func (d *stagingDriver) Reader(ctx context.Context, path string, offset int64) (io.ReadCloser, error) {
+	return d.driverFor(path).Reader(ctx, path, offset)
+}
+
+// Writer returns a FileWriter which will store the content written to it
+// at the location designated by "path" after the call to Commit.
+func (d *stagingDriver) Writer(ctx context.Context, path string, append bool) (storagedriver.FileWriter, error) {
+	return d.driverFor(path).Writer(ctx, path, append)
+}
+
+// Stat retrieves the FileInfo for the given path. A directory holding
+// uploads may only exist on the staging driver.
+func (d *stagingDriver) Stat(ctx context.Context, path string) (storagedriver.FileInfo, error) {
+	if isStaged(path) {
+		return d.staging.Stat(ctx, path)
+	}
+	fi, err := d.main.Stat(ctx, path)
+	if isPathNotFound(err) && !isMainOnly(path) {
+		return d.staging.Stat(ctx, path)
+	}
+	return fi, err
+}
+
+// List returns the objects that are direct descendants of the given path,
+// merging those of both drivers where uploads may be found.
+func (d *stagingDriver) List(ctx context.Context, path string) ([]string, error) {
+	if isStaged(path) {
+		return d.staging.List(ctx, path)
+	}
+
+	main, mainErr := d.main.List(ctx, path)
+	if isMainOnly(path) || (mainErr != nil && !isPathNotFound(mainErr)) {
+		return main, mainErr
+	}
+
+	staged, err := d.staging.List(ctx, path)
+	if err != nil {
+		if isPathNotFound(err) && mainErr == nil {
+			return main, nil
+		}
+		if mainErr == nil {
+			return nil, err
+		}
+		return nil, mainErr
+	}
+
+	seen := make(map[string]struct{}, len(main))
+	children := make([]string, 0, len(main)+len(staged))
+	for _, child := range append(main, staged...) {
+		if _, ok := seen[child]; ok {
+			continue
+		}
+		seen[child] = struct{}{}
+		children = append(children, child)
+	}
+	sort.Strings(children)
+
+	return children, nil
+}
+
+// Move moves an object stored at sourcePath to destPath. An upload moved
+// out of staging is copied to the main driver and then deleted.
+func (d *stagingDriver) Move(ctx context.Context, sourcePath string, destPath string) error {
+	source, dest := d.driverFor(sourcePath), d.driverFor(destPath)
+	if source == dest {
+		return source.Move(ctx, sourcePath, destPath)
+	}
+
+	if err := copyContent(ctx, source, sourcePath, dest, destPath); err != nil {
+		return err
+	}
+	return source.Delete(ctx, sourcePath)
+}
+
+// copyContent copies the object stored at sourcePath on source to destPath
+// on dest.
+func copyContent(ctx context.Context, source storagedriver.StorageDriver, sourcePath string, dest storagedriver.StorageDriver, destPath string) error {
+	rc, err := source.Reader(ctx, sourcePath, 0)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	fw, err := dest.Writer(ctx, destPath, false)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fw, rc); err != nil {
+		fw.Cancel()
+		return err
+	}
+	if err := fw.Commit(); err != nil {
+		fw.Cancel()
+		return err
+	}
+	return fw.Close()
+}
+
+// Delete recursively deletes all objects stored at "path" and its subpaths,
+// on both drivers where uploads may be found. The delete succeeds if the
+// path was found on either of them.
+func (d *stagingDriver) Delete(ctx context.Context, path string) error {
+	if isStaged(path) {
+		return d.staging.Delete(ctx, path)
+	}
+
+	mainErr := d.main.Delete(ctx, path)
+	if isMainOnly(path) || (mainErr != nil && !isPathNotFound(mainErr)) {
+		return mainErr
+	}
+
+	err := d.staging.Delete(ctx, path)
+	if mainErr == nil && isPathNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// URLFor returns a URL for the content stored at the given path.
+func (d *stagingDriver) URLFor(ctx context.Context, path string, options map[string]interface{}) (string, error) {
+	return d.driverFor(path).URLFor(ctx, path, options)
+}
+
+// Capabilities reports that URLs are made like main makes them. Moves may
+// copy content between the drivers, so they are not server-side.
+func (d *stagingDriver) Capabilities() storagedriver.Capabilities {
+	main, staging := d.main.Capabilities(), d.staging.Capabilities()
+	return storagedriver.Capabilities{
+		URLFor:            main.URLFor,
+		ListWithDelimiter: main.ListWithDelimiter && staging.ListWithDelimiter,
+	}
+}
+
+// Walk traverses a filesystem defined within driver, starting from the given
+// path, natively on a single driver unless both may hold objects under it.
+func (d *stagingDriver) Walk(ctx context.Context, path string, f storagedriver.WalkFn) error {
+	if isStaged(path) {
+		return d.staging.Walk(ctx, path, f)
+	}
+	if isMainOnly(path) {
+		return d.main.Walk(ctx, path, f)
+	}
+	return storagedriver.WalkFallback(ctx, d, path, f)
+}
@@ -0,0 +1,142 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestUploadStagingDriver(t *testing.T) {
+	ctx := context.Background()
+	main, staging := inmemory.New(), inmemory.New()
+	reg := createRegistry(t, main, UploadStagingDriver(staging))
+	repository := makeRepository(t, reg, "foo/staged")
+	bs := repository.Blobs(ctx)
+
+	content := bytes.Repeat([]byte("staged upload "), 1000)
+	upload, err := bs.Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+	if _, err := upload.Write(content[:5000]); err != nil {
+		t.Fatalf("unexpected error writing upload: %v", err)
+	}
+	if err := upload.Close(); err != nil {
+		t.Fatalf("unexpected error closing upload: %v", err)
+	}
+
+	uploadsPath, err := pathFor(uploadDataPathSpec{name: "foo/staged", id: upload.ID()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := staging.Stat(ctx, uploadsPath); err != nil {
+		t.Fatalf("expected upload data on the staging driver: %v", err)
+	}
+	if _, err := main.Stat(ctx, uploadsPath); !isPathNotFound(err) {
+		t.Fatalf("expected no upload data on the main driver, got %v", err)
+	}
+
+	// uploads in progress are found through the directories of main
+	uploads, errs := PurgeUploads(ctx, reg.(*registry).driver, time.Now().Add(time.Hour), false)
+	if len(errs) != 0 || len(uploads) != 1 {
+		t.Fatalf("expected 1 upload to purge, got %v (errors %v)", uploads, errs)
+	}
+
+	upload, err = bs.Resume(ctx, upload.ID())
+	if err != nil {
+		t.Fatalf("unexpected error resuming upload: %v", err)
+	}
+	if _, err := upload.Write(content[5000:]); err != nil {
+		t.Fatalf("unexpected error writing upload: %v", err)
+	}
+	desc, err := upload.Commit(ctx, distribution.Descriptor{Digest: digest.FromBytes(content)})
+	if err != nil {
+		t.Fatalf("unexpected error committing upload: %v", err)
+	}
+
+	blobPath, err := pathFor(blobDataPathSpec{digest: desc.Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := main.GetContent(ctx, blobPath)
+	if err != nil {
+		t.Fatalf("expected blob on the main driver: %v", err)
+	}
+	if !bytes.Equal(p, content) {
+		t.Fatalf("unexpected blob content on the main driver")
+	}
+	if _, err := staging.Stat(ctx, blobPath); !isPathNotFound(err) {
+		t.Fatalf("expected no blob on the staging driver, got %v", err)
+	}
+	if _, err := staging.Stat(ctx, uploadsPath); !isPathNotFound(err) {
+		t.Fatalf("expected upload data removed from the staging driver, got %v", err)
+	}
+
+	rc, err := bs.Open(ctx, desc.Digest)
+	if err != nil {
+		t.Fatalf("unexpected error opening blob: %v", err)
+	}
+	defer rc.Close()
+	p, err = ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatalf("unexpected error reading blob: %v", err)
+	}
+	if !bytes.Equal(p, content) {
+		t.Fatalf("unexpected blob content")
+	}
+}
+
+func TestStagingDriverList(t *testing.T) {
+	ctx := context.Background()
+	main, staging := inmemory.New(), inmemory.New()
+	d := newStagingDriver(main, staging)
+
+	for _, path := range []string{
+		"/docker/registry/v2/repositories/foo/_layers/link",
+		"/docker/registry/v2/repositories/foo/_uploads/id/data",
+		"/docker/registry/v2/repositories/bar/_uploads/id/data",
+	} {
+		if err := d.PutContent(ctx, path, []byte("content")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, expected := range map[string][]string{
+		"/docker/registry/v2/repositories":     {"/docker/registry/v2/repositories/bar", "/docker/registry/v2/repositories/foo"},
+		"/docker/registry/v2/repositories/foo": {"/docker/registry/v2/repositories/foo/_layers", "/docker/registry/v2/repositories/foo/_uploads"},
+		"/docker/registry/v2/repositories/bar": {"/docker/registry/v2/repositories/bar/_uploads"},
+	} {
+		children, err := d.List(ctx, path)
+		if err != nil {
+			t.Fatalf("unexpected error listing %s: %v", path, err)
+		}
+		if len(children) != len(expected) {
+			t.Fatalf("unexpected children of %s: %v != %v", path, children, expected)
+		}
+		for i := range children {
+			if children[i] != expected[i] {
+				t.Fatalf("unexpected children of %s: %v != %v", path, children, expected)
+			}
+		}
+	}
+
+	// deleting a repository removes its uploads
+	if err := d.Delete(ctx, "/docker/registry/v2/repositories/foo"); err != nil {
+		t.Fatalf("unexpected error deleting repository: %v", err)
+	}
+	if _, err := staging.Stat(ctx, "/docker/registry/v2/repositories/foo/_uploads/id/data"); !isPathNotFound(err) {
+		t.Fatalf("expected staged upload deleted, got %v", err)
+	}
+	if err := d.Delete(ctx, "/docker/registry/v2/repositories/bar"); err != nil {
+		t.Fatalf("unexpected error deleting repository only on staging: %v", err)
+	}
+	if _, err := d.List(ctx, "/docker/registry/v2/repositories/bar"); !isPathNotFound(err) {
+		t.Fatalf("expected PathNotFoundError listing deleted repository, got %v", err)
+	}
+}
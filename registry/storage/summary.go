@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/manifest/manifestlist"
+	"github.com/opencontainers/go-digest"
+)
+
+// Summary describes the content a repository's tags refer to. Its digest
+// is that of the JSON encoding of Tags, so it only changes when a tag, its
+// manifest, or the content that manifest references does.
+type Summary struct {
+	Digest digest.Digest `json:"digest"`
+	Tags   []TagSummary  `json:"tags"`
+}
+
+// TagSummary describes the manifest of a tag and the digests it
+// references, including those referenced by the manifests of an index.
+type TagSummary struct {
+	Tag        string          `json:"tag"`
+	Manifest   digest.Digest   `json:"manifest"`
+	References []digest.Digest `json:"references"`
+}
+
+// RepositorySummary summarizes the tags of repository, sorted by name, with
+// the sorted digests their manifests reference. Manifests which are missing
+// contribute no references.
+func RepositorySummary(ctx context.Context, repository distribution.Repository) (Summary, error) {
+	summary := Summary{Tags: []TagSummary{}}
+
+	tagService := repository.Tags(ctx)
+	tags, err := tagService.All(ctx)
+	switch err.(type) {
+	case distribution.ErrRepositoryUnknown:
+		// a repository without tags summarizes to an empty list
+	case nil:
+	default:
+		return summary, err
+	}
+	sort.Strings(tags)
+
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return summary, err
+	}
+
+	for _, tag := range tags {
+		desc, err := tagService.Get(ctx, tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				continue
+			}
+			return summary, err
+		}
+
+		references := make(map[digest.Digest]struct{})
+		if err := summarizeReferences(ctx, manifestService, desc.Digest, references); err != nil {
+			return summary, err
+		}
+
+		tagSummary := TagSummary{
+			Tag:        tag,
+			Manifest:   desc.Digest,
+			References: make([]digest.Digest, 0, len(references)),
+		}
+		for dgst := range references {
+			tagSummary.References = append(tagSummary.References, dgst)
+		}
+		sort.Slice(tagSummary.References, func(i, j int) bool {
+			return tagSummary.References[i] < tagSummary.References[j]
+		})
+		summary.Tags = append(summary.Tags, tagSummary)
+	}
+
+	content, err := json.Marshal(summary.Tags)
+	if err != nil {
+		return summary, err
+	}
+	summary.Digest = digest.FromBytes(content)
+	return summary, nil
+}
+
+// summarizeReferences adds the digests referenced by the manifest dgst, and
+// by any manifests it references, to references.
+func summarizeReferences(ctx context.Context, manifestService distribution.ManifestService, dgst digest.Digest, references map[digest.Digest]struct{}) error {
+	manifest, err := manifestService.Get(ctx, dgst)
+	if err != nil {
+		if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+			return nil
+		}
+		return err
+	}
+
+	// the references of an index are manifests themselves
+	_, isIndex := manifest.(*manifestlist.DeserializedManifestList)
+	for _, desc := range manifest.References() {
+		if _, ok := references[desc.Digest]; ok {
+			continue
+		}
+		references[desc.Digest] = struct{}{}
+
+		if isIndex {
+			if err := summarizeReferences(ctx, manifestService, desc.Digest, references); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
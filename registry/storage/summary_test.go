@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestRepositorySummary(t *testing.T) {
+	ctx := context.Background()
+	reg := createRegistry(t, inmemory.New())
+	repo := makeRepository(t, reg, "summary")
+
+	empty, err := RepositorySummary(ctx, repo)
+	if err != nil {
+		t.Fatalf("unexpected error summarizing empty repository: %v", err)
+	}
+	if len(empty.Tags) != 0 {
+		t.Fatalf("expected no tags in empty summary, got %v", empty.Tags)
+	}
+
+	image := uploadRandomSchema2Image(t, repo)
+	index, err := testutil.MakeManifestList(reg.BlobStatter(), []digest.Digest{image.manifestDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifests := makeManifestService(t, repo)
+	indexDigest, err := manifests.Put(ctx, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tag, dgst := range map[string]digest.Digest{"v1": image.manifestDigest, "multi": indexDigest} {
+		if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: dgst}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	summary, err := RepositorySummary(ctx, repo)
+	if err != nil {
+		t.Fatalf("unexpected error summarizing repository: %v", err)
+	}
+	if len(summary.Tags) != 2 || summary.Tags[0].Tag != "multi" || summary.Tags[1].Tag != "v1" {
+		t.Fatalf("expected tags multi and v1, got %v", summary.Tags)
+	}
+	// the index references the image, and through it the image's content
+	multi, v1 := summary.Tags[0], summary.Tags[1]
+	if multi.Manifest != indexDigest || len(multi.References) != len(v1.References)+1 {
+		t.Fatalf("expected the index to reference the image and its %d references, got %v", len(v1.References), multi.References)
+	}
+	for i := 1; i < len(multi.References); i++ {
+		if multi.References[i-1] >= multi.References[i] {
+			t.Fatalf("expected sorted references, got %v", multi.References)
+		}
+	}
+	if summary.Digest == empty.Digest {
+		t.Fatalf("expected the summary digest to change with the content")
+	}
+
+	again, err := RepositorySummary(ctx, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Digest != summary.Digest {
+		t.Fatalf("expected an unchanged repository to summarize to %v, got %v", summary.Digest, again.Digest)
+	}
+
+	if err := repo.Tags(ctx).Tag(ctx, "v1", distribution.Descriptor{Digest: indexDigest}); err != nil {
+		t.Fatal(err)
+	}
+	moved, err := RepositorySummary(ctx, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if moved.Digest == summary.Digest {
+		t.Fatalf("expected the summary digest to change when a tag moves")
+	}
+}
@@ -2,7 +2,11 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"path"
+	"regexp"
+	"sort"
+	"time"
 
 	"github.com/docker/distribution"
 	storagedriver "github.com/docker/distribution/registry/storage/driver"
@@ -11,6 +15,10 @@ import (
 
 var _ distribution.TagService = &tagStore{}
 
+// ErrTagAliasCycle is returned when following tag aliases leads back to a
+// tag already followed.
+var ErrTagAliasCycle = errors.New("tag aliases form a cycle")
+
 // tagStore provides methods to manage manifest tags in a backend storage driver.
 // This implementation uses the same on-disk layout as the (now deleted) tag
 // store.  This provides backward compatibility with current registry deployments
@@ -19,6 +27,7 @@ var _ distribution.TagService = &tagStore{}
 type tagStore struct {
 	repository *repository
 	blobStore  *blobStore
+	immutable  *regexp.Regexp // tags which can't be moved, if set
 }
 
 // All returns all tags
@@ -50,6 +59,76 @@ func (ts *tagStore) All(ctx context.Context) ([]string, error) {
 	return tags, nil
 }
 
+// TagInfo describes a tag and the manifest it currently points to.
+type TagInfo struct {
+	Name   string        `json:"name"`
+	Digest digest.Digest `json:"digest"`
+	// ModTime is the time the tag was last pointed at a manifest.
+	ModTime time.Time `json:"modified"`
+}
+
+// AllWithMetadata returns all tags with the digest they point to and the
+// modification time of their current link, or of their alias, sorted by tag
+// name.
+func (ts *tagStore) AllWithMetadata(ctx context.Context) ([]TagInfo, error) {
+	tags, err := ts.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(tags)
+
+	infos := make([]TagInfo, 0, len(tags))
+	for _, tag := range tags {
+		currentPath, err := pathFor(manifestTagCurrentPathSpec{
+			name: ts.repository.Named().Name(),
+			tag:  tag,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		aliasPath, err := pathFor(manifestTagAliasPathSpec{
+			name: ts.repository.Named().Name(),
+			tag:  tag,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		fi, err := ts.blobStore.driver.Stat(ctx, currentPath)
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			fi, err = ts.blobStore.driver.Stat(ctx, aliasPath)
+		}
+		if err != nil {
+			switch err.(type) {
+			case storagedriver.PathNotFoundError:
+				continue
+			}
+			return nil, err
+		}
+
+		revision, err := ts.resolve(ctx, tag, nil)
+		if err != nil {
+			switch err.(type) {
+			case storagedriver.PathNotFoundError:
+				continue
+			}
+			if err == ErrTagAliasCycle {
+				continue
+			}
+			return nil, err
+		}
+
+		infos = append(infos, TagInfo{
+			Name:    tag,
+			Digest:  revision,
+			ModTime: fi.ModTime(),
+		})
+	}
+
+	return infos, nil
+}
+
 // Tag tags the digest with the given tag, updating the the store to point at
 // the current tag. The digest must point to a manifest.
 func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descriptor) error {
@@ -62,6 +141,33 @@ func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descr
 		return err
 	}
 
+	if ts.immutable != nil && ts.immutable.MatchString(tag) {
+		current, err := ts.blobStore.readlink(ctx, currentPath)
+		switch err.(type) {
+		case nil:
+			if current != desc.Digest {
+				return distribution.ErrTagImmutable{Tag: tag, Digest: current}
+			}
+		case storagedriver.PathNotFoundError:
+			// an alias is an existing tag, which must keep resolving to the
+			// manifest it references
+			if _, err := ts.aliasTarget(ctx, tag); err == nil {
+				revision, err := ts.resolve(ctx, tag, nil)
+				if _, ok := err.(storagedriver.PathNotFoundError); err != nil && !ok {
+					return err
+				}
+				if revision != desc.Digest {
+					return distribution.ErrTagImmutable{Tag: tag, Digest: revision}
+				}
+			} else if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+				return err
+			}
+			// the first push of a tag is always allowed
+		default:
+			return err
+		}
+	}
+
 	lbs := ts.linkedBlobStore(ctx, tag)
 
 	// Link into the index
@@ -73,28 +179,120 @@ func (ts *tagStore) Tag(ctx context.Context, tag string, desc distribution.Descr
 	return ts.blobStore.link(ctx, currentPath, desc.Digest)
 }
 
-// resolve the current revision for name and tag.
+// resolve the current revision for name and tag, following aliases.
 func (ts *tagStore) Get(ctx context.Context, tag string) (distribution.Descriptor, error) {
-	currentPath, err := pathFor(manifestTagCurrentPathSpec{
+	revision, err := ts.resolve(ctx, tag, nil)
+	if err != nil {
+		switch err.(type) {
+		case storagedriver.PathNotFoundError:
+			return distribution.Descriptor{}, distribution.ErrTagUnknown{Tag: tag}
+		}
+
+		return distribution.Descriptor{}, err
+	}
+
+	return distribution.Descriptor{Digest: revision}, nil
+}
+
+// resolve reads the current revision of tag. A tag without one is followed
+// to the tag it is an alias of, if any.
+// Tags in followed, which is added to, are not followed again.
+func (ts *tagStore) resolve(ctx context.Context, tag string, followed map[string]struct{}) (digest.Digest, error) {
+	if followed == nil {
+		followed = make(map[string]struct{})
+	}
+	for {
+		if _, ok := followed[tag]; ok {
+			return "", ErrTagAliasCycle
+		}
+		followed[tag] = struct{}{}
+
+		currentPath, err := pathFor(manifestTagCurrentPathSpec{
+			name: ts.repository.Named().Name(),
+			tag:  tag,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		revision, err := ts.blobStore.readlink(ctx, currentPath)
+		if _, ok := err.(storagedriver.PathNotFoundError); !ok {
+			return revision, err
+		}
+
+		tag, err = ts.aliasTarget(ctx, tag)
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// aliasTarget returns the tag which tag is an alias of.
+func (ts *tagStore) aliasTarget(ctx context.Context, tag string) (string, error) {
+	aliasPath, err := pathFor(manifestTagAliasPathSpec{
 		name: ts.repository.Named().Name(),
 		tag:  tag,
 	})
+	if err != nil {
+		return "", err
+	}
 
+	target, err := ts.blobStore.driver.GetContent(ctx, aliasPath)
 	if err != nil {
-		return distribution.Descriptor{}, err
+		return "", err
 	}
+	return string(target), nil
+}
 
-	revision, err := ts.blobStore.readlink(ctx, currentPath)
+// SetAlias makes alias resolve to whatever target currently points to, so
+// that it follows target when it is moved. Pointing alias at a manifest
+// with Tag stops it being an alias. The target must resolve, and
+// ErrTagAliasCycle is returned if it is an alias of alias. Immutable tags
+// can't be aliases, since they would move along with their target.
+func (ts *tagStore) SetAlias(ctx context.Context, alias, target string) error {
+	// resolving target must not lead back to alias
+	if _, err := ts.resolve(ctx, target, map[string]struct{}{alias: {}}); err != nil {
+		if _, ok := err.(storagedriver.PathNotFoundError); ok {
+			return distribution.ErrTagUnknown{Tag: target}
+		}
+		return err
+	}
+
+	aliasPath, err := pathFor(manifestTagAliasPathSpec{
+		name: ts.repository.Named().Name(),
+		tag:  alias,
+	})
 	if err != nil {
+		return err
+	}
+	currentPath, err := pathFor(manifestTagCurrentPathSpec{
+		name: ts.repository.Named().Name(),
+		tag:  alias,
+	})
+	if err != nil {
+		return err
+	}
+
+	if ts.immutable != nil && ts.immutable.MatchString(alias) {
+		current, err := ts.blobStore.readlink(ctx, currentPath)
 		switch err.(type) {
-		case storagedriver.PathNotFoundError:
-			return distribution.Descriptor{}, distribution.ErrTagUnknown{Tag: tag}
+		case nil, storagedriver.PathNotFoundError:
+			return distribution.ErrTagImmutable{Tag: alias, Digest: current}
+		default:
+			return err
 		}
+	}
 
-		return distribution.Descriptor{}, err
+	if err := ts.blobStore.driver.PutContent(ctx, aliasPath, []byte(target)); err != nil {
+		return err
 	}
 
-	return distribution.Descriptor{Digest: revision}, nil
+	// the current revision takes precedence until it is removed
+	err = ts.blobStore.driver.Delete(ctx, currentPath)
+	if _, ok := err.(storagedriver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
 }
 
 // Untag removes the tag association
@@ -107,6 +305,10 @@ func (ts *tagStore) Untag(ctx context.Context, tag string) error {
 		return err
 	}
 
+	if err := ts.checkLastTag(ctx, []string{tag}); err != nil {
+		return err
+	}
+
 	if err := ts.blobStore.driver.Delete(ctx, tagPath); err != nil {
 		switch err.(type) {
 		case storagedriver.PathNotFoundError:
@@ -119,6 +321,50 @@ func (ts *tagStore) Untag(ctx context.Context, tag string) error {
 	return nil
 }
 
+type forceDeleteKey struct{}
+
+// WithForceDelete returns a context in which deletes are made even if they
+// leave the repository without tags, as protected by ProtectLastTag.
+func WithForceDelete(ctx context.Context) context.Context {
+	return context.WithValue(ctx, forceDeleteKey{}, true)
+}
+
+// checkLastTag returns distribution.ErrLastTagProtected if the registry
+// protects the last tag of repositories and removing tags would leave the
+// repository without any, unless the delete is forced.
+func (ts *tagStore) checkLastTag(ctx context.Context, tags []string) error {
+	if !ts.repository.protectLastTag || len(tags) == 0 {
+		return nil
+	}
+	if forced, _ := ctx.Value(forceDeleteKey{}).(bool); forced {
+		return nil
+	}
+
+	allTags, err := ts.All(ctx)
+	switch err.(type) {
+	case distribution.ErrRepositoryUnknown:
+		return nil
+	case nil:
+	default:
+		return err
+	}
+
+	removed := make(map[string]struct{}, len(tags))
+	for _, tag := range tags {
+		removed[tag] = struct{}{}
+	}
+	for _, tag := range allTags {
+		if _, ok := removed[tag]; !ok {
+			return nil
+		}
+	}
+	// an Untag of an unknown tag in an empty repository removes nothing
+	if len(allTags) == 0 {
+		return nil
+	}
+	return distribution.ErrLastTagProtected{Name: ts.repository.Named().Name(), Tags: allTags}
+}
+
 // linkedBlobStore returns the linkedBlobStore for the named tag, allowing one
 // to index manifest blobs by tag name. While the tag store doesn't map
 // precisely to the linked blob store, using this ensures the links are
@@ -142,6 +388,18 @@ func (ts *tagStore) linkedBlobStore(ctx context.Context, tag string) *linkedBlob
 // Lookup recovers a list of tags which refer to this digest.  When a manifest is deleted by
 // digest, tag entries which point to it need to be recovered to avoid dangling tags.
 func (ts *tagStore) Lookup(ctx context.Context, desc distribution.Descriptor) ([]string, error) {
+	tagsByDigest, err := ts.LookupAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return tagsByDigest[desc.Digest], nil
+}
+
+// LookupAll reads the current link of every tag once and returns the tags
+// grouped by the digest they refer to. Callers resolving the tags of many
+// digests should use it instead of repeated calls to Lookup.
+func (ts *tagStore) LookupAll(ctx context.Context) (map[digest.Digest][]string, error) {
 	allTags, err := ts.All(ctx)
 	switch err.(type) {
 	case distribution.ErrRepositoryUnknown:
@@ -153,27 +411,22 @@ func (ts *tagStore) Lookup(ctx context.Context, desc distribution.Descriptor) ([
 		return nil, err
 	}
 
-	var tags []string
+	tagsByDigest := make(map[digest.Digest][]string)
 	for _, tag := range allTags {
-		tagLinkPathSpec := manifestTagCurrentPathSpec{
-			name: ts.repository.Named().Name(),
-			tag:  tag,
-		}
-
-		tagLinkPath, _ := pathFor(tagLinkPathSpec)
-		tagDigest, err := ts.blobStore.readlink(ctx, tagLinkPath)
+		tagDigest, err := ts.resolve(ctx, tag, nil)
 		if err != nil {
 			switch err.(type) {
 			case storagedriver.PathNotFoundError:
 				continue
 			}
+			if err == ErrTagAliasCycle {
+				continue
+			}
 			return nil, err
 		}
 
-		if tagDigest == desc.Digest {
-			tags = append(tags, tag)
-		}
+		tagsByDigest[tagDigest] = append(tagsByDigest[tagDigest], tag)
 	}
 
-	return tags, nil
+	return tagsByDigest, nil
 }
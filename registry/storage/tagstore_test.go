@@ -2,22 +2,28 @@ package storage
 
 import (
 	"context"
+	"reflect"
+	"regexp"
+	"sort"
 	"testing"
+	"time"
 
 	"github.com/docker/distribution"
 	"github.com/docker/distribution/reference"
 	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
 )
 
 type tagsTestEnv struct {
-	ts  distribution.TagService
-	ctx context.Context
+	ts   distribution.TagService
+	repo distribution.Repository
+	ctx  context.Context
 }
 
-func testTagStore(t *testing.T) *tagsTestEnv {
+func testTagStore(t *testing.T, options ...RegistryOption) *tagsTestEnv {
 	ctx := context.Background()
 	d := inmemory.New()
-	reg, err := NewRegistry(ctx, d)
+	reg, err := NewRegistry(ctx, d, options...)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -29,8 +35,9 @@ func testTagStore(t *testing.T) *tagsTestEnv {
 	}
 
 	return &tagsTestEnv{
-		ctx: ctx,
-		ts:  repo.Tags(ctx),
+		ctx:  ctx,
+		ts:   repo.Tags(ctx),
+		repo: repo,
 	}
 }
 
@@ -77,6 +84,50 @@ func TestTagStoreTag(t *testing.T) {
 	}
 }
 
+func TestTagStoreImmutableTags(t *testing.T) {
+	ctx := context.Background()
+	reg, err := NewRegistry(ctx, inmemory.New(), ImmutableTagsRegexp(regexp.MustCompile(`^v[0-9]+$`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repoRef, _ := reference.WithName("a/b")
+	repo, err := reg.Repository(ctx, repoRef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tags := repo.Tags(ctx)
+
+	a := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	b := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+
+	// first push
+	if err := tags.Tag(ctx, "v1", a); err != nil {
+		t.Fatalf("unexpected error tagging an immutable tag the first time: %v", err)
+	}
+
+	// same digest re-push
+	if err := tags.Tag(ctx, "v1", a); err != nil {
+		t.Fatalf("unexpected error tagging an immutable tag with its digest again: %v", err)
+	}
+
+	// different digest overwrite
+	err = tags.Tag(ctx, "v1", b)
+	if immutableErr, ok := err.(distribution.ErrTagImmutable); !ok || immutableErr.Digest != a.Digest {
+		t.Fatalf("expected ErrTagImmutable referencing %v moving an immutable tag, got %v", a.Digest, err)
+	}
+	if desc, err := tags.Get(ctx, "v1"); err != nil || desc.Digest != a.Digest {
+		t.Fatalf("expected the immutable tag to still reference %v, got %v (%v)", a.Digest, desc.Digest, err)
+	}
+
+	// mutable tags can be overwritten
+	if err := tags.Tag(ctx, "latest", a); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.Tag(ctx, "latest", b); err != nil {
+		t.Fatalf("unexpected error moving a mutable tag: %v", err)
+	}
+}
+
 func TestTagStoreUnTag(t *testing.T) {
 	env := testTagStore(t)
 	tags := env.ts
@@ -105,6 +156,47 @@ func TestTagStoreUnTag(t *testing.T) {
 	}
 }
 
+func TestTagStoreProtectLastTag(t *testing.T) {
+	env := testTagStore(t, EnableDelete, ProtectLastTag)
+	tags := env.ts
+	ctx := env.ctx
+
+	d := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	for _, tag := range []string{"latest", "v1"} {
+		if err := tags.Tag(ctx, tag, d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tags.Untag(ctx, "v1"); err != nil {
+		t.Fatalf("unexpected error deleting a tag which is not the last: %v", err)
+	}
+
+	err := tags.Untag(ctx, "latest")
+	if _, ok := err.(distribution.ErrLastTagProtected); !ok {
+		t.Fatalf("expected ErrLastTagProtected deleting the last tag, got %v", err)
+	}
+	if _, err := tags.Get(ctx, "latest"); err != nil {
+		t.Fatalf("protected tag was deleted: %v", err)
+	}
+
+	manifests, err := env.repo.Manifests(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = manifests.Delete(ctx, d.Digest)
+	if _, ok := err.(distribution.ErrLastTagProtected); !ok {
+		t.Fatalf("expected ErrLastTagProtected deleting the last tagged manifest, got %v", err)
+	}
+
+	if err := tags.Untag(WithForceDelete(ctx), "latest"); err != nil {
+		t.Fatalf("unexpected error forcing the delete of the last tag: %v", err)
+	}
+	if _, err := tags.Get(ctx, "latest"); err == nil {
+		t.Fatalf("forced delete left the tag in place")
+	}
+}
+
 func TestTagStoreAll(t *testing.T) {
 	env := testTagStore(t)
 	tagStore := env.ts
@@ -207,3 +299,182 @@ func TestTagLookup(t *testing.T) {
 	}
 
 }
+
+func TestTagLookupAll(t *testing.T) {
+	env := testTagStore(t)
+	tagStore := env.ts.(*tagStore)
+	ctx := env.ctx
+
+	descA := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	desc0 := distribution.Descriptor{Digest: "sha256:0000000000000000000000000000000000000000000000000000000000000000"}
+
+	tagsByDigest, err := tagStore.LookupAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tagsByDigest) != 0 {
+		t.Fatalf("LookupAll returned tags from empty store: %v", tagsByDigest)
+	}
+
+	for tag, desc := range map[string]distribution.Descriptor{"a": descA, "b": descA, "0": desc0} {
+		if err := tagStore.Tag(ctx, tag, desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tagsByDigest, err = tagStore.LookupAll(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[digest.Digest][]string{
+		descA.Digest: {"a", "b"},
+		desc0.Digest: {"0"},
+	}
+	if !reflect.DeepEqual(tagsByDigest, expected) {
+		t.Fatalf("unexpected tags by digest: %v, expected %v", tagsByDigest, expected)
+	}
+}
+
+func TestTagStoreAllWithMetadata(t *testing.T) {
+	env := testTagStore(t)
+	tagStore := env.ts.(*tagStore)
+	ctx := env.ctx
+
+	descA := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	descB := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+
+	before := time.Now().Add(-time.Second)
+	for tag, desc := range map[string]distribution.Descriptor{"v2": descB, "latest": descB, "v1": descA} {
+		if err := tagStore.Tag(ctx, tag, desc); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	infos, err := tagStore.AllWithMetadata(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		name string
+		dgst digest.Digest
+	}{
+		{"latest", descB.Digest},
+		{"v1", descA.Digest},
+		{"v2", descB.Digest},
+	}
+	if len(infos) != len(expected) {
+		t.Fatalf("unexpected tag metadata: %v", infos)
+	}
+	for i, info := range infos {
+		if info.Name != expected[i].name || info.Digest != expected[i].dgst {
+			t.Errorf("unexpected tag metadata at %d: %+v", i, info)
+		}
+		if info.ModTime.Before(before) {
+			t.Errorf("unexpected modification time for %s: %v", info.Name, info.ModTime)
+		}
+	}
+}
+
+func TestTagStoreAlias(t *testing.T) {
+	env := testTagStore(t)
+	tags := env.ts.(*tagStore)
+	ctx := env.ctx
+
+	d1 := distribution.Descriptor{Digest: "sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"}
+	d2 := distribution.Descriptor{Digest: "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}
+	for _, tag := range []string{"v1", "stable"} {
+		if err := tags.Tag(ctx, tag, d1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tags.SetAlias(ctx, "stable", "v1"); err != nil {
+		t.Fatalf("unexpected error setting alias: %v", err)
+	}
+	if err := tags.SetAlias(ctx, "beta", "stable"); err != nil {
+		t.Fatalf("unexpected error setting alias of an alias: %v", err)
+	}
+
+	// the aliases follow the target when it moves
+	if err := tags.Tag(ctx, "v1", d2); err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"stable", "beta"} {
+		desc, err := tags.Get(ctx, tag)
+		if err != nil {
+			t.Fatalf("unexpected error getting alias %s: %v", tag, err)
+		}
+		if desc.Digest != d2.Digest {
+			t.Fatalf("expected alias %s to resolve to %v, got %v", tag, d2.Digest, desc.Digest)
+		}
+	}
+
+	found, err := tags.Lookup(ctx, d2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(found)
+	if !reflect.DeepEqual(found, []string{"beta", "stable", "v1"}) {
+		t.Fatalf("expected aliases in the lookup of their target, got %v", found)
+	}
+
+	for _, tc := range []struct {
+		alias, target string
+		err           error
+	}{
+		{"v1", "v1", ErrTagAliasCycle},
+		{"v1", "beta", ErrTagAliasCycle},
+		{"stable", "missing", distribution.ErrTagUnknown{Tag: "missing"}},
+	} {
+		if err := tags.SetAlias(ctx, tc.alias, tc.target); err != tc.err {
+			t.Errorf("aliasing %s to %s: expected %v, got %v", tc.alias, tc.target, tc.err, err)
+		}
+	}
+
+	// tagging a manifest replaces the alias
+	if err := tags.Tag(ctx, "stable", d1); err != nil {
+		t.Fatal(err)
+	}
+	desc, err := tags.Get(ctx, "beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc.Digest != d1.Digest {
+		t.Fatalf("expected beta to follow stable to %v, got %v", d1.Digest, desc.Digest)
+	}
+
+	// an alias of a removed tag is unknown
+	if err := tags.Untag(ctx, "stable"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tags.Get(ctx, "beta"); err != (distribution.ErrTagUnknown{Tag: "beta"}) {
+		t.Fatalf("expected dangling alias to be unknown, got %v", err)
+	}
+
+	// an immutable tag can't become an alias, which would move it
+	if err := tags.Tag(ctx, "v2", d1); err != nil {
+		t.Fatal(err)
+	}
+	if err := tags.SetAlias(ctx, "v3", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	tags.immutable = regexp.MustCompile(`^v[134]$`)
+	if err := tags.SetAlias(ctx, "v1", "v2"); err != (distribution.ErrTagImmutable{Tag: "v1", Digest: d2.Digest}) {
+		t.Fatalf("expected aliasing an immutable tag to fail, got %v", err)
+	}
+
+	// nor be created as one
+	if err := tags.SetAlias(ctx, "v4", "v2"); err != (distribution.ErrTagImmutable{Tag: "v4"}) {
+		t.Fatalf("expected creating an immutable alias to fail, got %v", err)
+	}
+
+	// an immutable alias made before is an existing tag
+	if err := tags.Tag(ctx, "v3", d2); err != (distribution.ErrTagImmutable{Tag: "v3", Digest: d1.Digest}) {
+		t.Fatalf("expected moving an immutable alias to fail, got %v", err)
+	}
+	if err := tags.Tag(ctx, "v3", d1); err != nil {
+		t.Fatalf("unexpected error tagging the manifest of an immutable alias: %v", err)
+	}
+}
@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// manifestTombstone records a manifest revision deleted while soft delete
+// is enabled, so that it can be restored.
+type manifestTombstone struct {
+	DeletedAt time.Time `json:"deletedat"`
+	Tags      []string  `json:"tags,omitempty"`
+}
+
+// tombstoneExpired reports whether the restore window of tombstone has
+// passed. Without a retention, which leaves the window unknown, tombstones
+// never expire.
+func (repo *repository) tombstoneExpired(tombstone manifestTombstone, now time.Time) bool {
+	if repo.softDeleteRetention <= 0 {
+		return false
+	}
+	return !tombstone.DeletedAt.Add(repo.softDeleteRetention).After(now)
+}
+
+// tombstone records that the manifest revision dgst is being deleted, along
+// with the tags currently referencing it.
+func (ms *manifestStore) tombstone(ctx context.Context, dgst digest.Digest) error {
+	tags, err := ms.repository.Tags(ctx).Lookup(ctx, distribution.Descriptor{Digest: dgst})
+	if err != nil {
+		return err
+	}
+
+	content, err := json.Marshal(manifestTombstone{
+		DeletedAt: time.Now().UTC(),
+		Tags:      tags,
+	})
+	if err != nil {
+		return err
+	}
+
+	tombstonePath, err := pathFor(manifestTombstonePathSpec{name: ms.repository.Named().Name(), revision: dgst})
+	if err != nil {
+		return err
+	}
+
+	return ms.repository.driver.PutContent(ctx, tombstonePath, content)
+}
+
+// Restore relinks a soft deleted manifest revision and the tags that
+// referenced it when it was deleted, unless they have since been reused,
+// returning the tags it relinked. It returns ErrManifestUnknownRevision if
+// the revision has no tombstone or its restore window has passed.
+func (ms *manifestStore) Restore(ctx context.Context, dgst digest.Digest) ([]string, error) {
+	if ms.repository.softDeleteRetention <= 0 {
+		return nil, distribution.ErrUnsupported
+	}
+
+	unknown := distribution.ErrManifestUnknownRevision{
+		Name:     ms.repository.Named().Name(),
+		Revision: dgst,
+	}
+
+	tombstonePath, err := pathFor(manifestTombstonePathSpec{name: ms.repository.Named().Name(), revision: dgst})
+	if err != nil {
+		return nil, err
+	}
+
+	tombstone, err := ms.repository.readTombstone(ctx, tombstonePath)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, unknown
+		}
+		return nil, err
+	}
+	if ms.repository.tombstoneExpired(tombstone, time.Now()) {
+		return nil, unknown
+	}
+
+	desc, err := ms.blobStore.blobStore.statter.Stat(ctx, dgst)
+	if err != nil {
+		if err == distribution.ErrBlobUnknown {
+			return nil, unknown
+		}
+		return nil, err
+	}
+
+	if err := ms.blobStore.linkBlob(ctx, desc); err != nil {
+		return nil, err
+	}
+
+	var restored []string
+	tags := ms.repository.Tags(ctx)
+	for _, tag := range tombstone.Tags {
+		_, err := tags.Get(ctx, tag)
+		if err == nil {
+			// the tag has been pushed again since
+			continue
+		}
+		if _, ok := err.(distribution.ErrTagUnknown); !ok {
+			return nil, err
+		}
+		if err := tags.Tag(ctx, tag, desc); err != nil {
+			return nil, err
+		}
+		restored = append(restored, tag)
+	}
+
+	if err := ms.repository.driver.Delete(ctx, tombstonePath); err != nil {
+		return nil, err
+	}
+	return restored, nil
+}
+
+// tombstones returns the tombstones of the manifests soft deleted from the
+// repository, by digest.
+func (repo *repository) tombstones(ctx context.Context) (map[digest.Digest]manifestTombstone, error) {
+	root, err := pathFor(manifestTombstonesPathSpec{name: repo.name.Name()})
+	if err != nil {
+		return nil, err
+	}
+
+	tombstones := make(map[digest.Digest]manifestTombstone)
+	err = repo.driver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+
+		dgst, err := digestFromPath(fileInfo.Path())
+		if err != nil {
+			return err
+		}
+
+		tombstone, err := repo.readTombstone(ctx, fileInfo.Path())
+		if err != nil {
+			return err
+		}
+		tombstones[dgst] = tombstone
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return tombstones, nil
+	}
+
+	return tombstones, err
+}
+
+func (repo *repository) readTombstone(ctx context.Context, tombstonePath string) (manifestTombstone, error) {
+	var tombstone manifestTombstone
+
+	content, err := repo.driver.GetContent(ctx, tombstonePath)
+	if err != nil {
+		return tombstone, err
+	}
+
+	err = json.Unmarshal(content, &tombstone)
+	return tombstone, err
+}
@@ -0,0 +1,202 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+)
+
+// softDelete deletes the manifest of im the way the manifest handler does,
+// removing its tags afterwards.
+func softDelete(t *testing.T, repository distribution.Repository, im image) {
+	ctx := context.Background()
+	if err := makeManifestService(t, repository).Delete(ctx, im.manifestDigest); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+	if err := repository.Tags(ctx).Untag(ctx, "latest"); err != nil {
+		t.Fatalf("unexpected error untagging manifest: %v", err)
+	}
+}
+
+func TestSoftDeleteRestore(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry := createRegistry(t, d, SoftDeleteRetention(time.Hour))
+	repo := makeRepository(t, registry, "softdelete")
+	im := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: im.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+
+	softDelete(t, repo, im)
+	manifestService := makeManifestService(t, repo)
+	if exists, err := manifestService.Exists(ctx, im.manifestDigest); err != nil || exists {
+		t.Fatalf("expected deleted manifest to be gone: %v, %v", exists, err)
+	}
+
+	// the content of a manifest within its restore window is kept
+	if err := MarkAndSweep(ctx, d, registry, GCOpts{}); err != nil {
+		t.Fatalf("failed to run garbage collection: %v", err)
+	}
+	blobs := allBlobs(t, registry)
+	for _, dgst := range append(getKeys(im.layers), im.manifestDigest) {
+		if _, ok := blobs[dgst]; !ok {
+			t.Fatalf("blob %v of tombstoned manifest was swept", dgst)
+		}
+	}
+
+	restored, err := manifestService.(*manifestStore).Restore(ctx, im.manifestDigest)
+	if err != nil {
+		t.Fatalf("unexpected error restoring manifest: %v", err)
+	}
+	if len(restored) != 1 || restored[0] != "latest" {
+		t.Fatalf("unexpected restored tags: %v", restored)
+	}
+	if _, err := manifestService.Get(ctx, im.manifestDigest); err != nil {
+		t.Fatalf("unexpected error getting restored manifest: %v", err)
+	}
+	if desc, err := repo.Tags(ctx).Get(ctx, "latest"); err != nil || desc.Digest != im.manifestDigest {
+		t.Fatalf("expected tag to be restored: %v, %v", desc, err)
+	}
+
+	// the tombstone is consumed by the restore
+	_, err = manifestService.(*manifestStore).Restore(ctx, im.manifestDigest)
+	if _, ok := err.(distribution.ErrManifestUnknownRevision); !ok {
+		t.Fatalf("expected ErrManifestUnknownRevision restoring twice, got %v", err)
+	}
+}
+
+func TestSoftDeleteRestoreKeepsRetaggedTags(t *testing.T) {
+	ctx := context.Background()
+
+	registry := createRegistry(t, inmemory.New(), SoftDeleteRetention(time.Hour))
+	repo := makeRepository(t, registry, "softdelete")
+	im := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: im.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+	softDelete(t, repo, im)
+
+	other := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: other.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+
+	restored, err := makeManifestService(t, repo).(*manifestStore).Restore(ctx, im.manifestDigest)
+	if err != nil {
+		t.Fatalf("unexpected error restoring manifest: %v", err)
+	}
+	if len(restored) != 0 {
+		t.Fatalf("unexpected restored tags: %v", restored)
+	}
+	if desc, err := repo.Tags(ctx).Get(ctx, "latest"); err != nil || desc.Digest != other.manifestDigest {
+		t.Fatalf("expected tag pushed since the delete to be kept: %v, %v", desc, err)
+	}
+}
+
+func TestSoftDeleteExpiredTombstonePurged(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry := createRegistry(t, d, SoftDeleteRetention(time.Nanosecond))
+	repo := makeRepository(t, registry, "softdelete")
+	im := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: im.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+	softDelete(t, repo, im)
+	time.Sleep(time.Millisecond)
+
+	_, err := makeManifestService(t, repo).(*manifestStore).Restore(ctx, im.manifestDigest)
+	if _, ok := err.(distribution.ErrManifestUnknownRevision); !ok {
+		t.Fatalf("expected ErrManifestUnknownRevision restoring an expired manifest, got %v", err)
+	}
+
+	// a dry run keeps the tombstone
+	if err := MarkAndSweep(ctx, d, registry, GCOpts{DryRun: true}); err != nil {
+		t.Fatalf("failed to run garbage collection: %v", err)
+	}
+	tombstonePath, err := pathFor(manifestTombstonePathSpec{name: "softdelete", revision: im.manifestDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Stat(ctx, tombstonePath); err != nil {
+		t.Fatalf("expected tombstone to survive a dry run: %v", err)
+	}
+
+	if err := MarkAndSweep(ctx, d, registry, GCOpts{}); err != nil {
+		t.Fatalf("failed to run garbage collection: %v", err)
+	}
+	if _, err := d.Stat(ctx, tombstonePath); err == nil {
+		t.Fatalf("expected expired tombstone to be purged")
+	} else if _, ok := err.(driver.PathNotFoundError); !ok {
+		t.Fatalf("unexpected error statting tombstone: %v", err)
+	}
+	blobs := allBlobs(t, registry)
+	for _, dgst := range append(getKeys(im.layers), im.manifestDigest) {
+		if _, ok := blobs[dgst]; ok {
+			t.Fatalf("blob %v of expired manifest was kept", dgst)
+		}
+	}
+}
+
+func TestSoftDeleteTombstonesKeptWithoutRetention(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry := createRegistry(t, d, SoftDeleteRetention(time.Nanosecond))
+	repo := makeRepository(t, registry, "softdelete")
+	im := uploadRandomSchema2Image(t, repo)
+	if err := repo.Tags(ctx).Tag(ctx, "latest", distribution.Descriptor{Digest: im.manifestDigest}); err != nil {
+		t.Fatalf("unexpected error tagging manifest: %v", err)
+	}
+	softDelete(t, repo, im)
+	time.Sleep(time.Millisecond)
+
+	// garbage collection run without the retention can't tell whether the
+	// restore window has passed
+	if err := MarkAndSweep(ctx, d, createRegistry(t, d), GCOpts{}); err != nil {
+		t.Fatalf("failed to run garbage collection: %v", err)
+	}
+	tombstonePath, err := pathFor(manifestTombstonePathSpec{name: "softdelete", revision: im.manifestDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.Stat(ctx, tombstonePath); err != nil {
+		t.Fatalf("expected tombstone to be kept without a retention: %v", err)
+	}
+	blobs := allBlobs(t, registry)
+	for _, dgst := range append(getKeys(im.layers), im.manifestDigest) {
+		if _, ok := blobs[dgst]; !ok {
+			t.Fatalf("blob %v of tombstoned manifest was swept", dgst)
+		}
+	}
+}
+
+func TestDeleteWithoutSoftDeleteLeavesNoTombstone(t *testing.T) {
+	ctx := context.Background()
+	d := inmemory.New()
+
+	registry := createRegistry(t, d)
+	repo := makeRepository(t, registry, "harddelete")
+	im := uploadRandomSchema2Image(t, repo)
+	if err := makeManifestService(t, repo).Delete(ctx, im.manifestDigest); err != nil {
+		t.Fatalf("unexpected error deleting manifest: %v", err)
+	}
+
+	tombstones, err := repo.(*repository).tombstones(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error listing tombstones: %v", err)
+	}
+	if len(tombstones) != 0 {
+		t.Fatalf("unexpected tombstones: %v", tombstones)
+	}
+	if _, err := makeManifestService(t, repo).(*manifestStore).Restore(ctx, im.manifestDigest); err != distribution.ErrUnsupported {
+		t.Fatalf("expected ErrUnsupported restoring without soft delete, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"sync"
+	"time"
+)
+
+// uploadSessionTimeout is the time after which an upload session that has
+// not been resumed no longer counts against the limit of its repository.
+const uploadSessionTimeout = 15 * time.Minute
+
+// uploadLimiter bounds the number of upload sessions in progress in each
+// repository. A session holds its slot until it is committed, cancelled or
+// left idle for the timeout.
+type uploadLimiter struct {
+	limit   int
+	timeout time.Duration
+
+	mu sync.Mutex
+	// sessions holds the last activity of the upload sessions in progress,
+	// by repository name and upload id.
+	sessions map[string]map[string]time.Time
+}
+
+func newUploadLimiter(limit int, timeout time.Duration) *uploadLimiter {
+	return &uploadLimiter{
+		limit:    limit,
+		timeout:  timeout,
+		sessions: make(map[string]map[string]time.Time),
+	}
+}
+
+// acquire starts counting the upload session id against the limit of the
+// repository name. It returns false if the repository has no slot left.
+func (l *uploadLimiter) acquire(name, id string, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sessions := l.sessions[name]
+	for sessionID, lastActive := range sessions {
+		if now.Sub(lastActive) >= l.timeout {
+			delete(sessions, sessionID)
+		}
+	}
+	if len(sessions) >= l.limit {
+		return false
+	}
+
+	if sessions == nil {
+		sessions = make(map[string]time.Time)
+		l.sessions[name] = sessions
+	}
+	sessions[id] = now
+	return true
+}
+
+// touch records activity on the upload session id. A session which timed out
+// is counted again, as its client is still using it.
+func (l *uploadLimiter) touch(name, id string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sessions := l.sessions[name]
+	if sessions == nil {
+		sessions = make(map[string]time.Time)
+		l.sessions[name] = sessions
+	}
+	sessions[id] = now
+}
+
+// release stops counting the upload session id.
+func (l *uploadLimiter) release(name, id string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	sessions := l.sessions[name]
+	delete(sessions, id)
+	if len(sessions) == 0 {
+		delete(l.sessions, name)
+	}
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestMaxConcurrentUploadsPerRepo(t *testing.T) {
+	ctx := context.Background()
+	registry, err := NewRegistry(ctx, inmemory.New(), MaxConcurrentUploadsPerRepo(2))
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+
+	blobs := func(name string) distribution.BlobStore {
+		named, _ := reference.WithName(name)
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			t.Fatalf("unexpected error getting repo: %v", err)
+		}
+		return repository.Blobs(ctx)
+	}
+	bs := blobs("foo/bar")
+
+	first, err := bs.Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+	second, err := bs.Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error starting upload: %v", err)
+	}
+	if _, err := bs.Create(ctx); err != distribution.ErrBlobUploadLimit {
+		t.Fatalf("expected ErrBlobUploadLimit, got %v", err)
+	}
+
+	if _, err := blobs("foo/other").Create(ctx); err != nil {
+		t.Fatalf("unexpected error starting upload in another repository: %v", err)
+	}
+
+	if err := first.Cancel(ctx); err != nil {
+		t.Fatalf("unexpected error cancelling upload: %v", err)
+	}
+	third, err := bs.Create(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error starting upload after cancel: %v", err)
+	}
+
+	content := []byte("upload limit")
+	if _, err := second.Write(content); err != nil {
+		t.Fatalf("unexpected error writing upload: %v", err)
+	}
+	if _, err := second.Commit(ctx, distribution.Descriptor{Digest: digest.FromBytes(content)}); err != nil {
+		t.Fatalf("unexpected error committing upload: %v", err)
+	}
+	if _, err := bs.Create(ctx); err != nil {
+		t.Fatalf("unexpected error starting upload after commit: %v", err)
+	}
+
+	if _, err := bs.Create(ctx); err != distribution.ErrBlobUploadLimit {
+		t.Fatalf("expected ErrBlobUploadLimit, got %v", err)
+	}
+
+	// resuming an upload keeps it counted
+	resumed, err := bs.Resume(ctx, third.ID())
+	if err != nil {
+		t.Fatalf("unexpected error resuming upload: %v", err)
+	}
+	if _, err := resumed.ReadFrom(bytes.NewReader(content)); err != nil {
+		t.Fatalf("unexpected error writing upload: %v", err)
+	}
+	if err := resumed.Close(); err != nil {
+		t.Fatalf("unexpected error closing upload: %v", err)
+	}
+	if _, err := bs.Create(ctx); err != distribution.ErrBlobUploadLimit {
+		t.Fatalf("expected ErrBlobUploadLimit, got %v", err)
+	}
+}
+
+func TestUploadLimiterTimeout(t *testing.T) {
+	limiter := newUploadLimiter(1, time.Minute)
+	now := time.Now()
+
+	if !limiter.acquire("foo/bar", "a", now) {
+		t.Fatalf("expected first upload to be admitted")
+	}
+	if limiter.acquire("foo/bar", "b", now.Add(30*time.Second)) {
+		t.Fatalf("expected upload over the limit to be refused")
+	}
+
+	limiter.touch("foo/bar", "a", now.Add(45*time.Second))
+	if limiter.acquire("foo/bar", "b", now.Add(90*time.Second)) {
+		t.Fatalf("expected upload to be refused while the active upload has not timed out")
+	}
+	if !limiter.acquire("foo/bar", "b", now.Add(105*time.Second)) {
+		t.Fatalf("expected upload to be admitted once the idle upload timed out")
+	}
+
+	limiter.release("foo/bar", "b")
+	if !limiter.acquire("foo/bar", "c", now.Add(106*time.Second)) {
+		t.Fatalf("expected upload to be admitted after release")
+	}
+}
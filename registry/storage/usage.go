@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// Usage describes the storage consumed by the content linked into a
+// repository. Blobs shared with other repositories are counted in full.
+type Usage struct {
+	BlobBytes     int64 `json:"blob_bytes"`
+	ManifestBytes int64 `json:"manifest_bytes"`
+	BlobCount     int   `json:"blob_count"`
+	ManifestCount int   `json:"manifest_count"`
+}
+
+// RepositoryUsage sums the sizes of the blobs and manifests linked into
+// repository. Each digest is counted once, however many times it is
+// referenced. The repository must come from a storage registry, as its
+// services have to be enumerable.
+func RepositoryUsage(ctx context.Context, repository distribution.Repository) (Usage, error) {
+	var usage Usage
+
+	blobService := repository.Blobs(ctx)
+	blobEnumerator, ok := blobService.(distribution.BlobEnumerator)
+	if !ok {
+		return usage, fmt.Errorf("unable to convert BlobStore into BlobEnumerator")
+	}
+
+	err := blobEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+		desc, err := blobService.Stat(ctx, dgst)
+		if err != nil {
+			if err == distribution.ErrBlobUnknown {
+				return nil
+			}
+			return err
+		}
+		usage.BlobBytes += desc.Size
+		usage.BlobCount++
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+		return usage, err
+	}
+
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return usage, err
+	}
+	manifestEnumerator, ok := manifestService.(distribution.ManifestEnumerator)
+	if !ok {
+		return usage, fmt.Errorf("unable to convert ManifestService into ManifestEnumerator")
+	}
+
+	err = manifestEnumerator.Enumerate(ctx, func(dgst digest.Digest) error {
+		manifest, err := manifestService.Get(ctx, dgst)
+		if err != nil {
+			if _, ok := err.(distribution.ErrManifestUnknownRevision); ok {
+				return nil
+			}
+			return err
+		}
+		_, payload, err := manifest.Payload()
+		if err != nil {
+			return err
+		}
+		usage.ManifestBytes += int64(len(payload))
+		usage.ManifestCount++
+		return nil
+	})
+	if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+		return usage, err
+	}
+
+	return usage, nil
+}
@@ -2,8 +2,12 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"path"
+	"strings"
+	"time"
 
+	"github.com/docker/distribution"
 	dcontext "github.com/docker/distribution/context"
 	"github.com/docker/distribution/registry/storage/driver"
 	"github.com/opencontainers/go-digest"
@@ -22,10 +26,22 @@ func NewVacuum(ctx context.Context, driver driver.StorageDriver) Vacuum {
 	}
 }
 
+// NewRegistryVacuum creates a new Vacuum removing blobs at the paths the
+// blobs of namespace are laid out with, which needs to be a registry
+// created by NewRegistry for the BlobPathSharding option to apply.
+func NewRegistryVacuum(ctx context.Context, driver driver.StorageDriver, namespace distribution.Namespace) Vacuum {
+	v := NewVacuum(ctx, driver)
+	if reg, ok := namespace.(*registry); ok {
+		v.layout = reg.blobStore.layout
+	}
+	return v
+}
+
 // Vacuum removes content from the filesystem
 type Vacuum struct {
 	driver driver.StorageDriver
 	ctx    context.Context
+	layout blobPathLayout
 }
 
 // RemoveBlob removes a blob from the filesystem
@@ -35,7 +51,7 @@ func (v Vacuum) RemoveBlob(dgst string) error {
 		return err
 	}
 
-	blobPath, err := pathFor(blobPathSpec{digest: d})
+	blobPath, err := pathFor(blobPathSpec{digest: d, layout: v.layout})
 	if err != nil {
 		return err
 	}
@@ -43,11 +59,23 @@ func (v Vacuum) RemoveBlob(dgst string) error {
 	dcontext.GetLogger(v.ctx).Infof("Deleting blob: %s", blobPath)
 
 	err = v.driver.Delete(v.ctx, blobPath)
-	if err != nil {
+	if v.layout.legacy() {
 		return err
 	}
 
-	return nil
+	// the blob may have been written before the layout was configured
+	legacyPath, pathErr := pathFor(blobPathSpec{digest: d})
+	if pathErr != nil {
+		return pathErr
+	}
+	if legacyErr := v.driver.Delete(v.ctx, legacyPath); legacyErr == nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil
+		}
+	} else if _, ok := legacyErr.(driver.PathNotFoundError); !ok {
+		return legacyErr
+	}
+	return err
 }
 
 // RemoveManifest removes a manifest from the filesystem
@@ -76,6 +104,13 @@ func (v Vacuum) RemoveManifest(name string, dgst digest.Digest, tags []string) e
 		}
 	}
 
+	return v.RemoveManifestRevision(name, dgst)
+}
+
+// RemoveManifestRevision removes a manifest revision, including its
+// signatures, without touching the tag index. Use it for manifests known to
+// have no tags.
+func (v Vacuum) RemoveManifestRevision(name string, dgst digest.Digest) error {
 	manifestPath, err := pathFor(manifestRevisionPathSpec{name: name, revision: dgst})
 	if err != nil {
 		return err
@@ -84,6 +119,47 @@ func (v Vacuum) RemoveManifest(name string, dgst digest.Digest, tags []string) e
 	return v.driver.Delete(v.ctx, manifestPath)
 }
 
+// RemoveManifestTombstone removes the tombstone of a soft deleted manifest
+// revision, after which its content is no longer kept for a restore.
+func (v Vacuum) RemoveManifestTombstone(name string, dgst digest.Digest) error {
+	tombstonePath, err := pathFor(manifestTombstonePathSpec{name: name, revision: dgst})
+	if err != nil {
+		return err
+	}
+	dcontext.GetLogger(v.ctx).Infof("deleting manifest tombstone: %s", tombstonePath)
+	return v.driver.Delete(v.ctx, tombstonePath)
+}
+
+// RemoveTag removes a tag, along with its history, from the named
+// repository.
+func (v Vacuum) RemoveTag(name, tag string) error {
+	tagPath, err := pathFor(manifestTagPathSpec{name: name, tag: tag})
+	if err != nil {
+		return err
+	}
+	dcontext.GetLogger(v.ctx).Infof("deleting tag: %s", tagPath)
+	err = v.driver.Delete(v.ctx, tagPath)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
+// RemoveReferrers removes the links to the referrers of subject from the
+// named repository.
+func (v Vacuum) RemoveReferrers(name string, subject digest.Digest) error {
+	referrersPath, err := pathFor(manifestReferrersPathSpec{name: name, subject: subject})
+	if err != nil {
+		return err
+	}
+	dcontext.GetLogger(v.ctx).Infof("deleting referrers: %s", referrersPath)
+	err = v.driver.Delete(v.ctx, referrersPath)
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return nil
+	}
+	return err
+}
+
 // RemoveRepository removes a repository directory from the
 // filesystem
 func (v Vacuum) RemoveRepository(repoName string) error {
@@ -100,3 +176,142 @@ func (v Vacuum) RemoveRepository(repoName string) error {
 
 	return nil
 }
+
+// RemoveEmptyRepository removes the directory of a repository left without
+// manifest revisions, tags, soft deleted manifests or uploads in progress,
+// reporting whether it was removed. The directories of repositories nested
+// under it are kept.
+func (v Vacuum) RemoveEmptyRepository(repoName string) (bool, error) {
+	for _, spec := range []pathSpec{
+		manifestRevisionsPathSpec{name: repoName},
+		manifestTagsPathSpec{name: repoName},
+		manifestTombstonesPathSpec{name: repoName},
+	} {
+		root, err := pathFor(spec)
+		if err != nil {
+			return false, err
+		}
+		found, err := containsFile(v.ctx, v.driver, root)
+		if err != nil || found {
+			return false, err
+		}
+	}
+
+	rootForRepository, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return false, err
+	}
+	repoDir := path.Join(rootForRepository, repoName)
+
+	// any upload, however old, may still be committed
+	uploads, err := v.driver.List(v.ctx, path.Join(repoDir, "_uploads"))
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); !ok {
+			return false, err
+		}
+	}
+	if len(uploads) > 0 {
+		return false, nil
+	}
+
+	children, err := v.driver.List(v.ctx, repoDir)
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return false, nil
+		}
+		return false, err
+	}
+	nested := false
+	for _, child := range children {
+		if !strings.HasPrefix(path.Base(child), "_") {
+			nested = true
+		}
+	}
+
+	if !nested {
+		dcontext.GetLogger(v.ctx).Infof("deleting empty repo: %s", repoDir)
+		return true, v.driver.Delete(v.ctx, repoDir)
+	}
+
+	for _, child := range children {
+		if strings.HasPrefix(path.Base(child), "_") {
+			dcontext.GetLogger(v.ctx).Infof("deleting empty repo directory: %s", child)
+			if err := v.driver.Delete(v.ctx, child); err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+// containsFile reports whether there is a file anywhere under root.
+func containsFile(ctx context.Context, storageDriver driver.StorageDriver, root string) (bool, error) {
+	found := false
+	err := storageDriver.Walk(ctx, root, func(fileInfo driver.FileInfo) error {
+		if fileInfo.IsDir() {
+			return nil
+		}
+		// stop walking, the error is dropped below
+		found = true
+		return errors.New("found file")
+	})
+	if found {
+		return true, nil
+	}
+	if _, ok := err.(driver.PathNotFoundError); ok {
+		return false, nil
+	}
+	return false, err
+}
+
+// RemoveStaleUploads removes the upload sessions of a repository started
+// more than olderThan ago, returning how many were removed. Sessions whose
+// start time can't be read are left alone.
+func (v Vacuum) RemoveStaleUploads(repoName string, olderThan time.Duration) (int, error) {
+	uploads, err := staleUploads(v.ctx, v.driver, repoName, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, uploadDir := range uploads {
+		dcontext.GetLogger(v.ctx).Infof("deleting stale upload: %s", uploadDir)
+		if err := v.driver.Delete(v.ctx, uploadDir); err != nil {
+			if _, ok := err.(driver.PathNotFoundError); ok {
+				// committed or cancelled since it was listed
+				continue
+			}
+			return removed, err
+		}
+		removed++
+	}
+
+	return removed, nil
+}
+
+// staleUploads returns the directories of the upload sessions of the named
+// repository which were started before the given time.
+func staleUploads(ctx context.Context, storageDriver driver.StorageDriver, name string, before time.Time) ([]string, error) {
+	root, err := pathFor(repositoriesRootPathSpec{})
+	if err != nil {
+		return nil, err
+	}
+
+	uploads, err := storageDriver.List(ctx, path.Join(root, name, "_uploads"))
+	if err != nil {
+		if _, ok := err.(driver.PathNotFoundError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var stale []string
+	for _, upload := range uploads {
+		startedAt, err := readStartedAtFile(storageDriver, path.Join(upload, "startedat"))
+		if err == nil && startedAt.Before(before) {
+			stale = append(stale, upload)
+		}
+	}
+
+	return stale, nil
+}
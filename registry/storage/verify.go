@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver"
+	"github.com/opencontainers/go-digest"
+)
+
+// BlobMismatch describes a blob linked into a repository whose stored
+// content does not hash to its digest.
+type BlobMismatch struct {
+	Digest digest.Digest `json:"digest"`
+	Actual digest.Digest `json:"actual,omitempty"`
+	Size   int64         `json:"size"`
+	Error  string        `json:"error,omitempty"`
+}
+
+// VerifyRepositoryBlobs reads back the content of the blobs linked into
+// repository through the storage driver and calls fn for each one that no
+// longer matches its digest. A sample below one verifies that fraction of the
+// blobs, chosen at random. The number of blobs verified is returned. The
+// repository must come from a storage registry.
+func VerifyRepositoryBlobs(ctx context.Context, repository distribution.Repository, sample float64, fn func(BlobMismatch) error) (int, error) {
+	lbs, ok := repository.Blobs(ctx).(*linkedBlobStore)
+	if !ok {
+		return 0, fmt.Errorf("unable to convert BlobStore into linkedBlobStore")
+	}
+
+	var verified int
+	err := lbs.Enumerate(ctx, func(dgst digest.Digest) error {
+		if sample < 1 && rand.Float64() >= sample {
+			return nil
+		}
+
+		desc, err := lbs.blobStore.statter.Stat(ctx, dgst)
+		if err != nil {
+			if err == distribution.ErrBlobUnknown {
+				return nil
+			}
+			return err
+		}
+
+		verified++
+		mismatch, err := verifyBlob(ctx, lbs.blobStore, desc)
+		if err != nil || mismatch == nil {
+			return err
+		}
+		return fn(*mismatch)
+	})
+	if _, ok := err.(driver.PathNotFoundError); err != nil && !ok {
+		return verified, err
+	}
+
+	return verified, nil
+}
+
+// verifyBlob hashes the stored content of the blob described by desc,
+// returning a mismatch if it differs from the digest or cannot be read.
+func verifyBlob(ctx context.Context, bs *blobStore, desc distribution.Descriptor) (*BlobMismatch, error) {
+	if !desc.Digest.Algorithm().Available() {
+		return nil, nil
+	}
+
+	blobPath, err := bs.readPath(ctx, desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+
+	rc, err := bs.driver.Reader(ctx, blobPath, 0)
+	if err != nil {
+		switch err.(type) {
+		case driver.PathNotFoundError:
+			return &BlobMismatch{Digest: desc.Digest, Error: err.Error()}, nil
+		default:
+			return nil, err
+		}
+	}
+	defer rc.Close()
+
+	digester := desc.Digest.Algorithm().Digester()
+	size, err := io.Copy(digester.Hash(), rc)
+	if err != nil {
+		return nil, err
+	}
+
+	if actual := digester.Digest(); actual != desc.Digest {
+		return &BlobMismatch{Digest: desc.Digest, Actual: actual, Size: size}, nil
+	}
+	return nil, nil
+}
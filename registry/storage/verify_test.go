@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestVerifyRepositoryBlobs(t *testing.T) {
+	ctx := context.Background()
+	imageName, _ := reference.WithName("foo/verify")
+	driver := inmemory.New()
+	reg, err := NewRegistry(ctx, driver)
+	if err != nil {
+		t.Fatalf("error creating registry: %v", err)
+	}
+	repository, err := reg.Repository(ctx, imageName)
+	if err != nil {
+		t.Fatalf("unexpected error getting repo: %v", err)
+	}
+	bs := repository.Blobs(ctx)
+
+	var descs []distribution.Descriptor
+	for _, content := range [][]byte{[]byte("intact"), []byte("corrupted")} {
+		desc, err := addBlob(ctx, bs, distribution.Descriptor{Digest: digest.FromBytes(content), Size: int64(len(content))}, bytes.NewReader(content))
+		if err != nil {
+			t.Fatalf("unexpected error uploading blob: %v", err)
+		}
+		descs = append(descs, desc)
+	}
+
+	collect := func(sample float64) (int, []BlobMismatch) {
+		var mismatches []BlobMismatch
+		verified, err := VerifyRepositoryBlobs(ctx, repository, sample, func(mismatch BlobMismatch) error {
+			mismatches = append(mismatches, mismatch)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error verifying blobs: %v", err)
+		}
+		return verified, mismatches
+	}
+
+	if verified, mismatches := collect(1); verified != 2 || len(mismatches) != 0 {
+		t.Fatalf("unexpected verification of intact blobs: %d verified, %+v", verified, mismatches)
+	}
+
+	// rewrite the content behind the registry's back, keeping the size
+	corrupted := descs[1]
+	blobPath, err := pathFor(blobDataPathSpec{digest: corrupted.Digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := driver.PutContent(ctx, blobPath, []byte("CORRUPTED")); err != nil {
+		t.Fatal(err)
+	}
+
+	verified, mismatches := collect(1)
+	if verified != 2 || len(mismatches) != 1 {
+		t.Fatalf("expected one mismatch out of two blobs: %d verified, %+v", verified, mismatches)
+	}
+	if mismatches[0].Digest != corrupted.Digest || mismatches[0].Actual != digest.FromString("CORRUPTED") {
+		t.Fatalf("unexpected mismatch: %+v", mismatches[0])
+	}
+
+	if verified, _ := collect(0); verified != 0 {
+		t.Fatalf("expected a zero sample to verify nothing, verified %d", verified)
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/reference"
+	"github.com/opencontainers/go-digest"
+)
+
+// TagsReferencing walks the tags of every repository in registry and
+// returns, by repository name, the sorted tags referencing dgst. A tag
+// references dgst if it points at it, or if its manifest, or a manifest of
+// its index, references it. Repositories without such tags are left out.
+func TagsReferencing(ctx context.Context, registry distribution.Namespace, dgst digest.Digest) (map[string][]string, error) {
+	repositoryEnumerator, ok := registry.(distribution.RepositoryEnumerator)
+	if !ok {
+		return nil, fmt.Errorf("unable to convert Namespace to RepositoryEnumerator")
+	}
+
+	referencing := make(map[string][]string)
+	err := repositoryEnumerator.Enumerate(ctx, func(repoName string) error {
+		named, err := reference.WithName(repoName)
+		if err != nil {
+			return fmt.Errorf("failed to parse repo name %s: %v", repoName, err)
+		}
+		repository, err := registry.Repository(ctx, named)
+		if err != nil {
+			return fmt.Errorf("failed to construct repository: %v", err)
+		}
+
+		tags, err := repositoryTagsReferencing(ctx, repository, dgst)
+		if err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			referencing[repoName] = tags
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return referencing, nil
+}
+
+// repositoryTagsReferencing returns the sorted tags of repository
+// referencing dgst.
+func repositoryTagsReferencing(ctx context.Context, repository distribution.Repository, dgst digest.Digest) ([]string, error) {
+	tagService := repository.Tags(ctx)
+	tags, err := tagService.All(ctx)
+	switch err.(type) {
+	case distribution.ErrRepositoryUnknown:
+		// a repository without tags references nothing
+		return nil, nil
+	case nil:
+	default:
+		return nil, err
+	}
+	sort.Strings(tags)
+
+	manifestService, err := repository.Manifests(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// tags commonly share manifests, which are only read once
+	matches := make(map[digest.Digest]bool)
+	var referencing []string
+	for _, tag := range tags {
+		desc, err := tagService.Get(ctx, tag)
+		if err != nil {
+			if _, ok := err.(distribution.ErrTagUnknown); ok {
+				continue
+			}
+			return nil, err
+		}
+
+		match, ok := matches[desc.Digest]
+		if !ok {
+			references := map[digest.Digest]struct{}{desc.Digest: {}}
+			if desc.Digest != dgst {
+				if err := summarizeReferences(ctx, manifestService, desc.Digest, references); err != nil {
+					return nil, err
+				}
+			}
+			_, match = references[dgst]
+			matches[desc.Digest] = match
+		}
+		if match {
+			referencing = append(referencing, tag)
+		}
+	}
+	return referencing, nil
+}
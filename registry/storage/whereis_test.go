@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/docker/distribution"
+	"github.com/docker/distribution/registry/storage/driver/inmemory"
+	"github.com/docker/distribution/testutil"
+	"github.com/opencontainers/go-digest"
+)
+
+func TestTagsReferencing(t *testing.T) {
+	ctx := context.Background()
+	reg := createRegistry(t, inmemory.New())
+
+	tag := func(repo distribution.Repository, tag string, dgst digest.Digest) {
+		if err := repo.Tags(ctx).Tag(ctx, tag, distribution.Descriptor{Digest: dgst}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	base := makeRepository(t, reg, "library/base")
+	baseImage := uploadRandomSchema2Image(t, base)
+	tag(base, "latest", baseImage.manifestDigest)
+	tag(base, "1.0", baseImage.manifestDigest)
+
+	// the application shares the layers of the base image, through an index
+	app := makeRepository(t, reg, "team/app")
+	for _, rs := range baseImage.layers {
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+	}
+	appManifest, err := testutil.MakeSchema2Manifest(app, getKeys(baseImage.layers))
+	if err != nil {
+		t.Fatal(err)
+	}
+	appDigest := uploadImage(t, app, image{manifest: appManifest, layers: baseImage.layers})
+	index, err := testutil.MakeManifestList(reg.BlobStatter(), []digest.Digest{appDigest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	indexDigest, err := makeManifestService(t, app).Put(ctx, index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tag(app, "multi", indexDigest)
+
+	other := makeRepository(t, reg, "team/other")
+	tag(other, "v1", uploadRandomSchema2Image(t, other).manifestDigest)
+
+	for _, tc := range []struct {
+		description string
+		dgst        digest.Digest
+		expected    map[string][]string
+	}{
+		{
+			description: "shared layer",
+			dgst:        getAnyKey(baseImage.layers),
+			expected: map[string][]string{
+				"library/base": {"1.0", "latest"},
+				"team/app":     {"multi"},
+			},
+		},
+		{
+			description: "index",
+			dgst:        indexDigest,
+			expected:    map[string][]string{"team/app": {"multi"}},
+		},
+		{
+			description: "unknown digest",
+			dgst:        digest.FromString("unknown"),
+			expected:    map[string][]string{},
+		},
+	} {
+		referencing, err := TagsReferencing(ctx, reg, tc.dgst)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.description, err)
+		}
+		if !reflect.DeepEqual(referencing, tc.expected) {
+			t.Errorf("%s: expected %v, got %v", tc.description, tc.expected, referencing)
+		}
+	}
+}